@@ -0,0 +1,349 @@
+// Command faketelegram is a stand-in for the Telegram Bot API, for trying the
+// academy's bot locally without a real bot or a public URL.
+//
+// Start it, then run the academy with TELEGRAM_BOT_TOKEN set to anything and
+// TELEGRAM_API_URL pointing at it. Without TELEGRAM_WEBHOOK_URL the bot
+// long-polls the fake server; with it (e.g. http://localhost:8080), the fake
+// server posts updates to the webhook the bot registers, with its secret token.
+//
+// Act as a Telegram user with:
+//
+//	curl -X POST 'localhost:8090/send?user=42&text=/login'
+//	curl -X POST 'localhost:8090/contact?user=42&phone=%2B998901234567'
+//	curl localhost:8090/messages
+//
+// Press an inline button by passing its callback_data from /messages:
+//
+//	curl -X POST 'localhost:8090/press?user=42&data=%0Cannounce_send|<id>'
+//
+// Log in with the Telegram Login Widget by opening
+// http://localhost:8090/widget?user=42 in the browser. It redirects to the
+// academy's widget callback with login data signed by the bot's token, which
+// the fake server learns from the bot's first call.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/globallstudent/academy/internal/auth"
+)
+
+// server is the fake Bot API's state
+type server struct {
+	mu       sync.Mutex
+	token    string // The bot's token, from the last Bot API call
+	academy  string // Base URL of the academy, for widget logins
+	nextID   int
+	updates  []map[string]interface{} // Queued for getUpdates
+	notify   chan struct{}            // Closed and replaced when an update is queued
+	webhook  string
+	secret   string
+	messages []map[string]interface{} // Everything the bot sent
+}
+
+func main() {
+	addr := flag.String("addr", "localhost:8090", "address to listen on")
+	academy := flag.String("academy", "http://localhost:8080", "academy base URL, for widget logins")
+	flag.Parse()
+
+	s := &server{nextID: 1, notify: make(chan struct{}), academy: strings.TrimRight(*academy, "/")}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/send", s.handleSend)
+	mux.HandleFunc("/contact", s.handleContact)
+	mux.HandleFunc("/press", s.handlePress)
+	mux.HandleFunc("/messages", s.handleMessages)
+	mux.HandleFunc("/widget", s.handleWidget)
+	mux.HandleFunc("/", s.handleBotAPI)
+
+	log.Printf("Fake Telegram Bot API listening on http://%s", *addr)
+	log.Fatal(http.ListenAndServe(*addr, mux))
+}
+
+// handleBotAPI answers the bot's calls to /bot<token>/<method>
+func (s *server) handleBotAPI(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if len(parts) != 2 || !strings.HasPrefix(parts[0], "bot") {
+		http.NotFound(w, r)
+		return
+	}
+	method := parts[1]
+
+	s.mu.Lock()
+	s.token = strings.TrimPrefix(parts[0], "bot")
+	s.mu.Unlock()
+
+	params := make(map[string]interface{})
+	if r.Body != nil {
+		json.NewDecoder(r.Body).Decode(&params)
+	}
+	param := func(name string) string {
+		if v, ok := params[name]; ok && v != nil {
+			return fmt.Sprint(v)
+		}
+		return ""
+	}
+
+	switch method {
+	case "getMe":
+		reply(w, map[string]interface{}{"id": 1, "is_bot": true, "first_name": "Academy", "username": "academy_bot"})
+
+	case "setWebhook":
+		s.mu.Lock()
+		s.webhook, s.secret = param("url"), param("secret_token")
+		s.mu.Unlock()
+		log.Printf("Webhook set to %s", param("url"))
+		reply(w, true)
+
+	case "deleteWebhook":
+		s.mu.Lock()
+		s.webhook, s.secret = "", ""
+		s.mu.Unlock()
+		reply(w, true)
+
+	case "getWebhookInfo":
+		s.mu.Lock()
+		info := map[string]interface{}{"url": s.webhook, "pending_update_count": len(s.updates)}
+		s.mu.Unlock()
+		reply(w, info)
+
+	case "getUpdates":
+		offset, _ := strconv.Atoi(param("offset"))
+		timeout, _ := strconv.Atoi(param("timeout"))
+		updates, ok := s.poll(offset, time.Duration(timeout)*time.Second, r)
+		if !ok {
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"ok": false, "error_code": 409,
+				"description": "Conflict: can't use getUpdates method while webhook is active",
+			})
+			return
+		}
+		reply(w, updates)
+
+	case "sendMessage", "editMessageText":
+		chatID, _ := strconv.ParseInt(param("chat_id"), 10, 64)
+		message := map[string]interface{}{
+			"message_id": s.id(),
+			"date":       time.Now().Unix(),
+			"chat":       map[string]interface{}{"id": chatID, "type": "private"},
+			"text":       param("text"),
+		}
+		if markup := param("reply_markup"); markup != "" {
+			var parsed interface{}
+			if json.Unmarshal([]byte(markup), &parsed) == nil {
+				message["reply_markup"] = parsed
+			}
+		}
+		s.mu.Lock()
+		s.messages = append(s.messages, message)
+		s.mu.Unlock()
+		log.Printf("Bot -> %d: %s", chatID, param("text"))
+		reply(w, message)
+
+	default:
+		log.Printf("Bot called %s, answering ok", method)
+		reply(w, true)
+	}
+}
+
+// handleSend delivers a text message from a user to the bot
+func (s *server) handleSend(w http.ResponseWriter, r *http.Request) {
+	user, ok := userParam(w, r)
+	if !ok {
+		return
+	}
+	message := s.message(user)
+	message["text"] = r.FormValue("text")
+	if strings.HasPrefix(r.FormValue("text"), "/") {
+		command := strings.Fields(r.FormValue("text"))[0]
+		message["entities"] = []map[string]interface{}{{"type": "bot_command", "offset": 0, "length": len(command)}}
+	}
+	s.deliver(w, map[string]interface{}{"update_id": s.id(), "message": message})
+}
+
+// handleContact delivers a shared contact from a user to the bot
+func (s *server) handleContact(w http.ResponseWriter, r *http.Request) {
+	user, ok := userParam(w, r)
+	if !ok {
+		return
+	}
+	message := s.message(user)
+	message["contact"] = map[string]interface{}{
+		"phone_number": r.FormValue("phone"),
+		"first_name":   "Student",
+		"user_id":      user,
+	}
+	s.deliver(w, map[string]interface{}{"update_id": s.id(), "message": message})
+}
+
+// handlePress delivers a press of an inline button, given by its
+// callback_data as listed by /messages
+func (s *server) handlePress(w http.ResponseWriter, r *http.Request) {
+	user, ok := userParam(w, r)
+	if !ok {
+		return
+	}
+	message := s.message(user)
+	message["text"] = "(message with the button)"
+	callback := map[string]interface{}{
+		"id":            strconv.Itoa(s.id()),
+		"from":          message["from"],
+		"message":       message,
+		"chat_instance": strconv.FormatInt(user, 10),
+		"data":          r.FormValue("data"),
+	}
+	s.deliver(w, map[string]interface{}{"update_id": s.id(), "callback_query": callback})
+}
+
+// handleMessages lists what the bot has sent
+func (s *server) handleMessages(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.messages)
+}
+
+// handleWidget logs a user in through the academy's login widget callback,
+// signing the login data like Telegram does
+func (s *server) handleWidget(w http.ResponseWriter, r *http.Request) {
+	user, ok := userParam(w, r)
+	if !ok {
+		return
+	}
+	s.mu.Lock()
+	token := s.token
+	s.mu.Unlock()
+	if token == "" {
+		http.Error(w, "the bot hasn't called the fake server yet, so its token is unknown", http.StatusConflict)
+		return
+	}
+
+	values := url.Values{
+		"id":         {strconv.FormatInt(user, 10)},
+		"first_name": {"Student"},
+		"username":   {fmt.Sprintf("student%d", user)},
+		"auth_date":  {strconv.FormatInt(time.Now().Unix(), 10)},
+	}
+	values.Set("hash", auth.SignTelegramLogin(token, values))
+	http.Redirect(w, r, s.academy+"/auth/telegram?"+values.Encode(), http.StatusFound)
+}
+
+// deliver posts an update to the bot's webhook if it registered one, or
+// queues it for getUpdates
+func (s *server) deliver(w http.ResponseWriter, update map[string]interface{}) {
+	s.mu.Lock()
+	webhook, secret := s.webhook, s.secret
+	if webhook == "" {
+		s.updates = append(s.updates, update)
+		close(s.notify)
+		s.notify = make(chan struct{})
+	}
+	s.mu.Unlock()
+
+	if webhook == "" {
+		fmt.Fprintln(w, "queued for getUpdates")
+		return
+	}
+
+	body, _ := json.Marshal(update)
+	req, err := http.NewRequest(http.MethodPost, webhook, bytes.NewReader(body))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if secret != "" {
+		req.Header.Set("X-Telegram-Bot-Api-Secret-Token", secret)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		http.Error(w, "webhook failed: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	fmt.Fprintf(w, "webhook answered %s\n", resp.Status)
+}
+
+// poll returns queued updates from offset on, waiting up to timeout for one to
+// arrive. It fails while a webhook is set, like Telegram does.
+func (s *server) poll(offset int, timeout time.Duration, r *http.Request) ([]map[string]interface{}, bool) {
+	deadline := time.After(timeout)
+	for {
+		s.mu.Lock()
+		if s.webhook != "" {
+			s.mu.Unlock()
+			return nil, false
+		}
+
+		// Updates before the offset have been confirmed
+		pending := s.updates[:0]
+		for _, update := range s.updates {
+			if update["update_id"].(int) >= offset {
+				pending = append(pending, update)
+			}
+		}
+		s.updates = pending
+		notify := s.notify
+		s.mu.Unlock()
+
+		if len(pending) > 0 {
+			return append([]map[string]interface{}(nil), pending...), true
+		}
+
+		select {
+		case <-notify:
+		case <-deadline:
+			return []map[string]interface{}{}, true
+		case <-r.Context().Done():
+			return []map[string]interface{}{}, true
+		}
+	}
+}
+
+// message starts a private message from a user
+func (s *server) message(user int64) map[string]interface{} {
+	from := map[string]interface{}{"id": user, "is_bot": false, "first_name": "Student", "username": fmt.Sprintf("student%d", user)}
+	return map[string]interface{}{
+		"message_id": s.id(),
+		"date":       time.Now().Unix(),
+		"from":       from,
+		"chat":       map[string]interface{}{"id": user, "type": "private"},
+	}
+}
+
+// id hands out increasing IDs for updates and messages
+func (s *server) id() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextID++
+	return s.nextID
+}
+
+// userParam reads the Telegram user ID a request acts as
+func userParam(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	user, err := strconv.ParseInt(r.FormValue("user"), 10, 64)
+	if err != nil {
+		http.Error(w, "user must be a numeric Telegram user ID", http.StatusBadRequest)
+		return 0, false
+	}
+	return user, true
+}
+
+// reply writes a successful Bot API response
+func reply(w http.ResponseWriter, result interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"ok": true, "result": result})
+}
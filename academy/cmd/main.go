@@ -1,8 +1,13 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/gin-contrib/cors"
@@ -13,6 +18,8 @@ import (
 	"github.com/globallstudent/academy/internal/database"
 	"github.com/globallstudent/academy/internal/handlers"
 	"github.com/globallstudent/academy/internal/middleware"
+	"github.com/globallstudent/academy/internal/problems"
+	"github.com/globallstudent/academy/internal/ratelimit"
 	"github.com/globallstudent/academy/internal/telegrambot"
 	"github.com/globallstudent/academy/internal/template"
 	"github.com/joho/godotenv"
@@ -130,12 +137,22 @@ func main() {
 	// Apply middlewares
 	router.Use(middleware.Logger())
 
-	// Register routes
-	handlers.RegisterRoutes(router, db, redis, cfg)
-
-	// Swagger documentation
-	docs.SwaggerInfo.BasePath = "/"
-	router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
+	// Login rate limits, login codes and the problems are shared by the web
+	// handlers and the Telegram bot
+	limiter := ratelimit.New(redis)
+	otpService := auth.NewOTPService(cfg.Auth, auth.NewOTPStore(redis), limiter,
+		ratelimit.NewRules(cfg.RateLimit).OTPRequestsPerPhone)
+	if cfg.SMTP.Host != "" {
+		otpService.Register(auth.NewSMTPSender(cfg.SMTP, cfg.Auth.OTPExpiry))
+	}
+	if cfg.Environment != "production" {
+		otpService.Register(auth.ConsoleSender{})
+	}
+	catalog, err := problems.Load(cfg.ProblemsDir)
+	if err != nil {
+		log.Printf("Warning: Failed to load problems: %v", err)
+		catalog = &problems.Catalog{}
+	}
 
 	// Define port
 	port := os.Getenv("PORT")
@@ -150,27 +167,75 @@ func main() {
 	}
 
 	// Only start the bot if token is provided
+	var bot *telegrambot.Bot
 	if cfg.Telegram.BotToken != "" {
-		bot, err := telegrambot.New(cfg, redis, db, serverURL)
+		bot, err = telegrambot.New(cfg, redis, db, otpService, catalog, serverURL)
 		if err != nil {
 			log.Printf("Warning: Failed to initialize Telegram bot: %v", err)
-		} else {
-			// Connect development OTP store if Redis is not available
-			if redis == nil && cfg.Environment != "production" {
-				handlers.ExportedStoreDevelopmentOTP = handlers.StoreDevelopmentOTP
-				bot.SetDevOTPStore(handlers.ExportedStoreDevelopmentOTP)
-			}
-
-			// Start the bot in a goroutine
-			go bot.Start()
-			log.Println("Telegram bot started successfully")
+			bot = nil
 		}
 	} else {
 		log.Println("No Telegram bot token provided, skipping bot initialization")
 	}
 
-	log.Printf("Server starting on :%s", port)
-	if err := router.Run(":" + port); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+	// The bot sends login codes, and messages students their verdicts and
+	// announcements
+	var notifier handlers.Notifier
+	if bot != nil {
+		otpService.Register(bot)
+		notifier = bot
+	}
+
+	// Register routes
+	stopHandlers := handlers.RegisterRoutes(router, db, redis, limiter, otpService, catalog, notifier, cfg)
+
+	// Swagger documentation
+	docs.SwaggerInfo.BasePath = "/"
+	router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
+
+	if bot != nil {
+		// In webhook mode, Telegram posts updates to the academy's own router
+		if bot.UsesWebhook() {
+			router.POST(telegrambot.WebhookPath, bot.HandleWebhook)
+		}
+
+		// Start the bot in a goroutine
+		go bot.Start()
+		if bot.UsesWebhook() {
+			log.Println("Telegram bot started in webhook mode")
+		} else {
+			log.Println("Telegram bot started successfully")
+		}
+	}
+
+	srv := &http.Server{
+		Addr:    ":" + port,
+		Handler: router,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	go func() {
+		log.Printf("Server starting on :%s", port)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Failed to start server: %v", err)
+		}
+	}()
+
+	<-ctx.Done()
+	log.Println("Shutting down server...")
+
+	// Give in-flight requests a chance to finish
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Server shutdown failed: %v", err)
+	}
+
+	if bot != nil {
+		bot.Stop()
 	}
+	stopHandlers()
+	log.Println("Server stopped")
 }
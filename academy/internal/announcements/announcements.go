@@ -0,0 +1,260 @@
+// Package announcements stores the announcements admins make during
+// contests. An announcement starts as a draft, is shown in the site banner
+// once published, and can be broadcast by the Telegram bot.
+package announcements
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/globallstudent/academy/internal/database"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	// MaxLength is the longest announcement accepted, leaving room in a
+	// Telegram message (4096 characters) for the heading
+	MaxLength = 3500
+	// BannerAge is how long a published announcement stays in the site banner
+	BannerAge = 24 * time.Hour
+	// bannerSize is how many announcements the banner shows at most
+	bannerSize = 3
+)
+
+var (
+	// ErrEmpty is returned for an announcement without a message
+	ErrEmpty = errors.New("announcement is empty")
+	// ErrTooLong is returned for a message longer than MaxLength
+	ErrTooLong = errors.New("announcement is too long")
+)
+
+// Announcement is a message from the admins to everyone, or to the
+// participants of one contest
+type Announcement struct {
+	ID           uuid.UUID
+	Message      string
+	ContestID    *uuid.UUID // nil when it's for everyone
+	ContestSlug  string
+	ContestTitle string
+	Telegram     bool // Also broadcast by the Telegram bot
+	CreatedBy    *uuid.UUID
+	CreatedAt    time.Time
+	PublishedAt  *time.Time // nil while it's a draft awaiting confirmation
+	RetractedAt  *time.Time // Set when it's taken out of the banner
+	Recipients   int        // Telegram users the broadcast reached
+}
+
+// Audience describes who an announcement is for
+func (a Announcement) Audience() string {
+	if a.ContestID == nil {
+		return "everyone"
+	}
+	return "participants of " + a.ContestTitle
+}
+
+// IsDraft reports whether an announcement still awaits confirmation
+func (a Announcement) IsDraft() bool {
+	return a.PublishedAt == nil
+}
+
+// Contest is a contest an announcement can be addressed to
+type Contest struct {
+	ID    uuid.UUID
+	Slug  string
+	Title string
+}
+
+// columns are the columns scanned by scan
+const columns = `a.id, a.message, a.contest_id, COALESCE(c.slug, ''), COALESCE(c.title, ''), a.telegram,
+	a.created_by, a.created_at, a.published_at, a.retracted_at, a.recipients`
+
+// from joins the contest an announcement is for
+const from = ` FROM announcements a LEFT JOIN contests c ON c.id = a.contest_id `
+
+func scan(row pgx.Row) (Announcement, error) {
+	var a Announcement
+	err := row.Scan(&a.ID, &a.Message, &a.ContestID, &a.ContestSlug, &a.ContestTitle, &a.Telegram,
+		&a.CreatedBy, &a.CreatedAt, &a.PublishedAt, &a.RetractedAt, &a.Recipients)
+	return a, err
+}
+
+func scanAll(rows pgx.Rows) ([]Announcement, error) {
+	defer rows.Close()
+	var list []Announcement
+	for rows.Next() {
+		a, err := scan(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, a)
+	}
+	return list, rows.Err()
+}
+
+// Validate checks a message before it's stored
+func Validate(message string) error {
+	if message == "" {
+		return ErrEmpty
+	}
+	if len([]rune(message)) > MaxLength {
+		return ErrTooLong
+	}
+	return nil
+}
+
+// CreateDraft stores an announcement awaiting confirmation. contestID is nil
+// for an announcement to everyone.
+func CreateDraft(ctx context.Context, db *database.DB, message string, contestID *uuid.UUID, telegram bool, createdBy uuid.UUID) (Announcement, error) {
+	if err := Validate(message); err != nil {
+		return Announcement{}, err
+	}
+	var id uuid.UUID
+	err := db.Pool.QueryRow(ctx, `
+		INSERT INTO announcements (message, contest_id, telegram, created_by)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id`, message, contestID, telegram, createdBy).Scan(&id)
+	if err != nil {
+		return Announcement{}, err
+	}
+	a, _, err := Get(ctx, db, id)
+	return a, err
+}
+
+// Get returns an announcement by ID. The second result is false if there is
+// no such announcement.
+func Get(ctx context.Context, db *database.DB, id uuid.UUID) (Announcement, bool, error) {
+	a, err := scan(db.Pool.QueryRow(ctx, `SELECT `+columns+from+`WHERE a.id = $1`, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Announcement{}, false, nil
+	}
+	if err != nil {
+		return Announcement{}, false, err
+	}
+	return a, true, nil
+}
+
+// List returns the latest announcements, drafts included, newest first
+func List(ctx context.Context, db *database.DB, limit int) ([]Announcement, error) {
+	rows, err := db.Pool.Query(ctx, `SELECT `+columns+from+`ORDER BY a.created_at DESC LIMIT $1`, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanAll(rows)
+}
+
+// Active returns the published announcements still shown in the banner,
+// newest first
+func Active(ctx context.Context, db *database.DB, now time.Time) ([]Announcement, error) {
+	rows, err := db.Pool.Query(ctx, `SELECT `+columns+from+`
+		WHERE a.published_at > $1 AND a.retracted_at IS NULL
+		ORDER BY a.published_at DESC
+		LIMIT $2`, now.Add(-BannerAge), bannerSize)
+	if err != nil {
+		return nil, err
+	}
+	return scanAll(rows)
+}
+
+// Publish confirms a draft. Only the first caller gets true, so a double
+// confirmation doesn't broadcast twice.
+func Publish(ctx context.Context, db *database.DB, id uuid.UUID) (Announcement, bool, error) {
+	tag, err := db.Pool.Exec(ctx, `
+		UPDATE announcements SET published_at = now()
+		WHERE id = $1 AND published_at IS NULL`, id)
+	if err != nil {
+		return Announcement{}, false, err
+	}
+	if tag.RowsAffected() != 1 {
+		return Announcement{}, false, nil
+	}
+	a, _, err := Get(ctx, db, id)
+	return a, err == nil, err
+}
+
+// Discard deletes a draft. Published announcements are retracted instead.
+func Discard(ctx context.Context, db *database.DB, id uuid.UUID) (bool, error) {
+	tag, err := db.Pool.Exec(ctx, `DELETE FROM announcements WHERE id = $1 AND published_at IS NULL`, id)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// Retract takes a published announcement out of the banner. Telegram
+// messages already sent stay sent.
+func Retract(ctx context.Context, db *database.DB, id uuid.UUID) (bool, error) {
+	tag, err := db.Pool.Exec(ctx, `
+		UPDATE announcements SET retracted_at = now()
+		WHERE id = $1 AND published_at IS NOT NULL AND retracted_at IS NULL`, id)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// SetRecipients records how many Telegram users a broadcast reached
+func SetRecipients(ctx context.Context, db *database.DB, id uuid.UUID, recipients int) error {
+	_, err := db.Pool.Exec(ctx, `UPDATE announcements SET recipients = $2 WHERE id = $1`, id, recipients)
+	return err
+}
+
+// TelegramIDs lists the Telegram users an announcement is for: everyone with
+// a linked Telegram account, or only the contest's participants
+func TelegramIDs(ctx context.Context, db *database.DB, contestID *uuid.UUID) ([]string, error) {
+	rows, err := db.Pool.Query(ctx, `
+		SELECT DISTINCT u.telegram_id FROM users u
+		WHERE u.telegram_id IS NOT NULL AND u.telegram_id <> ''
+		AND ($1::uuid IS NULL OR EXISTS (
+			SELECT 1 FROM contest_participants p
+			WHERE p.contest_id = $1 AND p.user_id = u.id))`, contestID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// FindContest looks up a contest by slug. The second result is false if
+// there is no such contest.
+func FindContest(ctx context.Context, db *database.DB, slug string) (Contest, bool, error) {
+	var c Contest
+	err := db.Pool.QueryRow(ctx, `SELECT id, slug, title FROM contests WHERE slug = $1`, slug).
+		Scan(&c.ID, &c.Slug, &c.Title)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Contest{}, false, nil
+	}
+	if err != nil {
+		return Contest{}, false, err
+	}
+	return c, true, nil
+}
+
+// Contests lists the contests announcements can be addressed to
+func Contests(ctx context.Context, db *database.DB) ([]Contest, error) {
+	rows, err := db.Pool.Query(ctx, `SELECT id, slug, title FROM contests ORDER BY start_date DESC NULLS LAST, title`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var contests []Contest
+	for rows.Next() {
+		var c Contest
+		if err := rows.Scan(&c.ID, &c.Slug, &c.Title); err != nil {
+			return nil, err
+		}
+		contests = append(contests, c)
+	}
+	return contests, rows.Err()
+}
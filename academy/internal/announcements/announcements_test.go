@@ -0,0 +1,66 @@
+package announcements
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		message string
+		want    error
+	}{
+		{name: "short message", message: "Problem 3 has a typo in the sample"},
+		{name: "empty", message: "", want: ErrEmpty},
+		{name: "at the limit", message: strings.Repeat("я", MaxLength)},
+		{name: "too long", message: strings.Repeat("a", MaxLength+1), want: ErrTooLong},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Validate(tt.message); !errors.Is(err, tt.want) {
+				t.Errorf("Validate() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestAnnouncementAudience(t *testing.T) {
+	contestID := uuid.New()
+	now := time.Now()
+
+	tests := []struct {
+		name         string
+		announcement Announcement
+		wantAudience string
+		wantDraft    bool
+	}{
+		{
+			name:         "draft to everyone",
+			announcement: Announcement{},
+			wantAudience: "everyone",
+			wantDraft:    true,
+		},
+		{
+			name:         "published to a contest",
+			announcement: Announcement{ContestID: &contestID, ContestTitle: "Week 1", PublishedAt: &now},
+			wantAudience: "participants of Week 1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.announcement.Audience(); got != tt.wantAudience {
+				t.Errorf("Audience() = %q, want %q", got, tt.wantAudience)
+			}
+			if got := tt.announcement.IsDraft(); got != tt.wantDraft {
+				t.Errorf("IsDraft() = %v, want %v", got, tt.wantDraft)
+			}
+		})
+	}
+}
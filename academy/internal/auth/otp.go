@@ -0,0 +1,46 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+)
+
+// Bounds on the length of a one-time password. Shorter codes are too easy
+// to guess, and longer ones are a pain to type.
+const (
+	minOTPLength = 4
+	maxOTPLength = 12
+)
+
+// GenerateOTP returns a random numeric one-time password of the given length.
+// Each digit is drawn uniformly from crypto/rand.
+func GenerateOTP(length int) (string, error) {
+	if length < minOTPLength || length > maxOTPLength {
+		return "", fmt.Errorf("OTP length must be between %d and %d, got %d", minOTPLength, maxOTPLength, length)
+	}
+
+	digits := make([]byte, length)
+	ten := big.NewInt(10)
+	for i := range digits {
+		n, err := rand.Int(rand.Reader, ten)
+		if err != nil {
+			return "", fmt.Errorf("failed to generate OTP: %w", err)
+		}
+		digits[i] = byte('0' + n.Int64())
+	}
+	return string(digits), nil
+}
+
+// HashOTP returns the keyed hash an OTP is stored as. The phone number is
+// mixed in so the same code hashes differently for different users.
+func HashOTP(secret, phoneNumber, otp string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(phoneNumber))
+	mac.Write([]byte{0})
+	mac.Write([]byte(otp))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,127 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"github.com/globallstudent/academy/internal/config"
+)
+
+// Channels login codes can be sent through
+const (
+	OTPChannelTelegram = "telegram"
+	OTPChannelEmail    = "email"
+	OTPChannelConsole  = "console"
+)
+
+// ErrOTPNoRoute is returned when a channel can't reach a user, e.g. email
+// for an account without an email address
+var ErrOTPNoRoute = errors.New("no way to reach the user on this channel")
+
+// OTPRecipient is who a login code is for, with what each channel needs to
+// reach them
+type OTPRecipient struct {
+	PhoneNumber string
+	Email       string
+	TelegramID  string
+}
+
+// OTPSender delivers login codes through one channel
+type OTPSender interface {
+	// Channel names the channel, as chosen on the login page
+	Channel() string
+	// CanReach reports whether the channel can deliver to the recipient
+	CanReach(to OTPRecipient) bool
+	// SendOTP delivers a code
+	SendOTP(ctx context.Context, to OTPRecipient, otp string) error
+}
+
+// ConsoleSender writes codes to the server log, for development without a
+// bot or mail server. It must not be used in production.
+type ConsoleSender struct{}
+
+// Channel names the channel
+func (ConsoleSender) Channel() string { return OTPChannelConsole }
+
+// CanReach reports true: anyone can read the log in development
+func (ConsoleSender) CanReach(OTPRecipient) bool { return true }
+
+// SendOTP logs the code
+func (ConsoleSender) SendOTP(_ context.Context, to OTPRecipient, otp string) error {
+	log.Printf("Development mode: login code for %s is %s", to.PhoneNumber, otp)
+	return nil
+}
+
+// SMTPSender emails codes through an SMTP server. The connection is
+// upgraded with STARTTLS when the server offers it.
+type SMTPSender struct {
+	cfg    config.SMTPConfig
+	expiry time.Duration
+}
+
+// NewSMTPSender creates an email sender. expiry is only mentioned in the
+// message.
+func NewSMTPSender(cfg config.SMTPConfig, expiry time.Duration) *SMTPSender {
+	return &SMTPSender{cfg: cfg, expiry: expiry}
+}
+
+// Channel names the channel
+func (s *SMTPSender) Channel() string { return OTPChannelEmail }
+
+// CanReach reports whether the recipient has an email address
+func (s *SMTPSender) CanReach(to OTPRecipient) bool { return to.Email != "" }
+
+// SendOTP emails the code
+func (s *SMTPSender) SendOTP(ctx context.Context, to OTPRecipient, otp string) error {
+	if to.Email == "" {
+		return ErrOTPNoRoute
+	}
+	from, err := mail.ParseAddress(s.cfg.From)
+	if err != nil {
+		return fmt.Errorf("invalid SMTP_FROM address: %w", err)
+	}
+	recipient, err := mail.ParseAddress(to.Email)
+	if err != nil {
+		return fmt.Errorf("invalid email address: %w", err)
+	}
+
+	minutes := int(s.expiry.Round(time.Minute) / time.Minute)
+	body := fmt.Sprintf("Your Summer Academy login code is: %s\r\n\r\n"+
+		"It is valid for %d minutes and can be used once. "+
+		"If you didn't ask for it, you can ignore this email.\r\n", otp, minutes)
+
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "From: %s\r\n", from.String())
+	fmt.Fprintf(&msg, "To: %s\r\n", recipient.String())
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", "Your Summer Academy login code"))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(body)
+
+	var auth smtp.Auth
+	if s.cfg.Username != "" {
+		auth = smtp.PlainAuth("", s.cfg.Username, s.cfg.Password, s.cfg.Host)
+	}
+
+	// smtp.SendMail takes no context, so give up waiting for it instead
+	addr := net.JoinHostPort(s.cfg.Host, s.cfg.Port)
+	done := make(chan error, 1)
+	go func() {
+		done <- smtp.SendMail(addr, auth, from.Address, []string{recipient.Address}, []byte(msg.String()))
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
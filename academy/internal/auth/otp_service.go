@@ -0,0 +1,226 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/globallstudent/academy/internal/config"
+	"github.com/globallstudent/academy/internal/database"
+	"github.com/globallstudent/academy/internal/ratelimit"
+)
+
+var (
+	// ErrTooManyOTPAttempts is returned by Verify once a code has been
+	// guessed at too often. The code is discarded.
+	ErrTooManyOTPAttempts = database.ErrTooManyOTPAttempts
+	// ErrUnknownOTPChannel is returned for a channel no sender is registered for
+	ErrUnknownOTPChannel = errors.New("unknown login code channel")
+)
+
+// OTPLimitError is returned when a phone number has been sent too many codes
+// recently
+type OTPLimitError struct {
+	RetryAfter time.Duration
+}
+
+func (e *OTPLimitError) Error() string {
+	return fmt.Sprintf("too many codes requested, retry in %s", e.RetryAfter)
+}
+
+// OTPStore keeps the hash of the current login code of each phone number
+type OTPStore interface {
+	// Save stores a code's hash, replacing any earlier code and its attempts
+	Save(ctx context.Context, phoneNumber, otpHash string, expiry time.Duration) error
+	// Verify checks a hash against the stored one. A matching code is deleted,
+	// so it works once. Every check counts as an attempt; after maxAttempts
+	// the code is deleted and ErrTooManyOTPAttempts returned.
+	Verify(ctx context.Context, phoneNumber, otpHash string, maxAttempts int) (bool, error)
+}
+
+// NewOTPStore returns a Redis-backed store, or an in-memory one when Redis
+// isn't available
+func NewOTPStore(redis *database.Redis) OTPStore {
+	if redis != nil && redis.Client != nil {
+		return &RedisOTPStore{redis: redis}
+	}
+	log.Printf("Login codes are kept in memory and will be lost on restart")
+	return NewMemoryOTPStore()
+}
+
+// RedisOTPStore keeps codes in Redis, shared between academy instances
+type RedisOTPStore struct {
+	redis *database.Redis
+}
+
+// Save stores a code's hash, replacing any earlier code and its attempts
+func (s *RedisOTPStore) Save(_ context.Context, phoneNumber, otpHash string, expiry time.Duration) error {
+	return s.redis.StoreOTP(phoneNumber, otpHash, expiry)
+}
+
+// Verify checks a hash against the stored one
+func (s *RedisOTPStore) Verify(_ context.Context, phoneNumber, otpHash string, maxAttempts int) (bool, error) {
+	return s.redis.VerifyOTP(phoneNumber, otpHash, maxAttempts)
+}
+
+// memoryOTP is a code kept by MemoryOTPStore
+type memoryOTP struct {
+	hash      string
+	attempts  int
+	expiresAt time.Time
+}
+
+// MemoryOTPStore keeps codes in memory, for development without Redis
+type MemoryOTPStore struct {
+	mu    sync.Mutex
+	codes map[string]*memoryOTP
+}
+
+// NewMemoryOTPStore creates an empty in-memory store
+func NewMemoryOTPStore() *MemoryOTPStore {
+	return &MemoryOTPStore{codes: make(map[string]*memoryOTP)}
+}
+
+// Save stores a code's hash, replacing any earlier code and its attempts
+func (s *MemoryOTPStore) Save(_ context.Context, phoneNumber, otpHash string, expiry time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Drop expired codes so the store doesn't grow without bound
+	now := time.Now()
+	for phone, code := range s.codes {
+		if now.After(code.expiresAt) {
+			delete(s.codes, phone)
+		}
+	}
+	s.codes[phoneNumber] = &memoryOTP{hash: otpHash, expiresAt: now.Add(expiry)}
+	return nil
+}
+
+// Verify checks a hash against the stored one, with the same attempt limit
+// and single use as Redis
+func (s *MemoryOTPStore) Verify(_ context.Context, phoneNumber, otpHash string, maxAttempts int) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	code, exists := s.codes[phoneNumber]
+	if !exists || time.Now().After(code.expiresAt) {
+		delete(s.codes, phoneNumber)
+		return false, nil
+	}
+
+	code.attempts++
+	if code.attempts > maxAttempts {
+		delete(s.codes, phoneNumber)
+		return false, ErrTooManyOTPAttempts
+	}
+	if subtle.ConstantTimeCompare([]byte(code.hash), []byte(otpHash)) != 1 {
+		return false, nil
+	}
+	delete(s.codes, phoneNumber)
+	return true, nil
+}
+
+// OTPService issues and checks login codes, and delivers them through the
+// registered senders. Codes are tied to a phone number, whichever channel
+// they were sent through.
+type OTPService struct {
+	cfg      config.AuthConfig
+	store    OTPStore
+	limiter  ratelimit.Limiter
+	requests ratelimit.Rule // Limits how often a phone number gets a new code
+	senders  map[string]OTPSender
+}
+
+// NewOTPService creates a service without senders; add them with Register
+func NewOTPService(cfg config.AuthConfig, store OTPStore, limiter ratelimit.Limiter, requests ratelimit.Rule) *OTPService {
+	return &OTPService{
+		cfg:      cfg,
+		store:    store,
+		limiter:  limiter,
+		requests: requests,
+		senders:  make(map[string]OTPSender),
+	}
+}
+
+// Register makes a channel available, replacing any sender for the same
+// channel. Senders are registered at startup, before requests are served.
+func (s *OTPService) Register(sender OTPSender) {
+	s.senders[sender.Channel()] = sender
+}
+
+// Channels lists the registered channels, in a stable order
+func (s *OTPService) Channels() []string {
+	channels := make([]string, 0, len(s.senders))
+	for channel := range s.senders {
+		channels = append(channels, channel)
+	}
+	sort.Slice(channels, func(i, j int) bool {
+		return channelOrder(channels[i]) < channelOrder(channels[j])
+	})
+	return channels
+}
+
+// channelOrder puts the usual channels first
+func channelOrder(channel string) string {
+	switch channel {
+	case OTPChannelTelegram:
+		return "0"
+	case OTPChannelEmail:
+		return "1"
+	case OTPChannelConsole:
+		return "3"
+	}
+	return "2" + channel
+}
+
+// Issue generates a new code for a phone number and stores its hash,
+// replacing any earlier code. Only the hash is kept, so the plaintext code
+// exists only in what's sent to the user. It returns an *OTPLimitError if the
+// phone number has been sent too many codes recently.
+func (s *OTPService) Issue(ctx context.Context, phoneNumber string) (string, error) {
+	// Each code is a fresh set of guesses, so limit how often they're handed
+	// out. If the limiter fails, codes are issued anyway.
+	if res, err := s.limiter.Hit(ctx, s.requests, phoneNumber); err != nil {
+		log.Printf("Error applying %s rate limit: %v", s.requests.Name, err)
+	} else if !res.Allowed {
+		return "", &OTPLimitError{RetryAfter: res.RetryAfter}
+	}
+
+	otp, err := GenerateOTP(s.cfg.OTPLength)
+	if err != nil {
+		return "", err
+	}
+	if err := s.store.Save(ctx, phoneNumber, HashOTP(s.cfg.OTPSecret, phoneNumber, otp), s.cfg.OTPExpiry); err != nil {
+		return "", fmt.Errorf("failed to store OTP: %w", err)
+	}
+	return otp, nil
+}
+
+// Send issues a code for the recipient's phone number and delivers it
+// through a channel. The recipient is checked first, so a code isn't spent
+// on a channel that can't reach them.
+func (s *OTPService) Send(ctx context.Context, channel string, to OTPRecipient) error {
+	sender, ok := s.senders[channel]
+	if !ok {
+		return ErrUnknownOTPChannel
+	}
+	if !sender.CanReach(to) {
+		return ErrOTPNoRoute
+	}
+	otp, err := s.Issue(ctx, to.PhoneNumber)
+	if err != nil {
+		return err
+	}
+	return sender.SendOTP(ctx, to, otp)
+}
+
+// Verify checks a code entered for a phone number
+func (s *OTPService) Verify(ctx context.Context, phoneNumber, otp string) (bool, error) {
+	return s.store.Verify(ctx, phoneNumber, HashOTP(s.cfg.OTPSecret, phoneNumber, otp), s.cfg.OTPMaxAttempts)
+}
@@ -0,0 +1,192 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestGenerateOTP(t *testing.T) {
+	tests := []struct {
+		length  int
+		wantErr bool
+	}{
+		{length: 3, wantErr: true},
+		{length: 4},
+		{length: 6},
+		{length: 12},
+		{length: 13, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		otp, err := GenerateOTP(tt.length)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("GenerateOTP(%d) = %q, want error", tt.length, otp)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("GenerateOTP(%d) failed: %v", tt.length, err)
+			continue
+		}
+		if len(otp) != tt.length {
+			t.Errorf("GenerateOTP(%d) = %q, wrong length", tt.length, otp)
+		}
+		for _, r := range otp {
+			if r < '0' || r > '9' {
+				t.Errorf("GenerateOTP(%d) = %q, not numeric", tt.length, otp)
+				break
+			}
+		}
+	}
+}
+
+func TestGenerateOTPUsesEveryDigit(t *testing.T) {
+	seen := make(map[rune]bool)
+	for i := 0; i < 100 && len(seen) < 10; i++ {
+		otp, err := GenerateOTP(12)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, r := range otp {
+			seen[r] = true
+		}
+	}
+	if len(seen) != 10 {
+		t.Errorf("only saw digits %v in 1200 draws", seen)
+	}
+}
+
+func TestHashOTP(t *testing.T) {
+	base := HashOTP("secret", "+998901234567", "123456")
+
+	if len(base) != 64 {
+		t.Errorf("HashOTP returned %d hex characters, want 64", len(base))
+	}
+	if base == "123456" {
+		t.Error("HashOTP returned the plaintext code")
+	}
+	if HashOTP("secret", "+998901234567", "123456") != base {
+		t.Error("HashOTP is not deterministic")
+	}
+
+	different := []struct {
+		name                     string
+		secret, phoneNumber, otp string
+	}{
+		{"other secret", "other", "+998901234567", "123456"},
+		{"other phone number", "secret", "+998901234568", "123456"},
+		{"other code", "secret", "+998901234567", "123457"},
+		// The separator keeps the phone number and code from running together
+		{"shifted boundary", "secret", "+99890123456", "7123456"},
+	}
+	for _, tt := range different {
+		if HashOTP(tt.secret, tt.phoneNumber, tt.otp) == base {
+			t.Errorf("%s: hash collides with the original", tt.name)
+		}
+	}
+}
+
+func TestMemoryOTPStoreVerify(t *testing.T) {
+	const phone = "+998901234567"
+	right := HashOTP("secret", phone, "123456")
+	wrong := HashOTP("secret", phone, "000000")
+
+	tests := []struct {
+		name        string
+		guesses     []string
+		maxAttempts int
+		want        []bool
+		wantErrAt   int // index of the guess that hits the attempt limit, -1 for none
+	}{
+		{
+			name:        "right code",
+			guesses:     []string{right},
+			maxAttempts: 3,
+			want:        []bool{true},
+			wantErrAt:   -1,
+		},
+		{
+			name:        "codes work once",
+			guesses:     []string{right, right},
+			maxAttempts: 3,
+			want:        []bool{true, false},
+			wantErrAt:   -1,
+		},
+		{
+			name:        "right code after wrong guesses",
+			guesses:     []string{wrong, wrong, right},
+			maxAttempts: 3,
+			want:        []bool{false, false, true},
+			wantErrAt:   -1,
+		},
+		{
+			name:        "too many attempts discards the code",
+			guesses:     []string{wrong, wrong, wrong, right, right},
+			maxAttempts: 3,
+			want:        []bool{false, false, false, false, false},
+			wantErrAt:   3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewMemoryOTPStore()
+			ctx := context.Background()
+			if err := store.Save(ctx, phone, right, time.Minute); err != nil {
+				t.Fatal(err)
+			}
+
+			for i, guess := range tt.guesses {
+				ok, err := store.Verify(ctx, phone, guess, tt.maxAttempts)
+				if ok != tt.want[i] {
+					t.Errorf("guess %d: ok = %v, want %v", i+1, ok, tt.want[i])
+				}
+				if wantErr := i == tt.wantErrAt; wantErr != errors.Is(err, ErrTooManyOTPAttempts) {
+					t.Errorf("guess %d: err = %v, want too many attempts %v", i+1, err, wantErr)
+				}
+			}
+		})
+	}
+}
+
+func TestMemoryOTPStoreSaveResetsAttempts(t *testing.T) {
+	const phone = "+998901234567"
+	store := NewMemoryOTPStore()
+	ctx := context.Background()
+
+	store.Save(ctx, phone, "first", time.Minute)
+	store.Verify(ctx, phone, "wrong", 2)
+	store.Verify(ctx, phone, "wrong", 2)
+
+	// A new code replaces the old one and starts with fresh attempts
+	store.Save(ctx, phone, "second", time.Minute)
+	if ok, _ := store.Verify(ctx, phone, "first", 2); ok {
+		t.Error("the replaced code still works")
+	}
+	if ok, err := store.Verify(ctx, phone, "second", 2); !ok || err != nil {
+		t.Errorf("Verify(new code) = %v, %v", ok, err)
+	}
+}
+
+func TestMemoryOTPStoreExpiry(t *testing.T) {
+	const phone = "+998901234567"
+	store := NewMemoryOTPStore()
+	ctx := context.Background()
+
+	store.Save(ctx, phone, "code", time.Minute)
+	store.codes[phone].expiresAt = time.Now().Add(-time.Second)
+
+	if ok, err := store.Verify(ctx, phone, "code", 3); ok || err != nil {
+		t.Errorf("Verify(expired code) = %v, %v", ok, err)
+	}
+	if _, exists := store.codes[phone]; exists {
+		t.Error("expired code was kept")
+	}
+
+	if ok, err := store.Verify(ctx, "+998900000000", "code", 3); ok || err != nil {
+		t.Errorf("Verify(unknown phone) = %v, %v", ok, err)
+	}
+}
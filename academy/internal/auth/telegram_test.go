@@ -0,0 +1,143 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testBotToken = "123456:test-bot-token"
+
+// signedLogin builds widget data signed the way Telegram documents it: the
+// HMAC-SHA256 of the "key=value" lines sorted by key, keyed with SHA-256 of
+// the bot token. It's written out independently of SignTelegramLogin.
+func signedLogin(botToken string, authDate time.Time) url.Values {
+	values := url.Values{
+		"id":         {"42"},
+		"first_name": {"Ada"},
+		"last_name":  {"Lovelace"},
+		"username":   {"ada"},
+		"photo_url":  {"https://t.me/i/userpic/ada.jpg"},
+		"auth_date":  {strconv.FormatInt(authDate.Unix(), 10)},
+	}
+	data := "auth_date=" + values.Get("auth_date") +
+		"\nfirst_name=Ada" +
+		"\nid=42" +
+		"\nlast_name=Lovelace" +
+		"\nphoto_url=https://t.me/i/userpic/ada.jpg" +
+		"\nusername=ada"
+
+	key := sha256.Sum256([]byte(botToken))
+	mac := hmac.New(sha256.New, key[:])
+	mac.Write([]byte(data))
+	values.Set("hash", hex.EncodeToString(mac.Sum(nil)))
+	return values
+}
+
+func TestVerifyTelegramLogin(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name    string
+		token   string
+		values  func() url.Values
+		wantErr error
+	}{
+		{
+			name:   "valid",
+			token:  testBotToken,
+			values: func() url.Values { return signedLogin(testBotToken, now) },
+		},
+		{
+			name:  "uppercase hash",
+			token: testBotToken,
+			values: func() url.Values {
+				v := signedLogin(testBotToken, now)
+				v.Set("hash", strings.ToUpper(v.Get("hash")))
+				return v
+			},
+		},
+		{
+			name:  "tampered field",
+			token: testBotToken,
+			values: func() url.Values {
+				v := signedLogin(testBotToken, now)
+				v.Set("id", "43")
+				return v
+			},
+			wantErr: ErrTelegramLoginInvalid,
+		},
+		{
+			name:  "added field",
+			token: testBotToken,
+			values: func() url.Values {
+				v := signedLogin(testBotToken, now)
+				v.Set("role", "admin")
+				return v
+			},
+			wantErr: ErrTelegramLoginInvalid,
+		},
+		{
+			name:    "wrong token",
+			token:   "654321:another-bot",
+			values:  func() url.Values { return signedLogin(testBotToken, now) },
+			wantErr: ErrTelegramLoginInvalid,
+		},
+		{
+			name:    "no bot token configured",
+			token:   "",
+			values:  func() url.Values { return signedLogin("", now) },
+			wantErr: ErrTelegramLoginInvalid,
+		},
+		{
+			name:  "missing hash",
+			token: testBotToken,
+			values: func() url.Values {
+				v := signedLogin(testBotToken, now)
+				v.Del("hash")
+				return v
+			},
+			wantErr: ErrTelegramLoginInvalid,
+		},
+		{
+			name:    "expired auth_date",
+			token:   testBotToken,
+			values:  func() url.Values { return signedLogin(testBotToken, now.Add(-2*time.Hour)) },
+			wantErr: ErrTelegramLoginExpired,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			login, err := VerifyTelegramLogin(tt.token, tt.values(), time.Hour)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("VerifyTelegramLogin() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("VerifyTelegramLogin() failed: %v", err)
+			}
+			if login.ID != 42 || login.FirstName != "Ada" || login.LastName != "Lovelace" || login.Username != "ada" {
+				t.Errorf("login = %+v", login)
+			}
+			if login.AuthDate.Unix() != now.Unix() {
+				t.Errorf("AuthDate = %s, want %s", login.AuthDate, now)
+			}
+		})
+	}
+}
+
+func TestSignTelegramLoginMatchesDocumentedAlgorithm(t *testing.T) {
+	values := signedLogin(testBotToken, time.Unix(1700000000, 0))
+	if got := SignTelegramLogin(testBotToken, values); got != values.Get("hash") {
+		t.Errorf("SignTelegramLogin() = %s, want %s", got, values.Get("hash"))
+	}
+}
@@ -1,15 +1,26 @@
 package config
 
-import "os"
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
 
 // Config holds application-wide configuration
 type Config struct {
 	Environment string
+	ProblemsDir string // Directory holding the dayN problem directories
 	Database    DatabaseConfig
 	Redis       RedisConfig
 	Auth        AuthConfig
+	RateLimit   RateLimitConfig
 	WBFY        WBFYConfig
 	Telegram    TelegramConfig
+	SMTP        SMTPConfig
 }
 
 // DatabaseConfig holds database connection information
@@ -31,27 +42,179 @@ type RedisConfig struct {
 
 // AuthConfig holds authentication configuration
 type AuthConfig struct {
-	JWTSecret    string
-	CookieName   string
-	CookieMaxAge int
+	JWTSecret      string
+	CookieName     string
+	CookieMaxAge   int
+	OTPSecret      string        // Key for hashing stored OTPs
+	OTPLength      int           // Digits in a login code
+	OTPExpiry      time.Duration // How long a login code stays valid
+	OTPMaxAttempts int           // Wrong guesses allowed before a login code is discarded
+}
+
+// RateLimitConfig holds limits on logging in. Counts are kept per phone
+// number or client address in sliding windows.
+type RateLimitConfig struct {
+	LoginFailuresPerPhone int           // Wrong codes allowed per phone number within LoginFailureWindow
+	LoginFailuresPerIP    int           // Wrong codes allowed per address within LoginFailureWindow
+	LoginFailureWindow    time.Duration // Also how long a lockout lasts
+	LoginRequestsPerIP    int           // Requests to /login and /verify allowed per address within LoginRequestWindow
+	LoginRequestWindow    time.Duration
+	OTPRequestsPerPhone   int // Codes the bot issues per phone number within OTPRequestWindow
+	OTPRequestWindow      time.Duration
 }
 
 // WBFYConfig holds configuration for WBFY terminal integration
 type WBFYConfig struct {
-	BinaryPath string
-	BaseURL    string
+	BinaryPath         string
+	BaseURL            string
+	Runtime            string // How sessions are launched: "docker" (default) or "process"
+	DockerSocket       string
+	PortRanges         string        // Host ports for sessions, e.g. "10000-10999,12000-12099"
+	MaxSessions        int           // Concurrent sessions across all users
+	MaxSessionsPerUser int           // Concurrent sessions per user
+	SessionLifetime    time.Duration // How long a new session lasts
+	SessionExtension   time.Duration // How much time "extend session" adds
+	MaxSessionLifetime time.Duration // Sessions can't be extended past this age
+	IdleTimeout        time.Duration // Sessions nobody has typed into for this long are ended
+	WorkspaceRoot      string        // Directory session workspaces are created in; with Docker, the same path on the host
+	WorkspaceMaxFile   int64         // Largest single file a student may upload, in bytes
+	WorkspaceQuota     int64         // Total size a session workspace may grow to via uploads, in bytes
+	WorkspaceUID       int           // Owner of the workspace files, the container's student user
+	WorkspaceGID       int           // Group of the workspace files
+	IsolatedNetwork    string        // Internal Docker network for sessions without network access
+	EgressNetwork      string        // Internal Docker network for sessions whose traffic goes through the egress proxy
+	EgressProxyPort    int           // Port the egress proxy listens on, on the egress network's gateway
+	AcademyContainer   string        // The academy's own container, when it runs in Docker; it joins the session networks
+	Profiles           map[string]ResourceProfile
+}
+
+// ResourceProfile limits what a terminal session's container may use
+type ResourceProfile struct {
+	Memory          int64    `json:"memory"`           // Bytes of memory, swap included
+	CPUs            float64  `json:"cpus"`             // Number of CPUs, may be fractional
+	PidsLimit       int64    `json:"pids_limit"`       // Maximum number of processes
+	DiskQuota       int64    `json:"disk_quota"`       // Bytes of writable container storage; needs a storage driver with quota support
+	Network         string   `json:"network"`          // "none", "egress" or "bridge" (unrestricted)
+	EgressAllowlist []string `json:"egress_allowlist"` // Hosts reachable in "egress" mode; a leading "." matches subdomains
+	ReadOnlyRoot    bool     `json:"read_only_root"`   // Mount the image read-only; /tmp stays writable
+	CapDrop         []string `json:"cap_drop"`
+	CapAdd          []string `json:"cap_add"`
+}
+
+// ProfileFor returns the resource profile for a problem type and language.
+// The most specific of "type:language", "type", "language" and "default" wins.
+func (c WBFYConfig) ProfileFor(problemType, language string) ResourceProfile {
+	for _, key := range []string{problemType + ":" + language, problemType, language} {
+		if profile, ok := c.Profiles[key]; ok {
+			return profile
+		}
+	}
+	return c.Profiles["default"]
+}
+
+// defaultProfiles are safe limits for untrusted students: no network access,
+// a read-only image and no capabilities
+func defaultProfiles() map[string]ResourceProfile {
+	base := ResourceProfile{
+		Memory:       512 << 20, // 512 MiB
+		CPUs:         1,
+		PidsLimit:    128,
+		Network:      "none",
+		ReadOnlyRoot: true,
+		CapDrop:      []string{"ALL"},
+	}
+
+	compiled := base
+	compiled.Memory = 1 << 30 // 1 GiB, compilers are hungry
+	compiled.PidsLimit = 256
+
+	// Build problems may need to fetch dependencies from the package registries
+	build := compiled
+	build.CPUs = 2
+	build.Network = "egress"
+	build.EgressAllowlist = []string{
+		"proxy.golang.org", "sum.golang.org",
+		"pypi.org", "files.pythonhosted.org",
+		"registry.npmjs.org",
+	}
+
+	return map[string]ResourceProfile{
+		"default": base,
+		"go":      compiled,
+		"build":   build,
+	}
+}
+
+// loadProfiles returns the default profiles, overridden by any profiles in the
+// JSON file at path (an object keyed like ProfileFor looks them up). An
+// override only changes the fields it sets: the rest come from the built-in
+// profile of the same name, or from "default" for new profiles.
+func loadProfiles(path string) map[string]ResourceProfile {
+	profiles := defaultProfiles()
+	if path == "" {
+		return profiles
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		log.Printf("Failed to read resource profiles from %s: %v", path, err)
+		return profiles
+	}
+
+	var overrides map[string]json.RawMessage
+	if err := json.Unmarshal(data, &overrides); err != nil {
+		log.Printf("Failed to parse resource profiles from %s: %v", path, err)
+		return defaultProfiles()
+	}
+	merged := make(map[string]ResourceProfile, len(overrides))
+	for key, override := range overrides {
+		profile, ok := profiles[key]
+		if !ok {
+			profile = profiles["default"]
+		}
+		// Unmarshalling into the profile leaves the fields the override doesn't set alone
+		profile.CapDrop = append([]string(nil), profile.CapDrop...)
+		profile.EgressAllowlist = append([]string(nil), profile.EgressAllowlist...)
+		if err := json.Unmarshal(override, &profile); err != nil {
+			log.Printf("Failed to parse resource profile %q from %s: %v", key, path, err)
+			return defaultProfiles()
+		}
+		profile.Network = strings.ToLower(profile.Network)
+		merged[key] = profile
+	}
+	for key, profile := range merged {
+		profiles[key] = profile
+	}
+	return profiles
 }
 
 // TelegramConfig holds Telegram bot configuration
 type TelegramConfig struct {
-	BotToken   string
-	WebhookURL string
+	BotToken      string
+	WebhookURL    string        // Public base URL Telegram sends updates to; the bot long-polls when empty
+	WebhookSecret string        // Secret Telegram sends in its secret-token header; random if empty
+	APIURL        string        // Bot API server, for pointing the bot at a fake server in development
+	StateTTL      time.Duration // How long the bot remembers a user's conversation state
+	BotUsername   string        // The bot's @username, without the @; enables the login widget
+	LoginMaxAge   time.Duration // How old login widget data may be
+	NotifyRate    int           // Notification messages sent per second, at most
+}
+
+// SMTPConfig holds the mail server login codes are emailed through. Email
+// codes are off when Host is empty.
+type SMTPConfig struct {
+	Host     string
+	Port     string
+	Username string // Optional; no authentication when empty
+	Password string
+	From     string // Sender address, e.g. "Summer Academy <noreply@example.com>"
 }
 
 // New creates a new Config instance populated from environment variables
 func New() *Config {
 	return &Config{
 		Environment: getEnv("ENV", "development"),
+		ProblemsDir: getEnv("PROBLEMS_DIR", "problems"),
 		Database: DatabaseConfig{
 			Host:     getEnv("DB_HOST", "localhost"),
 			Port:     getEnv("DB_PORT", "5432"),
@@ -66,17 +229,62 @@ func New() *Config {
 			Password: getEnv("REDIS_PASSWORD", ""),
 		},
 		Auth: AuthConfig{
-			JWTSecret:    getEnv("JWT_SECRET", "supersecret"),
-			CookieName:   getEnv("COOKIE_NAME", "academy_session"),
-			CookieMaxAge: 86400, // 24 hours
+			JWTSecret:      getEnv("JWT_SECRET", "supersecret"),
+			CookieName:     getEnv("COOKIE_NAME", "academy_session"),
+			CookieMaxAge:   86400, // 24 hours
+			OTPSecret:      getEnv("OTP_SECRET", getEnv("JWT_SECRET", "supersecret")),
+			OTPLength:      int(getEnvInt64("OTP_LENGTH", 6)),
+			OTPExpiry:      getEnvDuration("OTP_EXPIRY", 5*time.Minute),
+			OTPMaxAttempts: int(getEnvInt64("OTP_MAX_ATTEMPTS", 5)),
+		},
+		RateLimit: RateLimitConfig{
+			LoginFailuresPerPhone: int(getEnvInt64("RATE_LIMIT_LOGIN_FAILURES_PER_PHONE", 5)),
+			LoginFailuresPerIP:    int(getEnvInt64("RATE_LIMIT_LOGIN_FAILURES_PER_IP", 20)),
+			LoginFailureWindow:    getEnvDuration("RATE_LIMIT_LOGIN_FAILURE_WINDOW", 10*time.Minute),
+			LoginRequestsPerIP:    int(getEnvInt64("RATE_LIMIT_LOGIN_REQUESTS_PER_IP", 60)),
+			LoginRequestWindow:    getEnvDuration("RATE_LIMIT_LOGIN_REQUEST_WINDOW", time.Minute),
+			OTPRequestsPerPhone:   int(getEnvInt64("RATE_LIMIT_OTP_REQUESTS_PER_PHONE", 5)),
+			OTPRequestWindow:      getEnvDuration("RATE_LIMIT_OTP_REQUEST_WINDOW", 15*time.Minute),
 		},
 		WBFY: WBFYConfig{
-			BinaryPath: getEnv("WBFY_PATH", "../wbfy/wbfy"),
-			BaseURL:    getEnv("WBFY_URL", "http://localhost:8081"),
+			BinaryPath:         getEnv("WBFY_PATH", "../wbfy/wbfy"),
+			BaseURL:            getEnv("WBFY_URL", "http://localhost:8081"),
+			Runtime:            getEnv("WBFY_RUNTIME", "docker"),
+			DockerSocket:       getEnv("DOCKER_SOCKET", "/var/run/docker.sock"),
+			PortRanges:         getEnv("WBFY_PORT_RANGES", "10000-10999"),
+			MaxSessions:        int(getEnvInt64("WBFY_MAX_SESSIONS", 200)),
+			MaxSessionsPerUser: int(getEnvInt64("WBFY_MAX_SESSIONS_PER_USER", 2)),
+			SessionLifetime:    getEnvDuration("WBFY_SESSION_LIFETIME", 2*time.Hour),
+			SessionExtension:   getEnvDuration("WBFY_SESSION_EXTENSION", 30*time.Minute),
+			MaxSessionLifetime: getEnvDuration("WBFY_MAX_SESSION_LIFETIME", 6*time.Hour),
+			IdleTimeout:        getEnvDuration("WBFY_IDLE_TIMEOUT", 30*time.Minute),
+			WorkspaceRoot:      getEnv("WBFY_WORKSPACE_ROOT", filepath.Join(os.TempDir(), "academy-sessions")),
+			WorkspaceMaxFile:   getEnvInt64("WBFY_WORKSPACE_MAX_FILE", 10<<20), // 10 MiB
+			WorkspaceQuota:     getEnvInt64("WBFY_WORKSPACE_QUOTA", 100<<20),   // 100 MiB
+			WorkspaceUID:       int(getEnvInt64("WBFY_WORKSPACE_UID", 1000)),
+			WorkspaceGID:       int(getEnvInt64("WBFY_WORKSPACE_GID", 1000)),
+			IsolatedNetwork:    getEnv("WBFY_ISOLATED_NETWORK", "wbfy-isolated"),
+			EgressNetwork:      getEnv("WBFY_EGRESS_NETWORK", "wbfy-egress"),
+			EgressProxyPort:    int(getEnvInt64("WBFY_EGRESS_PROXY_PORT", 3128)),
+			AcademyContainer:   getEnv("WBFY_ACADEMY_CONTAINER", ""),
+			Profiles:           loadProfiles(os.Getenv("WBFY_PROFILES_FILE")),
 		},
 		Telegram: TelegramConfig{
-			BotToken:   getEnv("TELEGRAM_BOT_TOKEN", ""),
-			WebhookURL: getEnv("TELEGRAM_WEBHOOK_URL", ""),
+			BotToken:      getEnv("TELEGRAM_BOT_TOKEN", ""),
+			WebhookURL:    getEnv("TELEGRAM_WEBHOOK_URL", ""),
+			WebhookSecret: getEnv("TELEGRAM_WEBHOOK_SECRET", ""),
+			APIURL:        getEnv("TELEGRAM_API_URL", ""),
+			StateTTL:      getEnvDuration("TELEGRAM_STATE_TTL", 30*24*time.Hour),
+			BotUsername:   strings.TrimPrefix(getEnv("TELEGRAM_BOT_USERNAME", ""), "@"),
+			LoginMaxAge:   getEnvDuration("TELEGRAM_LOGIN_MAX_AGE", time.Hour),
+			NotifyRate:    int(getEnvInt64("TELEGRAM_NOTIFY_RATE", 25)),
+		},
+		SMTP: SMTPConfig{
+			Host:     getEnv("SMTP_HOST", ""),
+			Port:     getEnv("SMTP_PORT", "587"),
+			Username: getEnv("SMTP_USERNAME", ""),
+			Password: getEnv("SMTP_PASSWORD", ""),
+			From:     getEnv("SMTP_FROM", getEnv("SMTP_USERNAME", "")),
 		},
 	}
 }
@@ -89,3 +297,21 @@ func getEnv(key, defaultValue string) string {
 	}
 	return value
 }
+
+// getEnvInt64 retrieves an integer environment variable or returns a default value
+func getEnvInt64(key string, defaultValue int64) int64 {
+	value, err := strconv.ParseInt(os.Getenv(key), 10, 64)
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+// getEnvDuration retrieves a duration environment variable (e.g. "90m") or returns a default value
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	value, err := time.ParseDuration(os.Getenv(key))
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
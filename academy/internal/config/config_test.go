@@ -0,0 +1,92 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadProfiles(t *testing.T) {
+	defaults := defaultProfiles()
+
+	tests := []struct {
+		name  string
+		file  string
+		check map[string]ResourceProfile // profiles expected after loading
+	}{
+		{
+			name:  "no file",
+			check: defaults,
+		},
+		{
+			name: "override keeps the built-in hardening",
+			file: `{"default": {"memory": 268435456, "pids_limit": 64}}`,
+			check: map[string]ResourceProfile{"default": func() ResourceProfile {
+				p := defaults["default"]
+				p.Memory = 268435456
+				p.PidsLimit = 64
+				return p
+			}()},
+		},
+		{
+			name: "new profile starts from default",
+			file: `{"python": {"cpus": 0.5, "network": "EGRESS"}}`,
+			check: map[string]ResourceProfile{
+				"python": func() ResourceProfile {
+					p := defaults["default"]
+					p.CPUs = 0.5
+					p.Network = "egress"
+					return p
+				}(),
+				"default": defaults["default"],
+			},
+		},
+		{
+			name: "fields can be turned off explicitly",
+			file: `{"go": {"read_only_root": false, "cap_drop": []}}`,
+			check: map[string]ResourceProfile{
+				"go": func() ResourceProfile {
+					p := defaults["go"]
+					p.ReadOnlyRoot = false
+					p.CapDrop = []string{}
+					return p
+				}(),
+				"default": defaults["default"],
+			},
+		},
+		{
+			name: "lists are replaced",
+			file: `{"build": {"egress_allowlist": ["pypi.org"]}}`,
+			check: map[string]ResourceProfile{"build": func() ResourceProfile {
+				p := defaults["build"]
+				p.EgressAllowlist = []string{"pypi.org"}
+				return p
+			}()},
+		},
+		{
+			name:  "invalid file",
+			file:  `{"default": {"memory": "lots"}}`,
+			check: defaults,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := ""
+			if tt.file != "" {
+				path = filepath.Join(t.TempDir(), "profiles.json")
+				if err := os.WriteFile(path, []byte(tt.file), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			profiles := loadProfiles(path)
+			for key, want := range tt.check {
+				if got := profiles[key]; !reflect.DeepEqual(got, want) {
+					t.Errorf("profile %q = %+v, want %+v", key, got, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,554 @@
+package container
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/globallstudent/academy/internal/config"
+)
+
+// DockerRuntime runs sessions as containers through the Docker Engine API
+type DockerRuntime struct {
+	client *http.Client
+	cfg    config.WBFYConfig
+
+	mu       sync.Mutex
+	networks map[string]string // network name -> the academy's IP on it, once set up
+	egress   *EgressProxy
+	egressIP map[string]string // container ID -> IP registered with the egress proxy
+}
+
+// NewDockerRuntime creates a runtime that talks to the Docker daemon on a unix socket
+func NewDockerRuntime(cfg config.WBFYConfig) *DockerRuntime {
+	socket := cfg.DockerSocket
+	if socket == "" {
+		socket = "/var/run/docker.sock"
+	}
+
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socket)
+		},
+	}
+
+	return &DockerRuntime{
+		client:   &http.Client{Transport: transport},
+		cfg:      cfg,
+		networks: make(map[string]string),
+		egressIP: make(map[string]string),
+	}
+}
+
+// Start creates and starts a container, pulling the image if it's missing
+func (d *DockerRuntime) Start(ctx context.Context, opts StartOptions) (string, error) {
+	env := make([]string, 0, len(opts.Env))
+	for k, v := range opts.Env {
+		env = append(env, k+"="+v)
+	}
+
+	port := fmt.Sprintf("%d/tcp", opts.ContainerPort)
+	hostConfig := map[string]interface{}{
+		"Binds":       []string{opts.Workspace + ":" + WorkspacePath},
+		"AutoRemove":  true,
+		"SecurityOpt": []string{"no-new-privileges"},
+	}
+	applyProfile(hostConfig, opts.Profile)
+
+	// Sessions are reached through the academy's WebSocket proxy, so the wbfy
+	// port only has to be published when the container is on a normal network
+	switch opts.Profile.Network {
+	case "", "none":
+		network, err := d.ensureNetwork(ctx, d.cfg.IsolatedNetwork)
+		if err != nil {
+			return "", err
+		}
+		hostConfig["NetworkMode"] = network
+	case "egress":
+		network, err := d.ensureNetwork(ctx, d.cfg.EgressNetwork)
+		if err != nil {
+			return "", err
+		}
+		proxy, err := d.egressProxy(network)
+		if err != nil {
+			return "", err
+		}
+		hostConfig["NetworkMode"] = network
+		env = append(env, "HTTP_PROXY="+proxy, "HTTPS_PROXY="+proxy, "http_proxy="+proxy, "https_proxy="+proxy)
+	case "bridge":
+		hostConfig["PortBindings"] = map[string]interface{}{
+			port: []map[string]string{{"HostPort": strconv.Itoa(opts.HostPort)}},
+		}
+	default:
+		return "", fmt.Errorf("unknown network mode %q", opts.Profile.Network)
+	}
+
+	body := map[string]interface{}{
+		"Image":      opts.Image,
+		"Env":        env,
+		"Labels":     opts.Labels,
+		"HostConfig": hostConfig,
+	}
+	if opts.ContainerPort > 0 {
+		body["ExposedPorts"] = map[string]interface{}{port: struct{}{}}
+	}
+	if len(opts.Entrypoint) > 0 {
+		body["Entrypoint"] = opts.Entrypoint
+		body["Cmd"] = []string{} // not the image's arguments for its own entrypoint
+	}
+
+	var created struct {
+		ID string `json:"Id"`
+	}
+	path := "/containers/create?name=" + url.QueryEscape(opts.Name)
+	err := d.do(ctx, http.MethodPost, path, body, &created)
+	if err == ErrNotFound {
+		// The image isn't available locally yet
+		if err := d.pull(ctx, opts.Image); err != nil {
+			return "", err
+		}
+		err = d.do(ctx, http.MethodPost, path, body, &created)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to create container: %w", err)
+	}
+
+	if err := d.do(ctx, http.MethodPost, "/containers/"+created.ID+"/start", nil, nil); err != nil {
+		// Don't leave a created-but-never-started container behind
+		d.do(ctx, http.MethodDelete, "/containers/"+created.ID+"?force=true", nil, nil)
+		return "", fmt.Errorf("failed to start container: %w", err)
+	}
+
+	if opts.Profile.Network == "egress" {
+		info, err := d.Inspect(ctx, created.ID)
+		if err != nil {
+			d.Stop(ctx, created.ID)
+			return "", err
+		}
+		ip, _, _ := net.SplitHostPort(info.Address)
+		d.mu.Lock()
+		d.egress.Allow(ip, opts.Profile.EgressAllowlist)
+		d.egressIP[created.ID] = ip
+		d.mu.Unlock()
+	}
+
+	return created.ID, nil
+}
+
+// applyProfile sets the resource limits of a profile on a container's HostConfig
+func applyProfile(hostConfig map[string]interface{}, profile config.ResourceProfile) {
+	if profile.Memory > 0 {
+		hostConfig["Memory"] = profile.Memory
+		hostConfig["MemorySwap"] = profile.Memory // no swap on top of the limit
+	}
+	if profile.CPUs > 0 {
+		hostConfig["NanoCpus"] = int64(profile.CPUs * 1e9)
+	}
+	if profile.PidsLimit > 0 {
+		hostConfig["PidsLimit"] = profile.PidsLimit
+	}
+	if profile.DiskQuota > 0 {
+		hostConfig["StorageOpt"] = map[string]string{"size": strconv.FormatInt(profile.DiskQuota, 10)}
+	}
+	if profile.ReadOnlyRoot {
+		hostConfig["ReadonlyRootfs"] = true
+		hostConfig["Tmpfs"] = map[string]string{
+			"/tmp": "rw,nosuid,nodev,size=64m",
+			"/run": "rw,nosuid,nodev,size=1m",
+		}
+	}
+	if len(profile.CapDrop) > 0 {
+		hostConfig["CapDrop"] = profile.CapDrop
+	}
+	if len(profile.CapAdd) > 0 {
+		hostConfig["CapAdd"] = profile.CapAdd
+	}
+}
+
+// ensureNetwork creates an internal network (one with no route off the host)
+// if it doesn't exist yet, and remembers the academy's address on it. The
+// academy reaches containers on the network directly, so when it runs in a
+// container itself that container joins the network; otherwise it's on the
+// host, which has the network's gateway address.
+func (d *DockerRuntime) ensureNetwork(ctx context.Context, name string) (string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, ok := d.networks[name]; ok {
+		return name, nil
+	}
+
+	var network struct {
+		IPAM struct {
+			Config []struct {
+				Gateway string `json:"Gateway"`
+			} `json:"Config"`
+		} `json:"IPAM"`
+	}
+	err := d.do(ctx, http.MethodGet, "/networks/"+url.PathEscape(name), nil, &network)
+	if err == ErrNotFound {
+		err = d.do(ctx, http.MethodPost, "/networks/create", map[string]interface{}{
+			"Name":     name,
+			"Driver":   "bridge",
+			"Internal": true,
+			"Labels":   map[string]string{"academy.network": "terminal"},
+		}, nil)
+		if err == nil {
+			err = d.do(ctx, http.MethodGet, "/networks/"+url.PathEscape(name), nil, &network)
+		}
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to set up network %s: %w", name, err)
+	}
+
+	address := ""
+	if d.cfg.AcademyContainer != "" {
+		address, err = d.joinNetwork(ctx, name)
+		if err != nil {
+			return "", fmt.Errorf("failed to set up network %s: %w", name, err)
+		}
+	} else if len(network.IPAM.Config) > 0 {
+		address = network.IPAM.Config[0].Gateway
+	}
+	d.networks[name] = address
+	return name, nil
+}
+
+// joinNetwork connects the academy's own container to a network, if it isn't
+// on it yet, and returns its IP there
+func (d *DockerRuntime) joinNetwork(ctx context.Context, name string) (string, error) {
+	err := d.do(ctx, http.MethodPost, "/networks/"+url.PathEscape(name)+"/connect", map[string]interface{}{
+		"Container": d.cfg.AcademyContainer,
+	}, nil)
+	if err != nil && !strings.Contains(err.Error(), "already exists") {
+		return "", err
+	}
+
+	var academy struct {
+		NetworkSettings struct {
+			Networks map[string]struct {
+				IPAddress string `json:"IPAddress"`
+			} `json:"Networks"`
+		} `json:"NetworkSettings"`
+	}
+	if err := d.do(ctx, http.MethodGet, "/containers/"+url.PathEscape(d.cfg.AcademyContainer)+"/json", nil, &academy); err != nil {
+		return "", err
+	}
+	return academy.NetworkSettings.Networks[name].IPAddress, nil
+}
+
+// egressProxy starts the egress proxy on the academy's address on the network
+// the first time it's needed and returns its URL
+func (d *DockerRuntime) egressProxy(network string) (string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	host := d.networks[network]
+	if host == "" {
+		return "", fmt.Errorf("network %s has no address for the egress proxy", network)
+	}
+	addr := net.JoinHostPort(host, strconv.Itoa(d.cfg.EgressProxyPort))
+
+	if d.egress == nil {
+		proxy := NewEgressProxy()
+		if err := proxy.Listen(addr); err != nil {
+			return "", fmt.Errorf("failed to start egress proxy: %w", err)
+		}
+		d.egress = proxy
+	}
+	return "http://" + addr, nil
+}
+
+// Stop stops and removes a container
+func (d *DockerRuntime) Stop(ctx context.Context, id string) error {
+	d.mu.Lock()
+	if ip, ok := d.egressIP[id]; ok {
+		d.egress.Forget(ip)
+		delete(d.egressIP, id)
+	}
+	d.mu.Unlock()
+
+	err := d.do(ctx, http.MethodPost, "/containers/"+id+"/stop?t=5", nil, nil)
+	if err != nil && err != ErrNotFound {
+		return fmt.Errorf("failed to stop container: %w", err)
+	}
+
+	// Containers are started with AutoRemove, but make sure it's gone
+	err = d.do(ctx, http.MethodDelete, "/containers/"+id+"?force=true", nil, nil)
+	if err != nil && err != ErrNotFound && !strings.Contains(err.Error(), "already in progress") {
+		return fmt.Errorf("failed to remove container: %w", err)
+	}
+	return nil
+}
+
+// Inspect returns the current state of a container
+func (d *DockerRuntime) Inspect(ctx context.Context, id string) (*Info, error) {
+	var resp struct {
+		ID    string `json:"Id"`
+		Name  string `json:"Name"`
+		State struct {
+			Running   bool   `json:"Running"`
+			Status    string `json:"Status"`
+			StartedAt string `json:"StartedAt"`
+		} `json:"State"`
+		Config struct {
+			Labels       map[string]string      `json:"Labels"`
+			ExposedPorts map[string]interface{} `json:"ExposedPorts"`
+		} `json:"Config"`
+		NetworkSettings struct {
+			Networks map[string]struct {
+				IPAddress string `json:"IPAddress"`
+			} `json:"Networks"`
+		} `json:"NetworkSettings"`
+	}
+	if err := d.do(ctx, http.MethodGet, "/containers/"+id+"/json", nil, &resp); err != nil {
+		return nil, err
+	}
+
+	startedAt, _ := time.Parse(time.RFC3339Nano, resp.State.StartedAt)
+
+	// The wbfy server is reached directly on the container's address
+	address := ""
+	for _, network := range resp.NetworkSettings.Networks {
+		if network.IPAddress == "" {
+			continue
+		}
+		for port := range resp.Config.ExposedPorts {
+			address = net.JoinHostPort(network.IPAddress, strings.TrimSuffix(port, "/tcp"))
+			break
+		}
+		break
+	}
+
+	return &Info{
+		ID:        resp.ID,
+		Name:      strings.TrimPrefix(resp.Name, "/"),
+		Running:   resp.State.Running,
+		Status:    resp.State.Status,
+		StartedAt: startedAt,
+		Labels:    resp.Config.Labels,
+		Address:   address,
+	}, nil
+}
+
+// Exec runs a command inside a running container and waits for it to finish
+func (d *DockerRuntime) Exec(ctx context.Context, id string, opts ExecOptions) (*ExecResult, error) {
+	workDir := opts.WorkDir
+	if workDir == "" {
+		workDir = WorkspacePath
+	}
+
+	var created struct {
+		ID string `json:"Id"`
+	}
+	err := d.do(ctx, http.MethodPost, "/containers/"+id+"/exec", map[string]interface{}{
+		"AttachStdout": true,
+		"AttachStderr": true,
+		"Cmd":          opts.Cmd,
+		"Env":          opts.Env,
+		"WorkingDir":   workDir,
+		"User":         opts.User,
+	}, &created)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create exec: %w", err)
+	}
+
+	// Without a TTY the output comes back as a multiplexed stdout/stderr stream
+	stream, err := d.stream(ctx, http.MethodPost, "/exec/"+created.ID+"/start", map[string]interface{}{
+		"Detach": false,
+		"Tty":    false,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to start exec: %w", err)
+	}
+	defer stream.Close()
+
+	stdout, stderr := newOutputBuffer(opts.MaxOutput), newOutputBuffer(opts.MaxOutput)
+	if err := demuxStream(stream, stdout, stderr); err != nil {
+		return nil, fmt.Errorf("failed to read exec output: %w", err)
+	}
+
+	var inspect struct {
+		ExitCode int `json:"ExitCode"`
+	}
+	if err := d.do(ctx, http.MethodGet, "/exec/"+created.ID+"/json", nil, &inspect); err != nil {
+		return nil, fmt.Errorf("failed to inspect exec: %w", err)
+	}
+
+	return &ExecResult{
+		ExitCode:        inspect.ExitCode,
+		Stdout:          stdout.String(),
+		Stderr:          stderr.String(),
+		OutputTruncated: stdout.truncated || stderr.truncated,
+	}, nil
+}
+
+// Logs returns the last tail lines of a container's output
+func (d *DockerRuntime) Logs(ctx context.Context, id string, tail int) (string, error) {
+	path := fmt.Sprintf("/containers/%s/logs?stdout=1&stderr=1&tail=%d", id, tail)
+	stream, err := d.stream(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return "", err
+	}
+	defer stream.Close()
+
+	var out bytes.Buffer
+	if err := demuxStream(stream, &out, &out); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+// NeedsHostPort reports whether the profile publishes the wbfy port. Containers
+// on the internal networks are reached directly on their container address.
+func (d *DockerRuntime) NeedsHostPort(profile config.ResourceProfile) bool {
+	return profile.Network == "bridge"
+}
+
+// List returns all containers whose name starts with prefix
+func (d *DockerRuntime) List(ctx context.Context, prefix string) ([]Info, error) {
+	filters, _ := json.Marshal(map[string][]string{"name": {prefix}})
+
+	var resp []struct {
+		ID     string            `json:"Id"`
+		Names  []string          `json:"Names"`
+		State  string            `json:"State"`
+		Status string            `json:"Status"`
+		Labels map[string]string `json:"Labels"`
+	}
+	if err := d.do(ctx, http.MethodGet, "/containers/json?all=true&filters="+url.QueryEscape(string(filters)), nil, &resp); err != nil {
+		return nil, err
+	}
+
+	// The name filter matches anywhere in the name, so check the prefix ourselves
+	var containers []Info
+	for _, c := range resp {
+		for _, name := range c.Names {
+			name = strings.TrimPrefix(name, "/")
+			if !strings.HasPrefix(name, prefix) {
+				continue
+			}
+			containers = append(containers, Info{
+				ID:      c.ID,
+				Name:    name,
+				Running: c.State == "running",
+				Status:  c.Status,
+				Labels:  c.Labels,
+			})
+			break
+		}
+	}
+	return containers, nil
+}
+
+// pull downloads an image from its registry
+func (d *DockerRuntime) pull(ctx context.Context, image string) error {
+	name, tag := image, "latest"
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		name, tag = image[:i], image[i+1:]
+	}
+
+	stream, err := d.stream(ctx, http.MethodPost,
+		"/images/create?fromImage="+url.QueryEscape(name)+"&tag="+url.QueryEscape(tag), nil)
+	if err != nil {
+		return fmt.Errorf("failed to pull image %s: %w", image, err)
+	}
+	defer stream.Close()
+
+	// The pull only finishes once the progress stream is drained
+	_, err = io.Copy(io.Discard, stream)
+	return err
+}
+
+// do sends a JSON request and decodes a JSON response into out (if non-nil)
+func (d *DockerRuntime) do(ctx context.Context, method, path string, body, out interface{}) error {
+	stream, err := d.stream(ctx, method, path, body)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(stream).Decode(out)
+}
+
+// stream sends a request and returns the response body for the caller to read
+func (d *DockerRuntime) stream(ctx context.Context, method, path string, body interface{}) (io.ReadCloser, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, "http://docker"+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		resp.Body.Close()
+		return nil, ErrNotFound
+	case resp.StatusCode == http.StatusNotModified:
+		// Already in the requested state (e.g. stopping a stopped container)
+		resp.Body.Close()
+		return io.NopCloser(bytes.NewReader(nil)), nil
+	case resp.StatusCode >= 400:
+		defer resp.Body.Close()
+		var apiErr struct {
+			Message string `json:"message"`
+		}
+		json.NewDecoder(resp.Body).Decode(&apiErr)
+		return nil, fmt.Errorf("docker API %s %s: %d %s", method, path, resp.StatusCode, apiErr.Message)
+	}
+
+	return resp.Body, nil
+}
+
+// demuxStream splits Docker's multiplexed stream format into stdout and stderr.
+// Each frame has an 8 byte header: stream type, three zero bytes, and a big-endian payload size.
+func demuxStream(r io.Reader, stdout, stderr io.Writer) error {
+	header := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+
+		size := int64(binary.BigEndian.Uint32(header[4:]))
+		dst := stdout
+		if header[0] == 2 {
+			dst = stderr
+		}
+
+		if _, err := io.CopyN(dst, r, size); err != nil {
+			return err
+		}
+	}
+}
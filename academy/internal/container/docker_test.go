@@ -0,0 +1,172 @@
+package container
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/globallstudent/academy/internal/config"
+)
+
+// fakeDocker serves the parts of the Docker Engine API that setting up
+// networks uses, on a unix socket
+type fakeDocker struct {
+	mu        sync.Mutex
+	connected map[string]bool // network name -> the academy container joined it
+}
+
+func (f *fakeDocker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/networks/wbfy-isolated":
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"IPAM": map[string]interface{}{"Config": []map[string]string{{"Gateway": "172.30.0.1"}}},
+		})
+	case r.Method == http.MethodPost && r.URL.Path == "/networks/wbfy-isolated/connect":
+		var body struct{ Container string }
+		json.NewDecoder(r.Body).Decode(&body)
+		if body.Container != "academy" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if f.connected["wbfy-isolated"] {
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(map[string]string{"message": "endpoint with name academy already exists in network wbfy-isolated"})
+			return
+		}
+		f.connected["wbfy-isolated"] = true
+	case r.Method == http.MethodGet && r.URL.Path == "/containers/academy/json":
+		networks := map[string]interface{}{"academy-network": map[string]string{"IPAddress": "172.20.0.5"}}
+		if f.connected["wbfy-isolated"] {
+			networks["wbfy-isolated"] = map[string]string{"IPAddress": "172.30.0.7"}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"NetworkSettings": map[string]interface{}{"Networks": networks},
+		})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// startFakeDocker serves a fake Docker daemon and returns its socket path
+func startFakeDocker(t *testing.T, alreadyConnected bool) string {
+	t.Helper()
+	dir, err := os.MkdirTemp("", "docker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	socket := filepath.Join(dir, "docker.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &http.Server{Handler: &fakeDocker{connected: map[string]bool{"wbfy-isolated": alreadyConnected}}}
+	go server.Serve(listener)
+	t.Cleanup(func() { server.Close() })
+	return socket
+}
+
+func TestEnsureNetworkAddress(t *testing.T) {
+	tests := []struct {
+		name             string
+		academyContainer string
+		alreadyConnected bool
+		want             string
+	}{
+		{name: "academy on the host uses the gateway", want: "172.30.0.1"},
+		{name: "academy container joins the network", academyContainer: "academy", want: "172.30.0.7"},
+		{name: "academy container already on the network", academyContainer: "academy", alreadyConnected: true, want: "172.30.0.7"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewDockerRuntime(config.WBFYConfig{
+				DockerSocket:     startFakeDocker(t, tt.alreadyConnected),
+				AcademyContainer: tt.academyContainer,
+			})
+
+			network, err := d.ensureNetwork(context.Background(), "wbfy-isolated")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := d.networks[network]; got != tt.want {
+				t.Errorf("academy address on %s = %q, want %q", network, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEnsureNetworkUnknownAcademyContainer(t *testing.T) {
+	d := NewDockerRuntime(config.WBFYConfig{
+		DockerSocket:     startFakeDocker(t, false),
+		AcademyContainer: "missing",
+	})
+	if _, err := d.ensureNetwork(context.Background(), "wbfy-isolated"); err == nil {
+		t.Error("ensureNetwork succeeded without joining the network")
+	}
+}
+
+// muxFrame encodes payload as one frame of Docker's multiplexed stream
+func muxFrame(stream byte, payload string) []byte {
+	frame := make([]byte, 8, 8+len(payload))
+	frame[0] = stream
+	binary.BigEndian.PutUint32(frame[4:], uint32(len(payload)))
+	return append(frame, payload...)
+}
+
+func TestDemuxStreamOutputLimit(t *testing.T) {
+	tests := []struct {
+		name          string
+		frames        [][]byte
+		wantStdout    string
+		wantStderr    string
+		wantTruncated bool
+	}{
+		{
+			name:       "within the limit",
+			frames:     [][]byte{muxFrame(1, "12345"), muxFrame(2, "err"), muxFrame(1, "67890")},
+			wantStdout: "1234567890",
+			wantStderr: "err",
+		},
+		{
+			name:          "stdout over the limit",
+			frames:        [][]byte{muxFrame(1, "12345678"), muxFrame(2, "err"), muxFrame(1, "90abcdef")},
+			wantStdout:    "1234567890",
+			wantStderr:    "err",
+			wantTruncated: true,
+		},
+		{
+			name:          "stderr over the limit",
+			frames:        [][]byte{muxFrame(2, strings.Repeat("e", 25))},
+			wantStderr:    strings.Repeat("e", 10),
+			wantTruncated: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout, stderr := newOutputBuffer(10), newOutputBuffer(10)
+			if err := demuxStream(bytes.NewReader(bytes.Join(tt.frames, nil)), stdout, stderr); err != nil {
+				t.Fatal(err)
+			}
+			if stdout.String() != tt.wantStdout || stderr.String() != tt.wantStderr {
+				t.Errorf("stdout %q, stderr %q; want %q, %q", stdout, stderr, tt.wantStdout, tt.wantStderr)
+			}
+			if truncated := stdout.truncated || stderr.truncated; truncated != tt.wantTruncated {
+				t.Errorf("truncated = %v, want %v", truncated, tt.wantTruncated)
+			}
+		})
+	}
+}
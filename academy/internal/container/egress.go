@@ -0,0 +1,148 @@
+package container
+
+import (
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EgressProxy is an HTTP proxy for containers on the egress network. The
+// network is internal, so the proxy is the only way out, and each container
+// may only reach the hosts on its own allowlist. Containers are told apart by
+// their address on the network.
+type EgressProxy struct {
+	mu        sync.RWMutex
+	allowlist map[string][]string // container IP -> allowed hosts
+	server    *http.Server
+}
+
+// NewEgressProxy creates a proxy with no registered containers
+func NewEgressProxy() *EgressProxy {
+	return &EgressProxy{
+		allowlist: make(map[string][]string),
+	}
+}
+
+// Listen starts serving on addr in the background
+func (p *EgressProxy) Listen(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	p.server = &http.Server{
+		Handler:           p,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		if err := p.server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			log.Printf("Egress proxy stopped: %v", err)
+		}
+	}()
+	return nil
+}
+
+// Allow lets the container at ip reach the given hosts
+func (p *EgressProxy) Allow(ip string, hosts []string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.allowlist[ip] = hosts
+}
+
+// Forget removes a container's allowlist
+func (p *EgressProxy) Forget(ip string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.allowlist, ip)
+}
+
+// allowed reports whether the container at ip may connect to host
+func (p *EgressProxy) allowed(ip, host string) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	host = strings.ToLower(host)
+	for _, entry := range p.allowlist[ip] {
+		entry = strings.ToLower(entry)
+		if host == entry || (strings.HasPrefix(entry, ".") && strings.HasSuffix(host, entry)) {
+			return true
+		}
+	}
+	return false
+}
+
+// ServeHTTP handles CONNECT tunnels (HTTPS) and plain HTTP requests
+func (p *EgressProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ip, _, _ := net.SplitHostPort(r.RemoteAddr)
+
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if !p.allowed(ip, host) {
+		log.Printf("Egress proxy denied %s -> %s", ip, r.Host)
+		http.Error(w, "Host not on this session's allowlist", http.StatusForbidden)
+		return
+	}
+
+	if r.Method == http.MethodConnect {
+		p.tunnel(w, r)
+		return
+	}
+
+	if r.URL.Host == "" {
+		http.Error(w, "Not a proxy request", http.StatusBadRequest)
+		return
+	}
+
+	r.RequestURI = ""
+	r.Header.Del("Proxy-Connection")
+	r.Header.Del("Proxy-Authorization")
+	resp, err := http.DefaultTransport.RoundTrip(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+
+	for k, values := range resp.Header {
+		for _, v := range values {
+			w.Header().Add(k, v)
+		}
+	}
+	w.WriteHeader(resp.StatusCode)
+	io.Copy(w, resp.Body)
+}
+
+// tunnel connects the client to the requested host and copies bytes both ways
+func (p *EgressProxy) tunnel(w http.ResponseWriter, r *http.Request) {
+	upstream, err := net.DialTimeout("tcp", r.Host, 10*time.Second)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		upstream.Close()
+		http.Error(w, "Tunneling not supported", http.StatusInternalServerError)
+		return
+	}
+	client, _, err := hijacker.Hijack()
+	if err != nil {
+		upstream.Close()
+		return
+	}
+	client.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n"))
+
+	go func() {
+		io.Copy(upstream, client)
+		upstream.Close()
+	}()
+	io.Copy(client, upstream)
+	client.Close()
+}
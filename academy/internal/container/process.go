@@ -0,0 +1,299 @@
+package container
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/globallstudent/academy/internal/config"
+)
+
+// maxProcessLogBytes bounds the output kept for Logs per process
+const maxProcessLogBytes = 64 * 1024
+
+// ProcessRuntime runs the wbfy binary as a plain local process instead of a container.
+// It's meant for development and CI machines without Docker: there is no isolation,
+// and the workspace is used directly as the working directory.
+type ProcessRuntime struct {
+	binaryPath string
+
+	mu        sync.Mutex
+	processes map[string]*process
+}
+
+// process is a wbfy server started by the ProcessRuntime
+type process struct {
+	name      string
+	cmd       *exec.Cmd
+	labels    map[string]string
+	workspace string
+	address   string
+	startedAt time.Time
+	logs      *logBuffer
+	done      chan struct{}
+	exitErr   error
+}
+
+// NewProcessRuntime creates a runtime that starts the wbfy binary at binaryPath
+func NewProcessRuntime(binaryPath string) *ProcessRuntime {
+	return &ProcessRuntime{
+		binaryPath: binaryPath,
+		processes:  make(map[string]*process),
+	}
+}
+
+// Start launches wbfy serving the command from the WBFY_CMD environment
+// variable, or the entrypoint in the workspace if one is given
+func (p *ProcessRuntime) Start(ctx context.Context, opts StartOptions) (string, error) {
+	cmd, err := p.command(opts)
+	if err != nil {
+		return "", err
+	}
+	cmd.Env = os.Environ()
+	for k, v := range opts.Env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+	cmd.Env = append(cmd.Env,
+		"PORT="+strconv.Itoa(opts.HostPort),
+		"WBFY_WORKDIR="+opts.Workspace,
+		"WBFY_NO_BROWSER=1",
+	)
+	// Put wbfy and the shell it spawns in their own process group so Stop can kill both
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+	logs := &logBuffer{}
+	cmd.Stdout = logs
+	cmd.Stderr = logs
+
+	if err := cmd.Start(); err != nil {
+		return "", fmt.Errorf("failed to start %s: %w", filepath.Base(cmd.Path), err)
+	}
+
+	proc := &process{
+		name:      opts.Name,
+		cmd:       cmd,
+		labels:    opts.Labels,
+		workspace: opts.Workspace,
+		address:   "127.0.0.1:" + strconv.Itoa(opts.HostPort),
+		startedAt: time.Now(),
+		logs:      logs,
+		done:      make(chan struct{}),
+	}
+	go func() {
+		proc.exitErr = cmd.Wait()
+		close(proc.done)
+	}()
+
+	id := opts.Name
+	if id == "" {
+		id = strconv.Itoa(cmd.Process.Pid)
+	}
+
+	p.mu.Lock()
+	p.processes[id] = proc
+	p.mu.Unlock()
+
+	return id, nil
+}
+
+// command returns the process to start for opts
+func (p *ProcessRuntime) command(opts StartOptions) (*exec.Cmd, error) {
+	if len(opts.Entrypoint) > 0 {
+		cmd := exec.Command(opts.Entrypoint[0], opts.Entrypoint[1:]...)
+		cmd.Dir = opts.Workspace
+		return cmd, nil
+	}
+
+	binary, err := filepath.Abs(p.binaryPath)
+	if err != nil {
+		return nil, err
+	}
+
+	command := strings.Fields(opts.Env["WBFY_CMD"])
+	if len(command) == 0 {
+		command = []string{"bash"}
+	}
+
+	cmd := exec.Command(binary, command...)
+	// wbfy serves its web assets relative to its own directory
+	cmd.Dir = filepath.Dir(binary)
+	return cmd, nil
+}
+
+// Stop terminates the process group, killing it if it doesn't exit in time
+func (p *ProcessRuntime) Stop(ctx context.Context, id string) error {
+	p.mu.Lock()
+	proc, exists := p.processes[id]
+	delete(p.processes, id)
+	p.mu.Unlock()
+	if !exists {
+		return nil
+	}
+
+	pgid := -proc.cmd.Process.Pid
+	syscall.Kill(pgid, syscall.SIGTERM)
+
+	select {
+	case <-proc.done:
+	case <-time.After(5 * time.Second):
+		syscall.Kill(pgid, syscall.SIGKILL)
+		<-proc.done
+	case <-ctx.Done():
+		syscall.Kill(pgid, syscall.SIGKILL)
+		return ctx.Err()
+	}
+	return nil
+}
+
+// Inspect returns the state of a process
+func (p *ProcessRuntime) Inspect(ctx context.Context, id string) (*Info, error) {
+	proc, err := p.get(id)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &Info{
+		ID:        id,
+		Name:      proc.name,
+		Running:   true,
+		Status:    "running",
+		StartedAt: proc.startedAt,
+		Labels:    proc.labels,
+		Address:   proc.address,
+	}
+
+	select {
+	case <-proc.done:
+		info.Running = false
+		info.Status = "exited"
+	default:
+	}
+	return info, nil
+}
+
+// Exec runs a command on the host with the workspace as its working directory.
+// Paths under WorkspacePath in WorkDir are mapped onto the host workspace.
+func (p *ProcessRuntime) Exec(ctx context.Context, id string, opts ExecOptions) (*ExecResult, error) {
+	proc, err := p.get(id)
+	if err != nil {
+		return nil, err
+	}
+	if len(opts.Cmd) == 0 {
+		return nil, errors.New("no command given")
+	}
+
+	dir := proc.workspace
+	if rel, err := filepath.Rel(WorkspacePath, opts.WorkDir); opts.WorkDir != "" && err == nil && !strings.HasPrefix(rel, "..") {
+		dir = filepath.Join(proc.workspace, rel)
+	}
+
+	cmd := exec.CommandContext(ctx, opts.Cmd[0], opts.Cmd[1:]...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), opts.Env...)
+
+	stdout, stderr := newOutputBuffer(opts.MaxOutput), newOutputBuffer(opts.MaxOutput)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	result := &ExecResult{}
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			return nil, err
+		}
+		result.ExitCode = exitErr.ExitCode()
+		// Report a command killed by a signal the way a shell and Docker do
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+			result.ExitCode = 128 + int(status.Signal())
+		}
+	}
+	result.Stdout = stdout.String()
+	result.Stderr = stderr.String()
+	result.OutputTruncated = stdout.truncated || stderr.truncated
+	return result, nil
+}
+
+// Logs returns the last tail lines of the process output
+func (p *ProcessRuntime) Logs(ctx context.Context, id string, tail int) (string, error) {
+	proc, err := p.get(id)
+	if err != nil {
+		return "", err
+	}
+
+	lines := strings.SplitAfter(proc.logs.String(), "\n")
+	if tail > 0 && len(lines) > tail {
+		lines = lines[len(lines)-tail:]
+	}
+	return strings.Join(lines, ""), nil
+}
+
+// NeedsHostPort is always true: wbfy processes listen on a host port
+func (p *ProcessRuntime) NeedsHostPort(config.ResourceProfile) bool {
+	return true
+}
+
+// List returns the tracked processes whose name starts with prefix. Processes
+// started before a restart are not tracked and can't be found again.
+func (p *ProcessRuntime) List(ctx context.Context, prefix string) ([]Info, error) {
+	p.mu.Lock()
+	var ids []string
+	for id, proc := range p.processes {
+		if strings.HasPrefix(proc.name, prefix) {
+			ids = append(ids, id)
+		}
+	}
+	p.mu.Unlock()
+
+	var processes []Info
+	for _, id := range ids {
+		if info, err := p.Inspect(ctx, id); err == nil {
+			processes = append(processes, *info)
+		}
+	}
+	return processes, nil
+}
+
+// get looks up a tracked process
+func (p *ProcessRuntime) get(id string) (*process, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	proc, exists := p.processes[id]
+	if !exists {
+		return nil, ErrNotFound
+	}
+	return proc, nil
+}
+
+// logBuffer keeps the most recent output of a process
+type logBuffer struct {
+	mu  sync.Mutex
+	buf []byte
+}
+
+// Write appends output, discarding the oldest bytes beyond maxProcessLogBytes
+func (l *logBuffer) Write(b []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.buf = append(l.buf, b...)
+	if over := len(l.buf) - maxProcessLogBytes; over > 0 {
+		l.buf = append(l.buf[:0:0], l.buf[over:]...)
+	}
+	return len(b), nil
+}
+
+// String returns the buffered output
+func (l *logBuffer) String() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return string(l.buf)
+}
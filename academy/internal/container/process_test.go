@@ -0,0 +1,33 @@
+package container
+
+import (
+	"context"
+	"testing"
+)
+
+func TestProcessExecOutputLimit(t *testing.T) {
+	p := NewProcessRuntime("/nonexistent/wbfy")
+	id, err := p.Start(context.Background(), StartOptions{
+		Name:       "wbfy-test-exec",
+		Workspace:  t.TempDir(),
+		Entrypoint: []string{"sleep", "infinity"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Stop(context.Background(), id)
+
+	result, err := p.Exec(context.Background(), id, ExecOptions{
+		Cmd:       []string{"sh", "-c", "head -c 100000 /dev/zero; echo done >&2"},
+		MaxOutput: 1000,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Stdout) != 1000 || !result.OutputTruncated || result.ExitCode != 0 {
+		t.Errorf("kept %d bytes, truncated %v, exit %d; want 1000, true, 0", len(result.Stdout), result.OutputTruncated, result.ExitCode)
+	}
+	if result.Stderr != "done\n" {
+		t.Errorf("stderr = %q", result.Stderr)
+	}
+}
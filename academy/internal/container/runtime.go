@@ -0,0 +1,127 @@
+package container
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/globallstudent/academy/internal/config"
+)
+
+// ErrNotFound is returned when a container does not exist
+var ErrNotFound = errors.New("container not found")
+
+// WorkspacePath is where the session workspace is mounted inside a container
+const WorkspacePath = "/workspace"
+
+// Runtime starts and manages the isolated environments terminal sessions run in
+type Runtime interface {
+	// Start creates and starts a container, returning its ID
+	Start(ctx context.Context, opts StartOptions) (string, error)
+	// Stop stops and removes a container; stopping a missing container is not an error
+	Stop(ctx context.Context, id string) error
+	// Inspect returns the current state of a container
+	Inspect(ctx context.Context, id string) (*Info, error)
+	// Exec runs a command inside a running container and waits for it to finish
+	Exec(ctx context.Context, id string, opts ExecOptions) (*ExecResult, error)
+	// Logs returns the last tail lines of a container's output
+	Logs(ctx context.Context, id string, tail int) (string, error)
+	// List returns all containers, running or not, whose name starts with prefix
+	List(ctx context.Context, prefix string) ([]Info, error)
+	// NeedsHostPort reports whether a container with the given profile is
+	// reached through a published host port, so StartOptions.HostPort must be set
+	NeedsHostPort(profile config.ResourceProfile) bool
+}
+
+// StartOptions describes the container to start
+type StartOptions struct {
+	Name          string
+	Image         string
+	Env           map[string]string
+	Labels        map[string]string
+	Workspace     string // Host directory mounted at WorkspacePath
+	HostPort      int    // Host port published for the wbfy server, when NeedsHostPort says so
+	ContainerPort int    // Port the wbfy server listens on inside the container
+	Profile       config.ResourceProfile
+	// Entrypoint, when set, runs instead of the wbfy server. Containers that
+	// are only used through Exec keep running with e.g. sleep infinity.
+	Entrypoint []string
+}
+
+// Info describes the state of a container
+type Info struct {
+	ID        string
+	Name      string
+	Running   bool
+	Status    string
+	StartedAt time.Time
+	Labels    map[string]string
+	Address   string // host:port the wbfy server is reachable on from this machine
+}
+
+// DefaultMaxOutput is how much of each of stdout and stderr Exec keeps by default
+const DefaultMaxOutput = 4 << 20 // 4 MiB
+
+// ExecOptions describes a command to run inside a container
+type ExecOptions struct {
+	Cmd       []string
+	Env       []string
+	WorkDir   string // Defaults to WorkspacePath
+	User      string
+	MaxOutput int64 // Bytes of stdout, and of stderr, kept; DefaultMaxOutput when 0
+}
+
+// ExecResult holds the outcome of a command run inside a container
+type ExecResult struct {
+	ExitCode        int
+	Stdout          string
+	Stderr          string
+	OutputTruncated bool // The command wrote more than MaxOutput to stdout or stderr
+}
+
+// outputBuffer keeps the first limit bytes of a command's output. The rest is
+// read and discarded, so the command isn't blocked on a full pipe.
+type outputBuffer struct {
+	buf       bytes.Buffer
+	limit     int64
+	truncated bool
+}
+
+func newOutputBuffer(limit int64) *outputBuffer {
+	if limit <= 0 {
+		limit = DefaultMaxOutput
+	}
+	return &outputBuffer{limit: limit}
+}
+
+// Write keeps what still fits under the limit
+func (o *outputBuffer) Write(b []byte) (int, error) {
+	if room := o.limit - int64(o.buf.Len()); int64(len(b)) > room {
+		o.buf.Write(b[:room])
+		o.truncated = true
+	} else {
+		o.buf.Write(b)
+	}
+	return len(b), nil
+}
+
+// String returns the output kept
+func (o *outputBuffer) String() string {
+	return o.buf.String()
+}
+
+// New returns the runtime selected in the WBFY configuration
+func New(cfg config.WBFYConfig) (Runtime, error) {
+	switch cfg.Runtime {
+	case "", "docker":
+		return NewDockerRuntime(cfg), nil
+	case "process":
+		log.Printf("Terminal sessions run as local processes; resource profiles are not enforced")
+		return NewProcessRuntime(cfg.BinaryPath), nil
+	default:
+		return nil, fmt.Errorf("unknown terminal runtime %q", cfg.Runtime)
+	}
+}
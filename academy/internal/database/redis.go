@@ -2,6 +2,8 @@ package database
 
 import (
 	"context"
+	"crypto/subtle"
+	"errors"
 	"fmt"
 	"log"
 	"time"
@@ -38,42 +40,77 @@ func (r *Redis) Close() {
 	}
 }
 
-// StoreOTP stores a one-time password with expiration
-func (r *Redis) StoreOTP(phoneNumber string, otp string, expiry time.Duration) error {
-	ctx := context.Background()
-	key := fmt.Sprintf("otp:%s", phoneNumber)
-	return r.Client.Set(ctx, key, otp, expiry).Err()
+// ErrTooManyOTPAttempts is returned by VerifyOTP once a code has been guessed
+// at too often. The code is discarded, and a new one must be requested.
+var ErrTooManyOTPAttempts = errors.New("too many attempts for this code")
+
+// verifyOTPScript counts an attempt against a stored OTP and returns its hash
+// and the number of attempts so far, or nil if there is no OTP
+var verifyOTPScript = redis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 0 then
+	return false
+end
+local attempts = redis.call("HINCRBY", KEYS[1], "attempts", 1)
+return {redis.call("HGET", KEYS[1], "hash"), attempts}
+`)
+
+// otpKey is where the OTP for a phone number is kept
+func otpKey(phoneNumber string) string {
+	return fmt.Sprintf("otp:%s", phoneNumber)
 }
 
-// VerifyOTP checks if an OTP is valid and deletes it if it is
-func (r *Redis) VerifyOTP(phoneNumber string, otp string) (bool, error) {
+// StoreOTP stores the hash of a one-time password with expiration, replacing
+// any earlier one for the phone number and its attempt count
+func (r *Redis) StoreOTP(phoneNumber string, otpHash string, expiry time.Duration) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	key := fmt.Sprintf("otp:%s", phoneNumber)
+	key := otpKey(phoneNumber)
+	_, err := r.Client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, key)
+		pipe.HSet(ctx, key, "hash", otpHash, "attempts", 0)
+		pipe.Expire(ctx, key, expiry)
+		return nil
+	})
+	return err
+}
 
-	// Get the stored OTP with timeout
-	storedOTP, err := r.Client.Get(ctx, key).Result()
+// VerifyOTP checks an OTP hash against the stored one and deletes the OTP if
+// it matches, so it can only be used once. Every check counts as an attempt;
+// after maxAttempts the OTP is deleted and ErrTooManyOTPAttempts returned.
+func (r *Redis) VerifyOTP(phoneNumber string, otpHash string, maxAttempts int) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	key := otpKey(phoneNumber)
+	result, err := verifyOTPScript.Run(ctx, r.Client, []string{key}).Slice()
 	if err == redis.Nil {
 		return false, nil // OTP not found
 	} else if err != nil {
 		return false, fmt.Errorf("redis error retrieving OTP: %w", err)
 	}
+	if len(result) != 2 {
+		return false, fmt.Errorf("unexpected OTP record for %s", phoneNumber)
+	}
+	storedHash, _ := result[0].(string)
+	attempts, _ := result[1].(int64)
 
-	// Check if the OTP matches
-	if storedOTP == otp {
-		// Delete the OTP to prevent reuse - use a new context in case the previous one timed out
-		delCtx, delCancel := context.WithTimeout(context.Background(), 3*time.Second)
-		defer delCancel()
-
-		if err := r.Client.Del(delCtx, key).Err(); err != nil {
-			// Log but don't fail if deletion has an issue - the OTP is still valid
-			// and we've successfully authenticated the user
-			log.Printf("Warning: Failed to delete used OTP for %s: %v", phoneNumber, err)
-			return true, nil
+	if attempts > int64(maxAttempts) {
+		if err := r.Client.Del(ctx, key).Err(); err != nil {
+			log.Printf("Warning: Failed to delete exhausted OTP for %s: %v", phoneNumber, err)
 		}
-		return true, nil
+		return false, ErrTooManyOTPAttempts
 	}
 
-	return false, nil
+	if storedHash == "" || subtle.ConstantTimeCompare([]byte(storedHash), []byte(otpHash)) != 1 {
+		return false, nil
+	}
+
+	// Delete the OTP to prevent reuse. Only the request that deletes it wins,
+	// so the same code can't log in twice concurrently.
+	deleted, err := r.Client.Del(ctx, key).Result()
+	if err != nil {
+		return false, fmt.Errorf("redis error deleting used OTP: %w", err)
+	}
+	return deleted == 1, nil
 }
@@ -0,0 +1,40 @@
+package database
+
+import (
+	"context"
+
+	"github.com/globallstudent/academy/internal/models"
+	"github.com/jackc/pgx/v5"
+)
+
+// UserColumns are the columns scanned by ScanUser
+const UserColumns = `id, phone_number, COALESCE(telegram_id, ''), COALESCE(email, ''), username, registered_at, role`
+
+// ScanUser reads a user selected with UserColumns
+func ScanUser(row pgx.Row) (models.User, error) {
+	var user models.User
+	err := row.Scan(&user.ID, &user.PhoneNumber, &user.TelegramID, &user.Email, &user.Username, &user.RegisteredAt, &user.Role)
+	return user, err
+}
+
+// DefaultUsername is the name a new account gets: "Student" followed by the
+// last four digits of its phone number
+func DefaultUsername(phoneNumber string) string {
+	username := "Student"
+	if len(phoneNumber) > 4 {
+		username += phoneNumber[len(phoneNumber)-4:]
+	}
+	return username
+}
+
+// UpsertUserByPhone returns the account for a phone number, creating it if
+// the phone number hasn't been seen before. A non-empty telegramID links the
+// account to that Telegram user; an empty one leaves any link alone.
+func (db *DB) UpsertUserByPhone(ctx context.Context, phoneNumber, telegramID string) (models.User, error) {
+	// The update always touches the row, so RETURNING yields the existing account on conflict
+	return ScanUser(db.Pool.QueryRow(ctx, `
+		INSERT INTO users (phone_number, telegram_id, username)
+		VALUES ($1, NULLIF($2, ''), $3)
+		ON CONFLICT (phone_number) DO UPDATE SET telegram_id = COALESCE(EXCLUDED.telegram_id, users.telegram_id)
+		RETURNING `+UserColumns, phoneNumber, telegramID, DefaultUsername(phoneNumber)))
+}
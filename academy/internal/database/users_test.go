@@ -0,0 +1,21 @@
+package database
+
+import "testing"
+
+func TestDefaultUsername(t *testing.T) {
+	tests := []struct {
+		phoneNumber string
+		want        string
+	}{
+		{phoneNumber: "+998901234567", want: "Student4567"},
+		{phoneNumber: "12345", want: "Student2345"},
+		{phoneNumber: "1234", want: "Student"},
+		{phoneNumber: "", want: "Student"},
+	}
+
+	for _, tt := range tests {
+		if got := DefaultUsername(tt.phoneNumber); got != tt.want {
+			t.Errorf("DefaultUsername(%q) = %q, want %q", tt.phoneNumber, got, tt.want)
+		}
+	}
+}
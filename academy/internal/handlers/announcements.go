@@ -0,0 +1,244 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/globallstudent/academy/internal/announcements"
+	"github.com/globallstudent/academy/internal/config"
+	"github.com/globallstudent/academy/internal/database"
+	"github.com/google/uuid"
+)
+
+// announcementListSize is how many announcements the admin page lists
+const announcementListSize = 50
+
+// announcementNotices are the messages shown after an action redirects back
+// to the admin page
+var announcementNotices = map[string]string{
+	"published": "Announcement published.",
+	"discarded": "Draft discarded.",
+	"retracted": "Announcement taken out of the banner.",
+	"stale":     "That announcement was already published or removed.",
+}
+
+// AnnouncementHandlers contains handlers for announcements
+type AnnouncementHandlers struct {
+	db       *database.DB
+	cfg      *config.Config
+	notifier Notifier
+}
+
+// NewAnnouncementHandlers creates a new AnnouncementHandlers instance
+func NewAnnouncementHandlers(db *database.DB, cfg *config.Config, notifier Notifier) *AnnouncementHandlers {
+	return &AnnouncementHandlers{db: db, cfg: cfg, notifier: notifier}
+}
+
+// AdminAnnouncements godoc
+// @Summary      Manage announcements
+// @Description  Lists announcements with a form for a new one. With preview, shows a draft with its audience for confirmation.
+// @Tags         admin
+// @Produce      html
+// @Security     JWTCookie
+// @Param        preview  query  string  false  "ID of a draft to preview"
+// @Success      200  {object}  nil  "Announcements page"
+// @Failure      401  {object}  nil  "Unauthorized"
+// @Failure      403  {object}  nil  "Forbidden"
+// @Router       /admin/announcements [get]
+func (h *AnnouncementHandlers) AdminAnnouncements(c *gin.Context) {
+	data := gin.H{"Notice": announcementNotices[c.Query("notice")]}
+	if id, err := uuid.Parse(c.Query("preview")); err == nil {
+		ctx := c.Request.Context()
+		draft, found, err := announcements.Get(ctx, h.db, id)
+		if err != nil {
+			log.Printf("Failed to get announcement %s: %v", id, err)
+			data["Error"] = "Failed to load the draft"
+		} else if found && draft.IsDraft() {
+			data["Preview"] = draft
+			if draft.Telegram {
+				recipients, err := announcements.TelegramIDs(ctx, h.db, draft.ContestID)
+				if err != nil {
+					log.Printf("Failed to count recipients of announcement %s: %v", id, err)
+				}
+				data["Recipients"] = len(recipients)
+			}
+		}
+	}
+	h.renderAdmin(c, http.StatusOK, data)
+}
+
+// CreateAnnouncement godoc
+// @Summary      Draft an announcement
+// @Description  Stores a draft announcement and redirects to its preview, where it's confirmed
+// @Tags         admin
+// @Accept       x-www-form-urlencoded
+// @Produce      html
+// @Security     JWTCookie
+// @Param        message   formData  string  true   "Announcement text"
+// @Param        contest   formData  string  false  "Slug of the contest whose participants it's for; everyone if empty"
+// @Param        telegram  formData  string  false  "Also broadcast on Telegram when set"
+// @Success      303  {object}  nil  "Redirect to the preview"
+// @Failure      400  {object}  nil  "Invalid announcement"
+// @Router       /admin/announcements [post]
+func (h *AnnouncementHandlers) CreateAnnouncement(c *gin.Context) {
+	adminID, ok := currentUserID(c)
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	message := strings.TrimSpace(c.PostForm("message"))
+	var contestID *uuid.UUID
+	if slug := strings.TrimSpace(c.PostForm("contest")); slug != "" {
+		contest, found, err := announcements.FindContest(ctx, h.db, slug)
+		if err != nil {
+			log.Printf("Failed to look up contest %q: %v", slug, err)
+			h.renderAdmin(c, http.StatusInternalServerError, gin.H{"Error": "Failed to look up the contest", "Message": message})
+			return
+		}
+		if !found {
+			h.renderAdmin(c, http.StatusBadRequest, gin.H{"Error": fmt.Sprintf("There is no contest %q", slug), "Message": message})
+			return
+		}
+		contestID = &contest.ID
+	}
+
+	draft, err := announcements.CreateDraft(ctx, h.db, message, contestID, c.PostForm("telegram") != "", adminID)
+	switch {
+	case errors.Is(err, announcements.ErrEmpty):
+		h.renderAdmin(c, http.StatusBadRequest, gin.H{"Error": "The announcement is empty"})
+		return
+	case errors.Is(err, announcements.ErrTooLong):
+		h.renderAdmin(c, http.StatusBadRequest, gin.H{
+			"Error":   fmt.Sprintf("The announcement is longer than %d characters", announcements.MaxLength),
+			"Message": message,
+		})
+		return
+	case err != nil:
+		log.Printf("Failed to store announcement: %v", err)
+		h.renderAdmin(c, http.StatusInternalServerError, gin.H{"Error": "Failed to store the announcement", "Message": message})
+		return
+	}
+	c.Redirect(http.StatusSeeOther, "/admin/announcements?preview="+draft.ID.String())
+}
+
+// PublishAnnouncement godoc
+// @Summary      Publish an announcement
+// @Description  Confirms a draft: it's shown in the site banner and, if chosen, broadcast on Telegram
+// @Tags         admin
+// @Produce      html
+// @Security     JWTCookie
+// @Param        id  path  string  true  "Announcement ID"
+// @Success      303  {object}  nil  "Redirect to the announcements page"
+// @Router       /admin/announcements/{id}/publish [post]
+func (h *AnnouncementHandlers) PublishAnnouncement(c *gin.Context) {
+	h.announcementAction(c, func(id uuid.UUID) (string, error) {
+		announcement, published, err := announcements.Publish(c.Request.Context(), h.db, id)
+		if err != nil || !published {
+			return "stale", err
+		}
+		log.Printf("Announcement %s published for %s", id, announcement.Audience())
+		if announcement.Telegram {
+			h.notifier.Announce(announcement)
+		}
+		return "published", nil
+	})
+}
+
+// DiscardAnnouncement godoc
+// @Summary      Discard a draft announcement
+// @Tags         admin
+// @Produce      html
+// @Security     JWTCookie
+// @Param        id  path  string  true  "Announcement ID"
+// @Success      303  {object}  nil  "Redirect to the announcements page"
+// @Router       /admin/announcements/{id}/discard [post]
+func (h *AnnouncementHandlers) DiscardAnnouncement(c *gin.Context) {
+	h.announcementAction(c, func(id uuid.UUID) (string, error) {
+		discarded, err := announcements.Discard(c.Request.Context(), h.db, id)
+		if err != nil || !discarded {
+			return "stale", err
+		}
+		return "discarded", nil
+	})
+}
+
+// RetractAnnouncement godoc
+// @Summary      Take an announcement out of the banner
+// @Description  Telegram messages already sent stay sent
+// @Tags         admin
+// @Produce      html
+// @Security     JWTCookie
+// @Param        id  path  string  true  "Announcement ID"
+// @Success      303  {object}  nil  "Redirect to the announcements page"
+// @Router       /admin/announcements/{id}/retract [post]
+func (h *AnnouncementHandlers) RetractAnnouncement(c *gin.Context) {
+	h.announcementAction(c, func(id uuid.UUID) (string, error) {
+		retracted, err := announcements.Retract(c.Request.Context(), h.db, id)
+		if err != nil || !retracted {
+			return "stale", err
+		}
+		return "retracted", nil
+	})
+}
+
+// AnnouncementBanner godoc
+// @Summary      Site banner
+// @Description  HTML fragment with the current announcements, loaded into every page by the main layout
+// @Tags         announcements
+// @Produce      html
+// @Success      200  {object}  nil  "Banner fragment, empty if there are no announcements"
+// @Router       /announcements/banner [get]
+func (h *AnnouncementHandlers) AnnouncementBanner(c *gin.Context) {
+	active, err := announcements.Active(c.Request.Context(), h.db, time.Now())
+	if err != nil {
+		log.Printf("Failed to get announcements for the banner: %v", err)
+	}
+	c.HTML(http.StatusOK, "partials/announcement_banner.html", gin.H{"Announcements": active})
+}
+
+// announcementAction runs an action on the announcement in the path and
+// redirects back to the admin page with the notice it returns
+func (h *AnnouncementHandlers) announcementAction(c *gin.Context, action func(id uuid.UUID) (string, error)) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		h.renderAdmin(c, http.StatusBadRequest, gin.H{"Error": "Invalid announcement ID"})
+		return
+	}
+	notice, err := action(id)
+	if err != nil {
+		log.Printf("Failed to update announcement %s: %v", id, err)
+		h.renderAdmin(c, http.StatusInternalServerError, gin.H{"Error": "Failed to update the announcement"})
+		return
+	}
+	c.Redirect(http.StatusSeeOther, "/admin/announcements?notice="+notice)
+}
+
+// renderAdmin renders the admin page with the announcements and contests,
+// plus data for the request
+func (h *AnnouncementHandlers) renderAdmin(c *gin.Context, status int, data gin.H) {
+	ctx := c.Request.Context()
+	list, err := announcements.List(ctx, h.db, announcementListSize)
+	if err != nil {
+		log.Printf("Failed to list announcements: %v", err)
+		if data["Error"] == nil {
+			data["Error"] = "Failed to load announcements"
+		}
+	}
+	contests, err := announcements.Contests(ctx, h.db)
+	if err != nil {
+		log.Printf("Failed to list contests: %v", err)
+	}
+
+	data["Title"] = "Announcements - Admin - Summer Academy"
+	data["Announcements"] = list
+	data["Contests"] = contests
+	data["MaxLength"] = announcements.MaxLength
+	c.HTML(status, "pages/admin_announcements.html", data)
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/globallstudent/academy/internal/config"
 	"github.com/globallstudent/academy/internal/database"
 	"github.com/globallstudent/academy/internal/models"
+	"github.com/globallstudent/academy/internal/rbac"
 	"github.com/google/uuid"
 )
 
@@ -161,8 +162,8 @@ func (h *ContestHandlers) ContestDetail(c *gin.Context) {
 		// Log error but don't fail the request
 	}
 
-	// Check if user is admin
-	isAdmin := user.(models.User).Role == "admin"
+	// Contest managers get a link to manage it
+	isAdmin := rbac.Can(user.(models.User).Role, rbac.ManageContests)
 
 	c.HTML(http.StatusOK, "main", gin.H{
 		"Title":              contest.Title + " - Summer Academy",
@@ -1,4 +1,46 @@
 package handlers
 
-// ExportedStoreDevelopmentOTP is exported to allow the telegram bot to store OTPs in development mode
-var ExportedStoreDevelopmentOTP func(string, string)
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/globallstudent/academy/internal/models"
+	"github.com/globallstudent/academy/internal/rbac"
+	"github.com/google/uuid"
+)
+
+// currentUserID returns the authenticated user's ID from the context.
+// The auth middleware stores it as a string, but some callers set a uuid.UUID directly.
+func currentUserID(c *gin.Context) (uuid.UUID, bool) {
+	value, exists := c.Get("userID")
+	if !exists {
+		return uuid.Nil, false
+	}
+
+	switch id := value.(type) {
+	case uuid.UUID:
+		return id, true
+	case string:
+		parsed, err := uuid.Parse(id)
+		if err != nil {
+			return uuid.Nil, false
+		}
+		return parsed, true
+	default:
+		return uuid.Nil, false
+	}
+}
+
+// currentUser returns the authenticated user from the context
+func currentUser(c *gin.Context) (models.User, bool) {
+	value, exists := c.Get("user")
+	if !exists {
+		return models.User{}, false
+	}
+	user, ok := value.(models.User)
+	return user, ok
+}
+
+// can reports whether the authenticated user's role has a permission
+func can(c *gin.Context, permission rbac.Permission) bool {
+	user, ok := currentUser(c)
+	return ok && rbac.Can(user.Role, permission)
+}
@@ -0,0 +1,248 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/globallstudent/academy/internal/config"
+	"github.com/globallstudent/academy/internal/container"
+	"github.com/globallstudent/academy/internal/models"
+	"github.com/globallstudent/academy/internal/problems"
+	"github.com/google/uuid"
+)
+
+const (
+	// judgeCompileTimeout bounds compiling a submission
+	judgeCompileTimeout = 60 * time.Second
+	// judgeTestTimeout bounds running a submission against one test case
+	judgeTestTimeout = 5 * time.Second
+	// judgeExecGrace is how much longer than a command's own time limit the
+	// judge waits for the container to report back before giving up on it
+	judgeExecGrace = 5 * time.Second
+	// judgeMaxOutput is how much of a program's output is kept in a test result
+	judgeMaxOutput = 2000
+)
+
+// judgeLanguage says how to build and run a submission in a language. Both
+// commands run from the workspace, where the program's entry point is main
+// plus the language's extension.
+type judgeLanguage struct {
+	compile string
+	run     string
+}
+
+var judgeLanguages = map[string]judgeLanguage{
+	"python":     {run: "python3 main.py"},
+	"javascript": {run: "node main.js"},
+	"go":         {compile: "go build -o program *.go", run: "./program"},
+	"cpp":        {compile: "g++ -O2 -o program main.cpp", run: "./program"},
+}
+
+// goPackageClause matches the package clause of a Go source file
+var goPackageClause = regexp.MustCompile(`(?m)^\s*package\s+\w+`)
+
+// Judge runs DSA submissions against test cases. Each run gets a fresh
+// container without network access, so submissions can't see each other.
+type Judge struct {
+	cfg     *config.Config
+	runtime container.Runtime
+
+	compileTimeout time.Duration
+	testTimeout    time.Duration
+	execGrace      time.Duration
+}
+
+// NewJudge creates a Judge that starts its containers with runtime
+func NewJudge(cfg *config.Config, runtime container.Runtime) *Judge {
+	return &Judge{cfg: cfg, runtime: runtime, compileTimeout: judgeCompileTimeout, testTimeout: judgeTestTimeout, execGrace: judgeExecGrace}
+}
+
+// Errors returned by Judge.exec when a command broke a limit
+var (
+	errTimeLimit   = errors.New("time limit exceeded")
+	errOutputLimit = errors.New("output limit exceeded")
+)
+
+// exec runs command with bash in the container, killing it inside the
+// container once it has run for limit. A command killed that way, or one the
+// container doesn't report back on in time, returns errTimeLimit; one that
+// wrote more than container.DefaultMaxOutput returns errOutputLimit. Any
+// other error means the command couldn't be run.
+func (j *Judge) exec(ctx context.Context, containerID string, limit time.Duration, command string, args ...string) (*container.ExecResult, error) {
+	execCtx, cancel := context.WithTimeout(ctx, limit+j.execGrace)
+	defer cancel()
+
+	seconds := strconv.FormatFloat(limit.Seconds(), 'f', -1, 64)
+	result, err := j.runtime.Exec(execCtx, containerID, container.ExecOptions{
+		Cmd: append([]string{"timeout", "-s", "KILL", seconds, "bash", "-c", command, "judge"}, args...),
+	})
+	switch {
+	case err != nil && errors.Is(execCtx.Err(), context.DeadlineExceeded) && ctx.Err() == nil:
+		return nil, errTimeLimit
+	case err != nil:
+		return nil, err
+	case result.OutputTruncated:
+		// Checked first, as a command flooding its output often runs out of time too
+		return result, errOutputLimit
+	case result.ExitCode == 124 || result.ExitCode == 137:
+		// timeout's status when it had to kill the command
+		return result, errTimeLimit
+	}
+	return result, nil
+}
+
+// Run builds code and runs it once per test case, feeding the case's input on
+// stdin. When the problem has a harness for the language, code is the
+// student's function and the harness driver is the program that calls it;
+// otherwise code is a complete program.
+func (j *Judge) Run(ctx context.Context, problem *problems.Problem, language, code string, testcases []models.Testcase) ([]TestResult, error) {
+	lang, ok := judgeLanguages[language]
+	if !ok {
+		return nil, fmt.Errorf("unsupported language %q", language)
+	}
+
+	dir, err := os.MkdirTemp("", "academy-judge-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	if err := writeProgram(dir, problem, language, code); err != nil {
+		return nil, err
+	}
+	if err := os.Mkdir(filepath.Join(dir, "tests"), 0755); err != nil {
+		return nil, err
+	}
+	for i, testcase := range testcases {
+		if err := os.WriteFile(filepath.Join(dir, "tests", fmt.Sprintf("%d.in", i+1)), []byte(testcase.Input), 0644); err != nil {
+			return nil, err
+		}
+	}
+	if err := chownWorkspace(dir, j.cfg.WBFY.WorkspaceUID, j.cfg.WBFY.WorkspaceGID); err != nil {
+		return nil, err
+	}
+
+	containerID, err := startScratchContainer(ctx, j.runtime, j.cfg.WBFY, container.StartOptions{
+		Name:      terminalContainerPrefix + "judge-" + uuid.New().String(),
+		Image:     getDockerImage(language),
+		Env:       map[string]string{"PROBLEM_TYPE": problem.Type},
+		Labels:    map[string]string{"academy.judge": problem.Slug},
+		Workspace: dir,
+	}, problem.Type, language)
+	if err != nil {
+		return nil, err
+	}
+	defer stopScratchContainer(j.runtime, containerID)
+
+	// A submission that doesn't compile fails every test case
+	compileError := ""
+	if lang.compile != "" {
+		result, err := j.exec(ctx, containerID, j.compileTimeout, lang.compile)
+		switch {
+		case errors.Is(err, errTimeLimit):
+			compileError = "Compilation did not finish: " + err.Error()
+		case errors.Is(err, errOutputLimit):
+			compileError = "Compilation failed: " + err.Error()
+		case err != nil:
+			compileError = "System error: " + err.Error()
+		case result.ExitCode != 0:
+			compileError = "Compilation failed:\n" + lastLines(result.Stdout+result.Stderr, 20)
+		}
+	}
+
+	results := make([]TestResult, len(testcases))
+	for i, testcase := range testcases {
+		results[i] = TestResult{
+			Input:          testcase.Input,
+			ExpectedOutput: testcase.ExpectedOutput,
+			IsHidden:       testcase.IsHidden,
+			Subtask:        testcase.Subtask,
+		}
+		if compileError != "" {
+			results[i].Error = compileError
+			continue
+		}
+
+		result, err := j.exec(ctx, containerID, j.testTimeout, lang.run+` < "$1"`, fmt.Sprintf("tests/%d.in", i+1))
+		switch {
+		case errors.Is(err, errTimeLimit):
+			results[i].Error = "Time limit exceeded"
+		case errors.Is(err, errOutputLimit):
+			results[i].ActualOutput = limitOutput(result.Stdout)
+			results[i].Error = "Output limit exceeded"
+		case err != nil:
+			results[i].Error = "System error: " + err.Error()
+		case result.ExitCode != 0:
+			results[i].ActualOutput = limitOutput(result.Stdout)
+			results[i].Error = fmt.Sprintf("Exited with status %d:\n%s", result.ExitCode, lastLines(result.Stderr, 10))
+		default:
+			results[i].ActualOutput = limitOutput(result.Stdout)
+			results[i].Passed = problems.OutputMatches(result.Stdout, testcase.ExpectedOutput)
+		}
+	}
+	return results, nil
+}
+
+// writeProgram lays out a submission in dir: either the harness driver as
+// main with the student's code as solution, or the student's code as main
+func writeProgram(dir string, problem *problems.Problem, language, code string) error {
+	ext := languageExtension(language)
+	if language == "go" && !goPackageClause.MatchString(code) {
+		code = "package main\n\n" + code
+	}
+
+	driver, harnessed, err := problem.ReadDriver(language)
+	if err != nil {
+		return err
+	}
+	if !harnessed {
+		return os.WriteFile(filepath.Join(dir, "main"+ext), []byte(code), 0644)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "main"+ext), []byte(driver), 0644); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, "solution"+ext), []byte(code), 0644)
+}
+
+// scratchEntrypoint keeps a scratch container running for Exec. The image's
+// own entrypoint would start a wbfy server, which grading doesn't need.
+var scratchEntrypoint = []string{"sleep", "infinity"}
+
+// startScratchContainer starts a throwaway container for grading, with no
+// network access and dir mounted as the workspace. The name should carry the
+// terminal container prefix so a restart cleans up after a crash. The caller
+// must stop the container with stopScratchContainer.
+func startScratchContainer(ctx context.Context, runtime container.Runtime, cfg config.WBFYConfig, opts container.StartOptions, problemType, language string) (string, error) {
+	opts.Profile = cfg.ProfileFor(problemType, language)
+	opts.Profile.Network = "none"
+	opts.Entrypoint = scratchEntrypoint
+
+	containerID, err := runtime.Start(ctx, opts)
+	if err != nil {
+		return "", fmt.Errorf("failed to start grading container: %w", err)
+	}
+	return containerID, nil
+}
+
+// stopScratchContainer stops a container started by startScratchContainer,
+// even if the request that started it was cancelled
+func stopScratchContainer(runtime container.Runtime, containerID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	runtime.Stop(ctx, containerID)
+}
+
+// limitOutput keeps test results readable when a program prints too much
+func limitOutput(output string) string {
+	if len(output) <= judgeMaxOutput {
+		return output
+	}
+	return output[:judgeMaxOutput] + "\n... (output truncated)"
+}
@@ -0,0 +1,227 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/globallstudent/academy/internal/config"
+	"github.com/globallstudent/academy/internal/container"
+	"github.com/globallstudent/academy/internal/models"
+	"github.com/globallstudent/academy/internal/problems"
+)
+
+// stubRuntime is a container.Runtime whose Exec, Stop and Inspect are given
+// by the test. Stop and Inspect succeed when they aren't.
+type stubRuntime struct {
+	container.Runtime
+	exec    func(ctx context.Context, opts container.ExecOptions) (*container.ExecResult, error)
+	stop    func(ctx context.Context, id string) error
+	inspect func(ctx context.Context, id string) (*container.Info, error)
+}
+
+func (s stubRuntime) Start(ctx context.Context, opts container.StartOptions) (string, error) {
+	return "stub", nil
+}
+
+func (s stubRuntime) Stop(ctx context.Context, id string) error {
+	if s.stop == nil {
+		return nil
+	}
+	return s.stop(ctx, id)
+}
+
+func (s stubRuntime) Inspect(ctx context.Context, id string) (*container.Info, error) {
+	if s.inspect == nil {
+		return &container.Info{ID: id, Running: true}, nil
+	}
+	return s.inspect(ctx, id)
+}
+
+func (s stubRuntime) Exec(ctx context.Context, id string, opts container.ExecOptions) (*container.ExecResult, error) {
+	return s.exec(ctx, opts)
+}
+
+func testJudge(runtime container.Runtime) *Judge {
+	cfg := &config.Config{WBFY: config.WBFYConfig{
+		Profiles: map[string]config.ResourceProfile{"default": {}},
+	}}
+	j := NewJudge(cfg, runtime)
+	j.testTimeout = time.Second
+	return j
+}
+
+func TestJudgeExecResults(t *testing.T) {
+	tests := []struct {
+		name      string
+		exec      func(ctx context.Context, opts container.ExecOptions) (*container.ExecResult, error)
+		wantError string
+		wantPass  bool
+	}{
+		{
+			name: "right answer",
+			exec: func(ctx context.Context, opts container.ExecOptions) (*container.ExecResult, error) {
+				return &container.ExecResult{Stdout: "3\n"}, nil
+			},
+			wantPass: true,
+		},
+		{
+			name: "killed by timeout",
+			exec: func(ctx context.Context, opts container.ExecOptions) (*container.ExecResult, error) {
+				return &container.ExecResult{ExitCode: 137}, nil
+			},
+			wantError: "Time limit exceeded",
+		},
+		{
+			name: "timeout's own status",
+			exec: func(ctx context.Context, opts container.ExecOptions) (*container.ExecResult, error) {
+				return &container.ExecResult{ExitCode: 124}, nil
+			},
+			wantError: "Time limit exceeded",
+		},
+		{
+			name: "floods its output",
+			exec: func(ctx context.Context, opts container.ExecOptions) (*container.ExecResult, error) {
+				return &container.ExecResult{Stdout: "y\n", OutputTruncated: true}, nil
+			},
+			wantError: "Output limit exceeded",
+		},
+		{
+			name: "floods its output until killed",
+			exec: func(ctx context.Context, opts container.ExecOptions) (*container.ExecResult, error) {
+				return &container.ExecResult{ExitCode: 137, Stdout: "y\n", OutputTruncated: true}, nil
+			},
+			wantError: "Output limit exceeded",
+		},
+		{
+			name: "container never reports back",
+			exec: func(ctx context.Context, opts container.ExecOptions) (*container.ExecResult, error) {
+				<-ctx.Done()
+				return nil, ctx.Err()
+			},
+			wantError: "Time limit exceeded",
+		},
+		{
+			name: "runtime failure",
+			exec: func(ctx context.Context, opts container.ExecOptions) (*container.ExecResult, error) {
+				return nil, errors.New("failed to create exec: docker API unavailable")
+			},
+			wantError: "System error: failed to create exec: docker API unavailable",
+		},
+		{
+			name: "runtime error in the program",
+			exec: func(ctx context.Context, opts container.ExecOptions) (*container.ExecResult, error) {
+				return &container.ExecResult{ExitCode: 1, Stderr: "ZeroDivisionError"}, nil
+			},
+			wantError: "Exited with status 1:\nZeroDivisionError",
+		},
+	}
+
+	problem := &problems.Problem{Type: "dsa"}
+	testcases := []models.Testcase{{Input: "1 2", ExpectedOutput: "3"}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cmd []string
+			j := testJudge(stubRuntime{exec: func(ctx context.Context, opts container.ExecOptions) (*container.ExecResult, error) {
+				cmd = opts.Cmd
+				return tt.exec(ctx, opts)
+			}})
+			j.execGrace = 10 * time.Millisecond
+
+			results, err := j.Run(context.Background(), problem, "python", "print(3)", testcases)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if results[0].Passed != tt.wantPass || results[0].Error != tt.wantError {
+				t.Errorf("result = passed %v, error %q; want %v, %q", results[0].Passed, results[0].Error, tt.wantPass, tt.wantError)
+			}
+			if len(cmd) < 5 || strings.Join(cmd[:5], " ") != "timeout -s KILL 1 bash" {
+				t.Errorf("command %q isn't run under timeout", cmd)
+			}
+		})
+	}
+}
+
+// TestJudgeRunProcess runs submissions for real with the process runtime. The
+// wbfy binary doesn't exist, so this fails if grading tries to start it.
+func TestJudgeRunProcess(t *testing.T) {
+	if _, err := exec.LookPath("python3"); err != nil {
+		t.Skip("python3 is not installed")
+	}
+	runtime := container.NewProcessRuntime("/nonexistent/wbfy")
+	testJudgeRun(t, runtime)
+}
+
+// TestJudgeRunDocker runs submissions in the language images. It needs a
+// Docker daemon and pulls images, so it only runs when ACADEMY_DOCKER_TESTS is set.
+func TestJudgeRunDocker(t *testing.T) {
+	if os.Getenv("ACADEMY_DOCKER_TESTS") == "" {
+		t.Skip("set ACADEMY_DOCKER_TESTS to run against Docker")
+	}
+	runtime := container.NewDockerRuntime(config.WBFYConfig{IsolatedNetwork: "wbfy-test-isolated"})
+	testJudgeRun(t, runtime)
+}
+
+func testJudgeRun(t *testing.T, runtime container.Runtime) {
+	j := testJudge(runtime)
+	problem := &problems.Problem{Type: "dsa"}
+	testcases := []models.Testcase{
+		{Input: "1 2", ExpectedOutput: "3"},
+		{Input: "40 2", ExpectedOutput: "42"},
+	}
+
+	tests := []struct {
+		name      string
+		code      string
+		wantPass  []bool
+		wantError string
+	}{
+		{
+			name:     "right answer",
+			code:     "a, b = map(int, input().split())\nprint(a + b)",
+			wantPass: []bool{true, true},
+		},
+		{
+			name:     "wrong answer",
+			code:     "a, b = map(int, input().split())\nprint(a * b)",
+			wantPass: []bool{false, false},
+		},
+		{
+			name:      "runtime error",
+			code:      "raise SystemExit(3)",
+			wantPass:  []bool{false, false},
+			wantError: "Exited with status 3",
+		},
+		{
+			name:      "endless loop",
+			code:      "while True:\n    pass",
+			wantPass:  []bool{false, false},
+			wantError: "Time limit exceeded",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Now()
+			results, err := j.Run(context.Background(), problem, "python", tt.code, testcases)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, result := range results {
+				if result.Passed != tt.wantPass[i] || !strings.HasPrefix(result.Error, tt.wantError) {
+					t.Errorf("test %d: passed %v, error %q; want %v, %q", i+1, result.Passed, result.Error, tt.wantPass[i], tt.wantError)
+				}
+			}
+			// Each endless run is killed at the time limit instead of
+			// running on beside the next test case
+			if elapsed := time.Since(start); elapsed > 15*time.Second {
+				t.Errorf("judging took %s", elapsed)
+			}
+		})
+	}
+}
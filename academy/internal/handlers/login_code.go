@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/globallstudent/academy/internal/auth"
+	"github.com/globallstudent/academy/internal/database"
+	"github.com/globallstudent/academy/internal/ratelimit"
+	"github.com/jackc/pgx/v5"
+)
+
+// otpChannelLabels are how the login page names each channel
+var otpChannelLabels = map[string]string{
+	auth.OTPChannelTelegram: "Telegram",
+	auth.OTPChannelEmail:    "Email",
+	auth.OTPChannelConsole:  "Server log (development)",
+}
+
+// otpNoRouteMessages explain why a channel can't reach a user
+var otpNoRouteMessages = map[string]string{
+	auth.OTPChannelTelegram: "This phone number isn't linked to Telegram yet. Share your phone number with the bot first.",
+	auth.OTPChannelEmail:    "There is no email address on this account. Add one on your profile page after logging in.",
+}
+
+// loginChannel is a channel offered on the login page
+type loginChannel struct {
+	Name  string
+	Label string
+}
+
+// loginPageData adds what every render of the login page needs to data
+func (h *PublicHandlers) loginPageData(data gin.H) gin.H {
+	var channels []loginChannel
+	for _, name := range h.otp.Channels() {
+		label := otpChannelLabels[name]
+		if label == "" {
+			label = name
+		}
+		channels = append(channels, loginChannel{Name: name, Label: label})
+	}
+	if data["Channel"] == nil || data["Channel"] == "" {
+		if len(channels) > 0 {
+			data["Channel"] = channels[0].Name
+		}
+	}
+	data["OTPChannels"] = channels
+	data["OTPLength"] = h.cfg.Auth.OTPLength
+	data["BotUsername"] = h.cfg.Telegram.BotUsername
+	return data
+}
+
+// findOTPRecipient looks up how a phone number's owner can be reached. A
+// phone number without an account gets only its number, which is enough
+// for channels that don't need more.
+func findOTPRecipient(ctx context.Context, db *database.DB, phoneNumber string) (auth.OTPRecipient, error) {
+	to := auth.OTPRecipient{PhoneNumber: phoneNumber}
+	if db == nil || db.Pool == nil {
+		return to, nil
+	}
+	err := db.Pool.QueryRow(ctx, `
+		SELECT COALESCE(email, ''), COALESCE(telegram_id, '') FROM users
+		WHERE phone_number = $1`, phoneNumber).Scan(&to.Email, &to.TelegramID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return to, nil
+	}
+	return to, err
+}
+
+// RequestLoginCode godoc
+// @Summary      Send a login code
+// @Description  Sends a login code for a phone number through the chosen channel, then shows the login form to enter it
+// @Tags         auth
+// @Accept       x-www-form-urlencoded
+// @Produce      html
+// @Param        phone    formData  string  true  "Phone number"
+// @Param        channel  formData  string  true  "Channel to send the code through: telegram, email or console"
+// @Success      200  {object}  nil  "Login page asking for the code"
+// @Failure      400  {object}  nil  "Unknown channel, or it can't reach the user"
+// @Failure      429  {object}  nil  "Too many codes requested"
+// @Failure      500  {object}  nil  "Internal server error"
+// @Router       /login/code [post]
+func (h *PublicHandlers) RequestLoginCode(c *gin.Context) {
+	phoneNumber := strings.TrimSpace(c.PostForm("phone"))
+	channel := c.PostForm("channel")
+
+	render := func(status int, key, msg string) {
+		c.HTML(status, "main", h.loginPageData(gin.H{
+			"Title":   "Login - Summer Academy",
+			"Phone":   phoneNumber,
+			"Channel": channel,
+			key:       msg,
+		}))
+	}
+
+	if phoneNumber == "" {
+		render(http.StatusBadRequest, "Error", "Phone number is required.")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 15*time.Second)
+	defer cancel()
+
+	to, err := findOTPRecipient(ctx, h.db, phoneNumber)
+	if err != nil {
+		log.Printf("Error looking up login code recipient %s: %v", phoneNumber, err)
+		render(http.StatusInternalServerError, "Error", "Failed to send a login code. Please try again.")
+		return
+	}
+
+	var limitErr *auth.OTPLimitError
+	err = h.otp.Send(ctx, channel, to)
+	switch {
+	case err == nil:
+		log.Printf("Login code for %s sent by %s", phoneNumber, channel)
+		render(http.StatusOK, "Notice", "We sent you a login code by "+otpChannelLabels[channel]+". Enter it below.")
+	case errors.As(err, &limitErr):
+		c.Header("Retry-After", ratelimit.Result{RetryAfter: limitErr.RetryAfter}.RetryAfterSeconds())
+		render(http.StatusTooManyRequests, "Error",
+			"Too many codes requested. Please try again in "+formatWait(limitErr.RetryAfter)+".")
+	case errors.Is(err, auth.ErrUnknownOTPChannel):
+		render(http.StatusBadRequest, "Error", "Please choose how to get your login code.")
+	case errors.Is(err, auth.ErrOTPNoRoute):
+		msg := otpNoRouteMessages[channel]
+		if msg == "" {
+			msg = "We can't reach you that way. Please choose another way to get your code."
+		}
+		render(http.StatusBadRequest, "Error", msg)
+	default:
+		log.Printf("Error sending login code to %s by %s: %v", phoneNumber, channel, err)
+		render(http.StatusInternalServerError, "Error", "Failed to send a login code. Please try again.")
+	}
+}
@@ -0,0 +1,22 @@
+package handlers
+
+import (
+	"github.com/globallstudent/academy/internal/announcements"
+	"github.com/globallstudent/academy/internal/models"
+)
+
+// Notifier passes events on to students outside the site, e.g. through the
+// Telegram bot. Its methods must not block the request.
+type Notifier interface {
+	// SubmissionJudged is called for every judged submission once it has
+	// been saved, so the student can be told their verdict
+	SubmissionJudged(submission models.Submission)
+	// Announce broadcasts a published announcement
+	Announce(announcement announcements.Announcement)
+}
+
+// noopNotifier is used when nothing passes events on
+type noopNotifier struct{}
+
+func (noopNotifier) SubmissionJudged(models.Submission)  {}
+func (noopNotifier) Announce(announcements.Announcement) {}
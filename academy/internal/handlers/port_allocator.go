@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// PortRange is an inclusive range of host ports
+type PortRange struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// PortStats describes how much of the port pool is in use
+type PortStats struct {
+	Ranges        []PortRange `json:"ranges"`
+	Total         int         `json:"total"`
+	InUse         int         `json:"in_use"`
+	Free          int         `json:"free"`
+	ProbeFailures int         `json:"probe_failures"` // Ports skipped because something else was listening
+}
+
+// PortAllocator hands out host ports for terminal sessions. Reservations are
+// made under a single lock, so two sessions can never get the same port, and
+// each candidate port is probed so ports taken by other programs are skipped.
+type PortAllocator struct {
+	mu        sync.Mutex
+	ranges    []PortRange
+	ports     []int          // every port in the pool, in order
+	next      int            // index into ports to start the next search at
+	owners    map[int]string // port -> session ID
+	sessions  map[string]int // session ID -> port
+	failures  int
+	available func(port int) bool
+}
+
+// NewPortAllocator creates an allocator for ranges like "10000-10999,12000-12099"
+func NewPortAllocator(spec string) (*PortAllocator, error) {
+	ranges, err := parsePortRanges(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &PortAllocator{
+		ranges:    ranges,
+		owners:    make(map[int]string),
+		sessions:  make(map[string]int),
+		available: portAvailable,
+	}
+	seen := make(map[int]bool)
+	for _, r := range ranges {
+		for port := r.Start; port <= r.End; port++ {
+			if !seen[port] {
+				seen[port] = true
+				a.ports = append(a.ports, port)
+			}
+		}
+	}
+	return a, nil
+}
+
+// Reserve returns a free port for a session. A session that already holds a
+// port gets the same one back.
+func (a *PortAllocator) Reserve(sessionID string) (int, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if port, ok := a.sessions[sessionID]; ok {
+		return port, nil
+	}
+
+	// Search round-robin from where the last search stopped, so a port that was
+	// just released isn't handed out again straight away
+	for i := 0; i < len(a.ports); i++ {
+		idx := (a.next + i) % len(a.ports)
+		port := a.ports[idx]
+		if _, taken := a.owners[port]; taken {
+			continue
+		}
+		if !a.available(port) {
+			a.failures++
+			continue
+		}
+
+		a.owners[port] = sessionID
+		a.sessions[sessionID] = port
+		a.next = idx + 1
+		return port, nil
+	}
+
+	return 0, fmt.Errorf("no available ports")
+}
+
+// Claim records that a session already holds a port, e.g. one adopted after a
+// restart. It fails if another session holds the port.
+func (a *PortAllocator) Claim(sessionID string, port int) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if owner, taken := a.owners[port]; taken && owner != sessionID {
+		return fmt.Errorf("port %d is already held by session %s", port, owner)
+	}
+	if old, ok := a.sessions[sessionID]; ok && old != port {
+		delete(a.owners, old)
+	}
+	a.owners[port] = sessionID
+	a.sessions[sessionID] = port
+	return nil
+}
+
+// Release frees a session's port; releasing twice is harmless
+func (a *PortAllocator) Release(sessionID string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if port, ok := a.sessions[sessionID]; ok {
+		delete(a.owners, port)
+		delete(a.sessions, sessionID)
+	}
+}
+
+// Stats reports the current usage of the pool
+func (a *PortAllocator) Stats() PortStats {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return PortStats{
+		Ranges:        a.ranges,
+		Total:         len(a.ports),
+		InUse:         len(a.owners),
+		Free:          len(a.ports) - len(a.owners),
+		ProbeFailures: a.failures,
+	}
+}
+
+// portAvailable checks that nothing is listening on a host port by briefly binding it
+func portAvailable(port int) bool {
+	listener, err := net.Listen("tcp", ":"+strconv.Itoa(port))
+	if err != nil {
+		return false
+	}
+	listener.Close()
+	return true
+}
+
+// parsePortRanges parses a comma-separated list of ports and port ranges
+func parsePortRanges(spec string) ([]PortRange, error) {
+	var ranges []PortRange
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		startStr, endStr, isRange := strings.Cut(part, "-")
+		if !isRange {
+			endStr = startStr
+		}
+		start, err := strconv.Atoi(strings.TrimSpace(startStr))
+		if err != nil {
+			return nil, fmt.Errorf("invalid port range %q", part)
+		}
+		end, err := strconv.Atoi(strings.TrimSpace(endStr))
+		if err != nil {
+			return nil, fmt.Errorf("invalid port range %q", part)
+		}
+		if start < 1 || end > 65535 || start > end {
+			return nil, fmt.Errorf("invalid port range %q", part)
+		}
+		ranges = append(ranges, PortRange{Start: start, End: end})
+	}
+
+	if len(ranges) == 0 {
+		return nil, fmt.Errorf("no port ranges configured")
+	}
+	return ranges, nil
+}
@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"reflect"
+	"testing"
+)
+
+// newTestAllocator creates an allocator that never probes real ports
+func newTestAllocator(t *testing.T, spec string, busy ...int) *PortAllocator {
+	t.Helper()
+	a, err := NewPortAllocator(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	taken := make(map[int]bool)
+	for _, port := range busy {
+		taken[port] = true
+	}
+	a.available = func(port int) bool { return !taken[port] }
+	return a
+}
+
+func TestParsePortRanges(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    []PortRange
+		wantErr bool
+	}{
+		{spec: "10000-10002", want: []PortRange{{10000, 10002}}},
+		{spec: "10000-10002, 12000 ,", want: []PortRange{{10000, 10002}, {12000, 12000}}},
+		{spec: "", wantErr: true},
+		{spec: "10-5", wantErr: true},
+		{spec: "0-10", wantErr: true},
+		{spec: "65535-65536", wantErr: true},
+		{spec: "a-b", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := parsePortRanges(tt.spec)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parsePortRanges(%q) = %v, want error", tt.spec, got)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parsePortRanges(%q) = %v, %v, want %v", tt.spec, got, err, tt.want)
+		}
+	}
+}
+
+func TestPortAllocatorReserve(t *testing.T) {
+	tests := []struct {
+		name     string
+		spec     string
+		busy     []int
+		sessions []string
+		want     []int
+		wantErr  bool
+	}{
+		{
+			name:     "ports are handed out in order",
+			spec:     "100-102",
+			sessions: []string{"a", "b", "c"},
+			want:     []int{100, 101, 102},
+		},
+		{
+			name:     "busy ports are skipped",
+			spec:     "100-102",
+			busy:     []int{100, 101},
+			sessions: []string{"a"},
+			want:     []int{102},
+		},
+		{
+			name:     "same session gets its port back",
+			spec:     "100-102",
+			sessions: []string{"a", "a"},
+			want:     []int{100, 100},
+		},
+		{
+			name:     "overlapping ranges are counted once",
+			spec:     "100-101,101-101",
+			sessions: []string{"a", "b", "c"},
+			want:     []int{100, 101},
+			wantErr:  true,
+		},
+		{
+			name:     "exhausted pool",
+			spec:     "100",
+			sessions: []string{"a", "b"},
+			want:     []int{100},
+			wantErr:  true,
+		},
+		{
+			name:     "every port busy",
+			spec:     "100-101",
+			busy:     []int{100, 101},
+			sessions: []string{"a"},
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newTestAllocator(t, tt.spec, tt.busy...)
+
+			var got []int
+			var err error
+			for _, session := range tt.sessions {
+				var port int
+				if port, err = a.Reserve(session); err != nil {
+					break
+				}
+				got = append(got, port)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) && !(len(got) == 0 && len(tt.want) == 0) {
+				t.Errorf("reserved %v, want %v", got, tt.want)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPortAllocatorRelease(t *testing.T) {
+	a := newTestAllocator(t, "100-101")
+
+	first, _ := a.Reserve("a")
+	a.Reserve("b")
+	if _, err := a.Reserve("c"); err == nil {
+		t.Fatal("reserved a port from a full pool")
+	}
+
+	a.Release("a")
+	a.Release("a") // releasing twice is harmless
+	port, err := a.Reserve("c")
+	if err != nil || port != first {
+		t.Fatalf("Reserve after release = %d, %v, want %d", port, err, first)
+	}
+
+	if stats := a.Stats(); stats.InUse != 2 || stats.Free != 0 || stats.Total != 2 {
+		t.Errorf("Stats() = %+v", stats)
+	}
+}
+
+func TestPortAllocatorRoundRobin(t *testing.T) {
+	a := newTestAllocator(t, "100-102")
+
+	a.Reserve("a")
+	a.Release("a")
+
+	// A port that was just released isn't handed out again straight away
+	if port, _ := a.Reserve("b"); port != 101 {
+		t.Errorf("Reserve after release = %d, want 101", port)
+	}
+}
+
+func TestPortAllocatorClaim(t *testing.T) {
+	a := newTestAllocator(t, "100-102")
+
+	if err := a.Claim("a", 101); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Claim("b", 101); err == nil {
+		t.Error("claimed a port held by another session")
+	}
+	if port, _ := a.Reserve("a"); port != 101 {
+		t.Errorf("Reserve for a claiming session = %d, want 101", port)
+	}
+
+	// Claiming a different port moves the session
+	if err := a.Claim("a", 102); err != nil {
+		t.Fatal(err)
+	}
+	if port, _ := a.Reserve("b"); port != 100 {
+		t.Errorf("Reserve = %d, want 100", port)
+	}
+	if port, _ := a.Reserve("c"); port != 101 {
+		t.Errorf("Reserve = %d, want 101 after it was given up", port)
+	}
+	if stats := a.Stats(); stats.InUse != 3 {
+		t.Errorf("InUse = %d, want 3", stats.InUse)
+	}
+}
+
+func TestPortAllocatorProbeFailures(t *testing.T) {
+	a := newTestAllocator(t, "100-102", 100)
+
+	a.Reserve("a")
+	if stats := a.Stats(); stats.ProbeFailures != 1 {
+		t.Errorf("ProbeFailures = %d, want 1", stats.ProbeFailures)
+	}
+}
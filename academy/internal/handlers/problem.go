@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"context"
 	"net/http"
 	"strconv"
 	"time"
@@ -9,18 +10,21 @@ import (
 	"github.com/globallstudent/academy/internal/config"
 	"github.com/globallstudent/academy/internal/database"
 	"github.com/globallstudent/academy/internal/models"
+	"github.com/globallstudent/academy/internal/problems"
+	"github.com/globallstudent/academy/internal/rbac"
 	"github.com/google/uuid"
 )
 
 // ProblemHandlers contains handlers for problem routes
 type ProblemHandlers struct {
-	db  *database.DB
-	cfg *config.Config
+	db       *database.DB
+	cfg      *config.Config
+	problems *problems.Catalog
 }
 
 // NewProblemHandlers creates a new ProblemHandlers instance
-func NewProblemHandlers(db *database.DB, cfg *config.Config) *ProblemHandlers {
-	return &ProblemHandlers{db: db, cfg: cfg}
+func NewProblemHandlers(db *database.DB, cfg *config.Config, catalog *problems.Catalog) *ProblemHandlers {
+	return &ProblemHandlers{db: db, cfg: cfg, problems: catalog}
 }
 
 // ListDays godoc
@@ -121,39 +125,51 @@ func (h *ProblemHandlers) ProblemDetail(c *gin.Context) {
 	slug := c.Param("slug")
 
 	// Get problem by slug
-	problem, err := getProblemBySlug(h.db, slug)
-	if err != nil {
-		c.HTML(http.StatusInternalServerError, "pages/error.html", gin.H{
-			"Error": "Failed to get problem details",
+	problem, ok := h.problems.Problem(slug)
+	if !ok {
+		c.HTML(http.StatusNotFound, "pages/error.html", gin.H{
+			"Error": "Problem not found",
 		})
 		return
 	}
 
 	// Get problem content
-	content, err := getProblemContent(problem.FilePath)
+	content, err := problem.Content()
 	if err != nil {
-		c.HTML(http.StatusInternalServerError, "main", gin.H{
-			"Title": problem.Title + " - Summer Academy",
+		c.HTML(http.StatusInternalServerError, "pages/error.html", gin.H{
 			"Error": "Failed to load problem content",
 		})
 		return
 	}
 
-	// Get test cases (only non-hidden ones)
-	testcases, err := getTestcases(problem.ID, false)
+	// Get test cases, with the hidden ones for roles allowed to see them
+	testcases, err := problem.LoadTestcases(can(c, rbac.ViewHiddenTests))
 	if err != nil {
-		c.HTML(http.StatusInternalServerError, "main", gin.H{
-			"Title": problem.Title + " - Summer Academy",
+		c.HTML(http.StatusInternalServerError, "pages/error.html", gin.H{
 			"Error": "Failed to load test cases",
 		})
 		return
 	}
 
-	c.HTML(http.StatusOK, "main", gin.H{
-		"Title":     problem.Title + " - Summer Academy",
-		"Problem":   problem,
-		"Content":   content,
-		"Testcases": testcases,
+	// The editor starts in Python when the problem accepts it
+	languages := problemLanguages(problem)
+	language := languages[0]
+	for _, l := range languages {
+		if l == "python" {
+			language = l
+		}
+	}
+	starters := problem.StarterCode()
+
+	c.HTML(http.StatusOK, "pages/problem_detail.html", gin.H{
+		"Title":        problem.Title + " - Summer Academy",
+		"Problem":      problem,
+		"Content":      content,
+		"Testcases":    testcases,
+		"Languages":    languages,
+		"Language":     language,
+		"StarterCode":  starters[language],
+		"StarterCodes": starters,
 	})
 }
 
@@ -272,41 +288,36 @@ func getProblemsForDay(db *database.DB, day int) ([]models.Problem, error) {
 	return mockProblems, nil
 }
 
-// Helper function to get problem by slug
-func getProblemBySlug(db *database.DB, slug string) (models.Problem, error) {
-	// In production, actually query the database
-	return models.Problem{
-		ID:         uuid.New(),
-		Day:        1,
-		Type:       "dsa",
-		Slug:       slug,
-		Title:      "Two Sum",
-		FilePath:   "problems/day-1/dsa.md",
-		Score:      100,
-		UnlockTime: time.Now(),
-	}, nil
-}
-
-// Helper function to get problem content
-func getProblemContent(filePath string) (string, error) {
-	// In production, read from the file
-	return "# Two Sum\n\nGiven an array of integers `nums` and an integer `target`, return indices of the two numbers such that they add up to `target`.\n", nil
-}
-
-// Helper function to get test cases
-func getTestcases(problemID uuid.UUID, includeHidden bool) ([]models.Testcase, error) {
-	// In production, read from problem JSON file
-	return []models.Testcase{
-		{
-			Input:          "[2, 7, 11, 15]\n9",
-			ExpectedOutput: "[0, 1]",
-			IsHidden:       false,
-		},
-	}, nil
-}
-
 // Helper function to get all problems
 func getAllProblems(db *database.DB) ([]models.Problem, error) {
 	// In production, actually query the database
 	return []models.Problem{}, nil
 }
+
+// syncProblems stores the problems found on disk in the problems table, so
+// submissions can refer to them
+func syncProblems(db *database.DB, catalog *problems.Catalog) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	for _, day := range catalog.Days() {
+		for _, p := range day.Problems {
+			_, err := db.Pool.Exec(ctx, `
+				INSERT INTO problems (id, day, type, slug, title, file_path, score, unlock_time)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+				ON CONFLICT (id) DO UPDATE SET
+					day = EXCLUDED.day,
+					type = EXCLUDED.type,
+					slug = EXCLUDED.slug,
+					title = EXCLUDED.title,
+					file_path = EXCLUDED.file_path,
+					score = EXCLUDED.score,
+					unlock_time = EXCLUDED.unlock_time`,
+				p.ID, p.Day, p.Type, p.Slug, p.Title, p.FilePath, p.Score, day.UnlockDate)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -2,106 +2,57 @@ package handlers
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
-	"sync"
-	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/globallstudent/academy/internal/auth"
 	"github.com/globallstudent/academy/internal/config"
 	"github.com/globallstudent/academy/internal/database"
 	"github.com/globallstudent/academy/internal/models"
-	"github.com/google/uuid"
+	"github.com/globallstudent/academy/internal/ratelimit"
+	"github.com/globallstudent/academy/internal/standings"
 )
 
-// Development mode only: in-memory OTP store with mutex for thread safety
-var (
-	devOTPStore     = make(map[string]string)
-	devOTPStoreLock sync.RWMutex
-)
-
-// OTP verification rate limiting
-var (
-	failedAttempts     = make(map[string]int)
-	failedAttemptTimes = make(map[string]time.Time)
-	maxFailedAttempts  = 5
-	lockoutDuration    = 10 * time.Minute
-	failedAttemptsLock sync.RWMutex
-)
-
-// StoreDevelopmentOTP stores an OTP for development mode only
-func StoreDevelopmentOTP(phoneNumber, otp string) {
-	devOTPStoreLock.Lock()
-	defer devOTPStoreLock.Unlock()
-	devOTPStore[phoneNumber] = otp
-
-	// For security, automatically expire OTPs after 5 minutes
-	go func(phone string) {
-		time.Sleep(5 * time.Minute)
-		devOTPStoreLock.Lock()
-		defer devOTPStoreLock.Unlock()
-		delete(devOTPStore, phone)
-	}(phoneNumber)
-}
-
-// checkRateLimit checks if a phone number has exceeded the maximum allowed failed attempts
-// Returns true if rate limited, false otherwise
-func checkRateLimit(phoneNumber string) bool {
-	failedAttemptsLock.RLock()
-	attempts, exists := failedAttempts[phoneNumber]
-	lastAttemptTime, timeExists := failedAttemptTimes[phoneNumber]
-	failedAttemptsLock.RUnlock()
-
-	if !exists {
+// validOTPFormat reports whether otp is length digits
+func validOTPFormat(otp string, length int) bool {
+	if len(otp) != length {
 		return false
 	}
-
-	// Reset attempts if lockout period has passed
-	if timeExists && time.Since(lastAttemptTime) > lockoutDuration {
-		failedAttemptsLock.Lock()
-		delete(failedAttempts, phoneNumber)
-		delete(failedAttemptTimes, phoneNumber)
-		failedAttemptsLock.Unlock()
-		return false
-	}
-
-	// Check if max attempts reached
-	return attempts >= maxFailedAttempts
-}
-
-// incrementFailedAttempts increases the count of failed attempts for a phone number
-func incrementFailedAttempts(phoneNumber string) {
-	failedAttemptsLock.Lock()
-	defer failedAttemptsLock.Unlock()
-
-	count, exists := failedAttempts[phoneNumber]
-	if !exists {
-		failedAttempts[phoneNumber] = 1
-	} else {
-		failedAttempts[phoneNumber] = count + 1
+	for _, r := range otp {
+		if r < '0' || r > '9' {
+			return false
+		}
 	}
-	failedAttemptTimes[phoneNumber] = time.Now()
-}
-
-// resetFailedAttempts resets the failed attempts counter for a phone number
-func resetFailedAttempts(phoneNumber string) {
-	failedAttemptsLock.Lock()
-	defer failedAttemptsLock.Unlock()
-	delete(failedAttempts, phoneNumber)
-	delete(failedAttemptTimes, phoneNumber)
+	return true
 }
 
 // PublicHandlers contains handlers for public routes
 type PublicHandlers struct {
-	db    *database.DB
-	redis *database.Redis
-	cfg   *config.Config
+	db      *database.DB
+	otp     *auth.OTPService
+	limiter ratelimit.Limiter
+	rules   ratelimit.Rules
+	cfg     *config.Config
+
+	// findTelegramUser returns the account linked to a Telegram user
+	findTelegramUser func(ctx context.Context, telegramID string) (models.User, bool, error)
 }
 
 // NewPublicHandlers creates a new PublicHandlers instance
-func NewPublicHandlers(db *database.DB, redis *database.Redis, cfg *config.Config) *PublicHandlers {
-	return &PublicHandlers{db: db, redis: redis, cfg: cfg}
+func NewPublicHandlers(db *database.DB, otp *auth.OTPService, limiter ratelimit.Limiter, cfg *config.Config) *PublicHandlers {
+	return &PublicHandlers{
+		db:      db,
+		otp:     otp,
+		limiter: limiter,
+		rules:   ratelimit.NewRules(cfg.RateLimit),
+		cfg:     cfg,
+		findTelegramUser: func(ctx context.Context, telegramID string) (models.User, bool, error) {
+			return findUserByTelegramID(ctx, db, telegramID)
+		},
+	}
 }
 
 // HomePage godoc
@@ -150,11 +101,12 @@ func (h *PublicHandlers) LoginPage(c *gin.Context) {
 	phoneNumber := c.Query("phone")
 	otp := c.Query("otp")
 
-	c.HTML(http.StatusOK, "main", gin.H{
-		"Title": "Login - Summer Academy",
-		"Phone": phoneNumber,
-		"OTP":   otp,
-	})
+	c.HTML(http.StatusOK, "main", h.loginPageData(gin.H{
+		"Title":   "Login - Summer Academy",
+		"Phone":   phoneNumber,
+		"OTP":     otp,
+		"Channel": c.Query("channel"),
+	}))
 }
 
 // VerifyOTPPage godoc
@@ -173,9 +125,10 @@ func (h *PublicHandlers) VerifyOTPPage(c *gin.Context) {
 
 	// Render the verification page
 	c.HTML(http.StatusOK, "main", gin.H{
-		"Title": "Verify OTP - Summer Academy",
-		"Phone": phoneNumber,
-		"OTP":   otp,
+		"Title":     "Verify OTP - Summer Academy",
+		"Phone":     phoneNumber,
+		"OTP":       otp,
+		"OTPLength": h.cfg.Auth.OTPLength,
 	})
 }
 
@@ -197,14 +150,9 @@ func (h *PublicHandlers) ProcessLogin(c *gin.Context) {
 	phoneNumber := c.PostForm("phone")
 	otp := c.PostForm("otp")
 
-	// Log the request details for debugging
-	log.Printf("ProcessLogin: received request path=%s method=%s phone=%s otp=%s",
-		c.Request.URL.Path, c.Request.Method, phoneNumber, otp)
-
-	// Dump all form data for debugging
-	for key, values := range c.Request.PostForm {
-		log.Printf("Form field %s = %v", key, values)
-	}
+	// Log the request details for debugging, but never the code itself
+	log.Printf("ProcessLogin: received request path=%s method=%s phone=%s",
+		c.Request.URL.Path, c.Request.Method, phoneNumber)
 
 	// Dump all headers for debugging
 	for key, values := range c.Request.Header {
@@ -220,159 +168,89 @@ func (h *PublicHandlers) ProcessLogin(c *gin.Context) {
 			// For HTMX requests, return a partial page with the form and error
 			c.Header("HX-Retarget", "#verify-section")
 			c.HTML(status, "main", gin.H{
-				"Title":   title,
-				"Error":   errorMsg,
-				"Content": "verify",
-				"Phone":   phoneNumber,
+				"Title":     title,
+				"Error":     errorMsg,
+				"Content":   "verify",
+				"Phone":     phoneNumber,
+				"OTPLength": h.cfg.Auth.OTPLength,
 			})
 		} else {
 			// For regular form submissions, render the full page
 			c.HTML(status, "main", gin.H{
-				"Title":   title,
-				"Error":   errorMsg,
-				"Content": "verify",
-				"Phone":   phoneNumber,
+				"Title":     title,
+				"Error":     errorMsg,
+				"Content":   "verify",
+				"Phone":     phoneNumber,
+				"OTPLength": h.cfg.Auth.OTPLength,
 			})
 		}
 	}
 
 	// Validate input
-	if otp == "" || len(otp) != 6 {
+	if !validOTPFormat(otp, h.cfg.Auth.OTPLength) {
 		renderError(http.StatusBadRequest, "Verify OTP - Summer Academy",
-			"Invalid verification code. Code must be 6 digits.")
+			fmt.Sprintf("Invalid verification code. Code must be %d digits.", h.cfg.Auth.OTPLength))
 		return
 	}
 
 	if phoneNumber == "" {
 		renderError(http.StatusBadRequest, "Verify OTP - Summer Academy",
-			"Phone number is required. Please use the Telegram bot to get a verification code.")
+			"Phone number is required. Please request a login code first.")
 		return
 	}
 
-	// Check rate limit for OTP verification attempts
-	if checkRateLimit(phoneNumber) {
+	// Refuse phone numbers and addresses with too many recent wrong codes
+	ctx := c.Request.Context()
+	if lockout := h.loginLockout(ctx, phoneNumber, c.ClientIP()); !lockout.Allowed {
+		c.Header("Retry-After", lockout.RetryAfterSeconds())
 		renderError(http.StatusTooManyRequests, "Verify OTP - Summer Academy",
-			"Too many failed verification attempts. Please try again in 10 minutes.")
+			"Too many failed verification attempts. Please try again in "+formatWait(lockout.RetryAfter)+".")
 		return
 	}
 
-	var isValid bool
-	var verifyErr error
-
-	// Verify OTP against Redis if available
-	if h.redis != nil && h.redis.Client != nil {
-		isValid, verifyErr = h.redis.VerifyOTP(phoneNumber, otp)
-		if verifyErr != nil {
-			log.Printf("Error verifying OTP: %v", verifyErr)
-
-			// Try development store as fallback if Redis fails and we're in development
-			if h.cfg != nil && h.cfg.Environment == "development" {
-				devOTPStoreLock.RLock()
-				actualOTP, exists := devOTPStore[phoneNumber]
-				devOTPStoreLock.RUnlock()
-
-				if exists && actualOTP == otp {
-					isValid = true
-					devOTPStoreLock.Lock()
-					delete(devOTPStore, phoneNumber)
-					devOTPStoreLock.Unlock()
-					log.Printf("Redis failed but development OTP store verification succeeded for %s", phoneNumber)
-				} else {
-					renderError(http.StatusInternalServerError, "Verify OTP - Summer Academy",
-						"Verification service error. Please try again or request a new code.")
-					return
-				}
-			} else {
-				renderError(http.StatusInternalServerError, "Verify OTP - Summer Academy",
-					"Verification service error. Please try again or request a new code.")
-				return
-			}
-		}
-	} else if h.cfg != nil && h.cfg.Environment == "development" {
-		// ONLY for development when Redis isn't available
-
-		// Get the stored dev OTPs from temporary in-memory store
-		devOTPStoreLock.RLock()
-		actualOTP, exists := devOTPStore[phoneNumber]
-		devOTPStoreLock.RUnlock()
-
-		if exists && actualOTP == otp {
-			isValid = true
-			log.Printf("Development mode: OTP verified for %s", phoneNumber)
-			// Remove the OTP from store to prevent reuse
-			devOTPStoreLock.Lock()
-			delete(devOTPStore, phoneNumber)
-			devOTPStoreLock.Unlock()
-		} else {
-			isValid = false
-			log.Printf("Development mode: Invalid OTP attempt: %s", otp)
-		}
-	} else {
-		renderError(http.StatusServiceUnavailable, "Verify OTP - Summer Academy",
-			"Verification service unavailable. Please try again later or contact support.")
+	isValid, verifyErr := h.otp.Verify(ctx, phoneNumber, otp)
+	if verifyErr != nil && !errors.Is(verifyErr, auth.ErrTooManyOTPAttempts) {
+		log.Printf("Error verifying OTP: %v", verifyErr)
+		renderError(http.StatusInternalServerError, "Verify OTP - Summer Academy",
+			"Verification service error. Please try again or request a new code.")
+		return
+	}
+
+	if errors.Is(verifyErr, auth.ErrTooManyOTPAttempts) {
+		h.recordLoginFailure(ctx, phoneNumber, c.ClientIP())
+
+		renderError(http.StatusTooManyRequests, "Verify OTP - Summer Academy",
+			"Too many wrong codes. Please request a new code.")
 		return
 	}
 
 	if !isValid {
-		// Increment failed attempts counter
-		incrementFailedAttempts(phoneNumber)
+		h.recordLoginFailure(ctx, phoneNumber, c.ClientIP())
 
 		renderError(http.StatusBadRequest, "Verify OTP - Summer Academy",
 			"Invalid or expired verification code. Please request a new code.")
 		return
 	}
 
-	// Reset failed attempts counter on successful verification
-	resetFailedAttempts(phoneNumber)
+	// The phone number's owner got in, so forget its wrong codes. The
+	// address keeps its count, since others may be guessing from it.
+	h.clearLoginFailures(ctx, phoneNumber)
 
 	// Find user by phone number or create a new user
-	var user models.User
-	// TODO: Replace with actual database query in production
-	// Example query: SELECT * FROM users WHERE phone_number = $1
-
-	// For now, simulate user lookup/creation
-	username := "Student"
-	if phoneNumber != "" && len(phoneNumber) > 4 {
-		username = "Student" + phoneNumber[len(phoneNumber)-4:]
-	} else {
-		username = "Student" + otp[:4]
-	}
-
-	user = models.User{
-		ID:           uuid.New(),
-		PhoneNumber:  phoneNumber,
-		Username:     username,
-		RegisteredAt: time.Now(),
-		Role:         "user",
+	user, err := h.db.UpsertUserByPhone(ctx, phoneNumber, "")
+	if err != nil {
+		log.Printf("Error loading user for %s: %v", phoneNumber, err)
+		renderError(http.StatusInternalServerError, "Verify OTP - Summer Academy",
+			"Failed to load your account. Please try again.")
+		return
 	}
 
-	// In production, store the user in database if new
-	// INSERT INTO users (...) VALUES (...) ON CONFLICT DO UPDATE ...
-
-	// Generate JWT token
-	token, err := auth.GenerateToken(user.ID, user.Username, user.Role)
-	if err != nil {
+	if err := h.issueSession(c, user); err != nil {
 		renderError(http.StatusInternalServerError, "Verify OTP - Summer Academy",
 			"Failed to generate session token. Please try again.")
 		return
 	}
 
-	// Set secure cookie
-	secure := c.Request.TLS != nil || h.cfg.Environment == "production"
-	c.SetCookie(
-		h.cfg.Auth.CookieName,
-		token,
-		h.cfg.Auth.CookieMaxAge,
-		"/",
-		"",
-		secure,
-		true,
-	)
-
-	// Set the user in the context for consistent behavior
-	c.Set("user", user)
-	c.Set("IsAuthenticated", true)
-
 	// For HTMX requests, set headers for proper client-side handling
 	if isHtmx {
 		// Tell HTMX to redirect to the days page
@@ -402,9 +280,10 @@ func (h *PublicHandlers) LeaderboardPage(c *gin.Context) {
 	user, isAuthenticated := c.Get("user")
 
 	// Get leaderboard entries
-	entries, err := getLeaderboard(h.db)
+	entries, err := standings.Leaderboard(c.Request.Context(), h.db)
 	if err != nil {
-		c.HTML(http.StatusInternalServerError, "main", gin.H{
+		log.Printf("Failed to get leaderboard: %v", err)
+		c.HTML(http.StatusInternalServerError, "pages/leaderboard.html", gin.H{
 			"Title":           "Leaderboard - Summer Academy",
 			"Error":           "Failed to get leaderboard data",
 			"IsAuthenticated": isAuthenticated,
@@ -413,9 +292,9 @@ func (h *PublicHandlers) LeaderboardPage(c *gin.Context) {
 		return
 	}
 
-	c.HTML(http.StatusOK, "main", gin.H{
+	c.HTML(http.StatusOK, "pages/leaderboard.html", gin.H{
 		"Title":           "Leaderboard - Summer Academy",
-		"Users":           entries, // Changed from Entries to Users to match the leaderboard.html template
+		"Entries":         entries,
 		"IsAuthenticated": isAuthenticated,
 		"User":            user,
 	})
@@ -451,25 +330,3 @@ func getTodaysProblems(db *database.DB) ([]models.Problem, error) {
 	// In production, actually query the database
 	return []models.Problem{}, nil
 }
-
-// Helper function to get leaderboard entries
-func getLeaderboard(db *database.DB) ([]models.User, error) {
-	// In production, actually query the database
-	// For now, return sample data
-	return []models.User{
-		{
-			ID:           uuid.New(),
-			PhoneNumber:  "+1234567890",
-			Username:     "student1",
-			RegisteredAt: time.Now().Add(-24 * time.Hour),
-			Role:         "user",
-		},
-		{
-			ID:           uuid.New(),
-			PhoneNumber:  "+1987654321",
-			Username:     "student2",
-			RegisteredAt: time.Now().Add(-48 * time.Hour),
-			Role:         "user",
-		},
-	}, nil
-}
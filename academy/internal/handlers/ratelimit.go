@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/globallstudent/academy/internal/config"
+	"github.com/globallstudent/academy/internal/ratelimit"
+)
+
+// loginLockout checks whether a phone number or client address has entered
+// too many wrong codes recently, returning the longer lockout if both have.
+// If the counters can't be read, logging in is allowed rather than locking
+// everyone out.
+func (h *PublicHandlers) loginLockout(ctx context.Context, phoneNumber, ip string) ratelimit.Result {
+	lockout := ratelimit.Result{Allowed: true}
+	for _, check := range []struct {
+		rule ratelimit.Rule
+		key  string
+	}{
+		{h.rules.LoginFailuresPerPhone, phoneNumber},
+		{h.rules.LoginFailuresPerIP, ip},
+	} {
+		res, err := h.limiter.Check(ctx, check.rule, check.key)
+		if err != nil {
+			log.Printf("Error checking %s rate limit: %v", check.rule.Name, err)
+			continue
+		}
+		if !res.Allowed && (lockout.Allowed || res.RetryAfter > lockout.RetryAfter) {
+			lockout = res
+		}
+	}
+	return lockout
+}
+
+// recordLoginFailure counts a wrong code against the phone number and address
+func (h *PublicHandlers) recordLoginFailure(ctx context.Context, phoneNumber, ip string) {
+	if _, err := h.limiter.Hit(ctx, h.rules.LoginFailuresPerPhone, phoneNumber); err != nil {
+		log.Printf("Error recording failed login for %s: %v", phoneNumber, err)
+	}
+	if _, err := h.limiter.Hit(ctx, h.rules.LoginFailuresPerIP, ip); err != nil {
+		log.Printf("Error recording failed login from %s: %v", ip, err)
+	}
+}
+
+// clearLoginFailures forgets a phone number's wrong codes
+func (h *PublicHandlers) clearLoginFailures(ctx context.Context, phoneNumber string) {
+	if err := h.limiter.Reset(ctx, h.rules.LoginFailuresPerPhone, phoneNumber); err != nil {
+		log.Printf("Error clearing failed logins for %s: %v", phoneNumber, err)
+	}
+}
+
+// formatWait describes a wait for people, rounded up to a minute
+func formatWait(wait time.Duration) string {
+	minutes := int((wait + time.Minute - 1) / time.Minute)
+	if minutes <= 1 {
+		return "a minute"
+	}
+	return fmt.Sprintf("%d minutes", minutes)
+}
+
+// RateLimitHandlers let admins see and lift rate limit lockouts
+type RateLimitHandlers struct {
+	limiter ratelimit.Limiter
+	rules   ratelimit.Rules
+}
+
+// NewRateLimitHandlers creates rate limit admin handlers
+func NewRateLimitHandlers(limiter ratelimit.Limiter, cfg *config.Config) *RateLimitHandlers {
+	return &RateLimitHandlers{limiter: limiter, rules: ratelimit.NewRules(cfg.RateLimit)}
+}
+
+// AdminLockouts godoc
+// @Summary      List rate limit lockouts
+// @Description  Lists the phone numbers and addresses currently over a login rate limit
+// @Tags         admin
+// @Produce      json
+// @Security     JWTCookie
+// @Success      200  {object}  map[string]interface{}  "Lockouts and the limits in force"
+// @Failure      401  {object}  nil  "Unauthorized"
+// @Failure      403  {object}  nil  "Forbidden - Admin access required"
+// @Failure      500  {object}  map[string]string  "Rate limits unavailable"
+// @Router       /admin/lockouts [get]
+func (h *RateLimitHandlers) AdminLockouts(c *gin.Context) {
+	lockouts, err := h.limiter.Lockouts(c.Request.Context(), h.rules.All())
+	if err != nil {
+		log.Printf("Error listing lockouts: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list lockouts"})
+		return
+	}
+	if lockouts == nil {
+		lockouts = []ratelimit.Lockout{}
+	}
+
+	rules := make([]gin.H, 0, len(h.rules.All()))
+	for _, rule := range h.rules.All() {
+		rules = append(rules, gin.H{"name": rule.Name, "limit": rule.Limit, "window": rule.Window.String()})
+	}
+	c.JSON(http.StatusOK, gin.H{"lockouts": lockouts, "rules": rules})
+}
+
+// ClearLockout godoc
+// @Summary      Lift a rate limit lockout
+// @Description  Forgets the events counted against a phone number or address under a rule
+// @Tags         admin
+// @Produce      json
+// @Security     JWTCookie
+// @Param        rule  query  string  true  "Rule name, e.g. login-failures-phone"
+// @Param        key   query  string  true  "Phone number or address"
+// @Success      200  {object}  map[string]string  "Lockout lifted"
+// @Failure      400  {object}  map[string]string  "Unknown rule or missing key"
+// @Failure      401  {object}  nil  "Unauthorized"
+// @Failure      403  {object}  nil  "Forbidden - Admin access required"
+// @Router       /admin/lockouts [delete]
+func (h *RateLimitHandlers) ClearLockout(c *gin.Context) {
+	rule, ok := h.rules.Find(c.Query("rule"))
+	key := c.Query("key")
+	if !ok || key == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A known rule and a key are required"})
+		return
+	}
+
+	if err := h.limiter.Reset(c.Request.Context(), rule, key); err != nil {
+		log.Printf("Error clearing %s lockout for %s: %v", rule.Name, key, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to clear lockout"})
+		return
+	}
+	log.Printf("Admin cleared %s lockout for %s", rule.Name, key)
+	c.JSON(http.StatusOK, gin.H{"status": "cleared"})
+}
@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/globallstudent/academy/internal/database"
+	"github.com/globallstudent/academy/internal/models"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// Rejudge godoc
+// @Summary      Rejudge a submission
+// @Description  Grades a stored submission again against the problem's current test cases and updates its verdict. The student is told if the verdict changed.
+// @Tags         admin
+// @Produce      json
+// @Security     JWTCookie
+// @Param        id  path  string  true  "Submission ID"
+// @Success      200  {object}  map[string]interface{}  "New verdict, with the previous one"
+// @Failure      400  {object}  map[string]interface{}  "Invalid submission ID"
+// @Failure      403  {object}  map[string]interface{}  "Forbidden - requires the rejudge permission"
+// @Failure      404  {object}  map[string]interface{}  "Submission or problem not found"
+// @Failure      409  {object}  map[string]interface{}  "The submission has no stored code"
+// @Failure      500  {object}  map[string]interface{}  "Internal server error"
+// @Router       /admin/submissions/{id}/rejudge [post]
+func (h *SubmissionHandlers) Rejudge(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Invalid submission ID",
+		})
+		return
+	}
+
+	ctx := c.Request.Context()
+	previous, err := getSubmission(ctx, h.db, id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "error",
+			"message": "Submission not found",
+		})
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to load submission %s: %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Failed to load the submission",
+		})
+		return
+	}
+	// Terminal checks and submissions from before code was stored can't be rerun
+	if previous.Code == "" {
+		c.JSON(http.StatusConflict, gin.H{
+			"status":  "error",
+			"message": "This submission has no stored code to rejudge",
+		})
+		return
+	}
+
+	problem, ok := h.problems.ProblemByID(previous.ProblemID)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "error",
+			"message": "Problem not found",
+		})
+		return
+	}
+
+	submission, results, err := gradeSubmission(ctx, h.judge, previous.UserID, problem, previous.Language, previous.Code)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Failed to grade submission: " + err.Error(),
+		})
+		return
+	}
+	// The submission keeps its identity and time, so only its verdict changes
+	submission.ID = previous.ID
+	submission.SubmittedAt = previous.SubmittedAt
+	if err := updateSubmissionVerdict(h.db, submission); err != nil {
+		log.Printf("Failed to store rejudged submission %s: %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Failed to record the new verdict",
+		})
+		return
+	}
+
+	if staff, ok := currentUser(c); ok {
+		log.Printf("Submission %s rejudged by %s: %s (%d) -> %s (%d)", id, staff.Username,
+			previous.Status, previous.Score, submission.Status, submission.Score)
+	}
+	if submission.Status != previous.Status || submission.Score != previous.Score {
+		h.notifier.SubmissionJudged(submission)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":     "success",
+		"previous":   gin.H{"status": previous.Status, "score": previous.Score},
+		"submission": submission,
+		"results":    visibleResults(c, results),
+	})
+}
+
+// getSubmission loads a stored submission with its code
+func getSubmission(ctx context.Context, db *database.DB, id uuid.UUID) (models.Submission, error) {
+	var s models.Submission
+	err := db.Pool.QueryRow(ctx, `
+		SELECT id, user_id, problem_id, language, status, score, COALESCE(code, ''), submitted_at
+		FROM submissions WHERE id = $1`, id).
+		Scan(&s.ID, &s.UserID, &s.ProblemID, &s.Language, &s.Status, &s.Score, &s.Code, &s.SubmittedAt)
+	return s, err
+}
+
+// updateSubmissionVerdict stores a new verdict for an existing submission
+func updateSubmissionVerdict(db *database.DB, submission models.Submission) error {
+	var sections []byte
+	if len(submission.Sections) > 0 {
+		var err error
+		if sections, err = json.Marshal(submission.Sections); err != nil {
+			return err
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := db.Pool.Exec(ctx, `
+		UPDATE submissions SET status = $2, output = $3, score = $4, sections = $5
+		WHERE id = $1`,
+		submission.ID, submission.Status, submission.Output, submission.Score, sections)
+	return err
+}
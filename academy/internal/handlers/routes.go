@@ -1,48 +1,90 @@
 package handlers
 
 import (
+	"context"
 	"log"
 
 	"github.com/gin-gonic/gin"
+	"github.com/globallstudent/academy/internal/auth"
 	"github.com/globallstudent/academy/internal/config"
+	"github.com/globallstudent/academy/internal/container"
 	"github.com/globallstudent/academy/internal/database"
 	"github.com/globallstudent/academy/internal/middleware"
+	"github.com/globallstudent/academy/internal/problems"
+	"github.com/globallstudent/academy/internal/ratelimit"
+	"github.com/globallstudent/academy/internal/rbac"
+	"github.com/google/uuid"
 )
 
-// RegisterRoutes sets up all the routes for the application
-func RegisterRoutes(router *gin.Engine, db *database.DB, redis *database.Redis, cfg *config.Config) {
+// RegisterRoutes sets up all the routes for the application. It returns a
+// function that stops the background jobs the handlers started.
+func RegisterRoutes(router *gin.Engine, db *database.DB, redis *database.Redis, limiter ratelimit.Limiter, otp *auth.OTPService, catalog *problems.Catalog, notifier Notifier, cfg *config.Config) (shutdown func()) {
 	// Add a route logger middleware for debugging
 	router.Use(func(c *gin.Context) {
 		log.Printf("[Route] %s %s", c.Request.Method, c.Request.URL.Path)
 		c.Next()
 	})
 
+	if notifier == nil {
+		notifier = noopNotifier{}
+	}
+
 	// Create handler groups
-	publicHandlers := NewPublicHandlers(db, redis, cfg)
-	problemHandlers := NewProblemHandlers(db, cfg)
-	submissionHandlers := NewSubmissionHandlers(db, cfg)
+	publicHandlers := NewPublicHandlers(db, otp, limiter, cfg)
 	userHandlers := NewUserHandlers(db, cfg)
-	wbfyHandlers := NewWBFYHandlers(db, cfg)
+	runtime, err := container.New(cfg.WBFY)
+	if err != nil {
+		log.Fatalf("Failed to set up terminal runtime: %v", err)
+	}
+	ports, err := NewPortAllocator(cfg.WBFY.PortRanges)
+	if err != nil {
+		log.Fatalf("Invalid terminal port ranges: %v", err)
+	}
+	if err := syncProblems(db, catalog); err != nil {
+		log.Printf("Warning: Failed to store problems in the database: %v", err)
+	}
+	judge := NewJudge(cfg, runtime)
+	problemHandlers := NewProblemHandlers(db, cfg, catalog)
+	submissionHandlers := NewSubmissionHandlers(db, cfg, catalog, judge, notifier)
+	wbfyHandlers := NewWBFYHandlers(db, cfg, runtime, ports, catalog, judge, notifier)
+	wbfyHandlers.RestoreSessions()
 	wbfyHandlers.StartCleanupJob()
 	contestHandlers := NewContestHandlers(db, redis, cfg)
+	rateLimitHandlers := NewRateLimitHandlers(limiter, cfg)
+	announcementHandlers := NewAnnouncementHandlers(db, cfg, notifier)
 
 	// Public routes (no auth required)
 	router.GET("/", publicHandlers.HomePage)
-	router.GET("/login", publicHandlers.LoginPage)
-	router.GET("/verify", publicHandlers.VerifyOTPPage)
-	router.POST("/verify", publicHandlers.ProcessLogin)
-	router.POST("/login", publicHandlers.ProcessLogin)
-	router.POST("/auth/login", publicHandlers.ProcessLogin) // For backward compatibility
 	router.GET("/logout", publicHandlers.LogoutHandler)
+	router.GET("/announcements/banner", announcementHandlers.AnnouncementBanner)
+
+	// Login routes, limited per client address
+	login := router.Group("/")
+	login.Use(middleware.RateLimit(limiter, ratelimit.NewRules(cfg.RateLimit).LoginRequestsPerIP))
+	{
+		login.GET("/login", publicHandlers.LoginPage)
+		login.POST("/login/code", publicHandlers.RequestLoginCode)
+		login.GET("/verify", publicHandlers.VerifyOTPPage)
+		login.POST("/verify", publicHandlers.ProcessLogin)
+		login.POST("/login", publicHandlers.ProcessLogin)
+		login.POST("/auth/login", publicHandlers.ProcessLogin) // For backward compatibility
+		login.GET("/auth/telegram", publicHandlers.TelegramLogin)
+	}
 
 	// Debug route to help troubleshoot request issues
 	if cfg.Environment != "production" {
 		router.Any("/debug/request", DumpRequest)
 	}
 
+	// The user's role is read from the database rather than the session token,
+	// so that a demotion applies at once
+	currentRole := func(ctx context.Context, userID uuid.UUID) (string, bool, error) {
+		return rbac.Role(ctx, db, userID)
+	}
+
 	// Auth required routes
 	authenticated := router.Group("/")
-	authenticated.Use(middleware.Auth())
+	authenticated.Use(middleware.Auth(), middleware.CurrentRole(currentRole))
 	{
 		authenticated.GET("/leaderboard", publicHandlers.LeaderboardPage)
 		// Contest routes
@@ -68,16 +110,56 @@ func RegisterRoutes(router *gin.Engine, db *database.DB, redis *database.Redis,
 		// WBFY Terminal integration
 		authenticated.POST("/terminal/:slug", wbfyHandlers.CreateTerminal)
 		authenticated.GET("/terminal/:id", wbfyHandlers.TerminalPage)
+		authenticated.GET("/terminal/:id/status", wbfyHandlers.TerminalStatus)
+		authenticated.GET("/terminal/:id/ws", wbfyHandlers.WebSocketProxy)
+		authenticated.GET("/terminal/:id/socket", wbfyHandlers.TerminalSocket)
+		authenticated.DELETE("/terminal/:id", wbfyHandlers.CleanupTerminal)
+		authenticated.GET("/terminals", wbfyHandlers.MyTerminals)
+		authenticated.POST("/terminals/:id/extend", wbfyHandlers.ExtendTerminal)
+
+		// Terminal session workspace files
+		authenticated.GET("/workspace/:id/files", wbfyHandlers.ListWorkspace)
+		authenticated.POST("/workspace/:id/files", wbfyHandlers.UploadWorkspace)
+		authenticated.DELETE("/workspace/:id/files", wbfyHandlers.DeleteWorkspaceFile)
+		authenticated.GET("/workspace/:id/download", wbfyHandlers.DownloadWorkspace)
+		authenticated.POST("/workspace/:id/submit", wbfyHandlers.SubmitWorkspace)
+		authenticated.POST("/workspace/:id/check", wbfyHandlers.CheckWork)
 	}
 
-	// Admin routes
+	// Staff routes. Each needs a permission of the user's role.
 	admin := router.Group("/admin")
-	admin.Use(middleware.Auth(), middleware.AdminOnly())
+	admin.Use(middleware.Auth(), middleware.CurrentRole(currentRole))
 	{
-		admin.GET("/", userHandlers.AdminDashboard)
-		admin.GET("/users", userHandlers.UserList)
-		admin.GET("/problems", problemHandlers.AdminProblemList)
-		admin.POST("/problems", problemHandlers.CreateProblem)
-		admin.PUT("/problems/:id", problemHandlers.UpdateProblem)
+		admin.GET("/", middleware.RequirePermission(rbac.AllPermissions...), userHandlers.AdminDashboard)
+
+		// Terminal supervision
+		watch := middleware.RequirePermission(rbac.WatchTerminals)
+		admin.GET("/terminals", watch, wbfyHandlers.AdminTerminals)
+		admin.GET("/terminals/ports", watch, wbfyHandlers.TerminalPortStats)
+		admin.GET("/terminals/:id/join", watch, wbfyHandlers.JoinTerminal)
+
+		// Users, their roles and login lockouts
+		manageUsers := middleware.RequirePermission(rbac.ManageUsers)
+		admin.GET("/users", manageUsers, userHandlers.UserList)
+		admin.POST("/users/:id/role", manageUsers, userHandlers.ChangeRole)
+		admin.GET("/lockouts", manageUsers, rateLimitHandlers.AdminLockouts)
+		admin.DELETE("/lockouts", manageUsers, rateLimitHandlers.ClearLockout)
+
+		// Problems and submissions
+		manageProblems := middleware.RequirePermission(rbac.ManageProblems)
+		admin.GET("/problems", manageProblems, problemHandlers.AdminProblemList)
+		admin.POST("/problems", manageProblems, problemHandlers.CreateProblem)
+		admin.PUT("/problems/:id", manageProblems, problemHandlers.UpdateProblem)
+		admin.POST("/submissions/:id/rejudge", middleware.RequirePermission(rbac.Rejudge), submissionHandlers.Rejudge)
+
+		// Contest announcements
+		manageContests := middleware.RequirePermission(rbac.ManageContests)
+		admin.GET("/announcements", manageContests, announcementHandlers.AdminAnnouncements)
+		admin.POST("/announcements", manageContests, announcementHandlers.CreateAnnouncement)
+		admin.POST("/announcements/:id/publish", manageContests, announcementHandlers.PublishAnnouncement)
+		admin.POST("/announcements/:id/discard", manageContests, announcementHandlers.DiscardAnnouncement)
+		admin.POST("/announcements/:id/retract", manageContests, announcementHandlers.RetractAnnouncement)
 	}
+
+	return wbfyHandlers.StopCleanupJob
 }
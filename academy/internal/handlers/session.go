@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+
+	"github.com/gin-gonic/gin"
+	"github.com/globallstudent/academy/internal/auth"
+	"github.com/globallstudent/academy/internal/database"
+	"github.com/globallstudent/academy/internal/models"
+	"github.com/jackc/pgx/v5"
+)
+
+// findUserByTelegramID returns the account a Telegram user is linked to. The
+// second result is false if they haven't linked one.
+func findUserByTelegramID(ctx context.Context, db *database.DB, telegramID string) (models.User, bool, error) {
+	user, err := database.ScanUser(db.Pool.QueryRow(ctx, `
+		SELECT `+database.UserColumns+` FROM users
+		WHERE telegram_id = $1
+		ORDER BY registered_at DESC
+		LIMIT 1`, telegramID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.User{}, false, nil
+	}
+	if err != nil {
+		return models.User{}, false, err
+	}
+	return user, true, nil
+}
+
+// issueSession logs a user in: it signs a session token for them and sets
+// it as the session cookie. Every way of logging in ends here.
+func (h *PublicHandlers) issueSession(c *gin.Context, user models.User) error {
+	token, err := auth.GenerateToken(user.ID, user.Username, user.Role)
+	if err != nil {
+		return err
+	}
+
+	// Set secure cookie
+	secure := c.Request.TLS != nil || h.cfg.Environment == "production"
+	c.SetCookie(
+		h.cfg.Auth.CookieName,
+		token,
+		h.cfg.Auth.CookieMaxAge,
+		"/",
+		"",
+		secure,
+		true,
+	)
+
+	// Set the user in the context for consistent behavior
+	c.Set("user", user)
+	c.Set("IsAuthenticated", true)
+	return nil
+}
@@ -1,6 +1,8 @@
 package handlers
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"strings"
@@ -11,62 +13,46 @@ import (
 	"github.com/globallstudent/academy/internal/config"
 	"github.com/globallstudent/academy/internal/database"
 	"github.com/globallstudent/academy/internal/models"
+	"github.com/globallstudent/academy/internal/problems"
+	"github.com/globallstudent/academy/internal/rbac"
 )
 
 // SubmissionHandlers contains handlers for submission routes
 type SubmissionHandlers struct {
-	db  *database.DB
-	cfg *config.Config
+	db       *database.DB
+	cfg      *config.Config
+	problems *problems.Catalog
+	judge    *Judge
+	notifier Notifier
 }
 
 // NewSubmissionHandlers creates a new SubmissionHandlers instance
-func NewSubmissionHandlers(db *database.DB, cfg *config.Config) *SubmissionHandlers {
-	return &SubmissionHandlers{db: db, cfg: cfg}
+func NewSubmissionHandlers(db *database.DB, cfg *config.Config, catalog *problems.Catalog, judge *Judge, notifier Notifier) *SubmissionHandlers {
+	return &SubmissionHandlers{db: db, cfg: cfg, problems: catalog, judge: judge, notifier: notifier}
 }
 
 // SubmitPage godoc
 // @Summary      Display submission form
-// @Description  Renders the submission form for a specific problem
+// @Description  Redirects to the problem page, whose editor tests and submits solutions
 // @Tags         submission
 // @Accept       html
 // @Produce      html
 // @Security     JWTCookie
 // @Param        slug    path      string  true  "Problem slug"
-// @Success      200  {object}  nil  "Submission form page"
+// @Success      302  {object}  nil  "Redirect to the problem page"
 // @Failure      401  {object}  nil  "Unauthorized"
-// @Failure      500  {object}  nil  "Internal server error"
+// @Failure      404  {object}  nil  "Problem not found"
 // @Router       /submit/{slug} [get]
 func (h *SubmissionHandlers) SubmitPage(c *gin.Context) {
-	slug := c.Param("slug")
-
-	// Get problem by slug
-	problem, err := getProblemBySlug(h.db, slug)
-	if err != nil {
-		c.HTML(http.StatusInternalServerError, "pages/error.html", gin.H{
-			"Error": "Failed to get problem details",
-		})
-		return
-	}
-
-	// Get problem content
-	content, err := getProblemContent(problem.FilePath)
-	if err != nil {
-		c.HTML(http.StatusInternalServerError, "pages/submit.html", gin.H{
-			"Error": "Failed to load problem content",
+	problem, ok := h.problems.Problem(c.Param("slug"))
+	if !ok {
+		c.HTML(http.StatusNotFound, "pages/error.html", gin.H{
+			"Error": "Problem not found",
 		})
 		return
 	}
 
-	// Get supported languages
-	languages := getSupportedLanguages(problem.Type)
-
-	c.HTML(http.StatusOK, "pages/submit.html", gin.H{
-		"Title":     "Submit: " + problem.Title + " - Summer Academy",
-		"Problem":   problem,
-		"Content":   content,
-		"Languages": languages,
-		"WBFY":      h.cfg.WBFY,
-	})
+	c.Redirect(http.StatusFound, "/problems/"+problem.Slug)
 }
 
 // TestSubmission godoc
@@ -99,17 +85,24 @@ func (h *SubmissionHandlers) TestSubmission(c *gin.Context) {
 	}
 
 	// Get problem
-	problem, err := getProblemBySlug(h.db, slug)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
+	problem, ok := h.problems.Problem(slug)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{
 			"status":  "error",
-			"message": "Failed to get problem details",
+			"message": "Problem not found",
+		})
+		return
+	}
+	if !supportsLanguage(problem, language) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Unsupported language for this problem",
 		})
 		return
 	}
 
 	// Get test cases (only non-hidden ones for testing)
-	testcases, err := getTestcases(problem.ID, false)
+	testcases, err := problem.LoadTestcases(false)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"status":  "error",
@@ -119,7 +112,7 @@ func (h *SubmissionHandlers) TestSubmission(c *gin.Context) {
 	}
 
 	// Run tests
-	results, err := runTests(code, language, testcases, problem.Type)
+	results, err := h.judge.Run(c.Request.Context(), problem, language, code, testcases)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"status":  "error",
@@ -155,7 +148,7 @@ func (h *SubmissionHandlers) ProcessSubmission(c *gin.Context) {
 	language := c.PostForm("language")
 
 	// Get user ID from context
-	userID, exists := c.Get("userID")
+	userID, exists := currentUserID(c)
 	if !exists {
 		c.JSON(http.StatusUnauthorized, gin.H{
 			"status":  "error",
@@ -174,34 +167,65 @@ func (h *SubmissionHandlers) ProcessSubmission(c *gin.Context) {
 	}
 
 	// Get problem
-	problem, err := getProblemBySlug(h.db, slug)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
+	problem, ok := h.problems.Problem(slug)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{
 			"status":  "error",
-			"message": "Failed to get problem details",
+			"message": "Problem not found",
+		})
+		return
+	}
+	if !supportsLanguage(problem, language) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Unsupported language for this problem",
 		})
 		return
 	}
 
-	// Get all test cases (including hidden ones)
-	testcases, err := getTestcases(problem.ID, true)
+	// Run all tests and build the submission record
+	submission, results, err := gradeSubmission(c.Request.Context(), h.judge, userID, problem, language, code)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"status":  "error",
-			"message": "Failed to load test cases",
+			"message": "Failed to grade submission: " + err.Error(),
 		})
 		return
 	}
-
-	// Run tests
-	results, err := runTests(code, language, testcases, problem.Type)
-	if err != nil {
+	if err := saveSubmission(h.db, submission); err != nil {
+		fmt.Printf("Failed to save submission for %s: %v\n", problem.Slug, err)
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"status":  "error",
-			"message": "Failed to run tests: " + err.Error(),
+			"message": "Failed to record your submission",
 		})
 		return
 	}
+	h.notifier.SubmissionJudged(submission)
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":     "success",
+		"submission": submission,
+		"results":    visibleResults(c, results),
+	})
+}
+
+// gradeSubmission runs code against all of a problem's test cases (including hidden ones)
+// and builds the resulting submission record
+func gradeSubmission(ctx context.Context, judge *Judge, userID uuid.UUID, problem *problems.Problem, language, code string) (models.Submission, []TestResult, error) {
+	// Get all test cases (including hidden ones)
+	testcases, err := problem.LoadTestcases(true)
+	if err != nil {
+		return models.Submission{}, nil, fmt.Errorf("failed to load test cases: %w", err)
+	}
+	if len(testcases) == 0 {
+		return models.Submission{}, nil, fmt.Errorf("problem %s has no test cases", problem.Slug)
+	}
+
+	// Run tests
+	results, err := judge.Run(ctx, problem, language, code, testcases)
+	if err != nil {
+		return models.Submission{}, nil, fmt.Errorf("failed to run tests: %w", err)
+	}
 
 	// Calculate score
 	passed := 0
@@ -212,25 +236,96 @@ func (h *SubmissionHandlers) ProcessSubmission(c *gin.Context) {
 	}
 	score := int(float64(passed) / float64(len(testcases)) * float64(problem.Score))
 
+	// With subtasks, each group of test cases earns its points all-or-nothing
+	var sections []models.SectionScore
+	if len(problem.Subtasks) > 0 {
+		sections = scoreSubtasks(problem, results)
+		score = 0
+		for _, section := range sections {
+			score += section.Score
+		}
+	}
+
 	// Create submission record
 	submission := models.Submission{
 		ID:          uuid.New(),
-		UserID:      userID.(uuid.UUID),
+		UserID:      userID,
 		ProblemID:   problem.ID,
 		Language:    language,
 		Status:      getSubmissionStatus(passed, len(testcases)),
-		Output:      resultsToString(results),
+		Output:      subtasksToString(sections) + resultsToString(results),
 		Score:       score,
+		Sections:    sections,
+		Code:        code,
 		SubmittedAt: time.Now(),
 	}
 
-	// In production, save submission to database
+	return submission, results, nil
+}
 
-	c.JSON(http.StatusOK, gin.H{
-		"status":     "success",
-		"submission": submission,
-		"results":    results,
-	})
+// scoreSubtasks groups test results by subtask, in the order the problem lists
+// subtasks. A subtask scores its points only if all of its test cases passed.
+func scoreSubtasks(problem *problems.Problem, results []TestResult) []models.SectionScore {
+	sections := make([]models.SectionScore, len(problem.Subtasks))
+	index := make(map[string]int, len(problem.Subtasks))
+	for i, subtask := range problem.Subtasks {
+		sections[i] = models.SectionScore{Name: subtask.Name, MaxScore: subtask.Points}
+		index[subtask.Name] = i
+	}
+
+	failed := make([]bool, len(sections))
+	for i, result := range results {
+		j, ok := index[result.Subtask]
+		if !ok {
+			continue
+		}
+
+		check := models.CheckResult{
+			ID:          fmt.Sprintf("test-%d", i+1),
+			Description: fmt.Sprintf("Test case %d", i+1),
+			Passed:      result.Passed,
+		}
+		switch {
+		case result.Passed:
+		case result.IsHidden:
+			check.Description += " (hidden)"
+			check.Message = "Failed"
+		case result.Error != "":
+			check.Message = lastLines(result.Error, 1)
+		default:
+			check.Message = "Wrong answer"
+		}
+		sections[j].Checks = append(sections[j].Checks, check)
+		failed[j] = failed[j] || !result.Passed
+	}
+
+	for i := range sections {
+		if !failed[i] && len(sections[i].Checks) > 0 {
+			sections[i].Score = sections[i].MaxScore
+		}
+	}
+	return sections
+}
+
+// saveSubmission stores a graded submission
+func saveSubmission(db *database.DB, submission models.Submission) error {
+	var sections []byte
+	if len(submission.Sections) > 0 {
+		var err error
+		if sections, err = json.Marshal(submission.Sections); err != nil {
+			return err
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := db.Pool.Exec(ctx, `
+		INSERT INTO submissions (id, user_id, problem_id, language, status, output, score, sections, code, submitted_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NULLIF($9, ''), $10)`,
+		submission.ID, submission.UserID, submission.ProblemID, submission.Language, submission.Status,
+		submission.Output, submission.Score, sections, submission.Code, submission.SubmittedAt)
+	return err
 }
 
 // TestResult represents the result of a single test case
@@ -240,6 +335,8 @@ type TestResult struct {
 	ActualOutput   string `json:"actual_output"`
 	Passed         bool   `json:"passed"`
 	IsHidden       bool   `json:"is_hidden"`
+	Error          string `json:"error,omitempty"`   // Why the program failed to compile or run
+	Subtask        string `json:"subtask,omitempty"` // Subtask the test case is scored with
 }
 
 // Helper function to get supported languages
@@ -256,23 +353,45 @@ func getSupportedLanguages(problemType string) []string {
 	}
 }
 
-// Helper function to run tests
-func runTests(code, language string, testcases []models.Testcase, problemType string) ([]TestResult, error) {
-	results := make([]TestResult, len(testcases))
-
-	// In a real implementation, this would run code in a container
-	// For this example, we'll simulate test results
-	for i, testcase := range testcases {
-		results[i] = TestResult{
-			Input:          testcase.Input,
-			ExpectedOutput: testcase.ExpectedOutput,
-			ActualOutput:   testcase.ExpectedOutput, // Simulate correct output
-			Passed:         true,
-			IsHidden:       testcase.IsHidden,
+// problemLanguages returns the languages a problem accepts. Problems with
+// function-signature harnesses accept the languages they have drivers for.
+func problemLanguages(problem *problems.Problem) []string {
+	if len(problem.Harness) > 0 {
+		return problem.HarnessLanguages()
+	}
+	return getSupportedLanguages(problem.Type)
+}
+
+// supportsLanguage reports whether a problem accepts solutions in language
+func supportsLanguage(problem *problems.Problem, language string) bool {
+	for _, l := range problemLanguages(problem) {
+		if l == language {
+			return true
+		}
+	}
+	return false
+}
+
+// redactHiddenResults blanks out the details of hidden test cases, so results
+// can be shown to students without giving the cases away
+func redactHiddenResults(results []TestResult) []TestResult {
+	redacted := make([]TestResult, len(results))
+	for i, result := range results {
+		if result.IsHidden {
+			result = TestResult{Passed: result.Passed, IsHidden: true, Subtask: result.Subtask}
 		}
+		redacted[i] = result
 	}
+	return redacted
+}
 
-	return results, nil
+// visibleResults returns results as the requester may see them: in full for
+// roles that can view hidden tests, redacted for everyone else
+func visibleResults(c *gin.Context, results []TestResult) []TestResult {
+	if can(c, rbac.ViewHiddenTests) {
+		return results
+	}
+	return redactHiddenResults(results)
 }
 
 // Helper function to get submission status
@@ -285,17 +404,38 @@ func getSubmissionStatus(passed, total int) string {
 	return "failed"
 }
 
+// subtasksToString summarises subtask scores for the plain-text submission output
+func subtasksToString(sections []models.SectionScore) string {
+	if len(sections) == 0 {
+		return ""
+	}
+
+	var sb strings.Builder
+	for _, section := range sections {
+		sb.WriteString(fmt.Sprintf("%s: %d/%d\n", section.Name, section.Score, section.MaxScore))
+	}
+	sb.WriteString("\n")
+	return sb.String()
+}
+
 // Helper function to convert test results to string
 func resultsToString(results []TestResult) string {
 	var sb strings.Builder
 	for i, result := range results {
-		sb.WriteString(fmt.Sprintf("Test Case %d: %s\n", i+1, statusString(result.Passed)))
+		if result.Subtask != "" {
+			sb.WriteString(fmt.Sprintf("Test Case %d (%s): %s\n", i+1, result.Subtask, statusString(result.Passed)))
+		} else {
+			sb.WriteString(fmt.Sprintf("Test Case %d: %s\n", i+1, statusString(result.Passed)))
+		}
 		if !result.IsHidden {
 			sb.WriteString(fmt.Sprintf("Input: %s\n", result.Input))
 			sb.WriteString(fmt.Sprintf("Expected: %s\n", result.ExpectedOutput))
 			if !result.Passed {
 				sb.WriteString(fmt.Sprintf("Actual: %s\n", result.ActualOutput))
 			}
+			if result.Error != "" {
+				sb.WriteString(result.Error + "\n")
+			}
 		}
 		sb.WriteString("\n")
 	}
@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/globallstudent/academy/internal/problems"
+)
+
+func TestScoreSubtasks(t *testing.T) {
+	problem := &problems.Problem{Subtasks: []problems.Subtask{
+		{Name: "small", Points: 20},
+		{Name: "medium", Points: 30},
+		{Name: "large", Points: 50},
+	}}
+
+	tests := []struct {
+		name    string
+		results []TestResult
+		want    []int // score per subtask, in the order the problem lists them
+	}{
+		{
+			name: "all passed",
+			results: []TestResult{
+				{Passed: true, Subtask: "small"},
+				{Passed: true, Subtask: "medium"},
+				{Passed: true, Subtask: "large"},
+			},
+			want: []int{20, 30, 50},
+		},
+		{
+			name: "one failure loses the whole subtask",
+			results: []TestResult{
+				{Passed: true, Subtask: "small"},
+				{Passed: true, Subtask: "small"},
+				{Passed: true, Subtask: "medium"},
+				{Passed: false, Subtask: "medium"},
+				{Passed: true, Subtask: "large"},
+			},
+			want: []int{20, 0, 50},
+		},
+		{
+			name: "many easy cases don't outweigh one hard case",
+			results: []TestResult{
+				{Passed: true, Subtask: "small"},
+				{Passed: true, Subtask: "small"},
+				{Passed: true, Subtask: "small"},
+				{Passed: true, Subtask: "small"},
+				{Passed: false, Subtask: "large", IsHidden: true},
+			},
+			want: []int{20, 0, 0},
+		},
+		{
+			name: "subtask without results scores nothing",
+			results: []TestResult{
+				{Passed: true, Subtask: "small"},
+			},
+			want: []int{20, 0, 0},
+		},
+		{
+			name: "unknown subtasks are ignored",
+			results: []TestResult{
+				{Passed: false, Subtask: "bonus"},
+				{Passed: true, Subtask: "large"},
+			},
+			want: []int{0, 0, 50},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sections := scoreSubtasks(problem, tt.results)
+			if len(sections) != len(problem.Subtasks) {
+				t.Fatalf("got %d sections, want %d", len(sections), len(problem.Subtasks))
+			}
+			for i, section := range sections {
+				if section.Name != problem.Subtasks[i].Name || section.MaxScore != problem.Subtasks[i].Points {
+					t.Errorf("section %d = %s/%d, want %s/%d", i, section.Name, section.MaxScore, problem.Subtasks[i].Name, problem.Subtasks[i].Points)
+				}
+				if section.Score != tt.want[i] {
+					t.Errorf("section %s scored %d, want %d", section.Name, section.Score, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestScoreSubtasksCheckMessages(t *testing.T) {
+	problem := &problems.Problem{Subtasks: []problems.Subtask{{Name: "all", Points: 10}}}
+	results := []TestResult{
+		{Passed: true, Subtask: "all"},
+		{Passed: false, IsHidden: true, Subtask: "all"},
+		{Passed: false, Error: "line 1\nSyntaxError: invalid syntax", Subtask: "all"},
+		{Passed: false, Subtask: "all"},
+	}
+
+	checks := scoreSubtasks(problem, results)[0].Checks
+	want := []struct {
+		description, message string
+	}{
+		{"Test case 1", ""},
+		{"Test case 2 (hidden)", "Failed"},
+		{"Test case 3", "SyntaxError: invalid syntax"},
+		{"Test case 4", "Wrong answer"},
+	}
+	if len(checks) != len(want) {
+		t.Fatalf("got %d checks, want %d", len(checks), len(want))
+	}
+	for i, check := range checks {
+		if check.Description != want[i].description || check.Message != want[i].message {
+			t.Errorf("check %d = %q/%q, want %q/%q", i, check.Description, check.Message, want[i].description, want[i].message)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/globallstudent/academy/internal/auth"
+)
+
+// TelegramLogin godoc
+// @Summary      Log in with the Telegram Login Widget
+// @Description  Verifies the signed data the Telegram Login Widget redirects with, and logs in the account linked to the Telegram user
+// @Tags         auth
+// @Produce      html
+// @Param        id         query  string  true   "Telegram user ID"
+// @Param        auth_date  query  string  true   "When the user authorized, in Unix seconds"
+// @Param        hash       query  string  true   "Signature of the other fields"
+// @Success      302  {object}  nil  "Redirect to days page"
+// @Failure      401  {object}  nil  "Invalid or expired login data"
+// @Failure      403  {object}  nil  "Telegram account not linked"
+// @Router       /auth/telegram [get]
+func (h *PublicHandlers) TelegramLogin(c *gin.Context) {
+	renderError := func(status int, errorMsg string) {
+		c.HTML(status, "main", h.loginPageData(gin.H{
+			"Title": "Login - Summer Academy",
+			"Error": errorMsg,
+		}))
+	}
+
+	login, err := auth.VerifyTelegramLogin(h.cfg.Telegram.BotToken, c.Request.URL.Query(), h.cfg.Telegram.LoginMaxAge)
+	if err != nil {
+		log.Printf("Rejected Telegram login from %s: %v", c.ClientIP(), err)
+		msg := "Telegram login failed. Please try again or log in with a code from the bot."
+		if errors.Is(err, auth.ErrTelegramLoginExpired) {
+			msg = "Your Telegram login has expired. Please log in again."
+		}
+		renderError(http.StatusUnauthorized, msg)
+		return
+	}
+
+	// The widget doesn't share phone numbers, so only Telegram users the bot
+	// has linked to an account can log in this way
+	ctx := c.Request.Context()
+	user, found, err := h.findTelegramUser(ctx, strconv.FormatInt(login.ID, 10))
+	if err != nil {
+		log.Printf("Error looking up Telegram user %d: %v", login.ID, err)
+		renderError(http.StatusInternalServerError, "Failed to load your account. Please try again.")
+		return
+	}
+	if !found {
+		renderError(http.StatusForbidden,
+			"This Telegram account isn't linked yet. Send /login to the bot and share your phone number once, then try again.")
+		return
+	}
+
+	if err := h.issueSession(c, user); err != nil {
+		renderError(http.StatusInternalServerError, "Failed to generate session token. Please try again.")
+		return
+	}
+	log.Printf("User %s logged in with Telegram account %d", user.ID, login.ID)
+	c.Redirect(http.StatusFound, "/days")
+}
@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"context"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/globallstudent/academy/internal/auth"
+	"github.com/globallstudent/academy/internal/config"
+	"github.com/globallstudent/academy/internal/models"
+	"github.com/globallstudent/academy/internal/ratelimit"
+	"github.com/google/uuid"
+)
+
+const testBotToken = "123456:test-bot-token"
+
+// telegramLoginRouter serves TelegramLogin with accounts looked up in linked,
+// keyed by Telegram user ID
+func telegramLoginRouter(linked map[string]models.User) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	cfg := &config.Config{
+		Auth:     config.AuthConfig{CookieName: "academy_session", CookieMaxAge: 3600, OTPLength: 6},
+		Telegram: config.TelegramConfig{BotToken: testBotToken, LoginMaxAge: time.Hour},
+	}
+	h := &PublicHandlers{
+		otp: auth.NewOTPService(cfg.Auth, auth.NewMemoryOTPStore(), ratelimit.NewMemoryLimiter(), ratelimit.Rule{}),
+		cfg: cfg,
+		findTelegramUser: func(ctx context.Context, telegramID string) (models.User, bool, error) {
+			user, found := linked[telegramID]
+			return user, found, nil
+		},
+	}
+
+	r := gin.New()
+	r.SetHTMLTemplate(template.Must(template.New("main").Parse(`{{.Error}}`)))
+	r.GET("/auth/telegram", h.TelegramLogin)
+	return r
+}
+
+// telegramLoginQuery returns widget data for Telegram user id, signed with botToken
+func telegramLoginQuery(botToken string, id int64) string {
+	values := url.Values{
+		"id":         {strconv.FormatInt(id, 10)},
+		"first_name": {"Ada"},
+		"auth_date":  {strconv.FormatInt(time.Now().Unix(), 10)},
+	}
+	values.Set("hash", auth.SignTelegramLogin(botToken, values))
+	return values.Encode()
+}
+
+func TestTelegramLogin(t *testing.T) {
+	user := models.User{ID: uuid.New(), Username: "ada", Role: "student"}
+	router := telegramLoginRouter(map[string]models.User{"42": user})
+
+	tests := []struct {
+		name         string
+		query        string
+		wantStatus   int
+		wantLocation string
+		wantCookie   bool
+	}{
+		{
+			name:         "linked account",
+			query:        telegramLoginQuery(testBotToken, 42),
+			wantStatus:   http.StatusFound,
+			wantLocation: "/days",
+			wantCookie:   true,
+		},
+		{
+			name:       "unlinked account",
+			query:      telegramLoginQuery(testBotToken, 43),
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "signed by another bot",
+			query:      telegramLoginQuery("654321:another-bot", 42),
+			wantStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/auth/telegram?"+tt.query, nil))
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (%s)", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if got := w.Header().Get("Location"); got != tt.wantLocation {
+				t.Errorf("Location = %q, want %q", got, tt.wantLocation)
+			}
+
+			var session *http.Cookie
+			for _, cookie := range w.Result().Cookies() {
+				if cookie.Name == "academy_session" {
+					session = cookie
+				}
+			}
+			if !tt.wantCookie {
+				if session != nil {
+					t.Errorf("session cookie set: %v", session)
+				}
+				return
+			}
+			if session == nil {
+				t.Fatal("no session cookie")
+			}
+			claims, err := auth.ValidateToken(session.Value)
+			if err != nil {
+				t.Fatalf("session token is invalid: %v", err)
+			}
+			if claims.UserID != user.ID || claims.Role != user.Role {
+				t.Errorf("session token = %+v, want user %s", claims, user.ID)
+			}
+			if !strings.Contains(session.String(), "HttpOnly") {
+				t.Error("session cookie is not HttpOnly")
+			}
+		})
+	}
+}
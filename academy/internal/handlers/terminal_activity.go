@@ -0,0 +1,279 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// touchSession records activity on a session, postponing its idle timeout
+func (h *WBFYHandlers) touchSession(sessionID string) {
+	h.activityMutex.Lock()
+	h.activity[sessionID] = time.Now()
+	h.activityMutex.Unlock()
+}
+
+// lastActivity returns when a session was last used. Sessions that were never
+// touched count from when they were created.
+func (h *WBFYHandlers) lastActivity(session *TerminalSession) time.Time {
+	h.activityMutex.Lock()
+	defer h.activityMutex.Unlock()
+
+	if last, ok := h.activity[session.ID]; ok {
+		return last
+	}
+	return session.CreatedAt
+}
+
+// forgetActivity drops the activity record of a removed session
+func (h *WBFYHandlers) forgetActivity(sessionID string) {
+	h.activityMutex.Lock()
+	delete(h.activity, sessionID)
+	h.activityMutex.Unlock()
+}
+
+// idle reports whether nobody has used a ready session for longer than the idle timeout
+func (h *WBFYHandlers) idle(session *TerminalSession, now time.Time) bool {
+	if session.State != SessionReady || h.cfg.WBFY.IdleTimeout <= 0 {
+		return false
+	}
+	return now.Sub(h.lastActivity(session)) > h.cfg.WBFY.IdleTimeout
+}
+
+// liveSessionsLocked counts the sessions that are starting or running.
+// The caller must hold sessionMutex.
+func (h *WBFYHandlers) liveSessionsLocked() int {
+	live := 0
+	for _, session := range h.sessionMap {
+		if session.live() {
+			live++
+		}
+	}
+	return live
+}
+
+// ExtendTerminal godoc
+// @Summary      Extend a terminal session
+// @Description  Pushes back a session's expiry, up to the maximum session lifetime
+// @Tags         terminal
+// @Produce      json
+// @Security     JWTCookie
+// @Param        id    path      string  true  "Terminal session ID"
+// @Success      200  {object}  map[string]interface{}  "New expiry time"
+// @Failure      403  {object}  map[string]interface{}  "Forbidden"
+// @Failure      404  {object}  map[string]interface{}  "Session not found"
+// @Failure      409  {object}  map[string]interface{}  "Session can't be extended any further"
+// @Router       /terminals/{id}/extend [post]
+func (h *WBFYHandlers) ExtendTerminal(c *gin.Context) {
+	session, exists := h.getSession(c.Param("id"))
+	if !exists || !session.live() {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "error",
+			"message": "Terminal session not found",
+		})
+		return
+	}
+
+	user, _ := currentUser(c)
+	if role, ok := terminalRoleFor(session, user, ""); !ok || role != TerminalRoleOwner {
+		c.JSON(http.StatusForbidden, gin.H{
+			"status":  "error",
+			"message": "Only the owner can extend this session",
+		})
+		return
+	}
+
+	limit := session.CreatedAt.Add(h.cfg.WBFY.MaxSessionLifetime)
+	expiresAt := session.ExpiresAt.Add(h.cfg.WBFY.SessionExtension)
+	if expiresAt.After(limit) {
+		expiresAt = limit
+	}
+	if !expiresAt.After(session.ExpiresAt) {
+		c.JSON(http.StatusConflict, gin.H{
+			"status":  "error",
+			"message": "This session has reached its maximum length",
+		})
+		return
+	}
+
+	updated, ok := h.updateSession(session.ID, func(s *TerminalSession) {
+		s.ExpiresAt = expiresAt
+	})
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "error",
+			"message": "Terminal session not found",
+		})
+		return
+	}
+	h.touchSession(session.ID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":     "success",
+		"expires_at": updated.ExpiresAt,
+	})
+}
+
+// activityWriter wraps a response writer so that terminal input read from a
+// hijacked (WebSocket) connection counts as session activity
+type activityWriter struct {
+	gin.ResponseWriter
+	touch func()
+}
+
+// Hijack takes over the connection, reporting input frames from the client
+func (w activityWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("connection can't be hijacked")
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+	return &activityConn{Conn: conn, touch: w.touch}, rw, nil
+}
+
+// activityConn is a WebSocket connection that reports when the client sends
+// terminal input
+type activityConn struct {
+	net.Conn
+	touch  func()
+	frames inputFrames
+}
+
+// Read reads from the client and records the activity
+func (c *activityConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 && c.frames.feed(b[:n]) {
+		c.touch()
+	}
+	return n, err
+}
+
+// Kinds of WebSocket frames, as far as activity is concerned
+const (
+	frameOther   = iota // control frames and wbfy commands
+	frameInput          // keystrokes for the PTY
+	frameUnknown        // a text frame whose start hasn't been seen yet
+)
+
+// inputFrames follows the WebSocket frames a client sends and picks out the
+// ones carrying terminal input: binary messages, and text messages other than
+// wbfy's RESIZE: and CONTROL: commands. Pings, pongs and closes don't count,
+// so a connected but unused terminal still goes idle.
+type inputFrames struct {
+	header    []byte // header of the current frame, while it's being read
+	remaining uint64 // payload bytes of the current frame still to come
+	mask      [4]byte
+	prefix    []byte // unmasked start of a text frame, to recognise commands
+	opcode    byte
+	kind      int
+	message   int // kind of the fragmented message being continued
+}
+
+// feed follows the bytes read from the client, reporting whether any input
+// frame was completed
+func (f *inputFrames) feed(b []byte) bool {
+	input := false
+	for len(b) > 0 {
+		if f.remaining == 0 {
+			f.header = append(f.header, b[0])
+			b = b[1:]
+			if f.startFrame() && f.remaining == 0 {
+				input = f.endFrame() || input
+			}
+			continue
+		}
+
+		n := uint64(len(b))
+		if n > f.remaining {
+			n = f.remaining
+		}
+		if f.kind == frameUnknown {
+			for _, c := range b[:n] {
+				if len(f.prefix) == len("CONTROL:") {
+					break
+				}
+				f.prefix = append(f.prefix, c^f.mask[len(f.prefix)%4])
+			}
+		}
+		f.remaining -= n
+		b = b[n:]
+		if f.remaining == 0 {
+			input = f.endFrame() || input
+		}
+	}
+	return input
+}
+
+// startFrame parses the header read so far, returning false until it's complete
+func (f *inputFrames) startFrame() bool {
+	h := f.header
+	if len(h) < 2 {
+		return false
+	}
+	size := 2
+	switch h[1] & 0x7f {
+	case 126:
+		size += 2
+	case 127:
+		size += 8
+	}
+	masked := h[1]&0x80 != 0
+	if masked {
+		size += 4
+	}
+	if len(h) < size {
+		return false
+	}
+
+	f.opcode = h[0] & 0x0f
+	switch length := h[1] & 0x7f; length {
+	case 126:
+		f.remaining = uint64(binary.BigEndian.Uint16(h[2:4]))
+	case 127:
+		f.remaining = binary.BigEndian.Uint64(h[2:10])
+	default:
+		f.remaining = uint64(length)
+	}
+	f.mask = [4]byte{}
+	if masked {
+		copy(f.mask[:], h[size-4:size])
+	}
+
+	switch f.opcode {
+	case 0x0: // continuation
+		f.kind = f.message
+	case 0x1: // text
+		f.kind = frameUnknown
+	case 0x2: // binary
+		f.kind = frameInput
+	default:
+		f.kind = frameOther
+	}
+	f.header = nil
+	f.prefix = f.prefix[:0]
+	return true
+}
+
+// endFrame finishes the current frame, reporting whether it carried input
+func (f *inputFrames) endFrame() bool {
+	if f.kind == frameUnknown {
+		f.kind = frameInput
+		if bytes.HasPrefix(f.prefix, []byte("RESIZE:")) || bytes.HasPrefix(f.prefix, []byte("CONTROL:")) {
+			f.kind = frameOther
+		}
+	}
+	// Control frames may arrive in the middle of a fragmented message
+	if f.opcode < 0x8 {
+		f.message = f.kind
+	}
+	return f.kind == frameInput
+}
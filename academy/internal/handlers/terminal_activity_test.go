@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"strings"
+	"testing"
+)
+
+// clientFrame encodes a masked WebSocket frame as a browser sends it
+func clientFrame(fin bool, opcode byte, payload string) []byte {
+	first := opcode
+	if fin {
+		first |= 0x80
+	}
+	frame := []byte{first}
+	switch {
+	case len(payload) < 126:
+		frame = append(frame, 0x80|byte(len(payload)))
+	case len(payload) <= 0xffff:
+		frame = append(frame, 0x80|126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(len(payload)))
+	default:
+		frame = append(frame, 0x80|127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(len(payload)))
+	}
+	mask := []byte{0x37, 0xfa, 0x21, 0x3d}
+	frame = append(frame, mask...)
+	for i := 0; i < len(payload); i++ {
+		frame = append(frame, payload[i]^mask[i%4])
+	}
+	return frame
+}
+
+func TestInputFrames(t *testing.T) {
+	tests := []struct {
+		name   string
+		frames [][]byte
+		want   []bool // whether each frame counts as input
+	}{
+		{
+			name:   "keystrokes",
+			frames: [][]byte{clientFrame(true, 0x2, "ls\r")},
+			want:   []bool{true},
+		},
+		{
+			name:   "text keystrokes",
+			frames: [][]byte{clientFrame(true, 0x1, "ls\r")},
+			want:   []bool{true},
+		},
+		{
+			name:   "resize",
+			frames: [][]byte{clientFrame(true, 0x1, "RESIZE:80,24")},
+			want:   []bool{false},
+		},
+		{
+			name:   "control request",
+			frames: [][]byte{clientFrame(true, 0x1, "CONTROL:request")},
+			want:   []bool{false},
+		},
+		{
+			name:   "ping, pong and close",
+			frames: [][]byte{clientFrame(true, 0x9, "p"), clientFrame(true, 0xa, ""), clientFrame(true, 0x8, "")},
+			want:   []bool{false, false, false},
+		},
+		{
+			name:   "long paste",
+			frames: [][]byte{clientFrame(true, 0x2, strings.Repeat("x", 70000)), clientFrame(true, 0x1, "RESIZE:120,40")},
+			want:   []bool{true, false},
+		},
+		{
+			name: "fragmented command with a ping in between",
+			frames: [][]byte{
+				clientFrame(false, 0x1, "CONTROL:"),
+				clientFrame(true, 0x9, ""),
+				clientFrame(true, 0x0, "release"),
+				clientFrame(true, 0x2, "q"),
+			},
+			want: []bool{false, false, false, true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Whole frames at a time
+			var f inputFrames
+			for i, frame := range tt.frames {
+				if got := f.feed(frame); got != tt.want[i] {
+					t.Errorf("frame %d: input = %v, want %v", i+1, got, tt.want[i])
+				}
+			}
+
+			// One byte at a time, as reads may split frames anywhere
+			var split inputFrames
+			for i, frame := range tt.frames {
+				got := false
+				for j := range frame {
+					got = split.feed(frame[j:j+1]) || got
+				}
+				if got != tt.want[i] {
+					t.Errorf("frame %d read byte by byte: input = %v, want %v", i+1, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestActivityConnCountsOnlyInput(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+
+	touches := 0
+	conn := &activityConn{Conn: server, touch: func() { touches++ }}
+	defer conn.Close()
+
+	stream := bytes.Join([][]byte{
+		clientFrame(true, 0x1, "RESIZE:80,24"),
+		clientFrame(true, 0x9, ""),
+		clientFrame(true, 0x2, "echo hi\r"),
+		clientFrame(true, 0xa, ""),
+	}, nil)
+	go client.Write(stream)
+
+	buf := make([]byte, len(stream))
+	for read := 0; read < len(stream); {
+		n, err := conn.Read(buf[read:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		read += n
+	}
+	if !bytes.Equal(buf, stream) {
+		t.Error("the stream was changed on its way through")
+	}
+	if touches != 1 {
+		t.Errorf("touched %d times, want 1", touches)
+	}
+}
@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/globallstudent/academy/internal/container"
+	"github.com/globallstudent/academy/internal/models"
+	"github.com/globallstudent/academy/internal/problems"
+	"github.com/google/uuid"
+)
+
+// CheckWork godoc
+// @Summary      Check my work
+// @Description  Grades the session's work and records a submission with a score per section. Linux problems run their verifier inside the session container; build problems run their grader scenarios against a copy of the workspace in a fresh container.
+// @Tags         workspace
+// @Produce      json
+// @Security     JWTCookie
+// @Param        id    path      string  true  "Terminal session ID"
+// @Success      200  {object}  map[string]interface{}  "Submission with section scores"
+// @Failure      400  {object}  map[string]interface{}  "Problem can't be checked automatically"
+// @Failure      403  {object}  map[string]interface{}  "Forbidden"
+// @Failure      404  {object}  map[string]interface{}  "Session not found"
+// @Failure      409  {object}  map[string]interface{}  "Session not ready"
+// @Failure      500  {object}  map[string]interface{}  "Internal server error"
+// @Router       /workspace/{id}/check [post]
+func (h *WBFYHandlers) CheckWork(c *gin.Context) {
+	session, ok := h.workspaceSession(c, true)
+	if !ok {
+		return
+	}
+
+	problem, err := h.getProblemBySlug(session.ProblemSlug)
+	if err != nil || (problem.Verifier == nil && problem.Grader == nil) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "This problem can't be checked automatically",
+		})
+		return
+	}
+
+	var sections []models.SectionScore
+	if problem.Verifier != nil {
+		sections, err = h.runVerifier(c.Request.Context(), session, problem)
+	} else {
+		sections, err = h.runGrader(c.Request.Context(), session, problem)
+	}
+	if err != nil {
+		fmt.Printf("Checking session %s failed: %v\n", session.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Failed to check your work",
+		})
+		return
+	}
+
+	score, maxScore := 0, 0
+	for _, section := range sections {
+		score += section.Score
+		maxScore += section.MaxScore
+	}
+
+	submission := models.Submission{
+		ID:          uuid.New(),
+		UserID:      session.UserID,
+		ProblemID:   problem.ID,
+		Language:    session.Language,
+		Status:      getSubmissionStatus(score, maxScore),
+		Output:      sectionsToString(sections),
+		Score:       score,
+		Sections:    sections,
+		SubmittedAt: time.Now(),
+	}
+	if err := saveSubmission(h.db, submission); err != nil {
+		fmt.Printf("Failed to save submission for session %s: %v\n", session.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Failed to record your submission",
+		})
+		return
+	}
+	h.notifier.SubmissionJudged(submission)
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":     "success",
+		"submission": submission,
+		"max_score":  maxScore,
+	})
+}
+
+// runVerifier runs a problem's verifier inside the session container and grades its output
+func (h *WBFYHandlers) runVerifier(ctx context.Context, session *TerminalSession, problem *problems.Problem) ([]models.SectionScore, error) {
+	script, err := problem.ReadScript()
+	if err != nil {
+		return nil, err
+	}
+
+	// Pass the script as an argument so it never touches the workspace
+	ctx, cancel := context.WithTimeout(ctx, problem.Verifier.RunTimeout())
+	defer cancel()
+	result, err := h.runtime.Exec(ctx, session.ContainerID, container.ExecOptions{
+		Cmd: []string{"bash", "-c", script, "verify"},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("verifier failed: %w", err)
+	}
+	return problem.Verifier.Grade(result.Stdout), nil
+}
+
+// sectionsToString renders section scores as the plain-text submission output
+func sectionsToString(sections []models.SectionScore) string {
+	var sb strings.Builder
+	for _, section := range sections {
+		sb.WriteString(fmt.Sprintf("%s: %d/%d\n", section.Name, section.Score, section.MaxScore))
+		for _, check := range section.Checks {
+			sb.WriteString(fmt.Sprintf("  [%s] %s\n", statusString(check.Passed), check.Description))
+			if !check.Passed && check.Message != "" {
+				sb.WriteString(fmt.Sprintf("         %s\n", check.Message))
+			}
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/globallstudent/academy/internal/config"
+	"github.com/globallstudent/academy/internal/container"
+	"github.com/globallstudent/academy/internal/problems"
+)
+
+func TestRunVerifier(t *testing.T) {
+	dir := t.TempDir()
+	script := "test -f todo.txt && echo PASS todo-exists || echo FAIL todo-exists missing"
+	if err := os.WriteFile(filepath.Join(dir, "verify.sh"), []byte(script), 0644); err != nil {
+		t.Fatal(err)
+	}
+	problem := &problems.Problem{Slug: "linux-basics", Dir: dir, Verifier: &problems.Verifier{
+		Script: "verify.sh",
+		Checks: []problems.Check{{ID: "todo-exists", Section: "Files", Points: 10}},
+	}}
+
+	tests := []struct {
+		name      string
+		result    *container.ExecResult
+		err       error
+		wantScore int
+		wantErr   bool
+	}{
+		{name: "check passes", result: &container.ExecResult{Stdout: "PASS todo-exists\n"}, wantScore: 10},
+		{name: "check fails", result: &container.ExecResult{Stdout: "FAIL todo-exists missing\n"}},
+		{name: "script exits non-zero after reporting", result: &container.ExecResult{ExitCode: 1, Stdout: "PASS todo-exists\n"}, wantScore: 10},
+		{name: "container unreachable", err: errors.New("no such container"), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cmd []string
+			runtime := stubRuntime{exec: func(ctx context.Context, opts container.ExecOptions) (*container.ExecResult, error) {
+				cmd = opts.Cmd
+				return tt.result, tt.err
+			}}
+			h := NewWBFYHandlers(nil, &config.Config{}, runtime, nil, nil, nil, nil)
+
+			sections, err := h.runVerifier(context.Background(), &TerminalSession{ContainerID: "c1"}, problem)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("runVerifier succeeded, want error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			// The script is passed as an argument and never written to the workspace
+			if len(cmd) < 3 || cmd[0] != "bash" || cmd[1] != "-c" || cmd[2] != script {
+				t.Errorf("command = %q", cmd)
+			}
+			if len(sections) != 1 || sections[0].Score != tt.wantScore || sections[0].MaxScore != 10 {
+				t.Errorf("sections = %+v, want a score of %d/10", sections, tt.wantScore)
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/globallstudent/academy/internal/container"
+	"github.com/globallstudent/academy/internal/models"
+	"github.com/globallstudent/academy/internal/problems"
+	"github.com/google/uuid"
+)
+
+// graderPrelude runs before every grader command: it gives the command a fresh
+// home directory and puts the student's workspace on the PATH, so a program
+// named "todo" in the workspace runs as "todo"
+const graderPrelude = `mkdir -p "$HOME" && cd "$HOME" && export PATH="` + container.WorkspacePath + `:$PATH"` + "\n"
+
+// runGrader grades a build problem. The student's workspace is copied and run
+// in a fresh container without network access, so the scenarios can't disturb
+// the student's session and leftovers in the session can't affect the grade.
+func (h *WBFYHandlers) runGrader(ctx context.Context, session *TerminalSession, problem *problems.Problem) ([]models.SectionScore, error) {
+	grader := problem.Grader
+
+	dir, err := os.MkdirTemp("", "academy-grade-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	if err := copyProblemFiles(session.TempDir, dir); err != nil {
+		return nil, fmt.Errorf("failed to copy workspace: %w", err)
+	}
+	for name := range reservedWorkspaceFiles {
+		os.Remove(filepath.Join(dir, name))
+	}
+	if err := chownWorkspace(dir, h.cfg.WBFY.WorkspaceUID, h.cfg.WBFY.WorkspaceGID); err != nil {
+		return nil, err
+	}
+
+	gradingID := uuid.New().String()
+	containerID, err := startScratchContainer(ctx, h.runtime, h.cfg.WBFY, container.StartOptions{
+		Name:  terminalContainerPrefix + "grade-" + gradingID,
+		Image: getDockerImage(session.Language),
+		Env:   map[string]string{"PROBLEM_TYPE": problem.Type},
+		Labels: map[string]string{
+			"academy.grading": session.ID,
+			"academy.user":    session.UserID.String(),
+		},
+		Workspace: dir,
+	}, problem.Type, session.Language)
+	if err != nil {
+		return nil, err
+	}
+	defer stopScratchContainer(h.runtime, containerID)
+
+	run := func(home, command string, args ...string) (*container.ExecResult, error) {
+		stepCtx, cancel := context.WithTimeout(ctx, grader.StepTimeout())
+		defer cancel()
+		return h.runtime.Exec(stepCtx, containerID, container.ExecOptions{
+			Cmd: append([]string{"bash", "-c", graderPrelude + command, "grade"}, args...),
+			Env: []string{"HOME=" + home},
+		})
+	}
+
+	// A failed build fails every scenario, with the build's output as the reason
+	buildFailure := ""
+	if grader.Build != "" {
+		result, err := run(container.WorkspacePath, grader.Build)
+		switch {
+		case err != nil:
+			buildFailure = "Build did not finish: " + err.Error()
+		case result.OutputTruncated:
+			buildFailure = "Build failed: output limit exceeded"
+		case result.ExitCode != 0:
+			buildFailure = "Build failed: " + lastLines(result.Stdout+result.Stderr, 10)
+		}
+	}
+
+	sections := make([]models.SectionScore, 0, len(grader.Scenarios))
+	for i, scenario := range grader.Scenarios {
+		home := fmt.Sprintf("/tmp/%s-%d", gradingID, i+1)
+		section := models.SectionScore{Name: scenario.Name, MaxScore: scenario.Points}
+
+		failed := buildFailure != ""
+		for j, step := range scenario.Steps {
+			result := models.CheckResult{
+				ID:          fmt.Sprintf("step-%d", j+1),
+				Description: step.Run,
+			}
+			switch {
+			case buildFailure != "" && j == 0:
+				result.Message = buildFailure
+			case failed:
+				result.Message = "Skipped"
+			default:
+				result.Message = runStep(run, home, step)
+				result.Passed = result.Message == ""
+				failed = !result.Passed
+			}
+			section.Checks = append(section.Checks, result)
+		}
+
+		if !failed {
+			section.Score = scenario.Points
+		}
+		sections = append(sections, section)
+	}
+	return sections, nil
+}
+
+// runStep runs one scenario step, returning why it failed, or "" if it passed
+func runStep(run func(home, command string, args ...string) (*container.ExecResult, error), home string, step problems.Step) string {
+	result, err := run(home, step.Run)
+	if err != nil {
+		return "Command did not finish: " + err.Error()
+	}
+	if result.OutputTruncated {
+		return "Output limit exceeded"
+	}
+	if reason := step.Check(result.ExitCode, result.Stdout); reason != "" {
+		return reason
+	}
+
+	for _, file := range step.Files {
+		result, err := run(home, `cat -- "$1"`, file.Path)
+		if err != nil {
+			return "Failed to inspect " + file.Path
+		}
+		if reason := file.Check(result.ExitCode == 0, result.Stdout); reason != "" {
+			return reason
+		}
+	}
+	return ""
+}
+
+// lastLines returns the last n lines of command output
+func lastLines(output string, n int) string {
+	lines := strings.Split(strings.TrimRight(output, "\n"), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,287 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/globallstudent/academy/internal/container"
+	"github.com/globallstudent/academy/internal/database"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// terminalContainerPrefix is the name prefix of every terminal session container
+const terminalContainerPrefix = "wbfy-"
+
+// terminalSessionColumns lists the terminal_sessions columns in scan order
+const terminalSessionColumns = `id, user_id, problem_id, problem_slug, port, address, container_id,
+	container_name, command, language, temp_dir, secret, created_at, expires_at, state, failure_reason`
+
+// saveTerminalSession inserts a terminal session, or updates it if it's already
+// stored. Once a session has ended its record is final, so a late update from
+// a provisioning goroutine can't bring it back.
+func saveTerminalSession(db *database.DB, session TerminalSession) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := db.Pool.Exec(ctx, `
+		INSERT INTO terminal_sessions (`+terminalSessionColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)
+		ON CONFLICT (id) DO UPDATE SET
+			port = EXCLUDED.port,
+			address = EXCLUDED.address,
+			container_id = EXCLUDED.container_id,
+			container_name = EXCLUDED.container_name,
+			expires_at = EXCLUDED.expires_at,
+			state = EXCLUDED.state,
+			failure_reason = EXCLUDED.failure_reason
+		WHERE terminal_sessions.state IN ($17, $18)`,
+		session.ID, session.UserID, session.ProblemID, session.ProblemSlug, session.Port,
+		session.Address, session.ContainerID, session.ContainerName, session.Command,
+		session.Language, session.TempDir, session.Secret, session.CreatedAt, session.ExpiresAt,
+		session.State, session.FailureReason, SessionProvisioning, SessionReady)
+	return err
+}
+
+// loadTerminalSession reads a stored terminal session, returning pgx.ErrNoRows if there is none
+func loadTerminalSession(db *database.DB, sessionID string) (*TerminalSession, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	row := db.Pool.QueryRow(ctx, `SELECT `+terminalSessionColumns+` FROM terminal_sessions WHERE id = $1`, sessionID)
+	return scanTerminalSession(row)
+}
+
+// listLiveTerminalSessions reads the stored sessions that are starting or running
+func listLiveTerminalSessions(db *database.DB) ([]*TerminalSession, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := db.Pool.Query(ctx, `SELECT `+terminalSessionColumns+` FROM terminal_sessions WHERE state IN ($1, $2)`,
+		SessionProvisioning, SessionReady)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []*TerminalSession
+	for rows.Next() {
+		session, err := scanTerminalSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+// purgeTerminalSessions deletes the records of sessions that ended before the given time
+func purgeTerminalSessions(db *database.DB, before time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := db.Pool.Exec(ctx, `DELETE FROM terminal_sessions WHERE state NOT IN ($1, $2) AND expires_at < $3`,
+		SessionProvisioning, SessionReady, before)
+	return err
+}
+
+// lookupUsernames maps user IDs to usernames
+func lookupUsernames(db *database.DB, userIDs []uuid.UUID) (map[uuid.UUID]string, error) {
+	usernames := make(map[uuid.UUID]string, len(userIDs))
+	if len(userIDs) == 0 {
+		return usernames, nil
+	}
+
+	ids := make([]string, len(userIDs))
+	for i, id := range userIDs {
+		ids[i] = id.String()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := db.Pool.Query(ctx, `SELECT id, username FROM users WHERE id = ANY($1::uuid[])`, ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id uuid.UUID
+		var username string
+		if err := rows.Scan(&id, &username); err != nil {
+			return nil, err
+		}
+		usernames[id] = username
+	}
+	return usernames, rows.Err()
+}
+
+// scanTerminalSession reads a terminal_sessions row selected with terminalSessionColumns
+func scanTerminalSession(row pgx.Row) (*TerminalSession, error) {
+	var session TerminalSession
+	err := row.Scan(&session.ID, &session.UserID, &session.ProblemID, &session.ProblemSlug,
+		&session.Port, &session.Address, &session.ContainerID, &session.ContainerName,
+		&session.Command, &session.Language, &session.TempDir, &session.Secret,
+		&session.CreatedAt, &session.ExpiresAt, &session.State, &session.FailureReason)
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// RestoreSessions reconciles the stored sessions with the containers that are
+// actually running, so a restart doesn't orphan anything. Running containers
+// that belong to a ready stored session are adopted; every other terminal
+// container is killed, and the remaining stored sessions are marked as ended.
+func (h *WBFYHandlers) RestoreSessions() {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	stored, err := listLiveTerminalSessions(h.db)
+	if err != nil {
+		fmt.Printf("Failed to load stored terminal sessions: %v\n", err)
+		return
+	}
+	sessions := make(map[string]*TerminalSession, len(stored))
+	for _, session := range stored {
+		sessions[session.ID] = session
+	}
+
+	containers, err := h.runtime.List(ctx, terminalContainerPrefix)
+	if err != nil {
+		// Without the container list we can't tell what's orphaned, so leave everything alone
+		fmt.Printf("Failed to list terminal containers: %v\n", err)
+		return
+	}
+
+	adopted := make(map[string]bool)
+	for _, info := range containers {
+		sessionID := info.Labels["academy.session"]
+		if sessionID == "" {
+			sessionID = strings.TrimPrefix(info.Name, terminalContainerPrefix)
+		}
+
+		session, ok := sessions[sessionID]
+		if ok && session.State == SessionReady && info.Running &&
+			time.Now().Before(session.ExpiresAt) && h.adoptSession(ctx, session, info.ID) {
+			adopted[sessionID] = true
+			continue
+		}
+
+		fmt.Printf("Killing orphaned terminal container %s\n", info.Name)
+		if err := h.runtime.Stop(ctx, info.ID); err != nil {
+			fmt.Printf("Failed to stop orphaned container %s: %v\n", info.Name, err)
+		}
+	}
+
+	for id, session := range sessions {
+		if adopted[id] {
+			continue
+		}
+		if session.TempDir != "" {
+			os.RemoveAll(session.TempDir)
+		}
+
+		switch {
+		case session.State == SessionProvisioning:
+			session.State = SessionFailed
+			session.FailureReason = "The server restarted while the terminal was starting"
+		case time.Now().After(session.ExpiresAt):
+			session.State = SessionExpired
+		default:
+			session.State = SessionTerminated
+			session.FailureReason = "The terminal stopped while the server was down"
+		}
+		if err := h.saveSession(*session); err != nil {
+			fmt.Printf("Failed to update stale terminal session %s: %v\n", id, err)
+		}
+	}
+
+	fmt.Printf("Restored %d terminal sessions\n", len(adopted))
+}
+
+// recoverSession looks up a session missing from memory in the store and
+// adopts it if its container is still running. Sessions removed since the
+// server started are never adopted, even while their record still says ready.
+func (h *WBFYHandlers) recoverSession(sessionID string) (*TerminalSession, bool) {
+	h.sessionMutex.RLock()
+	removed := h.wasRemoved(sessionID)
+	h.sessionMutex.RUnlock()
+	if removed {
+		return nil, false
+	}
+
+	session, err := h.loadSession(sessionID)
+	if err != nil {
+		if !errors.Is(err, pgx.ErrNoRows) {
+			fmt.Printf("Failed to load terminal session %s: %v\n", sessionID, err)
+		}
+		return nil, false
+	}
+	if session.State != SessionReady || time.Now().After(session.ExpiresAt) || session.ContainerID == "" {
+		return nil, false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if !h.adoptSession(ctx, session, session.ContainerID) {
+		return nil, false
+	}
+
+	// Another request may have adopted it at the same time
+	h.sessionMutex.RLock()
+	defer h.sessionMutex.RUnlock()
+	adopted, exists := h.sessionMap[sessionID]
+	return adopted, exists
+}
+
+// adoptSession checks that a session's container is running and tracks the
+// session in memory again
+func (h *WBFYHandlers) adoptSession(ctx context.Context, session *TerminalSession, containerID string) bool {
+	info, err := h.runtime.Inspect(ctx, containerID)
+	if err != nil {
+		if !errors.Is(err, container.ErrNotFound) {
+			fmt.Printf("Failed to inspect container for session %s: %v\n", session.ID, err)
+		}
+		return false
+	}
+	if !info.Running {
+		return false
+	}
+
+	// Sessions on internal networks never held a host port
+	if session.Port != 0 {
+		if err := h.ports.Claim(session.ID, session.Port); err != nil {
+			fmt.Printf("Failed to adopt session %s: %v\n", session.ID, err)
+			return false
+		}
+	}
+
+	session.ContainerID = info.ID
+	if info.Address != "" {
+		session.Address = info.Address
+	}
+
+	// The session may have been removed while its container was inspected
+	h.sessionMutex.Lock()
+	if h.wasRemoved(session.ID) {
+		h.sessionMutex.Unlock()
+		if session.Port != 0 {
+			h.ports.Release(session.ID)
+		}
+		return false
+	}
+	if _, exists := h.sessionMap[session.ID]; !exists {
+		h.sessionMap[session.ID] = session
+	}
+	h.sessionMutex.Unlock()
+
+	// Activity isn't persisted, so the idle timeout restarts after a restart
+	h.touchSession(session.ID)
+	return true
+}
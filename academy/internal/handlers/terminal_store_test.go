@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/globallstudent/academy/internal/config"
+	"github.com/jackc/pgx/v5"
+)
+
+// memorySessionStore keeps terminal session records like the terminal_sessions
+// table does: once a record has ended, it's never changed again
+type memorySessionStore struct {
+	mu       sync.Mutex
+	sessions map[string]TerminalSession
+	failSave bool
+}
+
+func (m *memorySessionStore) save(session TerminalSession) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.failSave {
+		return errors.New("database unavailable")
+	}
+	if stored, ok := m.sessions[session.ID]; ok && stored.State != SessionProvisioning && stored.State != SessionReady {
+		return nil
+	}
+	m.sessions[session.ID] = session
+	return nil
+}
+
+func (m *memorySessionStore) load(sessionID string) (*TerminalSession, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	session, ok := m.sessions[sessionID]
+	if !ok {
+		return nil, pgx.ErrNoRows
+	}
+	return &session, nil
+}
+
+func TestRemoveSessionIsNotRecovered(t *testing.T) {
+	tests := []struct {
+		name      string
+		failSave  bool
+		wantState string // state stored while the container is being stopped
+	}{
+		{name: "ended state is stored first", wantState: SessionTerminated},
+		{name: "store unavailable", failSave: true, wantState: SessionReady},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stopping := make(chan struct{})
+			release := make(chan struct{})
+			runtime := stubRuntime{stop: func(ctx context.Context, id string) error {
+				close(stopping)
+				<-release
+				return nil
+			}}
+
+			ports, err := NewPortAllocator("20000-20001")
+			if err != nil {
+				t.Fatal(err)
+			}
+			ports.available = func(port int) bool { return true }
+
+			cfg := &config.Config{}
+			h := NewWBFYHandlers(nil, cfg, runtime, ports, nil, nil, nil)
+			store := &memorySessionStore{sessions: make(map[string]TerminalSession)}
+			h.saveSession = store.save
+			h.loadSession = store.load
+
+			port, err := ports.Reserve("s1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			session := &TerminalSession{
+				ID:          "s1",
+				Port:        port,
+				ContainerID: "c1",
+				State:       SessionReady,
+				ExpiresAt:   time.Now().Add(time.Hour),
+			}
+			h.sessionMap[session.ID] = session
+			if err := store.save(*session); err != nil {
+				t.Fatal(err)
+			}
+			store.failSave = tt.failSave
+
+			done := make(chan bool)
+			go func() { done <- h.removeSession(session, SessionTerminated, "") }()
+			<-stopping
+
+			// While the container is stopping, the session must stay gone
+			if stored, _ := store.load("s1"); stored.State != tt.wantState {
+				t.Errorf("stored state while stopping = %q, want %q", stored.State, tt.wantState)
+			}
+			if _, ok := h.getSession("s1"); ok {
+				t.Error("getSession found the session while it was being removed")
+			}
+
+			close(release)
+			if !<-done {
+				t.Fatal("removeSession did nothing")
+			}
+
+			if _, ok := h.getSession("s1"); ok {
+				t.Error("getSession found the session after it was removed")
+			}
+			if stats := ports.Stats(); stats.InUse != 0 {
+				t.Errorf("%d ports still in use", stats.InUse)
+			}
+			if h.removeSession(session, SessionExpired, "") {
+				t.Error("a second removal did something")
+			}
+		})
+	}
+}
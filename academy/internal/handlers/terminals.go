@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// TerminalListItem is a session as shown in the terminal lists
+type TerminalListItem struct {
+	*TerminalSession
+	Username     string
+	LastActivity time.Time
+}
+
+// MyTerminals godoc
+// @Summary      List my terminals
+// @Description  Lists the current user's open terminal sessions
+// @Tags         terminal
+// @Produce      html
+// @Security     JWTCookie
+// @Success      200  {object}  nil  "Terminal list"
+// @Failure      401  {object}  nil  "Unauthorized"
+// @Router       /terminals [get]
+func (h *WBFYHandlers) MyTerminals(c *gin.Context) {
+	user, _ := currentUser(c)
+
+	sessions := h.listSessions(func(s *TerminalSession) bool {
+		return s.UserID == user.ID
+	})
+
+	c.HTML(http.StatusOK, "pages/terminals.html", gin.H{
+		"Title":     "My Terminals - Summer Academy",
+		"Terminals": sessions,
+		"Admin":     false,
+	})
+}
+
+// AdminTerminals godoc
+// @Summary      List all terminals
+// @Description  Lists every open terminal session with its owner, for supervising and killing sessions
+// @Tags         admin
+// @Produce      html
+// @Security     JWTCookie
+// @Success      200  {object}  nil  "Terminal list"
+// @Failure      401  {object}  nil  "Unauthorized"
+// @Failure      403  {object}  nil  "Forbidden"
+// @Router       /admin/terminals [get]
+func (h *WBFYHandlers) AdminTerminals(c *gin.Context) {
+	sessions := h.listSessions(func(*TerminalSession) bool { return true })
+
+	c.HTML(http.StatusOK, "pages/terminals.html", gin.H{
+		"Title":     "Terminals - Admin - Summer Academy",
+		"Terminals": sessions,
+		"Admin":     true,
+		"Ports":     h.ports.Stats(),
+	})
+}
+
+// listSessions returns the tracked sessions matching keep, newest first
+func (h *WBFYHandlers) listSessions(keep func(*TerminalSession) bool) []TerminalListItem {
+	h.sessionMutex.RLock()
+	var sessions []*TerminalSession
+	for _, session := range h.sessionMap {
+		if keep(session) {
+			sessions = append(sessions, session)
+		}
+	}
+	h.sessionMutex.RUnlock()
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].CreatedAt.After(sessions[j].CreatedAt)
+	})
+
+	userIDs := make([]uuid.UUID, 0, len(sessions))
+	for _, session := range sessions {
+		userIDs = append(userIDs, session.UserID)
+	}
+	usernames, err := lookupUsernames(h.db, userIDs)
+	if err != nil {
+		usernames = map[uuid.UUID]string{}
+	}
+
+	items := make([]TerminalListItem, 0, len(sessions))
+	for _, session := range sessions {
+		username := usernames[session.UserID]
+		if username == "" {
+			username = session.UserID.String()
+		}
+		items = append(items, TerminalListItem{
+			TerminalSession: session,
+			Username:        username,
+			LastActivity:    h.lastActivity(session),
+		})
+	}
+	return items
+}
@@ -1,12 +1,20 @@
 package handlers
 
 import (
+	"context"
+	"errors"
+	"log"
 	"net/http"
+	"net/mail"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/globallstudent/academy/internal/config"
 	"github.com/globallstudent/academy/internal/database"
 	"github.com/globallstudent/academy/internal/models"
+	"github.com/globallstudent/academy/internal/rbac"
+	"github.com/globallstudent/academy/internal/standings"
 	"github.com/google/uuid"
 )
 
@@ -104,29 +112,47 @@ func (h *UserHandlers) ProfilePage(c *gin.Context) {
 		return
 	}
 
+	// Stats come from the leaderboard, as in the Telegram bot's /status. The
+	// profile is still useful without them.
+	ctx := c.Request.Context()
+	var standing standings.Entry
+	rank, streak := 0, 0
+	if entries, err := standings.Leaderboard(ctx, h.db); err != nil {
+		log.Printf("Failed to get standings for %s: %v", userUUID, err)
+	} else {
+		standing, rank, _ = standings.Rank(entries, userUUID)
+	}
+	if streak, err = standings.Streak(ctx, h.db, userUUID, time.Now()); err != nil {
+		log.Printf("Failed to get streak for %s: %v", userUUID, err)
+	}
+
 	c.HTML(http.StatusOK, "main", gin.H{
 		"Title":           "Profile - Summer Academy",
 		"User":            user,
 		"Submissions":     submissions,
+		"Standing":        standing,
+		"Rank":            rank,
+		"Streak":          streak,
 		"IsAuthenticated": true,
 	})
 }
 
 // UpdateProfile godoc
 // @Summary      Update user profile
-// @Description  Update user profile information like username
+// @Description  Update user profile information: the username, and the email address login codes can be sent to
 // @Tags         user
 // @Accept       multipart/form-data
 // @Produce      json
 // @Security     JWTCookie
-// @Param        username   formData  string  true  "User's username"
+// @Param        username   formData  string  true   "User's username"
+// @Param        email      formData  string  false  "Email address for login codes; removed if empty"
 // @Success      200  {object}  map[string]interface{}  "Profile updated successfully"
 // @Failure      400  {object}  map[string]interface{}  "Bad request"
 // @Failure      401  {object}  map[string]interface{}  "Unauthorized"
 // @Failure      500  {object}  map[string]interface{}  "Internal server error"
 // @Router       /profile [post]
 func (h *UserHandlers) UpdateProfile(c *gin.Context) {
-	_, exists := c.Get("userID")
+	userID, exists := currentUserID(c)
 	if !exists {
 		c.JSON(http.StatusUnauthorized, gin.H{
 			"status":  "error",
@@ -135,7 +161,7 @@ func (h *UserHandlers) UpdateProfile(c *gin.Context) {
 		return
 	}
 
-	username := c.PostForm("username")
+	username := strings.TrimSpace(c.PostForm("username"))
 	if username == "" {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"status":  "error",
@@ -144,7 +170,30 @@ func (h *UserHandlers) UpdateProfile(c *gin.Context) {
 		return
 	}
 
-	// Update user in database (in production)
+	// Only a bare address is accepted, since it's where login codes go
+	email := strings.TrimSpace(c.PostForm("email"))
+	if email != "" {
+		if addr, err := mail.ParseAddress(email); err != nil || addr.Address != email {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  "error",
+				"message": "Invalid email address",
+			})
+			return
+		}
+	}
+
+	_, err := h.db.Pool.Exec(c.Request.Context(), `
+		UPDATE users SET username = $2, email = NULLIF($3, '')
+		WHERE id = $1`, userID, username, email)
+	if err != nil {
+		log.Printf("Failed to update profile of %s: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Failed to update profile",
+		})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"status":  "success",
 		"message": "Profile updated successfully",
@@ -173,44 +222,122 @@ func (h *UserHandlers) AdminDashboard(c *gin.Context) {
 	})
 }
 
+// userListSize is how many users the admin page lists
+const userListSize = 200
+
+// roleChangeListSize is how many role changes the admin page lists
+const roleChangeListSize = 50
+
+// userNotices are the messages shown after a role change redirects back to
+// the admin page
+var userNotices = map[string]string{
+	"changed":   "Role changed.",
+	"unchanged": "The user already had that role.",
+}
+
 // UserList godoc
 // @Summary      List all users
-// @Description  Displays a list of all registered users for admin management
+// @Description  Lists registered users with a form to change each one's role, and the latest role changes
 // @Tags         admin
 // @Accept       html
 // @Produce      html
 // @Security     JWTCookie
+// @Param        q  query  string  false  "Only users whose username or phone number contains this"
 // @Success      200  {object}  nil  "Users list"
 // @Failure      401  {object}  nil  "Unauthorized"
-// @Failure      403  {object}  nil  "Forbidden - Admin access required"
-// @Failure      500  {object}  nil  "Internal server error"
+// @Failure      403  {object}  nil  "Forbidden - requires the manage_users permission"
 // @Router       /admin/users [get]
-// UserList handles the admin user listing page
 func (h *UserHandlers) UserList(c *gin.Context) {
-	// Get all users
-	users, err := getAllUsers(h.db)
+	h.renderUsers(c, http.StatusOK, gin.H{"Notice": userNotices[c.Query("notice")]})
+}
+
+// ChangeRole godoc
+// @Summary      Change a user's role
+// @Description  Sets a user's role and records the change in the audit log. Admins can't change their own role.
+// @Tags         admin
+// @Accept       x-www-form-urlencoded
+// @Produce      html
+// @Security     JWTCookie
+// @Param        id    path      string  true  "User ID"
+// @Param        role  formData  string  true  "New role: user, judge or admin"
+// @Success      303  {object}  nil  "Redirect to the users page"
+// @Failure      400  {object}  nil  "Invalid user or role"
+// @Failure      403  {object}  nil  "Forbidden - requires the manage_users permission"
+// @Router       /admin/users/{id}/role [post]
+func (h *UserHandlers) ChangeRole(c *gin.Context) {
+	adminID, ok := currentUserID(c)
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	userID, err := uuid.Parse(c.Param("id"))
 	if err != nil {
-		c.HTML(http.StatusInternalServerError, "pages/admin/users.html", gin.H{
-			"Error": "Failed to get users",
-		})
+		h.renderUsers(c, http.StatusBadRequest, gin.H{"Error": "Invalid user ID"})
+		return
+	}
+	// Nobody can lock themselves out, so there is always an admin left
+	if userID == adminID {
+		h.renderUsers(c, http.StatusBadRequest, gin.H{"Error": "You can't change your own role"})
 		return
 	}
 
-	c.HTML(http.StatusOK, "pages/admin/users.html", gin.H{
-		"Title": "Manage Users - Admin - Summer Academy",
-		"Users": users,
-	})
+	change, changed, err := rbac.ChangeRole(c.Request.Context(), h.db, userID, c.PostForm("role"), adminID)
+	switch {
+	case errors.Is(err, rbac.ErrUnknownRole):
+		h.renderUsers(c, http.StatusBadRequest, gin.H{"Error": "Unknown role"})
+		return
+	case err != nil:
+		log.Printf("Failed to change the role of %s: %v", userID, err)
+		h.renderUsers(c, http.StatusInternalServerError, gin.H{"Error": "Failed to change the role"})
+		return
+	case change.Username == "":
+		h.renderUsers(c, http.StatusNotFound, gin.H{"Error": "User not found"})
+		return
+	case !changed:
+		c.Redirect(http.StatusSeeOther, "/admin/users?notice=unchanged")
+		return
+	}
+	log.Printf("Role of %s (%s) changed from %s to %s by %s", change.Username, userID, change.OldRole, change.NewRole, adminID)
+	c.Redirect(http.StatusSeeOther, "/admin/users?notice=changed")
+}
+
+// renderUsers renders the users admin page with the users, their roles'
+// permissions and the latest role changes, plus data for the request
+func (h *UserHandlers) renderUsers(c *gin.Context, status int, data gin.H) {
+	ctx := c.Request.Context()
+	query := strings.TrimSpace(c.Query("q"))
+	users, err := getAllUsers(ctx, h.db, query, userListSize)
+	if err != nil {
+		log.Printf("Failed to list users: %v", err)
+		if data["Error"] == nil {
+			data["Error"] = "Failed to get users"
+		}
+	}
+	changes, err := rbac.History(ctx, h.db, roleChangeListSize)
+	if err != nil {
+		log.Printf("Failed to list role changes: %v", err)
+	}
+
+	grants := make(map[string][]rbac.Permission, len(rbac.Roles))
+	for _, role := range rbac.Roles {
+		grants[role] = rbac.PermissionsOf(role)
+	}
+
+	currentID, _ := currentUserID(c)
+	data["Title"] = "Manage Users - Admin - Summer Academy"
+	data["Users"] = users
+	data["Query"] = query
+	data["Roles"] = rbac.Roles
+	data["Grants"] = grants
+	data["Permissions"] = rbac.AllPermissions
+	data["RoleChanges"] = changes
+	data["CurrentUserID"] = currentID
+	c.HTML(status, "pages/admin_users.html", data)
 }
 
 // Helper function to get user by ID
 func getUserByID(db *database.DB, userID uuid.UUID) (models.User, error) {
-	// In production, actually query the database
-	return models.User{
-		ID:          userID,
-		PhoneNumber: "+12345678901",
-		Username:    "Student1234",
-		Role:        "user",
-	}, nil
+	return database.ScanUser(db.Pool.QueryRow(context.Background(), `SELECT `+database.UserColumns+` FROM users WHERE id = $1`, userID))
 }
 
 // Helper function to get user submissions
@@ -238,8 +365,26 @@ func getAdminStats(db *database.DB) AdminStats {
 	}
 }
 
-// Helper function to get all users
-func getAllUsers(db *database.DB) ([]models.User, error) {
-	// In production, actually query the database
-	return []models.User{}, nil
+// getAllUsers lists users, newest first, optionally only those whose
+// username or phone number contains query
+func getAllUsers(ctx context.Context, db *database.DB, query string, limit int) ([]models.User, error) {
+	rows, err := db.Pool.Query(ctx, `
+		SELECT `+database.UserColumns+` FROM users
+		WHERE $1 = '' OR username ILIKE '%' || $1 || '%' OR phone_number LIKE '%' || $1 || '%'
+		ORDER BY registered_at DESC
+		LIMIT $2`, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []models.User
+	for rows.Next() {
+		user, err := database.ScanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
 }
@@ -1,19 +1,31 @@
 package handlers
 
 import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
+	"io/fs"
 	"net/http"
+	"net/http/httputil"
+	"net/url"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/globallstudent/academy/internal/config"
+	"github.com/globallstudent/academy/internal/container"
 	"github.com/globallstudent/academy/internal/database"
+	"github.com/globallstudent/academy/internal/models"
+	"github.com/globallstudent/academy/internal/problems"
+	"github.com/globallstudent/academy/internal/rbac"
 	"github.com/google/uuid"
 )
 
@@ -21,21 +33,48 @@ import (
 type WBFYHandlers struct {
 	db           *database.DB
 	cfg          *config.Config
-	portMutex    sync.Mutex
-	portMap      map[string]int
+	runtime      container.Runtime
+	ports        *PortAllocator
+	problems     *problems.Catalog
+	judge        *Judge
+	notifier     Notifier
 	sessionMutex sync.RWMutex
 	sessionMap   map[string]*TerminalSession
+	removed      map[string]time.Time // session ID -> when it was removed, so it's never adopted again
+
+	// Terminal session persistence
+	saveSession func(session TerminalSession) error
+	loadSession func(sessionID string) (*TerminalSession, error)
+
+	activityMutex sync.Mutex
+	activity      map[string]time.Time // session ID -> last time a client sent input
+
+	stopCleanup chan struct{}
+	cleanupDone chan struct{}
 }
 
 // NewWBFYHandlers creates a new WBFYHandlers instance
-func NewWBFYHandlers(db *database.DB, cfg *config.Config) *WBFYHandlers {
+func NewWBFYHandlers(db *database.DB, cfg *config.Config, runtime container.Runtime, ports *PortAllocator, catalog *problems.Catalog, judge *Judge, notifier Notifier) *WBFYHandlers {
 	return &WBFYHandlers{
 		db:           db,
 		cfg:          cfg,
-		portMutex:    sync.Mutex{},
-		portMap:      make(map[string]int),
+		runtime:      runtime,
+		ports:        ports,
+		problems:     catalog,
+		judge:        judge,
+		notifier:     notifier,
 		sessionMutex: sync.RWMutex{},
 		sessionMap:   make(map[string]*TerminalSession),
+		removed:      make(map[string]time.Time),
+		saveSession: func(session TerminalSession) error {
+			return saveTerminalSession(db, session)
+		},
+		loadSession: func(sessionID string) (*TerminalSession, error) {
+			return loadTerminalSession(db, sessionID)
+		},
+		activity:    make(map[string]time.Time),
+		stopCleanup: make(chan struct{}),
+		cleanupDone: make(chan struct{}),
 	}
 }
 
@@ -44,66 +83,70 @@ type TerminalSession struct {
 	ID            string    `json:"id"`
 	UserID        uuid.UUID `json:"user_id"`
 	ProblemID     uuid.UUID `json:"problem_id"`
-	Port          int       `json:"port"`
-	ContainerID   string    `json:"container_id"`
-	ContainerName string    `json:"container_name"`
+	ProblemSlug   string    `json:"problem_slug"`
+	Port          int       `json:"-"` // Host port reserved for the session, if one is published
+	Address       string    `json:"-"` // Where the academy reaches the wbfy server
+	ContainerID   string    `json:"-"`
+	ContainerName string    `json:"-"`
 	Command       string    `json:"command"`
 	Language      string    `json:"language"`
-	TempDir       string    `json:"temp_dir"`
+	TempDir       string    `json:"-"` // Host directory mounted as the workspace
 	CreatedAt     time.Time `json:"created_at"`
 	ExpiresAt     time.Time `json:"expires_at"`
+	State         string    `json:"state"`
+	FailureReason string    `json:"failure_reason,omitempty"`
+	Secret        string    `json:"-"` // Signs wbfy client tokens, handed to wbfy in sessionSecretFile
 }
 
-// AllocatePort allocates a port for a terminal session
-func (h *WBFYHandlers) AllocatePort() (int, error) {
-	h.portMutex.Lock()
-	defer h.portMutex.Unlock()
+// Terminal session lifecycle states
+const (
+	SessionProvisioning = "provisioning" // The container is being started
+	SessionReady        = "ready"        // wbfy is accepting connections
+	SessionFailed       = "failed"       // Starting the session failed, see FailureReason
+	SessionExpired      = "expired"      // The session outlived its expiry and was cleaned up
+	SessionTerminated   = "terminated"   // The session was ended before it expired
+)
 
-	// Try to allocate a port in range 10000-10999
-	for port := 10000; port < 11000; port++ {
-		// Check if port is in use
-		inUse := false
-		for _, p := range h.portMap {
-			if p == port {
-				inUse = true
-				break
-			}
-		}
+// live reports whether a session is starting or running and hasn't expired
+func (s *TerminalSession) live() bool {
+	return (s.State == SessionProvisioning || s.State == SessionReady) && time.Now().Before(s.ExpiresAt)
+}
 
-		if !inUse {
-			return port, nil
-		}
-	}
+// sessionSecretFile is the workspace file wbfy reads the session secret from
+const sessionSecretFile = ".wbfy-secret"
 
-	return 0, fmt.Errorf("no available ports")
-}
+// sessionReadyTimeout bounds how long a session may take to start accepting connections
+const sessionReadyTimeout = 90 * time.Second
 
-// ReleasePort releases a port
-func (h *WBFYHandlers) ReleasePort(sessionID string) {
-	h.portMutex.Lock()
-	defer h.portMutex.Unlock()
-	delete(h.portMap, sessionID)
-}
+// Roles a client can attach to a wbfy terminal with
+const (
+	TerminalRoleOwner    = "owner"
+	TerminalRoleObserver = "observer"
+	TerminalRoleMentor   = "mentor"
+)
 
 // CreateTerminal godoc
 // @Summary      Create a new terminal session
-// @Description  Creates a new WBFY terminal session for a problem
+// @Description  Creates a new WBFY terminal session for a problem, or returns the user's live session for the same problem and language
 // @Tags         terminal
 // @Accept       multipart/form-data
 // @Produce      json
 // @Security     JWTCookie
 // @Param        slug        path      string  true  "Problem slug"
 // @Param        language    formData  string  false  "Programming language (default: bash)"
+// @Success      200  {object}  map[string]interface{}  "Existing session reused"
 // @Success      202  {object}  map[string]interface{}  "Terminal session created"
 // @Failure      401  {object}  map[string]interface{}  "Unauthorized"
+// @Failure      404  {object}  map[string]interface{}  "Problem not found"
+// @Failure      429  {object}  map[string]interface{}  "Too many open terminals for this user"
 // @Failure      500  {object}  map[string]interface{}  "Internal server error"
-// @Failure      503  {object}  map[string]interface{}  "Service unavailable - no ports available"
+// @Failure      503  {object}  map[string]interface{}  "Service unavailable - terminal capacity reached"
 // @Router       /terminal/{slug} [post]
 func (h *WBFYHandlers) CreateTerminal(c *gin.Context) {
 	slug := c.Param("slug")
 	language := c.DefaultPostForm("language", "bash")
 
-	userID, exists := c.Get("userID")
+	userID, exists := currentUserID(c)
 	if !exists {
 		c.JSON(http.StatusUnauthorized, gin.H{
 			"status":  "error",
@@ -115,9 +158,9 @@ func (h *WBFYHandlers) CreateTerminal(c *gin.Context) {
 	// Get problem by slug
 	problem, err := h.getProblemBySlug(slug)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
+		c.JSON(http.StatusNotFound, gin.H{
 			"status":  "error",
-			"message": "Failed to get problem details",
+			"message": "Problem not found",
 		})
 		return
 	}
@@ -125,145 +168,314 @@ func (h *WBFYHandlers) CreateTerminal(c *gin.Context) {
 	// Create a unique session ID
 	sessionID := uuid.New().String()
 
-	// Allocate a port for this session
-	port, err := h.AllocatePort()
+	// Generate the secret wbfy uses to verify which role a client attaches with
+	secret, err := generateSessionSecret()
 	if err != nil {
-		c.JSON(http.StatusServiceUnavailable, gin.H{
+		c.JSON(http.StatusInternalServerError, gin.H{
 			"status":  "error",
-			"message": "No available ports for terminal session",
+			"message": "Failed to create terminal session",
 		})
 		return
 	}
 
-	// Register the port as in use
-	h.portMap[sessionID] = port
-
 	// Determine the command to run based on problem type and language
 	command := getTerminalCommand(problem.Type, language)
 
-	// Determine which Docker image to use
-	image := getDockerImage(language)
-
-	// Create the container name
-	containerName := fmt.Sprintf("wbfy-%s", sessionID)
+	// Reuse checks, limits and registration happen under one lock so
+	// concurrent requests can't overshoot the caps
+	h.sessionMutex.Lock()
 
-	// Start WBFY container in the background
-	go func() {
-		// Create temporary directory for session
-		tempDir := filepath.Join(os.TempDir(), "academy-sessions", sessionID)
-		if err := os.MkdirAll(tempDir, 0755); err != nil {
-			fmt.Printf("Failed to create temp directory: %v\n", err)
-			h.ReleasePort(sessionID)
+	userSessions := 0
+	for _, existing := range h.sessionMap {
+		if existing.UserID != userID || !existing.live() {
+			continue
+		}
+		if existing.ProblemSlug == problem.Slug && existing.Language == language {
+			reused := *existing
+			h.sessionMutex.Unlock()
+			c.JSON(http.StatusOK, gin.H{
+				"status":  "success",
+				"session": reused,
+				"url":     terminalPageURL(c, reused.ID),
+				"reused":  true,
+			})
 			return
 		}
+		userSessions++
+	}
 
-		// Copy problem files to the temp directory
-		problemDir := filepath.Join("problems", fmt.Sprintf("day%d", problem.Day))
-		if err := copyProblemFiles(problemDir, tempDir); err != nil {
-			fmt.Printf("Failed to copy problem files: %v\n", err)
-		}
+	if userSessions >= h.cfg.WBFY.MaxSessionsPerUser {
+		h.sessionMutex.Unlock()
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"status":  "error",
+			"message": fmt.Sprintf("You already have %d open terminals; close one before opening another", userSessions),
+		})
+		return
+	}
 
-		// Create a file that will track the session status
-		statusFile := filepath.Join(tempDir, "session.json")
-		sessionData := map[string]interface{}{
-			"id":         sessionID,
-			"user_id":    userID.(uuid.UUID).String(),
-			"problem_id": problem.ID.String(),
-			"language":   language,
-			"start_time": time.Now(),
-		}
+	if h.liveSessionsLocked() >= h.cfg.WBFY.MaxSessions {
+		h.sessionMutex.Unlock()
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"status":  "error",
+			"message": "All terminals are in use, please try again in a few minutes",
+		})
+		return
+	}
 
-		sessionJSON, _ := json.Marshal(sessionData)
-		if err := os.WriteFile(statusFile, sessionJSON, 0644); err != nil {
-			fmt.Printf("Failed to write session data: %v\n", err)
+	// Reserve a port for this session, if the runtime publishes one
+	port := 0
+	if h.runtime.NeedsHostPort(h.cfg.WBFY.ProfileFor(problem.Type, language)) {
+		port, err = h.ports.Reserve(sessionID)
+		if err != nil {
+			h.sessionMutex.Unlock()
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"status":  "error",
+				"message": "No available ports for terminal session",
+			})
+			return
 		}
+	}
 
-		// Start WBFY Docker container
-		dockerArgs := []string{
-			"run",
-			"--name", containerName,
-			"-d", // detached mode
-			"-p", fmt.Sprintf("%d:8081", port),
-			"-v", fmt.Sprintf("%s:/workspace", tempDir),
-			"-e", "WBFY_CMD=" + command,
-			"-e", "PROBLEM_TYPE=" + problem.Type,
-			"-e", "SESSION_ID=" + sessionID,
-			"--rm", // remove container when stopped
-			image,
-		}
+	// The session is tracked from the start so its progress can be reported
+	now := time.Now()
+	session := &TerminalSession{
+		ID:            sessionID,
+		UserID:        userID,
+		ProblemID:     problem.ID,
+		ProblemSlug:   problem.Slug,
+		Port:          port,
+		ContainerName: fmt.Sprintf("wbfy-%s", sessionID),
+		Command:       command,
+		Language:      language,
+		TempDir:       filepath.Join(h.cfg.WBFY.WorkspaceRoot, sessionID),
+		CreatedAt:     now,
+		ExpiresAt:     now.Add(h.cfg.WBFY.SessionLifetime),
+		State:         SessionProvisioning,
+		Secret:        secret,
+	}
+	h.sessionMap[sessionID] = session
+	created := *session
+	h.sessionMutex.Unlock()
 
-		cmd := exec.Command("docker", dockerArgs...)
-		out, err := cmd.CombinedOutput()
-		if err != nil {
-			fmt.Printf("Failed to start WBFY container: %v\nOutput: %s\n", err, out)
-			h.ReleasePort(sessionID)
+	if err := h.saveSession(created); err != nil {
+		fmt.Printf("Failed to store terminal session: %v\n", err)
+	}
+
+	// Start the WBFY environment in the background; the terminal page polls its status
+	go h.provisionSession(created, problem, getDockerImage(language))
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"status":  "success",
+		"session": created,
+		"url":     terminalPageURL(c, sessionID),
+	})
+}
+
+// terminalPageURL returns the absolute URL of a session's terminal page
+func terminalPageURL(c *gin.Context, sessionID string) string {
+	// Get the protocol (http/https)
+	protocol := "http"
+	if c.Request.TLS != nil {
+		protocol = "https"
+	}
+
+	return fmt.Sprintf("%s://%s/terminal/%s", protocol, c.Request.Host, sessionID)
+}
+
+// provisionSession prepares the workspace, starts the container and waits for
+// wbfy to come up, moving the session to ready or failed
+func (h *WBFYHandlers) provisionSession(session TerminalSession, problem *problems.Problem, image string) {
+	// Create temporary directory for session
+	if err := os.MkdirAll(session.TempDir, 0755); err != nil {
+		h.failSession(session.ID, "Failed to create the workspace", err)
+		return
+	}
+
+	// Copy the problem's fixtures, and nothing else, into the workspace
+	if env := problem.EnvDir(); env != "" {
+		if err := copyProblemFiles(env, session.TempDir); err != nil {
+			h.failSession(session.ID, "Failed to prepare the problem files", err)
 			return
 		}
+	}
+
+	// Create a file that will track the session status
+	statusFile := filepath.Join(session.TempDir, "session.json")
+	sessionData := map[string]interface{}{
+		"id":         session.ID,
+		"user_id":    session.UserID.String(),
+		"problem_id": problem.ID.String(),
+		"language":   session.Language,
+		"start_time": session.CreatedAt,
+	}
+
+	sessionJSON, _ := json.Marshal(sessionData)
+	if err := os.WriteFile(statusFile, sessionJSON, 0644); err != nil {
+		fmt.Printf("Failed to write session data: %v\n", err)
+	}
+
+	// wbfy reads its signing secret from this file and deletes it before starting
+	// the student's command; the container environment is readable from the shell
+	if err := os.WriteFile(filepath.Join(session.TempDir, sessionSecretFile), []byte(session.Secret), 0600); err != nil {
+		h.failSession(session.ID, "Failed to prepare the workspace", err)
+		return
+	}
+
+	// The student works in the container as an unprivileged user, who has to own the workspace
+	if err := chownWorkspace(session.TempDir, h.cfg.WBFY.WorkspaceUID, h.cfg.WBFY.WorkspaceGID); err != nil {
+		h.failSession(session.ID, "Failed to prepare the workspace", err)
+		return
+	}
+
+	// Start the WBFY environment through the configured runtime
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute+sessionReadyTimeout)
+	defer cancel()
+
+	containerID, err := h.runtime.Start(ctx, container.StartOptions{
+		Name:  session.ContainerName,
+		Image: image,
+		Env: map[string]string{
+			"WBFY_CMD":         session.Command,
+			"PROBLEM_TYPE":     problem.Type,
+			"SESSION_ID":       session.ID,
+			"WBFY_SECRET_FILE": sessionSecretFile,
+		},
+		Labels: map[string]string{
+			"academy.session": session.ID,
+			"academy.user":    session.UserID.String(),
+		},
+		Workspace:     session.TempDir,
+		HostPort:      session.Port,
+		ContainerPort: 8081,
+		Profile:       h.cfg.WBFY.ProfileFor(problem.Type, session.Language),
+	})
+	if err != nil {
+		h.failSession(session.ID, "Failed to start the terminal environment", err)
+		return
+	}
 
-		containerID := string(out)[:12] // Get container ID from docker output
+	// Record the container straight away so a failure from here on stops it
+	updated, ok := h.updateSession(session.ID, func(s *TerminalSession) {
+		s.ContainerID = containerID
+	})
+	if !ok {
+		// The session was ended while the container was starting
+		h.runtime.Stop(ctx, containerID)
+		os.RemoveAll(session.TempDir)
+		return
+	}
+
+	// Store container info for cleanup
+	containerInfo := map[string]string{
+		"container_id":   containerID,
+		"container_name": session.ContainerName,
+		"session_id":     session.ID,
+	}
+	containerJSON, _ := json.Marshal(containerInfo)
+	os.WriteFile(filepath.Join(session.TempDir, "container.json"), containerJSON, 0644)
 
-		// Store container info for cleanup
-		containerInfo := map[string]string{
-			"container_id":   containerID,
-			"container_name": containerName,
-			"session_id":     sessionID,
+	address, err := h.waitForReady(ctx, updated)
+	if err != nil {
+		h.failSession(session.ID, "The terminal did not start", err)
+		return
+	}
+
+	if err := h.runSetup(ctx, problem, containerID); err != nil {
+		h.failSession(session.ID, "Setting up the problem environment failed", err)
+		return
+	}
+
+	if _, ok := h.updateSession(session.ID, func(s *TerminalSession) {
+		s.Address = address
+		s.State = SessionReady
+	}); !ok {
+		// The session was ended while we were waiting for it
+		h.runtime.Stop(ctx, containerID)
+		os.RemoveAll(session.TempDir)
+		return
+	}
+	h.touchSession(session.ID)
+}
+
+// waitForReady polls the session's wbfy health check until it answers,
+// returning the address it's reachable on
+func (h *WBFYHandlers) waitForReady(ctx context.Context, session *TerminalSession) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, sessionReadyTimeout)
+	defer cancel()
+
+	client := &http.Client{Timeout: 2 * time.Second}
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		info, err := h.runtime.Inspect(ctx, session.ContainerID)
+		if err != nil {
+			return "", err
 		}
-		containerJSON, _ := json.Marshal(containerInfo)
-		os.WriteFile(filepath.Join(tempDir, "container.json"), containerJSON, 0644)
-
-		// Create a session with 2 hour expiry
-		session := TerminalSession{
-			ID:            sessionID,
-			UserID:        userID.(uuid.UUID),
-			ProblemID:     problem.ID,
-			Port:          port,
-			ContainerID:   containerID,
-			ContainerName: containerName,
-			Command:       command,
-			Language:      language,
-			TempDir:       tempDir,
-			CreatedAt:     time.Now(),
-			ExpiresAt:     time.Now().Add(2 * time.Hour),
+		if !info.Running {
+			logs, _ := h.runtime.Logs(ctx, session.ContainerID, 20)
+			return "", fmt.Errorf("container exited (%s): %s", info.Status, logs)
 		}
 
-		// Store in memory map
-		h.sessionMutex.Lock()
-		h.sessionMap[sessionID] = &session
-		h.sessionMutex.Unlock()
+		if info.Address != "" {
+			resp, err := client.Get("http://" + info.Address + "/healthz")
+			if err == nil {
+				resp.Body.Close()
+				if resp.StatusCode == http.StatusOK {
+					return info.Address, nil
+				}
+			}
+		}
 
-		// Store session in database (could use Redis in production)
-		h.storeTerminalSession(session)
-	}()
+		select {
+		case <-ctx.Done():
+			return "", fmt.Errorf("not ready after %s", sessionReadyTimeout)
+		case <-ticker.C:
+		}
+	}
+}
 
-	// Create session record for immediate return
-	session := TerminalSession{
-		ID:        sessionID,
-		UserID:    userID.(uuid.UUID),
-		ProblemID: problem.ID,
-		Port:      port,
-		Command:   command,
-		Language:  language,
-		CreatedAt: time.Now(),
-		ExpiresAt: time.Now().Add(2 * time.Hour),
+// updateSession applies fn to a copy of a tracked session, replaces it and
+// persists the result. Sessions are never modified in place, so handlers can
+// keep reading a session they looked up without locking.
+func (h *WBFYHandlers) updateSession(sessionID string, fn func(*TerminalSession)) (*TerminalSession, bool) {
+	h.sessionMutex.Lock()
+	current, exists := h.sessionMap[sessionID]
+	if !exists {
+		h.sessionMutex.Unlock()
+		return nil, false
 	}
+	updated := *current
+	fn(&updated)
+	h.sessionMap[sessionID] = &updated
+	h.sessionMutex.Unlock()
 
-	// Get the protocol (http/https)
-	protocol := "http"
-	if c.Request.TLS != nil {
-		protocol = "https"
+	if err := h.saveSession(updated); err != nil {
+		fmt.Printf("Failed to store terminal session %s: %v\n", sessionID, err)
 	}
+	return &updated, true
+}
 
-	// Generate the terminal URL
-	terminalURL := fmt.Sprintf("%s://%s/terminal/%s",
-		protocol,
-		c.Request.Host,
-		sessionID)
+// failSession marks a session as failed and releases everything it holds.
+// The session stays in memory so its status can still be reported.
+func (h *WBFYHandlers) failSession(sessionID, reason string, err error) {
+	fmt.Printf("Terminal session %s failed: %s: %v\n", sessionID, reason, err)
 
-	c.JSON(http.StatusOK, gin.H{
-		"status":  "success",
-		"session": session,
-		"url":     terminalURL,
+	session, ok := h.updateSession(sessionID, func(s *TerminalSession) {
+		s.State = SessionFailed
+		s.FailureReason = reason
+		// Keep the record around long enough for the browser to see why
+		s.ExpiresAt = time.Now().Add(10 * time.Minute)
 	})
+	if !ok {
+		return
+	}
+
+	h.stopContainer(session)
+	if session.TempDir != "" {
+		os.RemoveAll(session.TempDir)
+	}
+	h.ports.Release(sessionID)
 }
 
 // TerminalPage godoc
@@ -280,62 +492,173 @@ func (h *WBFYHandlers) CreateTerminal(c *gin.Context) {
 func (h *WBFYHandlers) TerminalPage(c *gin.Context) {
 	sessionID := c.Param("id")
 
-	// Get session from memory map
-	h.sessionMutex.RLock()
-	session, exists := h.sessionMap[sessionID]
-	h.sessionMutex.RUnlock()
+	// Get the session, recovering it from the store after a restart
+	session, exists := h.getSession(sessionID)
 	if !exists {
-		// In a production environment, you might want to fetch from database
-		// and recreate the container if it doesn't exist
-
+		message := "Session not found or expired"
+		if ended, err := h.loadSession(sessionID); err == nil {
+			message = sessionEndedMessage(ended)
+		}
 		c.HTML(http.StatusOK, "pages/terminal.html", gin.H{
 			"Title":     "Terminal - Summer Academy",
 			"SessionID": sessionID,
-			"Error":     "Session not found or expired",
+			"Error":     message,
 		})
 		return
 	}
 
-	// In production, check if the session has expired
-	if time.Now().After(session.ExpiresAt) {
-		c.HTML(http.StatusOK, "pages/terminal.html", gin.H{
+	// Only the owner and staff may open the terminal
+	user, _ := currentUser(c)
+	if _, ok := terminalRoleFor(session, user, ""); !ok {
+		c.HTML(http.StatusForbidden, "pages/terminal.html", gin.H{
 			"Title":     "Terminal - Summer Academy",
 			"SessionID": sessionID,
-			"Error":     "Session has expired",
+			"Error":     "You do not have access to this session",
 		})
 		return
 	}
 
-	// Get the WebSocket URL for the terminal
-	wsProtocol := "ws"
-	if c.Request.TLS != nil {
-		wsProtocol = "wss"
+	if session.State == SessionFailed || time.Now().After(session.ExpiresAt) {
+		c.HTML(http.StatusOK, "pages/terminal.html", gin.H{
+			"Title":     "Terminal - Summer Academy",
+			"SessionID": sessionID,
+			"Error":     sessionEndedMessage(session),
+		})
+		return
 	}
 
-	wsURL := fmt.Sprintf("%s://%s/ws/%s",
-		wsProtocol,
-		c.Request.Host,
-		sessionID)
+	// Problems that can be graded automatically get a "Check my work" button
+	problem, err := h.getProblemBySlug(session.ProblemSlug)
+	checkable := err == nil && (problem.Verifier != nil || problem.Grader != nil)
 
+	// The page polls /terminal/:id/status until the session is ready, then
+	// fetches its WebSocket URL
 	c.HTML(http.StatusOK, "pages/terminal.html", gin.H{
 		"Title":     "Terminal - Summer Academy",
 		"SessionID": sessionID,
 		"Port":      session.Port,
+		"WSInfoURL": fmt.Sprintf("/terminal/%s/ws", sessionID),
+		"Checkable": checkable,
 		"WBFY": map[string]interface{}{
 			"BaseURL": h.cfg.WBFY.BaseURL,
-			"WSPath":  wsURL,
 		},
 	})
 }
 
-// WebSocketProxy handles WebSocket proxying to the WBFY container
+// TerminalStatus godoc
+// @Summary      Terminal session status
+// @Description  Reports the lifecycle state of a terminal session: provisioning, ready, failed, expired or terminated
+// @Tags         terminal
+// @Produce      json
+// @Security     JWTCookie
+// @Param        id    path      string  true  "Terminal session ID"
+// @Success      200  {object}  map[string]interface{}  "Session state and failure reason"
+// @Failure      403  {object}  map[string]interface{}  "Forbidden"
+// @Failure      404  {object}  map[string]interface{}  "Session not found"
+// @Router       /terminal/{id}/status [get]
+func (h *WBFYHandlers) TerminalStatus(c *gin.Context) {
+	sessionID := c.Param("id")
+
+	session, exists := h.getSession(sessionID)
+	if !exists {
+		// Ended sessions are only in the store
+		stored, err := h.loadSession(sessionID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{
+				"status":  "error",
+				"message": "Terminal session not found",
+			})
+			return
+		}
+		session = stored
+	}
+
+	user, _ := currentUser(c)
+	if _, ok := terminalRoleFor(session, user, ""); !ok {
+		c.JSON(http.StatusForbidden, gin.H{
+			"status":  "error",
+			"message": "You do not have access to this session",
+		})
+		return
+	}
+
+	state := session.State
+	if state == SessionReady && time.Now().After(session.ExpiresAt) {
+		// The cleanup job hasn't got to it yet
+		state = SessionExpired
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":     "success",
+		"state":      state,
+		"reason":     session.FailureReason,
+		"expires_at": session.ExpiresAt,
+	})
+}
+
+// JoinTerminal godoc
+// @Summary      Join an active terminal session
+// @Description  Lets an admin or judge attach to any active terminal session as an observer or mentor
+// @Tags         terminal
+// @Accept       html
+// @Produce      html
+// @Security     JWTCookie
+// @Param        id    path      string  true   "Terminal session ID"
+// @Param        as    query     string  false  "Join as observer (default) or mentor"
+// @Success      200  {object}  nil  "Terminal page"
+// @Failure      401  {object}  nil  "Unauthorized"
+// @Failure      403  {object}  nil  "Forbidden - Admin or judge access required"
+// @Failure      404  {object}  nil  "Session not found"
+// @Router       /admin/terminals/{id}/join [get]
+func (h *WBFYHandlers) JoinTerminal(c *gin.Context) {
+	sessionID := c.Param("id")
+	as := c.DefaultQuery("as", TerminalRoleObserver)
+
+	if as != TerminalRoleObserver && as != TerminalRoleMentor {
+		c.HTML(http.StatusBadRequest, "pages/terminal.html", gin.H{
+			"Title":     "Terminal - Summer Academy",
+			"SessionID": sessionID,
+			"Error":     "You can only join as an observer or a mentor",
+		})
+		return
+	}
+
+	session, exists := h.getSession(sessionID)
+	if !exists || session.State == SessionFailed || time.Now().After(session.ExpiresAt) {
+		c.HTML(http.StatusNotFound, "pages/terminal.html", gin.H{
+			"Title":     "Terminal - Summer Academy",
+			"SessionID": sessionID,
+			"Error":     "Session not found or expired",
+		})
+		return
+	}
+
+	c.HTML(http.StatusOK, "pages/terminal.html", gin.H{
+		"Title":     "Terminal - Summer Academy",
+		"SessionID": sessionID,
+		"Port":      session.Port,
+		"JoinAs":    as,
+		"WSInfoURL": fmt.Sprintf("/terminal/%s/ws?as=%s", sessionID, as),
+	})
+}
+
+// WebSocketProxy godoc
+// @Summary      Get the terminal WebSocket URL
+// @Description  Returns the academy WebSocket URL that proxies to the session's wbfy server. Owners attach read-write; admins and judges attach as observer or mentor.
+// @Tags         terminal
+// @Produce      json
+// @Security     JWTCookie
+// @Param        id    path      string  true   "Terminal session ID"
+// @Param        as    query     string  false  "Staff only: observer (default) or mentor"
+// @Success      200  {object}  map[string]interface{}  "WebSocket URL and role"
+// @Failure      401  {object}  map[string]interface{}  "Unauthorized"
+// @Failure      403  {object}  map[string]interface{}  "Forbidden"
+// @Failure      404  {object}  map[string]interface{}  "Session not found"
+// @Router       /terminal/{id}/ws [get]
 func (h *WBFYHandlers) WebSocketProxy(c *gin.Context) {
 	sessionID := c.Param("id")
 
-	// Get session from memory map
-	h.sessionMutex.RLock()
-	session, exists := h.sessionMap[sessionID]
-	h.sessionMutex.RUnlock()
+	session, exists := h.getSession(sessionID)
 	if !exists {
 		c.JSON(http.StatusNotFound, gin.H{
 			"status":  "error",
@@ -344,112 +667,288 @@ func (h *WBFYHandlers) WebSocketProxy(c *gin.Context) {
 		return
 	}
 
-	// Construct the target WebSocket URL
-	targetURL := fmt.Sprintf("ws://localhost:%d/ws", session.Port)
+	// Work out which role the requester attaches with
+	user, _ := currentUser(c)
+	role, ok := terminalRoleFor(session, user, c.Query("as"))
+	if !ok {
+		c.JSON(http.StatusForbidden, gin.H{
+			"status":  "error",
+			"message": "You do not have access to this session",
+		})
+		return
+	}
 
-	// TODO: Implement WebSocket proxy to forward WebSocket connection to the container
-	// This would require a WebSocket proxy library or implementation
+	// The browser connects through the academy, which proxies to the session
+	socketURL := fmt.Sprintf("/terminal/%s/socket", session.ID)
+	if role != TerminalRoleOwner {
+		socketURL += "?as=" + role
+	}
 
-	// For now, just return the URL for frontend to connect directly
 	c.JSON(http.StatusOK, gin.H{
 		"status": "success",
-		"url":    targetURL,
+		"url":    socketURL,
+		"role":   role,
 	})
 }
 
-// CleanupTerminal handles cleaning up terminal sessions
+// TerminalSocket godoc
+// @Summary      Terminal WebSocket
+// @Description  Proxies the terminal WebSocket to the session's wbfy server, signed for the requester's role
+// @Tags         terminal
+// @Security     JWTCookie
+// @Param        id     path      string  true   "Terminal session ID"
+// @Param        as     query     string  false  "Role to attach as (observer, mentor)"
+// @Param        since  query     int     false  "Last output sequence number seen, to replay missed output"
+// @Success      101  {object}  nil  "Switching protocols"
+// @Failure      403  {object}  nil  "Forbidden"
+// @Failure      404  {object}  nil  "Session not found"
+// @Router       /terminal/{id}/socket [get]
+func (h *WBFYHandlers) TerminalSocket(c *gin.Context) {
+	session, exists := h.getSession(c.Param("id"))
+	if !exists {
+		c.String(http.StatusNotFound, "Terminal session not found")
+		return
+	}
+
+	user, _ := currentUser(c)
+	role, ok := terminalRoleFor(session, user, c.Query("as"))
+	if !ok {
+		c.String(http.StatusForbidden, "You do not have access to this session")
+		return
+	}
+
+	if session.State != SessionReady || session.Address == "" {
+		c.String(http.StatusConflict, "Terminal session is not ready")
+		return
+	}
+
+	// The socket is authenticated by cookie, so only our own pages may open it
+	if !sameOrigin(c.Request) {
+		c.String(http.StatusForbidden, "Cross-origin terminal connections are not allowed")
+		return
+	}
+
+	// The owner opening the terminal and typing into it keep the session from
+	// idling out. Observers and mentors watching don't.
+	var writer http.ResponseWriter = c.Writer
+	if role == TerminalRoleOwner {
+		h.touchSession(session.ID)
+		writer = activityWriter{
+			ResponseWriter: c.Writer,
+			touch:          func() { h.touchSession(session.ID) },
+		}
+	}
+
+	target := terminalSocketURL(session, role, user.Username, c.Query("since"))
+	proxy := &httputil.ReverseProxy{
+		Director: func(req *http.Request) {
+			req.URL = target
+			req.Host = target.Host
+			// The session cookie is for the academy, not the terminal, and the
+			// origin was checked above against the academy's own host
+			req.Header.Del("Cookie")
+			req.Header.Del("Origin")
+		},
+	}
+	proxy.ServeHTTP(writer, c.Request)
+}
+
+// CleanupTerminal godoc
+// @Summary      Close a terminal session
+// @Description  Stops the session's container, deletes its workspace and releases its port. Closing a session that has already ended succeeds.
+// @Tags         terminal
+// @Produce      json
+// @Security     JWTCookie
+// @Param        id    path      string  true  "Terminal session ID"
+// @Success      200  {object}  map[string]interface{}  "Session closed"
+// @Failure      403  {object}  map[string]interface{}  "Forbidden"
+// @Failure      404  {object}  map[string]interface{}  "Session not found"
+// @Router       /terminal/{id} [delete]
 func (h *WBFYHandlers) CleanupTerminal(c *gin.Context) {
 	sessionID := c.Param("id")
 
 	// Get session
-	h.sessionMutex.RLock()
-	session, exists := h.sessionMap[sessionID]
-	h.sessionMutex.RUnlock()
+	session, exists := h.getSession(sessionID)
 	if !exists {
-		c.JSON(http.StatusNotFound, gin.H{
+		// Closing twice is fine, as long as the session existed
+		stored, err := h.loadSession(sessionID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{
+				"status":  "error",
+				"message": "Terminal session not found",
+			})
+			return
+		}
+		session = stored
+	}
+
+	// The owner and staff may close a session
+	user, _ := currentUser(c)
+	if _, ok := terminalRoleFor(session, user, ""); !ok {
+		c.JSON(http.StatusForbidden, gin.H{
 			"status":  "error",
-			"message": "Terminal session not found",
+			"message": "You do not have access to this session",
 		})
 		return
 	}
 
-	// Stop and remove the container
-	if session.ContainerName != "" {
-		cmd := exec.Command("docker", "stop", session.ContainerName)
-		cmd.Run() // Ignore errors, container might already be stopped
-	}
-
-	// Delete the temporary directory
-	if session.TempDir != "" {
-		os.RemoveAll(session.TempDir)
+	if exists {
+		reason := ""
+		if session.UserID != user.ID {
+			reason = "Closed by " + user.Username
+		}
+		h.removeSession(session, SessionTerminated, reason)
 	}
 
-	// Release the port
-	h.ReleasePort(sessionID)
-
-	// Remove from memory map
-	h.sessionMutex.Lock()
-	delete(h.sessionMap, sessionID)
-	h.sessionMutex.Unlock()
-
 	c.JSON(http.StatusOK, gin.H{
 		"status":  "success",
 		"message": "Terminal session cleaned up",
 	})
 }
 
-// StartCleanupJob starts a background job to clean up expired terminal sessions
+// TerminalPortStats godoc
+// @Summary      Terminal port usage
+// @Description  Reports how many host ports of the terminal port pool are in use
+// @Tags         terminal
+// @Produce      json
+// @Security     JWTCookie
+// @Success      200  {object}  PortStats  "Port pool usage"
+// @Failure      403  {object}  nil  "Forbidden"
+// @Router       /admin/terminals/ports [get]
+func (h *WBFYHandlers) TerminalPortStats(c *gin.Context) {
+	c.JSON(http.StatusOK, h.ports.Stats())
+}
+
+// StartCleanupJob starts a background job to clean up expired and idle terminal sessions
 func (h *WBFYHandlers) StartCleanupJob() {
-	ticker := time.NewTicker(15 * time.Minute)
+	ticker := time.NewTicker(time.Minute)
 	go func() {
-		for range ticker.C {
-			h.cleanupExpiredSessions()
+		defer close(h.cleanupDone)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				h.cleanupExpiredSessions()
+			case <-h.stopCleanup:
+				return
+			}
 		}
 	}()
 }
 
-// cleanupExpiredSessions cleans up expired terminal sessions
+// StopCleanupJob stops the cleanup job, waiting for a run in progress to finish.
+// Running sessions are left alone so they can be adopted after a restart.
+func (h *WBFYHandlers) StopCleanupJob() {
+	close(h.stopCleanup)
+	<-h.cleanupDone
+}
+
+// cleanupExpiredSessions cleans up expired and idle terminal sessions
 func (h *WBFYHandlers) cleanupExpiredSessions() {
 	now := time.Now()
 
 	// Create a list of sessions to remove to avoid concurrent map iteration
-	var sessionsToRemove []string
+	var sessionsToRemove, idleSessions []*TerminalSession
 
 	// Check all sessions
 	h.sessionMutex.RLock()
-	for id, session := range h.sessionMap {
+	for _, session := range h.sessionMap {
 		if now.After(session.ExpiresAt) {
-			sessionsToRemove = append(sessionsToRemove, id)
+			sessionsToRemove = append(sessionsToRemove, session)
+		} else if h.idle(session, now) {
+			idleSessions = append(idleSessions, session)
 		}
 	}
 	h.sessionMutex.RUnlock()
 
+	for _, session := range idleSessions {
+		h.removeSession(session, SessionExpired, "No activity for "+h.cfg.WBFY.IdleTimeout.String())
+		fmt.Printf("Cleaned up idle session: %s\n", session.ID)
+	}
+
 	// Remove expired sessions
-	for _, id := range sessionsToRemove {
-		h.sessionMutex.RLock()
-		session := h.sessionMap[id]
-		h.sessionMutex.RUnlock()
-
-		// Stop and remove the container
-		if session.ContainerName != "" {
-			cmd := exec.Command("docker", "stop", session.ContainerName)
-			cmd.Run() // Ignore errors, container might already be stopped
+	for _, session := range sessionsToRemove {
+		if session.State == SessionFailed {
+			// Its resources were released when it failed; only the record was kept
+			h.sessionMutex.Lock()
+			delete(h.sessionMap, session.ID)
+			h.sessionMutex.Unlock()
+			continue
 		}
 
-		// Delete the temporary directory
-		if session.TempDir != "" {
-			os.RemoveAll(session.TempDir)
+		h.removeSession(session, SessionExpired, "")
+		fmt.Printf("Cleaned up expired session: %s\n", session.ID)
+	}
+
+	// Ended sessions are kept in the store for a day so their status can still be looked up
+	if err := purgeTerminalSessions(h.db, now.Add(-24*time.Hour)); err != nil {
+		fmt.Printf("Failed to purge old terminal sessions: %v\n", err)
+	}
+	h.sessionMutex.Lock()
+	for id, at := range h.removed {
+		if at.Before(now.Add(-24 * time.Hour)) {
+			delete(h.removed, id)
 		}
+	}
+	h.sessionMutex.Unlock()
+}
 
-		// Release the port
-		h.ReleasePort(id)
+// removeSession records the state a session ended in, then stops its
+// container and releases what it holds. Only the first of several concurrent
+// removals of the same session does anything, so it's safe to call more than once.
+func (h *WBFYHandlers) removeSession(session *TerminalSession, state, reason string) bool {
+	// Claim the session, picking up any changes made since the caller looked
+	// it up. Stopping the container takes a while; in the meantime a request
+	// that misses the session in memory must not adopt it from the store.
+	h.sessionMutex.Lock()
+	current, exists := h.sessionMap[session.ID]
+	delete(h.sessionMap, session.ID)
+	if exists {
+		h.removed[session.ID] = time.Now()
+	}
+	h.sessionMutex.Unlock()
+	if !exists {
+		return false
+	}
+	h.forgetActivity(session.ID)
 
-		// Remove from memory map
-		h.sessionMutex.Lock()
-		delete(h.sessionMap, id)
-		h.sessionMutex.Unlock()
+	ended := *current
+	ended.State = state
+	ended.FailureReason = reason
+	if err := h.saveSession(ended); err != nil {
+		fmt.Printf("Failed to store terminal session %s: %v\n", current.ID, err)
+	}
+
+	// Stop and remove the container
+	h.stopContainer(current)
+
+	// Delete the temporary directory
+	if current.TempDir != "" {
+		os.RemoveAll(current.TempDir)
+	}
+
+	// Release the port
+	h.ports.Release(current.ID)
+	return true
+}
+
+// wasRemoved reports whether a session was removed. The caller must hold sessionMutex.
+func (h *WBFYHandlers) wasRemoved(sessionID string) bool {
+	_, removed := h.removed[sessionID]
+	return removed
+}
+
+// stopContainer stops a session's container, ignoring containers that are already gone
+func (h *WBFYHandlers) stopContainer(session *TerminalSession) {
+	if session.ContainerID == "" {
+		return
+	}
 
-		fmt.Printf("Cleaned up expired session: %s\n", id)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if err := h.runtime.Stop(ctx, session.ContainerID); err != nil {
+		fmt.Printf("Failed to stop container for session %s: %v\n", session.ID, err)
 	}
 }
 
@@ -483,86 +982,199 @@ func getDockerImage(language string) string {
 	}
 }
 
-// Helper function to copy problem files to the workspace
+// runSetup runs a problem's setup script inside the session container, as the
+// student, from the workspace root. The script is passed as an argument so it
+// never shows up in the workspace.
+func (h *WBFYHandlers) runSetup(ctx context.Context, problem *problems.Problem, containerID string) error {
+	script, err := problem.ReadSetup()
+	if err != nil || script == "" {
+		return err
+	}
+
+	result, err := h.runtime.Exec(ctx, containerID, container.ExecOptions{
+		Cmd: []string{"bash", "-c", script, "setup"},
+	})
+	if err != nil {
+		return err
+	}
+	if result.ExitCode != 0 {
+		return fmt.Errorf("setup script exited with status %d: %s", result.ExitCode, result.Stderr)
+	}
+	return nil
+}
+
+// Helper function to copy problem files to the workspace, keeping their permissions.
+// Symbolic links are skipped so fixtures can't point outside the problem. The
+// grader copies student workspaces with it too, so src is read through an
+// os.Root and a link swapped in while copying can't lead out of it.
 func copyProblemFiles(src, dst string) error {
-	// Walk through the source directory
-	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
+	root, err := os.OpenRoot(src)
+	if err != nil {
+		return err
+	}
+	defer root.Close()
 
-		// Calculate destination path
-		relPath, err := filepath.Rel(src, path)
+	return fs.WalkDir(root.FS(), ".", func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
-		dstPath := filepath.Join(dst, relPath)
+		dstPath := filepath.Join(dst, path)
 
 		// If it's a directory, create it
-		if info.IsDir() {
-			return os.MkdirAll(dstPath, 0755)
+		if d.IsDir() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			return os.MkdirAll(dstPath, info.Mode().Perm())
+		}
+		if !d.Type().IsRegular() {
+			return nil
 		}
 
-		// Copy the file
-		srcFile, err := os.Open(path)
+		// Copy the file, unless it was swapped for something else since it was listed
+		srcFile, info, err := openInRoot(root, path, nil)
 		if err != nil {
-			return err
+			return nil
 		}
 		defer srcFile.Close()
+		if !info.Mode().IsRegular() {
+			return nil
+		}
 
-		dstFile, err := os.Create(dstPath)
+		dstFile, err := os.OpenFile(dstPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
 		if err != nil {
 			return err
 		}
 		defer dstFile.Close()
 
-		_, err = io.Copy(dstFile, srcFile)
+		_, err = io.Copy(dstFile, io.LimitReader(srcFile, info.Size()))
 		return err
 	})
 }
 
-// storeTerminalSession stores a terminal session in the database
-func (h *WBFYHandlers) storeTerminalSession(session TerminalSession) error {
-	// In a production environment, this would store the session in the database
-	// For now, we'll just log it
-	fmt.Printf("Storing terminal session: %+v\n", session)
-
-	// Here's how you would implement the database storage:
-	/*
-		ctx := context.Background()
-		_, err := h.db.Pool.Exec(ctx, `
-			INSERT INTO terminal_sessions
-			(id, user_id, problem_id, port, container_id, container_name, command, language, temp_dir, created_at, expires_at)
-			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`,
-			session.ID, session.UserID, session.ProblemID, session.Port,
-			session.ContainerID, session.ContainerName, session.Command, session.Language,
-			session.TempDir, session.CreatedAt, session.ExpiresAt)
-		return err
-	*/
+// chownWorkspace hands a workspace to the user the container runs as. It only
+// applies when the academy runs as root; otherwise the files already belong to
+// the user running the sessions.
+func chownWorkspace(root string, uid, gid int) error {
+	if os.Geteuid() != 0 {
+		return nil
+	}
+	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		return os.Lchown(path, uid, gid)
+	})
+}
 
-	return nil
+// sessionEndedMessage explains to the user why a session can't be used
+func sessionEndedMessage(session *TerminalSession) string {
+	switch {
+	case session.State == SessionFailed:
+		return "The terminal failed to start: " + session.FailureReason
+	case session.State == SessionTerminated && session.FailureReason != "":
+		return "This terminal session was ended: " + session.FailureReason
+	case session.State == SessionTerminated:
+		return "This terminal session was ended"
+	case session.FailureReason != "":
+		return "Session has expired: " + session.FailureReason
+	default:
+		return "Session has expired"
+	}
+}
+
+// getSession looks up a terminal session, recovering it from the store after a restart
+func (h *WBFYHandlers) getSession(sessionID string) (*TerminalSession, bool) {
+	h.sessionMutex.RLock()
+	session, exists := h.sessionMap[sessionID]
+	h.sessionMutex.RUnlock()
+	if exists {
+		return session, true
+	}
+
+	// The session may have been started before a restart
+	return h.recoverSession(sessionID)
+}
+
+// isTerminalStaff reports whether a user role may watch other users' terminals
+func isTerminalStaff(role string) bool {
+	return rbac.Can(role, rbac.WatchTerminals)
+}
+
+// terminalRoleFor decides which wbfy role a user attaches to a session with.
+// Owners always attach as owner; staff attach as observer unless they ask for mentor.
+func terminalRoleFor(session *TerminalSession, user models.User, requested string) (string, bool) {
+	if user.ID == session.UserID {
+		return TerminalRoleOwner, true
+	}
+
+	if !isTerminalStaff(user.Role) {
+		return "", false
+	}
+
+	switch requested {
+	case "", TerminalRoleObserver:
+		return TerminalRoleObserver, true
+	case TerminalRoleMentor:
+		return TerminalRoleMentor, true
+	default:
+		return "", false
+	}
+}
+
+// sameOrigin reports whether a browser request came from a page served by this host.
+// Requests without an Origin header don't come from a browser page and are allowed.
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(u.Host, r.Host)
+}
+
+// terminalSocketURL builds the signed wbfy WebSocket URL for a client
+func terminalSocketURL(session *TerminalSession, role, name, since string) *url.URL {
+	query := url.Values{}
+	query.Set("role", role)
+	query.Set("name", name)
+	query.Set("token", signTerminalClient(session.Secret, role, name))
+	if since != "" {
+		query.Set("since", since)
+	}
+
+	return &url.URL{
+		Scheme:   "http",
+		Host:     session.Address,
+		Path:     "/ws",
+		RawQuery: query.Encode(),
+	}
+}
+
+func signTerminalClient(secret, role, name string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(role + ":" + name))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// generateSessionSecret returns a random hex secret for a terminal session
+func generateSessionSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
 }
 
 // getProblemBySlug gets a problem by its slug
-func (h *WBFYHandlers) getProblemBySlug(slug string) (*Problem, error) {
-	// In a production environment, fetch from database
-	// For now, return a mock problem
-	return &Problem{
-		ID:       uuid.New(),
-		Title:    "Sample Problem",
-		Slug:     slug,
-		Type:     "linux",
-		FilePath: "/app/problems/day1/linux.md",
-		Day:      1,
-	}, nil
-}
-
-// Problem represents a coding problem
-type Problem struct {
-	ID       uuid.UUID `json:"id"`
-	Title    string    `json:"title"`
-	Slug     string    `json:"slug"`
-	Type     string    `json:"type"`
-	FilePath string    `json:"file_path"`
-	Day      int       `json:"day"`
+func (h *WBFYHandlers) getProblemBySlug(slug string) (*problems.Problem, error) {
+	problem, ok := h.problems.Problem(slug)
+	if !ok {
+		return nil, fmt.Errorf("problem %q not found", slug)
+	}
+	return problem, nil
 }
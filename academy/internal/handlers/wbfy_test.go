@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/globallstudent/academy/internal/config"
+	"github.com/globallstudent/academy/internal/models"
+	"github.com/globallstudent/academy/internal/rbac"
+	"github.com/google/uuid"
+)
+
+func TestTerminalRoleFor(t *testing.T) {
+	owner := models.User{ID: uuid.New(), Role: rbac.RoleUser}
+	session := &TerminalSession{ID: "s1", UserID: owner.ID}
+
+	tests := []struct {
+		name      string
+		user      models.User
+		requested string
+		want      string
+		wantOK    bool
+	}{
+		{name: "owner", user: owner, want: TerminalRoleOwner, wantOK: true},
+		{name: "owner asking to observe stays owner", user: owner, requested: TerminalRoleObserver, want: TerminalRoleOwner, wantOK: true},
+		{name: "other student", user: models.User{ID: uuid.New(), Role: rbac.RoleUser}},
+		{name: "judge observes by default", user: models.User{ID: uuid.New(), Role: rbac.RoleJudge}, want: TerminalRoleObserver, wantOK: true},
+		{name: "admin as mentor", user: models.User{ID: uuid.New(), Role: rbac.RoleAdmin}, requested: TerminalRoleMentor, want: TerminalRoleMentor, wantOK: true},
+		{name: "staff can't take ownership", user: models.User{ID: uuid.New(), Role: rbac.RoleAdmin}, requested: TerminalRoleOwner},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := terminalRoleFor(session, tt.user, tt.requested)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("terminalRoleFor() = %q, %v; want %q, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestTerminalSocketURL(t *testing.T) {
+	session := &TerminalSession{Address: "172.30.0.7:8081", Secret: "s3cret"}
+
+	u := terminalSocketURL(session, TerminalRoleOwner, "ada", "42")
+	if u.Host != session.Address || u.Path != "/ws" {
+		t.Errorf("socket URL = %s", u)
+	}
+	query := u.Query()
+	// wbfy signs role:name with HMAC-SHA256 of the session secret the same way
+	want := "166a0f4a8b68ff9556c60355df411a82ec5c90407a0219c9f16bebdd4838301b"
+	if query.Get("token") != want {
+		t.Errorf("token = %q, want %q", query.Get("token"), want)
+	}
+	if query.Get("role") != TerminalRoleOwner || query.Get("name") != "ada" || query.Get("since") != "42" {
+		t.Errorf("query = %v", query)
+	}
+	if query.Has("secret") {
+		t.Error("the session secret is in the socket URL")
+	}
+}
+
+// cleanupRouter serves CleanupTerminal for a session owned by owner, with the
+// requests made as whoever the "as" header names
+func cleanupRouter(t *testing.T, owner models.User, users map[string]models.User) (*gin.Engine, *WBFYHandlers, *memorySessionStore, *int) {
+	t.Helper()
+	stops := 0
+	runtime := stubRuntime{stop: func(ctx context.Context, id string) error {
+		stops++
+		return nil
+	}}
+	ports, err := NewPortAllocator("20000-20001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ports.available = func(port int) bool { return true }
+
+	h := NewWBFYHandlers(nil, &config.Config{}, runtime, ports, nil, nil, nil)
+	store := &memorySessionStore{sessions: make(map[string]TerminalSession)}
+	h.saveSession = store.save
+	h.loadSession = store.load
+
+	port, err := ports.Reserve("s1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	session := &TerminalSession{
+		ID:          "s1",
+		UserID:      owner.ID,
+		Port:        port,
+		ContainerID: "c1",
+		TempDir:     t.TempDir(),
+		State:       SessionReady,
+		ExpiresAt:   time.Now().Add(time.Hour),
+	}
+	h.sessionMap[session.ID] = session
+	store.save(*session)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set("user", users[c.GetHeader("As")])
+	})
+	r.DELETE("/terminal/:id", h.CleanupTerminal)
+	return r, h, store, &stops
+}
+
+func TestCleanupTerminal(t *testing.T) {
+	owner := models.User{ID: uuid.New(), Username: "ada", Role: rbac.RoleUser}
+	users := map[string]models.User{
+		"owner":   owner,
+		"student": {ID: uuid.New(), Username: "bob", Role: rbac.RoleUser},
+		"judge":   {ID: uuid.New(), Username: "grace", Role: rbac.RoleJudge},
+	}
+
+	tests := []struct {
+		name       string
+		requests   []string // who closes the session, in order
+		path       string
+		wantStatus []int
+		wantState  string
+		wantReason string
+	}{
+		{
+			name:       "owner closes",
+			requests:   []string{"owner"},
+			wantStatus: []int{http.StatusOK},
+			wantState:  SessionTerminated,
+		},
+		{
+			name:       "closing twice",
+			requests:   []string{"owner", "owner"},
+			wantStatus: []int{http.StatusOK, http.StatusOK},
+			wantState:  SessionTerminated,
+		},
+		{
+			name:       "judge kills",
+			requests:   []string{"judge"},
+			wantStatus: []int{http.StatusOK},
+			wantState:  SessionTerminated,
+			wantReason: "Closed by grace",
+		},
+		{
+			name:       "another student",
+			requests:   []string{"student"},
+			wantStatus: []int{http.StatusForbidden},
+			wantState:  SessionReady,
+		},
+		{
+			name:       "unknown session",
+			requests:   []string{"owner"},
+			path:       "/terminal/nope",
+			wantStatus: []int{http.StatusNotFound},
+			wantState:  SessionReady,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router, h, store, stops := cleanupRouter(t, owner, users)
+			workspace := h.sessionMap["s1"].TempDir
+			path := tt.path
+			if path == "" {
+				path = "/terminal/s1"
+			}
+
+			for i, as := range tt.requests {
+				req := httptest.NewRequest(http.MethodDelete, path, nil)
+				req.Header.Set("As", as)
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, req)
+				if w.Code != tt.wantStatus[i] {
+					t.Errorf("request %d: status = %d, want %d", i+1, w.Code, tt.wantStatus[i])
+				}
+			}
+
+			stored, _ := store.load("s1")
+			if stored.State != tt.wantState || stored.FailureReason != tt.wantReason {
+				t.Errorf("stored session is %q (%q), want %q (%q)", stored.State, stored.FailureReason, tt.wantState, tt.wantReason)
+			}
+
+			// A closed session has stopped its container once and given up
+			// its workspace and port; any other still holds them
+			wantStops, wantPorts, wantWorkspace := 0, 1, true
+			if tt.wantState == SessionTerminated {
+				wantStops, wantPorts, wantWorkspace = 1, 0, false
+			}
+			if *stops != wantStops {
+				t.Errorf("container stopped %d times, want %d", *stops, wantStops)
+			}
+			if inUse := h.ports.Stats().InUse; inUse != wantPorts {
+				t.Errorf("%d ports in use, want %d", inUse, wantPorts)
+			}
+			if _, err := os.Stat(workspace); (err == nil) != wantWorkspace {
+				t.Errorf("workspace exists = %v, want %v", err == nil, wantWorkspace)
+			}
+		})
+	}
+}
@@ -0,0 +1,631 @@
+package handlers
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Files the academy writes into the workspace for its own bookkeeping.
+// They are hidden from the file API so students can't read or tamper with them.
+var reservedWorkspaceFiles = map[string]bool{
+	"session.json":    true,
+	"container.json":  true,
+	sessionSecretFile: true,
+}
+
+// errOutsideWorkspace is returned when a path escapes the session workspace
+var errOutsideWorkspace = errors.New("path is outside the workspace")
+
+// WorkspaceEntry describes a file or directory in a session workspace
+type WorkspaceEntry struct {
+	Name    string    `json:"name"`
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	IsDir   bool      `json:"is_dir"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+// ListWorkspace godoc
+// @Summary      List workspace files
+// @Description  Lists the files in a directory of a terminal session's workspace
+// @Tags         workspace
+// @Produce      json
+// @Security     JWTCookie
+// @Param        id    path      string  true   "Terminal session ID"
+// @Param        path  query     string  false  "Directory relative to the workspace root"
+// @Success      200  {object}  map[string]interface{}  "Directory listing"
+// @Failure      400  {object}  map[string]interface{}  "Invalid path"
+// @Failure      403  {object}  map[string]interface{}  "Forbidden"
+// @Failure      404  {object}  map[string]interface{}  "Session or directory not found"
+// @Router       /workspace/{id}/files [get]
+func (h *WBFYHandlers) ListWorkspace(c *gin.Context) {
+	session, ok := h.workspaceSession(c, false)
+	if !ok {
+		return
+	}
+
+	workspace, ok := openSessionWorkspace(c, session)
+	if !ok {
+		return
+	}
+	defer workspace.Close()
+
+	rel := c.Query("path")
+	dir, info, err := workspace.Open(rel)
+	if err != nil || !info.IsDir() {
+		if dir != nil {
+			dir.Close()
+		}
+		workspaceOpenError(c, err, "Directory not found")
+		return
+	}
+	entries, err := dir.ReadDir(-1)
+	dir.Close()
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "error",
+			"message": "Directory not found",
+		})
+		return
+	}
+	top := workspace.isTop(info)
+
+	files := make([]WorkspaceEntry, 0, len(entries))
+	for _, entry := range entries {
+		if top && reservedWorkspaceFiles[entry.Name()] {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil || workspace.isReserved(info) {
+			continue
+		}
+		entryRel := filepath.ToSlash(filepath.Join(rel, entry.Name()))
+
+		files = append(files, WorkspaceEntry{
+			Name:    entry.Name(),
+			Path:    entryRel,
+			Size:    info.Size(),
+			IsDir:   entry.IsDir(),
+			ModTime: info.ModTime(),
+		})
+	}
+
+	// Directories first, then alphabetical
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].IsDir != files[j].IsDir {
+			return files[i].IsDir
+		}
+		return files[i].Name < files[j].Name
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"path":   filepath.ToSlash(filepath.Clean("/" + rel)),
+		"files":  files,
+	})
+}
+
+// DownloadWorkspace godoc
+// @Summary      Download workspace files
+// @Description  Downloads a single file, or a zip archive when the path is a directory (the whole workspace by default)
+// @Tags         workspace
+// @Produce      octet-stream
+// @Security     JWTCookie
+// @Param        id    path      string  true   "Terminal session ID"
+// @Param        path  query     string  false  "File or directory relative to the workspace root"
+// @Success      200  {file}    file  "File contents or zip archive"
+// @Failure      400  {object}  map[string]interface{}  "Invalid path"
+// @Failure      403  {object}  map[string]interface{}  "Forbidden"
+// @Failure      404  {object}  map[string]interface{}  "Session or file not found"
+// @Router       /workspace/{id}/download [get]
+func (h *WBFYHandlers) DownloadWorkspace(c *gin.Context) {
+	session, ok := h.workspaceSession(c, false)
+	if !ok {
+		return
+	}
+
+	workspace, ok := openSessionWorkspace(c, session)
+	if !ok {
+		return
+	}
+	defer workspace.Close()
+
+	rel := c.Query("path")
+	f, info, err := workspace.Open(rel)
+	if err != nil {
+		workspaceOpenError(c, err, "File not found")
+		return
+	}
+	defer f.Close()
+
+	if !info.IsDir() {
+		c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filepath.Base(workspaceName(rel))}))
+		http.ServeContent(c.Writer, c.Request, info.Name(), info.ModTime(), f)
+		return
+	}
+
+	// Directories are sent as a zip archive
+	name := "workspace"
+	if workspaceName(rel) != "." {
+		name = filepath.Base(workspaceName(rel))
+	}
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name + ".zip"}))
+
+	if err := zipWorkspaceDir(c.Writer, workspace, workspaceName(rel)); err != nil {
+		// Headers are already sent, all we can do is log
+		fmt.Printf("Failed to zip workspace %s: %v\n", session.ID, err)
+	}
+}
+
+// UploadWorkspace godoc
+// @Summary      Upload a file to the workspace
+// @Description  Uploads a file into a directory of the session workspace, subject to per-file and total size quotas
+// @Tags         workspace
+// @Accept       multipart/form-data
+// @Produce      json
+// @Security     JWTCookie
+// @Param        id    path      string  true   "Terminal session ID"
+// @Param        file  formData  file    true   "File to upload"
+// @Param        path  formData  string  false  "Target directory relative to the workspace root"
+// @Success      200  {object}  map[string]interface{}  "File uploaded"
+// @Failure      400  {object}  map[string]interface{}  "Invalid path or missing file"
+// @Failure      403  {object}  map[string]interface{}  "Forbidden"
+// @Failure      404  {object}  map[string]interface{}  "Session not found"
+// @Failure      413  {object}  map[string]interface{}  "File too large or quota exceeded"
+// @Router       /workspace/{id}/files [post]
+func (h *WBFYHandlers) UploadWorkspace(c *gin.Context) {
+	session, ok := h.workspaceSession(c, true)
+	if !ok {
+		return
+	}
+
+	// Never read more than one file's worth of body (plus room for the form fields)
+	maxFile := h.cfg.WBFY.WorkspaceMaxFile
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxFile+1<<20)
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+				"status":  "error",
+				"message": fmt.Sprintf("Files may be at most %d bytes", maxFile),
+			})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "A file is required",
+		})
+		return
+	}
+
+	if fileHeader.Size > maxFile {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+			"status":  "error",
+			"message": fmt.Sprintf("Files may be at most %d bytes", maxFile),
+		})
+		return
+	}
+
+	workspace, ok := openSessionWorkspace(c, session)
+	if !ok {
+		return
+	}
+	defer workspace.Close()
+
+	// Only the base name of the uploaded file is used
+	rel := filepath.Join(c.PostForm("path"), filepath.Base(fileHeader.Filename))
+	if workspaceName(rel) == "." {
+		workspacePathError(c, errOutsideWorkspace)
+		return
+	}
+
+	// Check the workspace quota, not counting the file we're about to replace
+	used, err := workspace.Usage()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Failed to check workspace usage",
+		})
+		return
+	}
+	if existing, err := workspace.root.Lstat(workspaceName(rel)); err == nil && existing.Mode().IsRegular() {
+		used -= existing.Size()
+	}
+	if used+fileHeader.Size > h.cfg.WBFY.WorkspaceQuota {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+			"status":  "error",
+			"message": "Workspace quota exceeded",
+		})
+		return
+	}
+
+	src, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Failed to read the uploaded file",
+		})
+		return
+	}
+	defer src.Close()
+
+	// The file and any new directories belong to the container's user
+	dst, err := workspace.Create(rel, h.cfg.WBFY.WorkspaceUID, h.cfg.WBFY.WorkspaceGID)
+	if errors.Is(err, errOutsideWorkspace) {
+		workspacePathError(c, err)
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Failed to save file",
+		})
+		return
+	}
+	_, err = io.Copy(dst, io.LimitReader(src, maxFile))
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Failed to save file",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "File uploaded",
+		"path":    filepath.ToSlash(filepath.Clean(rel)),
+	})
+}
+
+// DeleteWorkspaceFile godoc
+// @Summary      Delete a workspace file
+// @Description  Deletes a file or directory from the session workspace
+// @Tags         workspace
+// @Produce      json
+// @Security     JWTCookie
+// @Param        id    path      string  true  "Terminal session ID"
+// @Param        path  query     string  true  "File or directory relative to the workspace root"
+// @Success      200  {object}  map[string]interface{}  "File deleted"
+// @Failure      400  {object}  map[string]interface{}  "Invalid path"
+// @Failure      403  {object}  map[string]interface{}  "Forbidden"
+// @Failure      404  {object}  map[string]interface{}  "Session or file not found"
+// @Router       /workspace/{id}/files [delete]
+func (h *WBFYHandlers) DeleteWorkspaceFile(c *gin.Context) {
+	session, ok := h.workspaceSession(c, true)
+	if !ok {
+		return
+	}
+
+	// Refuse to delete the workspace root itself
+	rel := c.Query("path")
+	if filepath.Clean("/"+rel) == "/" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Cannot delete the workspace root",
+		})
+		return
+	}
+
+	workspace, ok := openSessionWorkspace(c, session)
+	if !ok {
+		return
+	}
+	defer workspace.Close()
+
+	// A symlink is deleted itself, never what it points to
+	err := workspace.Remove(rel)
+	switch {
+	case errors.Is(err, errOutsideWorkspace):
+		workspacePathError(c, err)
+		return
+	case errors.Is(err, fs.ErrNotExist):
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "error",
+			"message": "File not found",
+		})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Failed to delete file",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "File deleted",
+	})
+}
+
+// SubmitWorkspace godoc
+// @Summary      Submit workspace as a solution
+// @Description  Exports a source file from the session workspace and runs it through the submission pipeline. Without a path, the single source file matching the language is used.
+// @Tags         workspace
+// @Accept       multipart/form-data
+// @Produce      json
+// @Security     JWTCookie
+// @Param        id        path      string  true   "Terminal session ID"
+// @Param        language  formData  string  false  "Programming language (defaults to the session language)"
+// @Param        path      formData  string  false  "Source file relative to the workspace root"
+// @Success      200  {object}  map[string]interface{}  "Submission results"
+// @Failure      400  {object}  map[string]interface{}  "No unique source file found"
+// @Failure      403  {object}  map[string]interface{}  "Forbidden"
+// @Failure      404  {object}  map[string]interface{}  "Session not found"
+// @Failure      500  {object}  map[string]interface{}  "Internal server error"
+// @Router       /workspace/{id}/submit [post]
+func (h *WBFYHandlers) SubmitWorkspace(c *gin.Context) {
+	session, ok := h.workspaceSession(c, true)
+	if !ok {
+		return
+	}
+
+	workspace, ok := openSessionWorkspace(c, session)
+	if !ok {
+		return
+	}
+	defer workspace.Close()
+
+	language := c.DefaultPostForm("language", session.Language)
+	rel := c.PostForm("path")
+
+	// Without an explicit path, look for the one source file in the language
+	if rel == "" {
+		candidates, err := findSourceFiles(workspace.root.FS(), languageExtension(language))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  "error",
+				"message": "Failed to read workspace",
+			})
+			return
+		}
+		if len(candidates) != 1 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":     "error",
+				"message":    "Choose which file to submit",
+				"candidates": candidates,
+			})
+			return
+		}
+		rel = candidates[0]
+	}
+
+	f, info, err := workspace.Open(rel)
+	if err != nil || info.IsDir() {
+		if f != nil {
+			f.Close()
+		}
+		workspaceOpenError(c, err, "File not found")
+		return
+	}
+	defer f.Close()
+	if info.Size() > h.cfg.WBFY.WorkspaceMaxFile {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+			"status":  "error",
+			"message": "File is too large to submit",
+		})
+		return
+	}
+
+	code, err := io.ReadAll(io.LimitReader(f, h.cfg.WBFY.WorkspaceMaxFile))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Failed to read file",
+		})
+		return
+	}
+
+	problem, err := h.getProblemBySlug(session.ProblemSlug)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "error",
+			"message": "Problem not found",
+		})
+		return
+	}
+	if !supportsLanguage(problem, language) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Unsupported language for this problem",
+		})
+		return
+	}
+
+	submission, results, err := gradeSubmission(c.Request.Context(), h.judge, session.UserID, problem, language, string(code))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Failed to grade submission: " + err.Error(),
+		})
+		return
+	}
+	if err := saveSubmission(h.db, submission); err != nil {
+		fmt.Printf("Failed to save submission for session %s: %v\n", session.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Failed to record your submission",
+		})
+		return
+	}
+	h.notifier.SubmissionJudged(submission)
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":     "success",
+		"file":       filepath.ToSlash(filepath.Clean(rel)),
+		"submission": submission,
+		"results":    visibleResults(c, results),
+	})
+}
+
+// workspaceSession loads the session for a workspace request and checks access.
+// Staff may browse any workspace, but only the owner may change it.
+func (h *WBFYHandlers) workspaceSession(c *gin.Context, write bool) (*TerminalSession, bool) {
+	session, exists := h.getSession(c.Param("id"))
+	if !exists || session.TempDir == "" {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "error",
+			"message": "Terminal session not found",
+		})
+		return nil, false
+	}
+
+	user, _ := currentUser(c)
+	role, ok := terminalRoleFor(session, user, "")
+	if !ok || (write && role != TerminalRoleOwner) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"status":  "error",
+			"message": "You do not have access to this workspace",
+		})
+		return nil, false
+	}
+
+	if session.State != SessionReady {
+		c.JSON(http.StatusConflict, gin.H{
+			"status":  "error",
+			"message": "Terminal session is not ready",
+		})
+		return nil, false
+	}
+
+	if role == TerminalRoleOwner {
+		h.touchSession(session.ID)
+	}
+	return session, true
+}
+
+// openSessionWorkspace opens a session's workspace, responding with an error
+// if it can't be opened
+func openSessionWorkspace(c *gin.Context, session *TerminalSession) (*workspaceRoot, bool) {
+	workspace, err := openWorkspaceRoot(session.TempDir)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "error",
+			"message": "Workspace not found",
+		})
+		return nil, false
+	}
+	return workspace, true
+}
+
+// workspacePathError responds to an invalid workspace path
+func workspacePathError(c *gin.Context, err error) {
+	c.JSON(http.StatusBadRequest, gin.H{
+		"status":  "error",
+		"message": "Invalid path: " + err.Error(),
+	})
+}
+
+// workspaceOpenError responds to a workspace path that couldn't be opened.
+// Besides a missing file, the workspace refuses paths that lead out of it
+// or to a bookkeeping file.
+func workspaceOpenError(c *gin.Context, err error, notFound string) {
+	if err == nil || errors.Is(err, fs.ErrNotExist) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "error",
+			"message": notFound,
+		})
+		return
+	}
+	workspacePathError(c, errOutsideWorkspace)
+}
+
+// zipWorkspaceDir writes the regular files under the workspace directory
+// name into a zip archive. Symlinks and bookkeeping files are skipped.
+func zipWorkspaceDir(w io.Writer, workspace *workspaceRoot, name string) error {
+	dir, err := workspace.root.OpenRoot(name)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+
+	zw := zip.NewWriter(w)
+
+	err = fs.WalkDir(dir.FS(), ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		// The entry may have been swapped for a link since it was listed
+		src, info, err := openInRoot(dir, path, workspace.isReserved)
+		if err != nil {
+			return nil
+		}
+		defer src.Close()
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		header, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return err
+		}
+		header.Name = path
+		header.Method = zip.Deflate
+
+		dst, err := zw.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(dst, io.LimitReader(src, info.Size()))
+		return err
+	})
+	if err != nil {
+		zw.Close()
+		return err
+	}
+
+	return zw.Close()
+}
+
+// findSourceFiles lists workspace files with the given extension, relative to the root
+func findSourceFiles(workspace fs.FS, ext string) ([]string, error) {
+	var files []string
+	err := fs.WalkDir(workspace, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() && filepath.Ext(path) == ext {
+			files = append(files, path)
+		}
+		return nil
+	})
+	return files, err
+}
+
+// Helper function to get the source file extension for a language
+func languageExtension(language string) string {
+	switch language {
+	case "python":
+		return ".py"
+	case "go":
+		return ".go"
+	case "javascript":
+		return ".js"
+	case "cpp":
+		return ".cpp"
+	default:
+		return ".sh"
+	}
+}
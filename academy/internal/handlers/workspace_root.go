@@ -0,0 +1,277 @@
+package handlers
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// workspaceRoot gives access to a session workspace. The student controls
+// the workspace from inside the container and can swap files for symlinks at
+// any moment, so every access goes through an os.Root, which resolves each
+// path element relative to the directory it opened and refuses to leave it.
+// Checking a path first and using it later would let a symlink swapped in
+// between reach files elsewhere on the host.
+type workspaceRoot struct {
+	root     *os.Root
+	reserved []os.FileInfo // the academy's bookkeeping files, to recognise them under any name
+}
+
+// openWorkspaceRoot opens the workspace at dir. The caller must close it.
+func openWorkspaceRoot(dir string) (*workspaceRoot, error) {
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &workspaceRoot{root: root}
+	for name := range reservedWorkspaceFiles {
+		if info, err := root.Lstat(name); err == nil && info.Mode().IsRegular() {
+			w.reserved = append(w.reserved, info)
+		}
+	}
+	return w, nil
+}
+
+// Close releases the workspace
+func (w *workspaceRoot) Close() error {
+	return w.root.Close()
+}
+
+// workspaceName turns a path relative to the workspace root into a name for
+// an os.Root, clamping ".." at the root
+func workspaceName(rel string) string {
+	name := strings.TrimPrefix(filepath.Clean("/"+rel), "/")
+	if name == "" {
+		return "."
+	}
+	return name
+}
+
+// isReserved reports whether info is one of the academy's bookkeeping files,
+// also when reached through a symlink or hard link with another name
+func (w *workspaceRoot) isReserved(info os.FileInfo) bool {
+	for _, reserved := range w.reserved {
+		if os.SameFile(info, reserved) {
+			return true
+		}
+	}
+	return false
+}
+
+// isTop reports whether info is the workspace root directory itself
+func (w *workspaceRoot) isTop(info os.FileInfo) bool {
+	top, err := w.root.Stat(".")
+	return err == nil && os.SameFile(info, top)
+}
+
+// Open opens a file or directory for reading. Bookkeeping files can't be opened.
+func (w *workspaceRoot) Open(rel string) (*os.File, os.FileInfo, error) {
+	return openInRoot(w.root, workspaceName(rel), w.isReserved)
+}
+
+// openInRoot opens name in root for reading, rejecting anything that isn't a
+// regular file or directory and anything reserved says no to. It doesn't
+// block on a FIFO the student left in place of a file.
+func openInRoot(root *os.Root, name string, reserved func(os.FileInfo) bool) (*os.File, os.FileInfo, error) {
+	f, err := root.OpenFile(name, os.O_RDONLY|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	if !info.Mode().IsRegular() && !info.IsDir() {
+		f.Close()
+		return nil, nil, fs.ErrNotExist
+	}
+	if reserved != nil && reserved(info) {
+		f.Close()
+		return nil, nil, errOutsideWorkspace
+	}
+	return f, info, nil
+}
+
+// Create opens a file for writing, creating it and its missing parent
+// directories owned by uid and gid, and truncating it if it exists. A
+// symlink, or a bookkeeping file, is never written through.
+func (w *workspaceRoot) Create(rel string, uid, gid int) (*os.File, error) {
+	name := workspaceName(rel)
+	if name == "." {
+		return nil, errOutsideWorkspace
+	}
+
+	dir, err := w.mkdirAll(filepath.Dir(name), uid, gid)
+	if err != nil {
+		return nil, err
+	}
+	defer dir.Close()
+
+	base := filepath.Base(name)
+	if dirInfo, err := dir.Stat("."); err != nil {
+		return nil, err
+	} else if w.isTop(dirInfo) && reservedWorkspaceFiles[base] {
+		return nil, errOutsideWorkspace
+	}
+
+	// The file isn't truncated until it's known to be the entry itself and
+	// not something a symlink led to
+	f, err := dir.OpenFile(base, os.O_WRONLY|os.O_CREATE|syscall.O_NONBLOCK, 0644)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err == nil {
+		var entry os.FileInfo
+		entry, err = dir.Lstat(base)
+		if err == nil && (!info.Mode().IsRegular() || !os.SameFile(info, entry) || w.isReserved(info)) {
+			err = errOutsideWorkspace
+		}
+	}
+	if err == nil {
+		err = f.Truncate(0)
+	}
+	if err == nil {
+		err = chownWorkspaceFile(f, uid, gid)
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// mkdirAll opens the directory rel, creating it and any missing parents
+// owned by uid and gid. Each one is looked up from the workspace root, so
+// links inside the workspace work as they do for the student.
+func (w *workspaceRoot) mkdirAll(rel string, uid, gid int) (*os.Root, error) {
+	name := workspaceName(rel)
+	if name != "." {
+		elems := strings.Split(name, "/")
+		for i := range elems {
+			dir := strings.Join(elems[:i+1], "/")
+			err := w.root.Mkdir(dir, 0755)
+			if errors.Is(err, fs.ErrExist) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+
+			created, err := w.root.OpenRoot(dir)
+			if err != nil {
+				return nil, err
+			}
+			err = chownRoot(created, uid, gid)
+			created.Close()
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return w.root.OpenRoot(name)
+}
+
+// Remove deletes a file or directory. A symlink is removed itself, never
+// what it points to, and nothing outside the workspace is touched.
+func (w *workspaceRoot) Remove(rel string) error {
+	name := workspaceName(rel)
+	if name == "." {
+		return errOutsideWorkspace
+	}
+
+	dir, err := w.root.OpenRoot(filepath.Dir(name))
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+
+	base := filepath.Base(name)
+	if dirInfo, err := dir.Stat("."); err != nil {
+		return err
+	} else if w.isTop(dirInfo) && reservedWorkspaceFiles[base] {
+		return errOutsideWorkspace
+	}
+	return removeAllInRoot(dir, base)
+}
+
+// removeAllInRoot deletes name in dir, and everything under it if it's a directory
+func removeAllInRoot(dir *os.Root, name string) error {
+	info, err := dir.Lstat(name)
+	if err != nil {
+		return err
+	}
+
+	if info.IsDir() {
+		sub, err := dir.OpenRoot(name)
+		if err != nil {
+			return err
+		}
+		defer sub.Close()
+
+		// Opening followed a symlink if the entry was swapped after Lstat
+		if subInfo, err := sub.Stat("."); err != nil || !os.SameFile(info, subInfo) {
+			return errOutsideWorkspace
+		}
+
+		f, err := sub.Open(".")
+		if err != nil {
+			return err
+		}
+		entries, err := f.ReadDir(-1)
+		f.Close()
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if err := removeAllInRoot(sub, entry.Name()); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+		}
+	}
+
+	return dir.Remove(name)
+}
+
+// Usage returns the total size of regular files in the workspace
+func (w *workspaceRoot) Usage() (int64, error) {
+	var total int64
+	err := fs.WalkDir(w.root.FS(), ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				return nil // removed while walking
+			}
+			total += info.Size()
+		}
+		return nil
+	})
+	return total, err
+}
+
+// chownRoot hands the directory root was opened on to uid and gid. Like
+// chownWorkspace, it does nothing unless the academy runs as root.
+func chownRoot(root *os.Root, uid, gid int) error {
+	f, err := root.Open(".")
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return chownWorkspaceFile(f, uid, gid)
+}
+
+// chownWorkspaceFile hands an open file to uid and gid, when running as root
+func chownWorkspaceFile(f *os.File, uid, gid int) error {
+	if os.Geteuid() != 0 {
+		return nil
+	}
+	return f.Chown(uid, gid)
+}
@@ -0,0 +1,320 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// testWorkspace lays out a workspace with bookkeeping files, links inside and
+// out of it, and a secret file outside. It returns the workspace directory
+// and the outside directory.
+func testWorkspace(t *testing.T) (root, outside string) {
+	t.Helper()
+	root = t.TempDir()
+	outside = t.TempDir()
+
+	mustWrite(t, filepath.Join(root, "session.json"), "{}")
+	mustWrite(t, filepath.Join(root, "main.py"), "print(1)")
+	mustWrite(t, filepath.Join(outside, "secret.txt"), "secret")
+	if err := os.Mkdir(filepath.Join(root, "src"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	mustWrite(t, filepath.Join(root, "src", "util.py"), "x = 1")
+	mustSymlink(t, "session.json", filepath.Join(root, "status"))
+	mustSymlink(t, "main.py", filepath.Join(root, "link.py"))
+	mustSymlink(t, "..", filepath.Join(root, "src", "up"))
+	mustSymlink(t, outside, filepath.Join(root, "escape"))
+	mustSymlink(t, filepath.Join(outside, "secret.txt"), filepath.Join(root, "secret"))
+	mustSymlink(t, filepath.Join(outside, "missing.txt"), filepath.Join(root, "dangling"))
+	return root, outside
+}
+
+func openTestWorkspace(t *testing.T, root string) *workspaceRoot {
+	t.Helper()
+	w, err := openWorkspaceRoot(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { w.Close() })
+	return w
+}
+
+func TestWorkspaceRootOpen(t *testing.T) {
+	root, _ := testWorkspace(t)
+	w := openTestWorkspace(t, root)
+
+	tests := []struct {
+		name    string
+		rel     string
+		want    string // content of the file opened, or "dir"
+		wantErr error
+	}{
+		{name: "root", rel: "", want: "dir"},
+		{name: "regular file", rel: "main.py", want: "print(1)"},
+		{name: "nested file", rel: "src/util.py", want: "x = 1"},
+		{name: "symlink inside workspace", rel: "link.py", want: "print(1)"},
+		{name: "dot-dot is clamped to the root", rel: "../../main.py", want: "print(1)"},
+		{name: "symlink back up to the root", rel: "src/up/main.py", want: "print(1)"},
+		{name: "missing file", rel: "nope.py", wantErr: fs.ErrNotExist},
+		{name: "reserved file", rel: "session.json", wantErr: errOutsideWorkspace},
+		{name: "symlink to reserved file", rel: "status", wantErr: errOutsideWorkspace},
+		{name: "reserved file through a parent link", rel: "src/up/session.json", wantErr: errOutsideWorkspace},
+		{name: "symlink out of the workspace", rel: "secret"},
+		{name: "directory symlink out of the workspace", rel: "escape/secret.txt"},
+		{name: "dangling symlink out of the workspace", rel: "dangling"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, info, err := w.Open(tt.rel)
+			if tt.want == "" {
+				if err == nil {
+					f.Close()
+					t.Fatalf("Open(%q) succeeded, want error", tt.rel)
+				}
+				if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Open(%q) error = %v, want %v", tt.rel, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Open(%q) failed: %v", tt.rel, err)
+			}
+			defer f.Close()
+
+			if tt.want == "dir" {
+				if !info.IsDir() {
+					t.Errorf("Open(%q) is not a directory", tt.rel)
+				}
+				return
+			}
+			data, err := io.ReadAll(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != tt.want {
+				t.Errorf("Open(%q) read %q, want %q", tt.rel, data, tt.want)
+			}
+		})
+	}
+}
+
+func TestWorkspaceRootCreate(t *testing.T) {
+	tests := []struct {
+		name    string
+		rel     string
+		wantErr bool
+	}{
+		{name: "new file", rel: "new.txt"},
+		{name: "replace a file", rel: "main.py"},
+		{name: "new directories", rel: "a/b/c.txt"},
+		{name: "through a link back to the root", rel: "src/up/new.txt"},
+		{name: "root", rel: "", wantErr: true},
+		{name: "reserved file", rel: "session.json", wantErr: true},
+		{name: "reserved file through a parent link", rel: "src/up/session.json", wantErr: true},
+		{name: "symlink to reserved file", rel: "status", wantErr: true},
+		{name: "symlink inside workspace", rel: "link.py", wantErr: true},
+		{name: "symlink out of the workspace", rel: "secret", wantErr: true},
+		{name: "directory symlink out of the workspace", rel: "escape/secret.txt", wantErr: true},
+		{name: "dangling symlink out of the workspace", rel: "dangling", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root, outside := testWorkspace(t)
+			w := openTestWorkspace(t, root)
+
+			f, err := w.Create(tt.rel, os.Getuid(), os.Getgid())
+			if err == nil {
+				_, err = f.WriteString("uploaded")
+				f.Close()
+			}
+
+			if data, _ := os.ReadFile(filepath.Join(outside, "secret.txt")); string(data) != "secret" {
+				t.Errorf("the file outside the workspace was changed to %q", data)
+			}
+			if data, _ := os.ReadFile(filepath.Join(root, "session.json")); string(data) != "{}" {
+				t.Errorf("the bookkeeping file was changed to %q", data)
+			}
+			if data, _ := os.ReadFile(filepath.Join(root, "main.py")); tt.rel != "main.py" && string(data) != "print(1)" {
+				t.Errorf("the link target was changed to %q", data)
+			}
+			if _, err := os.Lstat(filepath.Join(outside, "missing.txt")); err == nil {
+				t.Error("a file was created outside the workspace")
+			}
+
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Create(%q) succeeded, want error", tt.rel)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Create(%q) failed: %v", tt.rel, err)
+			}
+			f, _, err = w.Open(tt.rel)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			if data, _ := io.ReadAll(f); string(data) != "uploaded" {
+				t.Errorf("Create(%q) wrote %q", tt.rel, data)
+			}
+		})
+	}
+}
+
+func TestWorkspaceRootCreateDirectoryPermissions(t *testing.T) {
+	root, _ := testWorkspace(t)
+	w := openTestWorkspace(t, root)
+
+	f, err := w.Create("a/b/c.txt", os.Getuid(), os.Getgid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	// The container's user must be able to write into new directories
+	for _, dir := range []string{"a", "a/b"} {
+		info, err := os.Stat(filepath.Join(root, dir))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if perm := info.Mode().Perm(); perm&0700 != 0700 {
+			t.Errorf("%s has permissions %v", dir, perm)
+		}
+	}
+}
+
+func TestWorkspaceRootRemove(t *testing.T) {
+	tests := []struct {
+		name    string
+		rel     string
+		gone    string // path that must no longer exist, relative to the workspace
+		wantErr error
+	}{
+		{name: "file", rel: "main.py", gone: "main.py"},
+		{name: "directory", rel: "src", gone: "src"},
+		{name: "symlink inside workspace", rel: "link.py", gone: "link.py"},
+		{name: "symlink out of the workspace", rel: "escape", gone: "escape"},
+		{name: "dangling symlink", rel: "dangling", gone: "dangling"},
+		{name: "link to reserved file", rel: "status", gone: "status"},
+		{name: "root", rel: "/", wantErr: errOutsideWorkspace},
+		{name: "reserved file", rel: "session.json", wantErr: errOutsideWorkspace},
+		{name: "reserved file through a parent link", rel: "src/up/session.json", wantErr: errOutsideWorkspace},
+		{name: "through a link out of the workspace", rel: "escape/secret.txt"},
+		{name: "missing file", rel: "nope", wantErr: fs.ErrNotExist},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root, outside := testWorkspace(t)
+			w := openTestWorkspace(t, root)
+
+			err := w.Remove(tt.rel)
+
+			for _, keep := range []string{filepath.Join(outside, "secret.txt"), filepath.Join(root, "session.json")} {
+				if _, err := os.Stat(keep); err != nil {
+					t.Errorf("%s was removed", keep)
+				}
+			}
+			if tt.rel == "link.py" {
+				if _, err := os.Stat(filepath.Join(root, "main.py")); err != nil {
+					t.Error("removing the link removed its target")
+				}
+			}
+
+			if tt.gone == "" {
+				if err == nil {
+					t.Fatalf("Remove(%q) succeeded, want error", tt.rel)
+				}
+				if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Remove(%q) error = %v, want %v", tt.rel, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Remove(%q) failed: %v", tt.rel, err)
+			}
+			if _, err := os.Lstat(filepath.Join(root, tt.gone)); err == nil {
+				t.Errorf("%s still exists", tt.gone)
+			}
+		})
+	}
+}
+
+func TestWorkspaceRootUsage(t *testing.T) {
+	root, _ := testWorkspace(t)
+	w := openTestWorkspace(t, root)
+
+	// Links aren't followed, so the file outside doesn't count
+	used, err := w.Usage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := int64(len("{}") + len("print(1)") + len("x = 1")); used != want {
+		t.Errorf("Usage() = %d, want %d", used, want)
+	}
+}
+
+func TestZipWorkspaceDir(t *testing.T) {
+	root, _ := testWorkspace(t)
+	w := openTestWorkspace(t, root)
+
+	var buf bytes.Buffer
+	if err := zipWorkspaceDir(&buf, w, "."); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+	}
+	sort.Strings(names)
+	if got := strings.Join(names, " "); got != "main.py src/util.py" {
+		t.Errorf("archive holds %s, want main.py src/util.py", got)
+	}
+}
+
+func TestCopyProblemFilesSkipsLinks(t *testing.T) {
+	root, _ := testWorkspace(t)
+	dst := t.TempDir()
+
+	if err := copyProblemFiles(root, dst); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"secret", "escape", "link.py", "src/up"} {
+		if _, err := os.Lstat(filepath.Join(dst, name)); err == nil {
+			t.Errorf("the link %s was copied", name)
+		}
+	}
+	if data, err := os.ReadFile(filepath.Join(dst, "src", "util.py")); err != nil || string(data) != "x = 1" {
+		t.Errorf("src/util.py = %q, %v", data, err)
+	}
+}
+
+func mustWrite(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func mustSymlink(t *testing.T, target, link string) {
+	t.Helper()
+	if err := os.Symlink(target, link); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -1,12 +1,16 @@
 package middleware
 
 import (
+	"context"
 	"log"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/globallstudent/academy/internal/auth"
 	"github.com/globallstudent/academy/internal/models"
+	"github.com/globallstudent/academy/internal/ratelimit"
+	"github.com/globallstudent/academy/internal/rbac"
 	"github.com/google/uuid"
 )
 
@@ -83,13 +87,81 @@ func Auth() gin.HandlerFunc {
 	}
 }
 
-// AdminOnly returns a middleware that checks if the user is an admin
-func AdminOnly() gin.HandlerFunc {
+// RequirePermission returns a middleware that allows only users whose role
+// has at least one of the permissions
+func RequirePermission(permissions ...rbac.Permission) gin.HandlerFunc {
+	names := make([]string, len(permissions))
+	for i, permission := range permissions {
+		names[i] = string(permission)
+	}
+	required := "the " + strings.Join(names, " or ") + " permission"
+
+	return func(c *gin.Context) {
+		role, _ := c.Get("role")
+		roleName, _ := role.(string)
+		for _, permission := range permissions {
+			if rbac.Can(roleName, permission) {
+				c.Next()
+				return
+			}
+		}
+		c.AbortWithStatusJSON(403, gin.H{
+			"error": "Forbidden: requires " + required,
+		})
+	}
+}
+
+// CurrentRole returns a middleware that replaces the role from the session
+// token with the user's current one, so a role change applies at once
+// instead of when the token expires. It must run after Auth.
+func CurrentRole(lookup func(ctx context.Context, userID uuid.UUID) (string, bool, error)) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		role, exists := c.Get("role")
-		if !exists || role != "admin" {
-			c.AbortWithStatusJSON(403, gin.H{
-				"error": "Forbidden: Admin access required",
+		user, _ := c.Get("user")
+		current, ok := user.(models.User)
+		if !ok {
+			c.AbortWithStatusJSON(401, gin.H{
+				"error": "Unauthorized",
+			})
+			return
+		}
+
+		role, found, err := lookup(c.Request.Context(), current.ID)
+		if err != nil {
+			log.Printf("Failed to look up the role of %s: %v", current.ID, err)
+			c.AbortWithStatusJSON(500, gin.H{
+				"error": "Failed to check permissions",
+			})
+			return
+		}
+		if !found {
+			c.AbortWithStatusJSON(401, gin.H{
+				"error": "Unauthorized",
+			})
+			return
+		}
+
+		current.Role = role
+		c.Set("role", role)
+		c.Set("user", current)
+		c.Next()
+	}
+}
+
+// RateLimit returns a middleware that allows each client address at most
+// rule's number of requests within its window. If the limiter fails, requests
+// are let through.
+func RateLimit(limiter ratelimit.Limiter, rule ratelimit.Rule) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		res, err := limiter.Hit(c.Request.Context(), rule, c.ClientIP())
+		if err != nil {
+			log.Printf("Error applying %s rate limit: %v", rule.Name, err)
+			c.Next()
+			return
+		}
+		if !res.Allowed {
+			c.Header("Retry-After", res.RetryAfterSeconds())
+			c.AbortWithStatusJSON(429, gin.H{
+				"error": "Too many requests, please slow down",
 			})
 			return
 		}
@@ -0,0 +1,142 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/globallstudent/academy/internal/auth"
+	"github.com/globallstudent/academy/internal/models"
+	"github.com/globallstudent/academy/internal/rbac"
+	"github.com/google/uuid"
+)
+
+func TestRequirePermission(t *testing.T) {
+	tests := []struct {
+		name        string
+		role        string
+		permissions []rbac.Permission
+		wantStatus  int
+	}{
+		{name: "admin", role: rbac.RoleAdmin, permissions: []rbac.Permission{rbac.ManageUsers}, wantStatus: http.StatusOK},
+		{name: "judge without the permission", role: rbac.RoleJudge, permissions: []rbac.Permission{rbac.ManageUsers}, wantStatus: http.StatusForbidden},
+		{name: "judge with one of the permissions", role: rbac.RoleJudge, permissions: []rbac.Permission{rbac.ManageProblems, rbac.Rejudge}, wantStatus: http.StatusOK},
+		{name: "student", role: rbac.RoleUser, permissions: []rbac.Permission{rbac.WatchTerminals}, wantStatus: http.StatusForbidden},
+		{name: "no role", permissions: []rbac.Permission{rbac.Rejudge}, wantStatus: http.StatusForbidden},
+	}
+
+	gin.SetMode(gin.TestMode)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			r.Use(func(c *gin.Context) {
+				if tt.role != "" {
+					c.Set("role", tt.role)
+				}
+			})
+			r.GET("/", RequirePermission(tt.permissions...), func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestCurrentRole(t *testing.T) {
+	userID := uuid.New()
+
+	tests := []struct {
+		name       string
+		tokenRole  string
+		lookup     func(ctx context.Context, id uuid.UUID) (string, bool, error)
+		wantStatus int
+		wantRole   string
+	}{
+		{
+			name:       "role unchanged",
+			tokenRole:  rbac.RoleAdmin,
+			lookup:     func(context.Context, uuid.UUID) (string, bool, error) { return rbac.RoleAdmin, true, nil },
+			wantStatus: http.StatusOK,
+			wantRole:   rbac.RoleAdmin,
+		},
+		{
+			name:       "demoted since logging in",
+			tokenRole:  rbac.RoleAdmin,
+			lookup:     func(context.Context, uuid.UUID) (string, bool, error) { return rbac.RoleUser, true, nil },
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "promoted since logging in",
+			tokenRole:  rbac.RoleUser,
+			lookup:     func(context.Context, uuid.UUID) (string, bool, error) { return rbac.RoleJudge, true, nil },
+			wantStatus: http.StatusOK,
+			wantRole:   rbac.RoleJudge,
+		},
+		{
+			name:       "account deleted",
+			tokenRole:  rbac.RoleAdmin,
+			lookup:     func(context.Context, uuid.UUID) (string, bool, error) { return "", false, nil },
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "lookup fails",
+			tokenRole:  rbac.RoleAdmin,
+			lookup:     func(context.Context, uuid.UUID) (string, bool, error) { return "", false, errors.New("database down") },
+			wantStatus: http.StatusInternalServerError,
+		},
+	}
+
+	gin.SetMode(gin.TestMode)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := auth.GenerateToken(userID, "ada", tt.tokenRole)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var gotRole string
+			r := gin.New()
+			r.Use(Auth(), CurrentRole(tt.lookup))
+			r.GET("/", RequirePermission(rbac.Rejudge), func(c *gin.Context) {
+				user := c.MustGet("user").(models.User)
+				gotRole = user.Role
+				c.Status(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.AddCookie(&http.Cookie{Name: cookieName, Value: token})
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if gotRole != tt.wantRole {
+				t.Errorf("handler saw role %q, want %q", gotRole, tt.wantRole)
+			}
+		})
+	}
+}
+
+func TestCurrentRoleWithoutAuth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/", CurrentRole(func(context.Context, uuid.UUID) (string, bool, error) {
+		t.Error("looked up a role without a user")
+		return "", false, nil
+	}))
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
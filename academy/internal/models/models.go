@@ -11,6 +11,7 @@ type User struct {
 	ID           uuid.UUID `json:"id"`
 	PhoneNumber  string    `json:"phone_number"`
 	TelegramID   string    `json:"telegram_id"`
+	Email        string    `json:"email"`
 	Username     string    `json:"username"`
 	RegisteredAt time.Time `json:"registered_at"`
 	Role         string    `json:"role"` // user, admin, judge
@@ -30,14 +31,33 @@ type Problem struct {
 
 // Submission represents a user's submission for a problem
 type Submission struct {
-	ID          uuid.UUID `json:"id"`
-	UserID      uuid.UUID `json:"user_id"`
-	ProblemID   uuid.UUID `json:"problem_id"`
-	Language    string    `json:"language"`
-	Status      string    `json:"status"` // pending, passed, failed, error
-	Output      string    `json:"output"`
-	Score       int       `json:"score"`
-	SubmittedAt time.Time `json:"submitted_at"`
+	ID          uuid.UUID      `json:"id"`
+	UserID      uuid.UUID      `json:"user_id"`
+	ProblemID   uuid.UUID      `json:"problem_id"`
+	Language    string         `json:"language"`
+	Status      string         `json:"status"` // pending, passed, failed, error
+	Output      string         `json:"output"`
+	Score       int            `json:"score"`
+	Sections    []SectionScore `json:"sections,omitempty"` // Per-section breakdown, for problems graded by a rubric or by subtasks
+	Code        string         `json:"-"`                  // Source the submission was graded from, kept for rejudging; empty for terminal checks
+	SubmittedAt time.Time      `json:"submitted_at"`
+}
+
+// SectionScore is the score a submission earned on one section of a problem
+type SectionScore struct {
+	Name     string        `json:"name"`
+	Score    int           `json:"score"`
+	MaxScore int           `json:"max_score"`
+	Checks   []CheckResult `json:"checks,omitempty"`
+}
+
+// CheckResult is the outcome of a single rubric check
+type CheckResult struct {
+	ID          string `json:"id"`
+	Description string `json:"description"`
+	Points      int    `json:"points"`
+	Passed      bool   `json:"passed"`
+	Message     string `json:"message,omitempty"` // Why the check failed
 }
 
 // LeaderboardEntry represents a row in the leaderboard
@@ -53,4 +73,5 @@ type Testcase struct {
 	Input          string `json:"input"`
 	ExpectedOutput string `json:"expected_output"`
 	IsHidden       bool   `json:"is_hidden"`
+	Subtask        string `json:"subtask,omitempty"` // Subtask the case is scored with, if the problem has subtasks
 }
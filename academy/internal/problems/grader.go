@@ -0,0 +1,121 @@
+package problems
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// defaultStepTimeout bounds each grader command when the problem doesn't set a timeout
+const defaultStepTimeout = 10 * time.Second
+
+// Grader grades a build problem by running scenarios of shell commands against
+// a copy of the student's workspace in a fresh container. Each scenario starts
+// with an empty home directory and earns its points only if every step passes.
+type Grader struct {
+	Build     string     `json:"build"`   // Command run once from the workspace before the scenarios, e.g. to compile
+	Timeout   int        `json:"timeout"` // Seconds each command may run for
+	Scenarios []Scenario `json:"scenarios"`
+}
+
+// Scenario is a sequence of commands graded together
+type Scenario struct {
+	Name   string `json:"name"`
+	Points int    `json:"points"`
+	Steps  []Step `json:"steps"`
+}
+
+// Step is one command of a scenario and what it should do
+type Step struct {
+	Run            string      `json:"run"`                       // Shell command, run from the scenario's home directory
+	ExitCode       *int        `json:"exit_code,omitempty"`       // Expected exit status; 0 if not given
+	Fails          bool        `json:"fails,omitempty"`           // Expect any non-zero exit status instead
+	Stdout         *string     `json:"stdout,omitempty"`          // Exact output, ignoring trailing whitespace
+	StdoutContains []string    `json:"stdout_contains,omitempty"` // Text the output must contain
+	Files          []FileCheck `json:"files,omitempty"`           // Files to inspect after the command
+}
+
+// FileCheck describes a file a step should leave behind
+type FileCheck struct {
+	Path     string   `json:"path"`               // Relative to the scenario's home directory
+	Missing  bool     `json:"missing,omitempty"`  // The file must not exist
+	Contains []string `json:"contains,omitempty"` // Text the file must contain
+}
+
+// StepTimeout returns how long each command may run for
+func (g *Grader) StepTimeout() time.Duration {
+	if g.Timeout <= 0 {
+		return defaultStepTimeout
+	}
+	return time.Duration(g.Timeout) * time.Second
+}
+
+// MaxScore returns the points available across all scenarios
+func (g *Grader) MaxScore() int {
+	total := 0
+	for _, scenario := range g.Scenarios {
+		total += scenario.Points
+	}
+	return total
+}
+
+// Check compares a command's result with what the step expects, returning
+// why it failed, or "" if it passed
+func (s Step) Check(exitCode int, stdout string) string {
+	switch {
+	case s.Fails && exitCode == 0:
+		return "exited successfully, expected an error status"
+	case !s.Fails && s.ExitCode != nil && exitCode != *s.ExitCode:
+		return fmt.Sprintf("exited with status %d, expected %d", exitCode, *s.ExitCode)
+	case !s.Fails && s.ExitCode == nil && exitCode != 0:
+		return fmt.Sprintf("exited with status %d", exitCode)
+	}
+
+	if s.Stdout != nil && normalizeOutput(stdout) != normalizeOutput(*s.Stdout) {
+		return fmt.Sprintf("printed %q, expected %q", truncate(normalizeOutput(stdout)), truncate(normalizeOutput(*s.Stdout)))
+	}
+	for _, want := range s.StdoutContains {
+		if !strings.Contains(stdout, want) {
+			return fmt.Sprintf("output doesn't contain %q", want)
+		}
+	}
+	return ""
+}
+
+// Check compares a file's state with what's expected, returning why it
+// failed, or "" if it passed
+func (f FileCheck) Check(exists bool, content string) string {
+	if f.Missing {
+		if exists {
+			return fmt.Sprintf("%s should not exist", f.Path)
+		}
+		return ""
+	}
+	if !exists {
+		return fmt.Sprintf("%s doesn't exist", f.Path)
+	}
+	for _, want := range f.Contains {
+		if !strings.Contains(content, want) {
+			return fmt.Sprintf("%s doesn't contain %q", f.Path, want)
+		}
+	}
+	return ""
+}
+
+// normalizeOutput drops trailing whitespace from every line and trailing blank lines
+func normalizeOutput(s string) string {
+	lines := strings.Split(strings.ReplaceAll(s, "\r\n", "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t")
+	}
+	return strings.TrimRight(strings.Join(lines, "\n"), "\n")
+}
+
+// truncate shortens long output for failure messages
+func truncate(s string) string {
+	const max = 200
+	if len(s) <= max {
+		return s
+	}
+	return s[:max] + "..."
+}
@@ -0,0 +1,155 @@
+package problems
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func intPtr(v int) *int { return &v }
+
+func strPtr(v string) *string { return &v }
+
+func TestParseGrader(t *testing.T) {
+	spec := `{
+		"build": "make",
+		"timeout": 5,
+		"scenarios": [
+			{"name": "add", "points": 30, "steps": [
+				{"run": "todo add milk", "stdout": "Added 1"},
+				{"run": "todo list", "stdout_contains": ["milk"], "files": [{"path": ".todo.json", "contains": ["milk"]}]}
+			]},
+			{"name": "errors", "points": 20, "steps": [
+				{"run": "todo done 9", "fails": true},
+				{"run": "todo help", "exit_code": 2, "files": [{"path": "junk", "missing": true}]}
+			]}
+		]
+	}`
+
+	var g Grader
+	if err := json.Unmarshal([]byte(spec), &g); err != nil {
+		t.Fatal(err)
+	}
+
+	if g.Build != "make" || len(g.Scenarios) != 2 {
+		t.Fatalf("parsed %+v", g)
+	}
+	if g.MaxScore() != 50 {
+		t.Errorf("MaxScore() = %d, want 50", g.MaxScore())
+	}
+	if g.StepTimeout() != 5*time.Second {
+		t.Errorf("StepTimeout() = %s, want 5s", g.StepTimeout())
+	}
+
+	add := g.Scenarios[0].Steps
+	if add[0].Stdout == nil || *add[0].Stdout != "Added 1" || add[0].ExitCode != nil {
+		t.Errorf("first step = %+v", add[0])
+	}
+	if len(add[1].Files) != 1 || add[1].Files[0].Path != ".todo.json" {
+		t.Errorf("second step files = %+v", add[1].Files)
+	}
+
+	errs := g.Scenarios[1].Steps
+	if !errs[0].Fails {
+		t.Errorf("fails not parsed: %+v", errs[0])
+	}
+	if errs[1].ExitCode == nil || *errs[1].ExitCode != 2 || !errs[1].Files[0].Missing {
+		t.Errorf("exit code and missing file not parsed: %+v", errs[1])
+	}
+}
+
+func TestGraderDefaultTimeout(t *testing.T) {
+	for _, timeout := range []int{0, -3} {
+		g := Grader{Timeout: timeout}
+		if g.StepTimeout() != defaultStepTimeout {
+			t.Errorf("StepTimeout() with timeout %d = %s, want %s", timeout, g.StepTimeout(), defaultStepTimeout)
+		}
+	}
+}
+
+func TestStepCheck(t *testing.T) {
+	tests := []struct {
+		name     string
+		step     Step
+		exitCode int
+		stdout   string
+		wantPass bool
+	}{
+		{name: "success by default", step: Step{}, exitCode: 0, wantPass: true},
+		{name: "non-zero status fails by default", step: Step{}, exitCode: 1},
+		{name: "expected status", step: Step{ExitCode: intPtr(2)}, exitCode: 2, wantPass: true},
+		{name: "wrong status", step: Step{ExitCode: intPtr(2)}, exitCode: 1},
+		{name: "expected failure", step: Step{Fails: true}, exitCode: 3, wantPass: true},
+		{name: "unexpected success", step: Step{Fails: true}, exitCode: 0},
+		{name: "exact output", step: Step{Stdout: strPtr("1. milk\n2. eggs")}, stdout: "1. milk  \r\n2. eggs\n\n", wantPass: true},
+		{name: "wrong output", step: Step{Stdout: strPtr("1. milk")}, stdout: "1. eggs\n"},
+		{name: "empty output expected", step: Step{Stdout: strPtr("")}, stdout: "\n", wantPass: true},
+		{name: "contains all", step: Step{StdoutContains: []string{"milk", "eggs"}}, stdout: "milk and eggs", wantPass: true},
+		{name: "missing text", step: Step{StdoutContains: []string{"milk", "bread"}}, stdout: "milk and eggs"},
+		{name: "status is checked before output", step: Step{Stdout: strPtr("ok")}, exitCode: 1, stdout: "ok"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reason := tt.step.Check(tt.exitCode, tt.stdout)
+			if (reason == "") != tt.wantPass {
+				t.Errorf("Check(%d, %q) = %q, want pass %v", tt.exitCode, tt.stdout, reason, tt.wantPass)
+			}
+		})
+	}
+}
+
+func TestFileCheck(t *testing.T) {
+	tests := []struct {
+		name     string
+		check    FileCheck
+		exists   bool
+		content  string
+		wantPass bool
+	}{
+		{name: "exists", check: FileCheck{Path: "a"}, exists: true, wantPass: true},
+		{name: "doesn't exist", check: FileCheck{Path: "a"}},
+		{name: "missing as expected", check: FileCheck{Path: "a", Missing: true}, wantPass: true},
+		{name: "should be missing", check: FileCheck{Path: "a", Missing: true}, exists: true},
+		{name: "contains", check: FileCheck{Path: "a", Contains: []string{"milk"}}, exists: true, content: "[\"milk\"]", wantPass: true},
+		{name: "doesn't contain", check: FileCheck{Path: "a", Contains: []string{"milk"}}, exists: true, content: "[]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reason := tt.check.Check(tt.exists, tt.content)
+			if (reason == "") != tt.wantPass {
+				t.Errorf("Check(%v, %q) = %q, want pass %v", tt.exists, tt.content, reason, tt.wantPass)
+			}
+		})
+	}
+}
+
+func TestOutputMatches(t *testing.T) {
+	tests := []struct {
+		actual, expected string
+		want             bool
+	}{
+		{"3\n", "3", true},
+		{"a \nb\t\n\n", "a\nb", true},
+		{"a\r\nb\r\n", "a\nb", true},
+		{" a", "a", false},
+		{"a\n\nb", "a\nb", false},
+	}
+
+	for _, tt := range tests {
+		if got := OutputMatches(tt.actual, tt.expected); got != tt.want {
+			t.Errorf("OutputMatches(%q, %q) = %v, want %v", tt.actual, tt.expected, got, tt.want)
+		}
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	long := string(make([]byte, 250))
+	if got := truncate(long); len(got) != 203 {
+		t.Errorf("truncate of 250 bytes has length %d, want 203", len(got))
+	}
+	if got := truncate("short"); got != "short" {
+		t.Errorf("truncate(%q) = %q", "short", got)
+	}
+}
@@ -0,0 +1,102 @@
+package problems
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/globallstudent/academy/internal/models"
+)
+
+// Harness lets students submit just a function for a language. The driver is
+// a complete program that reads a test case from stdin, calls the student's
+// function and prints the result; the student's code is placed next to it.
+type Harness struct {
+	Driver  string `json:"driver"`  // Path relative to the day directory, outside the env directory
+	Starter string `json:"starter"` // Code the editor starts with, relative to the day directory
+}
+
+// Content returns the problem's markdown description. It is read from the day
+// directory, by the file name in FilePath.
+func (p *Problem) Content() (string, error) {
+	data, err := os.ReadFile(p.path(filepath.Base(p.FilePath)))
+	if err != nil {
+		return "", fmt.Errorf("failed to read problem description: %w", err)
+	}
+	return string(data), nil
+}
+
+// LoadTestcases reads the problem's test cases, leaving out hidden ones unless includeHidden is set
+func (p *Problem) LoadTestcases(includeHidden bool) ([]models.Testcase, error) {
+	if p.Testcases == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(p.path(p.Testcases))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read test cases: %w", err)
+	}
+
+	var all []models.Testcase
+	if err := json.Unmarshal(data, &all); err != nil {
+		return nil, fmt.Errorf("failed to parse test cases: %w", err)
+	}
+
+	testcases := make([]models.Testcase, 0, len(all))
+	for _, testcase := range all {
+		if includeHidden || !testcase.IsHidden {
+			testcases = append(testcases, testcase)
+		}
+	}
+	return testcases, nil
+}
+
+// HarnessLanguages returns the languages the problem has a driver for, sorted
+func (p *Problem) HarnessLanguages() []string {
+	languages := make([]string, 0, len(p.Harness))
+	for language := range p.Harness {
+		languages = append(languages, language)
+	}
+	sort.Strings(languages)
+	return languages
+}
+
+// ReadDriver returns the driver program for a language, and false if the
+// language has no harness and submissions are complete programs
+func (p *Problem) ReadDriver(language string) (string, bool, error) {
+	harness, ok := p.Harness[language]
+	if !ok || harness.Driver == "" {
+		return "", false, nil
+	}
+
+	data, err := os.ReadFile(p.path(harness.Driver))
+	if err != nil {
+		return "", true, fmt.Errorf("failed to read %s driver: %w", language, err)
+	}
+	return string(data), true, nil
+}
+
+// StarterCode returns the code the editor starts with for each language
+func (p *Problem) StarterCode() map[string]string {
+	starters := make(map[string]string, len(p.Harness))
+	for language, harness := range p.Harness {
+		if harness.Starter == "" {
+			continue
+		}
+		data, err := os.ReadFile(p.path(harness.Starter))
+		if err != nil {
+			continue
+		}
+		starters[language] = strings.TrimLeft(string(data), "\n")
+	}
+	return starters
+}
+
+// OutputMatches compares a program's output with the expected output,
+// ignoring trailing whitespace
+func OutputMatches(actual, expected string) bool {
+	return normalizeOutput(actual) == normalizeOutput(expected)
+}
@@ -0,0 +1,200 @@
+package problems
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Day is a day of problems, as described by a dayN/metadata.json file
+type Day struct {
+	Day         int       `json:"day"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	UnlockDate  time.Time `json:"unlock_date"`
+	Problems    []Problem `json:"problems"`
+	Dir         string    `json:"-"` // Directory the metadata was loaded from
+}
+
+// Problem is a single problem of a day
+type Problem struct {
+	ID        uuid.UUID          `json:"id"`
+	Type      string             `json:"type"` // dsa, linux, build
+	Title     string             `json:"title"`
+	Slug      string             `json:"slug"`
+	FilePath  string             `json:"file_path"`
+	Score     int                `json:"score"`
+	Env       string             `json:"env,omitempty"`       // Fixture directory copied into the workspace, relative to the day directory
+	Setup     string             `json:"setup,omitempty"`     // Script run inside the session container before the student connects
+	Testcases string             `json:"testcases,omitempty"` // JSON file of test cases, relative to the day directory
+	Harness   map[string]Harness `json:"harness,omitempty"`   // Function-signature drivers, by language
+	Subtasks  []Subtask          `json:"subtasks,omitempty"`  // Groups of test cases scored all-or-nothing
+	Verifier  *Verifier          `json:"verifier,omitempty"`
+	Grader    *Grader            `json:"grader,omitempty"`
+	Day       int                `json:"-"`
+	Dir       string             `json:"-"` // The day directory
+}
+
+// Catalog holds every problem found in the problems directory
+type Catalog struct {
+	days   []Day
+	bySlug map[string]*Problem
+	byID   map[uuid.UUID]*Problem
+}
+
+// Load reads the metadata.json of every day directory under dir
+func Load(dir string) (*Catalog, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read problems directory: %w", err)
+	}
+
+	c := &Catalog{bySlug: make(map[string]*Problem), byID: make(map[uuid.UUID]*Problem)}
+	for _, entry := range entries {
+		if !entry.IsDir() || !strings.HasPrefix(entry.Name(), "day") {
+			continue
+		}
+
+		dayDir := filepath.Join(dir, entry.Name())
+		day, err := loadDay(dayDir)
+		if err != nil {
+			return nil, err
+		}
+		c.days = append(c.days, *day)
+	}
+
+	sort.Slice(c.days, func(i, j int) bool { return c.days[i].Day < c.days[j].Day })
+	for i := range c.days {
+		for j := range c.days[i].Problems {
+			p := &c.days[i].Problems[j]
+			if _, exists := c.bySlug[p.Slug]; exists {
+				return nil, fmt.Errorf("problem slug %q is used more than once", p.Slug)
+			}
+			c.bySlug[p.Slug] = p
+			c.byID[p.ID] = p
+		}
+	}
+	return c, nil
+}
+
+// loadDay reads a day directory's metadata.json
+func loadDay(dir string) (*Day, error) {
+	data, err := os.ReadFile(filepath.Join(dir, "metadata.json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read metadata for %s: %w", dir, err)
+	}
+
+	var day Day
+	if err := json.Unmarshal(data, &day); err != nil {
+		return nil, fmt.Errorf("failed to parse metadata for %s: %w", dir, err)
+	}
+	day.Dir = dir
+
+	for i := range day.Problems {
+		p := &day.Problems[i]
+		p.Day = day.Day
+		p.Dir = dir
+		if err := p.checkPrivateFiles(); err != nil {
+			return nil, fmt.Errorf("problem %s: %w", p.Slug, err)
+		}
+		if err := p.checkSubtasks(); err != nil {
+			return nil, fmt.Errorf("problem %s: %w", p.Slug, err)
+		}
+		if len(p.Subtasks) > 0 {
+			if total := p.SubtaskScore(); total != p.Score {
+				log.Printf("Subtasks for %s add up to %d points, but the problem is worth %d", p.Slug, total, p.Score)
+			}
+		}
+		if p.Verifier != nil {
+			if total := p.Verifier.MaxScore(); total != p.Score {
+				log.Printf("Verifier checks for %s add up to %d points, but the problem is worth %d", p.Slug, total, p.Score)
+			}
+		}
+		if p.Grader != nil {
+			if total := p.Grader.MaxScore(); total != p.Score {
+				log.Printf("Grader scenarios for %s add up to %d points, but the problem is worth %d", p.Slug, total, p.Score)
+			}
+		}
+	}
+	return &day, nil
+}
+
+// checkPrivateFiles makes sure the fixture directory doesn't hand the student
+// anything they shouldn't see: the metadata, test cases, drivers or scripts
+func (p *Problem) checkPrivateFiles() error {
+	if p.Env == "" {
+		return nil
+	}
+
+	env := filepath.Clean("/" + p.Env)
+	if env == "/" {
+		return fmt.Errorf("env must be a subdirectory of the day directory")
+	}
+
+	private := []string{p.Setup, p.Testcases}
+	for _, harness := range p.Harness {
+		private = append(private, harness.Driver)
+	}
+	if p.Verifier != nil {
+		private = append(private, p.Verifier.Script)
+	}
+	for _, path := range private {
+		if path == "" {
+			continue
+		}
+		if rel, err := filepath.Rel(env, filepath.Clean("/"+path)); err == nil && !strings.HasPrefix(rel, "..") {
+			return fmt.Errorf("%s is inside the env directory and would be copied into the workspace", path)
+		}
+	}
+	return nil
+}
+
+// EnvDir returns the fixture directory to copy into the workspace, or "" if the problem has none
+func (p *Problem) EnvDir() string {
+	if p.Env == "" {
+		return ""
+	}
+	return p.path(p.Env)
+}
+
+// ReadSetup returns the contents of the problem's setup script, or "" if it has none
+func (p *Problem) ReadSetup() (string, error) {
+	if p.Setup == "" {
+		return "", nil
+	}
+
+	data, err := os.ReadFile(p.path(p.Setup))
+	if err != nil {
+		return "", fmt.Errorf("failed to read setup script: %w", err)
+	}
+	return string(data), nil
+}
+
+// path resolves a path from the metadata, keeping it inside the day directory
+func (p *Problem) path(rel string) string {
+	return filepath.Join(p.Dir, filepath.Clean("/"+rel))
+}
+
+// Problem looks up a problem by its slug
+func (c *Catalog) Problem(slug string) (*Problem, bool) {
+	p, ok := c.bySlug[slug]
+	return p, ok
+}
+
+// ProblemByID looks up a problem by its ID, as stored with submissions
+func (c *Catalog) ProblemByID(id uuid.UUID) (*Problem, bool) {
+	p, ok := c.byID[id]
+	return p, ok
+}
+
+// Days returns every day, in order
+func (c *Catalog) Days() []Day {
+	return c.days
+}
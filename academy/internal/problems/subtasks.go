@@ -0,0 +1,53 @@
+package problems
+
+import "fmt"
+
+// Subtask groups test cases that are scored together. A subtask earns its
+// points only if every test case in it passes, so a hard case can be worth
+// more than many easy ones.
+type Subtask struct {
+	Name   string `json:"name"`
+	Points int    `json:"points"`
+}
+
+// SubtaskScore returns the points available across all subtasks
+func (p *Problem) SubtaskScore() int {
+	total := 0
+	for _, subtask := range p.Subtasks {
+		total += subtask.Points
+	}
+	return total
+}
+
+// checkSubtasks makes sure every test case belongs to a listed subtask and
+// every subtask has test cases, so no points are silently unreachable
+func (p *Problem) checkSubtasks() error {
+	if len(p.Subtasks) == 0 {
+		return nil
+	}
+
+	testcases, err := p.LoadTestcases(true)
+	if err != nil {
+		return err
+	}
+
+	counts := make(map[string]int, len(p.Subtasks))
+	for _, subtask := range p.Subtasks {
+		if _, exists := counts[subtask.Name]; exists {
+			return fmt.Errorf("subtask %q is listed more than once", subtask.Name)
+		}
+		counts[subtask.Name] = 0
+	}
+	for i, testcase := range testcases {
+		if _, ok := counts[testcase.Subtask]; !ok {
+			return fmt.Errorf("test case %d belongs to unknown subtask %q", i+1, testcase.Subtask)
+		}
+		counts[testcase.Subtask]++
+	}
+	for _, subtask := range p.Subtasks {
+		if counts[subtask.Name] == 0 {
+			return fmt.Errorf("subtask %q has no test cases", subtask.Name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package problems
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckSubtasks(t *testing.T) {
+	tests := []struct {
+		name      string
+		subtasks  []Subtask
+		testcases string
+		wantErr   string
+	}{
+		{
+			name:      "no subtasks",
+			testcases: `[{"input": "1", "expected_output": "1"}]`,
+		},
+		{
+			name:     "every case in a listed subtask",
+			subtasks: []Subtask{{Name: "small", Points: 40}, {Name: "large", Points: 60}},
+			testcases: `[
+				{"input": "1", "expected_output": "1", "subtask": "small"},
+				{"input": "2", "expected_output": "2", "subtask": "small"},
+				{"input": "3", "expected_output": "3", "is_hidden": true, "subtask": "large"}
+			]`,
+		},
+		{
+			name:      "hidden cases are checked too",
+			subtasks:  []Subtask{{Name: "small", Points: 40}},
+			testcases: `[{"input": "1", "expected_output": "1", "subtask": "small"}, {"input": "2", "expected_output": "2", "is_hidden": true, "subtask": "large"}]`,
+			wantErr:   `test case 2 belongs to unknown subtask "large"`,
+		},
+		{
+			name:      "case without a subtask",
+			subtasks:  []Subtask{{Name: "small", Points: 40}},
+			testcases: `[{"input": "1", "expected_output": "1"}]`,
+			wantErr:   `test case 1 belongs to unknown subtask ""`,
+		},
+		{
+			name:      "empty subtask",
+			subtasks:  []Subtask{{Name: "small", Points: 40}, {Name: "large", Points: 60}},
+			testcases: `[{"input": "1", "expected_output": "1", "subtask": "small"}]`,
+			wantErr:   `subtask "large" has no test cases`,
+		},
+		{
+			name:      "duplicate subtask",
+			subtasks:  []Subtask{{Name: "small", Points: 40}, {Name: "small", Points: 60}},
+			testcases: `[{"input": "1", "expected_output": "1", "subtask": "small"}]`,
+			wantErr:   `subtask "small" is listed more than once`,
+		},
+		{
+			name:      "malformed test cases",
+			subtasks:  []Subtask{{Name: "small", Points: 40}},
+			testcases: `{`,
+			wantErr:   "failed to parse test cases",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := os.WriteFile(filepath.Join(dir, "tests.json"), []byte(tt.testcases), 0644); err != nil {
+				t.Fatal(err)
+			}
+			p := &Problem{Dir: dir, Testcases: "tests.json", Subtasks: tt.subtasks}
+
+			err := p.checkSubtasks()
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("checkSubtasks() failed: %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Errorf("checkSubtasks() = %v, want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSubtaskScore(t *testing.T) {
+	p := &Problem{Subtasks: []Subtask{{Name: "a", Points: 10}, {Name: "b", Points: 25}, {Name: "c", Points: 65}}}
+	if got := p.SubtaskScore(); got != 100 {
+		t.Errorf("SubtaskScore() = %d, want 100", got)
+	}
+
+	if got := (&Problem{}).SubtaskScore(); got != 0 {
+		t.Errorf("SubtaskScore() without subtasks = %d, want 0", got)
+	}
+}
+
+func TestLoadDaySubtasks(t *testing.T) {
+	dir := t.TempDir()
+	metadata := `{
+		"day": 3,
+		"problems": [{
+			"slug": "sum",
+			"type": "dsa",
+			"score": 100,
+			"testcases": "tests/sum.json",
+			"subtasks": [{"name": "small", "points": 30}, {"name": "large", "points": 70}]
+		}]
+	}`
+	testcases := `[
+		{"input": "1 2", "expected_output": "3", "subtask": "small"},
+		{"input": "1000000000 1000000000", "expected_output": "2000000000", "is_hidden": true, "subtask": "large"}
+	]`
+	if err := os.MkdirAll(filepath.Join(dir, "tests"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "metadata.json"), []byte(metadata), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "tests", "sum.json"), []byte(testcases), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	day, err := loadDay(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := day.Problems[0]
+	if len(p.Subtasks) != 2 || p.Subtasks[1].Name != "large" || p.Subtasks[1].Points != 70 {
+		t.Errorf("subtasks = %+v", p.Subtasks)
+	}
+
+	visible, err := p.LoadTestcases(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(visible) != 1 || visible[0].Subtask != "small" {
+		t.Errorf("visible test cases = %+v", visible)
+	}
+}
@@ -0,0 +1,118 @@
+package problems
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/globallstudent/academy/internal/models"
+)
+
+// defaultVerifierTimeout bounds a verifier run when the rubric doesn't set a timeout
+const defaultVerifierTimeout = 30 * time.Second
+
+// Verifier grades a problem by running a script inside the student's session
+// container. The script prints one line per check, "PASS <id>" or
+// "FAIL <id> <reason>"; any other output is ignored.
+type Verifier struct {
+	Script  string  `json:"script"`  // Path relative to the day directory, outside the env directory
+	Timeout int     `json:"timeout"` // Seconds the script may run for
+	Checks  []Check `json:"checks"`
+}
+
+// Check is one graded item of a verifier's rubric
+type Check struct {
+	ID          string `json:"id"`
+	Section     string `json:"section"` // Challenge section the check counts towards
+	Description string `json:"description"`
+	Points      int    `json:"points"`
+}
+
+// ReadScript returns the contents of a problem's verifier script
+func (p *Problem) ReadScript() (string, error) {
+	if p.Verifier == nil {
+		return "", fmt.Errorf("problem %s has no verifier", p.Slug)
+	}
+
+	data, err := os.ReadFile(p.path(p.Verifier.Script))
+	if err != nil {
+		return "", fmt.Errorf("failed to read verifier script: %w", err)
+	}
+	return string(data), nil
+}
+
+// RunTimeout returns how long the verifier may run for
+func (v *Verifier) RunTimeout() time.Duration {
+	if v.Timeout <= 0 {
+		return defaultVerifierTimeout
+	}
+	return time.Duration(v.Timeout) * time.Second
+}
+
+// MaxScore returns the points available across all checks
+func (v *Verifier) MaxScore() int {
+	total := 0
+	for _, check := range v.Checks {
+		total += check.Points
+	}
+	return total
+}
+
+// Grade scores a verifier's output against the rubric, section by section, in
+// the order sections first appear in the rubric. Checks the script didn't
+// report on count as failed.
+func (v *Verifier) Grade(output string) []models.SectionScore {
+	type outcome struct {
+		passed  bool
+		message string
+	}
+	outcomes := make(map[string]outcome)
+
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		verdict, rest, _ := strings.Cut(strings.TrimSpace(scanner.Text()), " ")
+		id, message, _ := strings.Cut(strings.TrimSpace(rest), " ")
+		if id == "" {
+			continue
+		}
+		switch verdict {
+		case "PASS":
+			outcomes[id] = outcome{passed: true}
+		case "FAIL":
+			outcomes[id] = outcome{message: strings.TrimSpace(message)}
+		}
+	}
+
+	var sections []models.SectionScore
+	index := make(map[string]int)
+	for _, check := range v.Checks {
+		i, ok := index[check.Section]
+		if !ok {
+			i = len(sections)
+			index[check.Section] = i
+			sections = append(sections, models.SectionScore{Name: check.Section})
+		}
+
+		result := models.CheckResult{
+			ID:          check.ID,
+			Description: check.Description,
+			Points:      check.Points,
+		}
+		if o, reported := outcomes[check.ID]; !reported {
+			result.Message = "Not checked"
+		} else {
+			result.Passed = o.passed
+			result.Message = o.message
+		}
+
+		section := &sections[i]
+		section.MaxScore += check.Points
+		if result.Passed {
+			section.Score += check.Points
+		}
+		section.Checks = append(section.Checks, result)
+	}
+	return sections
+}
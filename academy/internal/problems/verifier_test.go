@@ -0,0 +1,97 @@
+package problems
+
+import (
+	"testing"
+	"time"
+)
+
+func TestVerifierGrade(t *testing.T) {
+	v := &Verifier{Checks: []Check{
+		{ID: "todo-exists", Section: "Files", Description: "todo.txt exists", Points: 10},
+		{ID: "todo-mode", Section: "Files", Description: "todo.txt has mode 600", Points: 10},
+		{ID: "notes-link", Section: "Links", Description: "notes links to documents/notes", Points: 20},
+		{ID: "report-copied", Section: "Files", Description: "report.txt copied to archive", Points: 5},
+	}}
+
+	type check struct {
+		passed  bool
+		message string
+	}
+	tests := []struct {
+		name   string
+		output string
+		scores map[string]int // section -> score
+		checks map[string]check
+	}{
+		{
+			name:   "everything passes",
+			output: "PASS todo-exists\nPASS todo-mode\nPASS notes-link\nPASS report-copied\n",
+			scores: map[string]int{"Files": 25, "Links": 20},
+			checks: map[string]check{"todo-mode": {passed: true}},
+		},
+		{
+			name:   "partial credit with reasons",
+			output: "PASS todo-exists\nFAIL todo-mode mode is 644, want 600\nPASS notes-link\n",
+			scores: map[string]int{"Files": 10, "Links": 20},
+			checks: map[string]check{
+				"todo-mode":     {message: "mode is 644, want 600"},
+				"report-copied": {message: "Not checked"},
+			},
+		},
+		{
+			name:   "noise and unknown checks are ignored",
+			output: "checking...\n  PASS notes-link  \nPASS rm-rf-root\nPASS\nWARN todo-exists\n",
+			scores: map[string]int{"Files": 0, "Links": 20},
+			checks: map[string]check{"todo-exists": {message: "Not checked"}},
+		},
+		{
+			name:   "the last verdict for a check wins",
+			output: "PASS todo-exists\nFAIL todo-exists deleted again\n",
+			scores: map[string]int{"Files": 0, "Links": 0},
+			checks: map[string]check{"todo-exists": {message: "deleted again"}},
+		},
+		{
+			name:   "no output",
+			scores: map[string]int{"Files": 0, "Links": 0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sections := v.Grade(tt.output)
+
+			// Sections keep the order they first appear in the rubric
+			if len(sections) != 2 || sections[0].Name != "Files" || sections[1].Name != "Links" {
+				t.Fatalf("sections = %+v", sections)
+			}
+			if sections[0].MaxScore != 25 || sections[1].MaxScore != 20 {
+				t.Errorf("max scores = %d, %d; want 25, 20", sections[0].MaxScore, sections[1].MaxScore)
+			}
+			for _, section := range sections {
+				if section.Score != tt.scores[section.Name] {
+					t.Errorf("section %s scored %d, want %d", section.Name, section.Score, tt.scores[section.Name])
+				}
+				for _, result := range section.Checks {
+					want, ok := tt.checks[result.ID]
+					if ok && (result.Passed != want.passed || result.Message != want.message) {
+						t.Errorf("check %s = %v %q, want %v %q", result.ID, result.Passed, result.Message, want.passed, want.message)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestVerifierLimits(t *testing.T) {
+	v := &Verifier{Checks: []Check{{Points: 10}, {Points: 15}}}
+	if v.MaxScore() != 25 {
+		t.Errorf("MaxScore() = %d, want 25", v.MaxScore())
+	}
+	if v.RunTimeout() != defaultVerifierTimeout {
+		t.Errorf("RunTimeout() = %s without a timeout, want %s", v.RunTimeout(), defaultVerifierTimeout)
+	}
+	v.Timeout = 5
+	if v.RunTimeout() != 5*time.Second {
+		t.Errorf("RunTimeout() = %s, want 5s", v.RunTimeout())
+	}
+}
@@ -0,0 +1,118 @@
+package ratelimit
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryLimiter keeps events in memory, for development without Redis.
+// Counters are per process and lost on restart.
+type MemoryLimiter struct {
+	mu     sync.Mutex
+	events map[string][]time.Time // Event times per rule and key, oldest first
+}
+
+// NewMemoryLimiter creates an in-memory limiter
+func NewMemoryLimiter() *MemoryLimiter {
+	return &MemoryLimiter{events: make(map[string][]time.Time)}
+}
+
+// memoryKey is where a rule's events for a key are kept
+func memoryKey(rule Rule, key string) string {
+	return rule.Name + ":" + key
+}
+
+// Check reports whether key is under rule's limit
+func (l *MemoryLimiter) Check(ctx context.Context, rule Rule, key string) (Result, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	events := l.prune(memoryKey(rule, key), rule.Window, now)
+	return resultFor(rule, events, now), nil
+}
+
+// Hit records an event for key if it is under rule's limit
+func (l *MemoryLimiter) Hit(ctx context.Context, rule Rule, key string) (Result, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	k := memoryKey(rule, key)
+	events := l.prune(k, rule.Window, now)
+	recorded := len(events) < rule.Limit
+	if recorded {
+		events = append(events, now)
+		l.events[k] = events
+	}
+	return hitResult(resultFor(rule, events, now), recorded), nil
+}
+
+// Reset forgets key's events for rule
+func (l *MemoryLimiter) Reset(ctx context.Context, rule Rule, key string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.events, memoryKey(rule, key))
+	return nil
+}
+
+// Lockouts lists the keys over the limit of one of rules
+func (l *MemoryLimiter) Lockouts(ctx context.Context, rules []Rule) ([]Lockout, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	var lockouts []Lockout
+	for _, rule := range rules {
+		prefix := memoryKey(rule, "")
+		for k := range l.events {
+			if !strings.HasPrefix(k, prefix) {
+				continue
+			}
+			events := l.prune(k, rule.Window, now)
+			res := resultFor(rule, events, now)
+			if !res.Allowed {
+				lockouts = append(lockouts, Lockout{
+					Rule:  rule.Name,
+					Key:   strings.TrimPrefix(k, prefix),
+					Count: res.Count,
+					Limit: rule.Limit,
+					Until: now.Add(res.RetryAfter),
+				})
+			}
+		}
+	}
+	sort.Slice(lockouts, func(i, j int) bool { return lockouts[i].Until.Before(lockouts[j].Until) })
+	return lockouts, nil
+}
+
+// prune drops the events for k that fell out of the window and returns the
+// rest. The caller must hold the lock.
+func (l *MemoryLimiter) prune(k string, window time.Duration, now time.Time) []time.Time {
+	events := l.events[k]
+	cutoff := now.Add(-window)
+	i := 0
+	for i < len(events) && !events[i].After(cutoff) {
+		i++
+	}
+	events = events[i:]
+	if len(events) == 0 {
+		delete(l.events, k)
+		return nil
+	}
+	l.events[k] = events
+	return events
+}
+
+// resultFor works out a Result from a window's events
+func resultFor(rule Rule, events []time.Time, now time.Time) Result {
+	oldest := now
+	if len(events) > 0 {
+		oldest = events[0]
+	}
+	return result(rule, len(events), oldest, now)
+}
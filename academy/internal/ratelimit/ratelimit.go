@@ -0,0 +1,121 @@
+// Package ratelimit counts events per subject, such as failed logins per
+// phone number, in sliding windows, and says when a subject is over its limit.
+package ratelimit
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/globallstudent/academy/internal/config"
+	"github.com/globallstudent/academy/internal/database"
+)
+
+// Rule limits how many events a subject may cause within a sliding window
+type Rule struct {
+	Name   string
+	Limit  int
+	Window time.Duration
+}
+
+// Result says where a subject stands against a rule
+type Result struct {
+	Allowed    bool
+	Count      int           // Events in the window
+	RetryAfter time.Duration // Until the subject is under the limit again, when not allowed
+}
+
+// RetryAfterSeconds is RetryAfter rounded up to whole seconds, for the
+// Retry-After header
+func (r Result) RetryAfterSeconds() string {
+	return strconv.Itoa(int((r.RetryAfter + time.Second - 1) / time.Second))
+}
+
+// Lockout is a subject that is currently over a rule's limit
+type Lockout struct {
+	Rule  string    `json:"rule"`
+	Key   string    `json:"key"`
+	Count int       `json:"count"`
+	Limit int       `json:"limit"`
+	Until time.Time `json:"until"`
+}
+
+// Limiter counts events in sliding windows
+type Limiter interface {
+	// Check reports whether key is under rule's limit, without recording anything
+	Check(ctx context.Context, rule Rule, key string) (Result, error)
+	// Hit records an event for key if it is under rule's limit, and reports
+	// whether it was. Events over the limit are not recorded.
+	Hit(ctx context.Context, rule Rule, key string) (Result, error)
+	// Reset forgets key's events for rule
+	Reset(ctx context.Context, rule Rule, key string) error
+	// Lockouts lists the keys that are over the limit of one of rules
+	Lockouts(ctx context.Context, rules []Rule) ([]Lockout, error)
+}
+
+// New returns a limiter that keeps its counters in Redis when it's available,
+// so they are shared by all replicas and survive restarts, and in memory
+// otherwise
+func New(redis *database.Redis) Limiter {
+	if redis != nil && redis.Client != nil {
+		return NewRedisLimiter(redis.Client)
+	}
+	log.Printf("Rate limits are kept in memory and will be lost on restart")
+	return NewMemoryLimiter()
+}
+
+// Rules are the limits on logging in
+type Rules struct {
+	LoginFailuresPerPhone Rule // Wrong codes entered for a phone number
+	LoginFailuresPerIP    Rule // Wrong codes entered from an address
+	LoginRequestsPerIP    Rule // Requests to the login and verification pages from an address
+	OTPRequestsPerPhone   Rule // Login codes issued for a phone number
+}
+
+// NewRules builds the login limits from configuration
+func NewRules(cfg config.RateLimitConfig) Rules {
+	return Rules{
+		LoginFailuresPerPhone: Rule{Name: "login-failures-phone", Limit: cfg.LoginFailuresPerPhone, Window: cfg.LoginFailureWindow},
+		LoginFailuresPerIP:    Rule{Name: "login-failures-ip", Limit: cfg.LoginFailuresPerIP, Window: cfg.LoginFailureWindow},
+		LoginRequestsPerIP:    Rule{Name: "login-requests-ip", Limit: cfg.LoginRequestsPerIP, Window: cfg.LoginRequestWindow},
+		OTPRequestsPerPhone:   Rule{Name: "otp-requests-phone", Limit: cfg.OTPRequestsPerPhone, Window: cfg.OTPRequestWindow},
+	}
+}
+
+// All lists every rule
+func (r Rules) All() []Rule {
+	return []Rule{r.LoginFailuresPerPhone, r.LoginFailuresPerIP, r.LoginRequestsPerIP, r.OTPRequestsPerPhone}
+}
+
+// Find returns the rule with the given name
+func (r Rules) Find(name string) (Rule, bool) {
+	for _, rule := range r.All() {
+		if rule.Name == name {
+			return rule, true
+		}
+	}
+	return Rule{}, false
+}
+
+// result works out a Result from the events in a window, oldest first
+func result(rule Rule, count int, oldest, now time.Time) Result {
+	if count < rule.Limit {
+		return Result{Allowed: true, Count: count}
+	}
+	retryAfter := oldest.Add(rule.Window).Sub(now)
+	if retryAfter < 0 {
+		retryAfter = 0
+	}
+	return Result{Count: count, RetryAfter: retryAfter}
+}
+
+// hitResult adjusts the result after recording an event: the event that
+// reaches the limit is itself allowed
+func hitResult(res Result, recorded bool) Result {
+	if recorded {
+		res.Allowed = true
+		res.RetryAfter = 0
+	}
+	return res
+}
@@ -0,0 +1,244 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestResult(t *testing.T) {
+	rule := Rule{Name: "r", Limit: 3, Window: time.Minute}
+	now := time.Now()
+
+	tests := []struct {
+		name      string
+		count     int
+		oldest    time.Time
+		wantAllow bool
+		wantRetry time.Duration
+	}{
+		{name: "empty", count: 0, oldest: now, wantAllow: true},
+		{name: "under the limit", count: 2, oldest: now.Add(-30 * time.Second), wantAllow: true},
+		{name: "at the limit", count: 3, oldest: now.Add(-20 * time.Second), wantRetry: 40 * time.Second},
+		{name: "over the limit", count: 5, oldest: now.Add(-59 * time.Second), wantRetry: time.Second},
+		{name: "oldest already outside the window", count: 3, oldest: now.Add(-2 * time.Minute), wantRetry: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := result(rule, tt.count, tt.oldest, now)
+			if res.Allowed != tt.wantAllow || res.RetryAfter != tt.wantRetry || res.Count != tt.count {
+				t.Errorf("result() = %+v, want allowed %v, retry %s, count %d", res, tt.wantAllow, tt.wantRetry, tt.count)
+			}
+		})
+	}
+}
+
+func TestHitResult(t *testing.T) {
+	limited := Result{Count: 3, RetryAfter: time.Minute}
+
+	if res := hitResult(limited, true); !res.Allowed || res.RetryAfter != 0 || res.Count != 3 {
+		t.Errorf("hitResult(recorded) = %+v", res)
+	}
+	if res := hitResult(limited, false); res.Allowed || res.RetryAfter != time.Minute {
+		t.Errorf("hitResult(not recorded) = %+v", res)
+	}
+}
+
+func TestRetryAfterSeconds(t *testing.T) {
+	tests := []struct {
+		retryAfter time.Duration
+		want       string
+	}{
+		{0, "0"},
+		{time.Millisecond, "1"},
+		{time.Second, "1"},
+		{1500 * time.Millisecond, "2"},
+		{time.Minute, "60"},
+	}
+
+	for _, tt := range tests {
+		if got := (Result{RetryAfter: tt.retryAfter}).RetryAfterSeconds(); got != tt.want {
+			t.Errorf("RetryAfterSeconds(%s) = %q, want %q", tt.retryAfter, got, tt.want)
+		}
+	}
+}
+
+func TestRulesFind(t *testing.T) {
+	rules := Rules{
+		LoginFailuresPerPhone: Rule{Name: "login-failures-phone", Limit: 5},
+		OTPRequestsPerPhone:   Rule{Name: "otp-requests-phone", Limit: 3},
+	}
+
+	if rule, ok := rules.Find("otp-requests-phone"); !ok || rule.Limit != 3 {
+		t.Errorf("Find(otp-requests-phone) = %+v, %v", rule, ok)
+	}
+	if _, ok := rules.Find("nope"); ok {
+		t.Error("Find(nope) found a rule")
+	}
+}
+
+// age moves every event recorded for key back in time, as if d had passed
+func age(l *MemoryLimiter, rule Rule, key string, d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	events := l.events[memoryKey(rule, key)]
+	for i := range events {
+		events[i] = events[i].Add(-d)
+	}
+}
+
+func TestMemoryLimiterHit(t *testing.T) {
+	rule := Rule{Name: "failures", Limit: 3, Window: time.Minute}
+
+	// Each step waits, then hits; want is whether the hit is allowed
+	type step struct {
+		wait time.Duration
+		want bool
+	}
+
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name:  "up to the limit",
+			steps: []step{{0, true}, {0, true}, {0, true}, {0, false}, {0, false}},
+		},
+		{
+			name:  "whole window expires",
+			steps: []step{{0, true}, {0, true}, {0, true}, {0, false}, {time.Minute, true}, {0, true}, {0, true}, {0, false}},
+		},
+		{
+			name:  "window slides one event at a time",
+			steps: []step{{0, true}, {30 * time.Second, true}, {0, true}, {0, false}, {31 * time.Second, true}, {0, false}},
+		},
+		{
+			name:  "rejected hits are not recorded",
+			steps: []step{{0, true}, {0, true}, {0, true}, {50 * time.Second, false}, {0, false}, {11 * time.Second, true}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewMemoryLimiter()
+			ctx := context.Background()
+
+			for i, step := range tt.steps {
+				age(l, rule, "k", step.wait)
+				res, err := l.Hit(ctx, rule, "k")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if res.Allowed != step.want {
+					t.Fatalf("hit %d: allowed = %v, want %v (%+v)", i+1, res.Allowed, step.want, res)
+				}
+				if !res.Allowed && res.RetryAfter <= 0 {
+					t.Errorf("hit %d: rejected without a retry time", i+1)
+				}
+			}
+		})
+	}
+}
+
+func TestMemoryLimiterRetryAfter(t *testing.T) {
+	rule := Rule{Name: "failures", Limit: 2, Window: time.Minute}
+	l := NewMemoryLimiter()
+	ctx := context.Background()
+
+	l.Hit(ctx, rule, "k")
+	age(l, rule, "k", 40*time.Second)
+	l.Hit(ctx, rule, "k")
+
+	// The oldest event leaves the window in about 20 seconds
+	res, _ := l.Check(ctx, rule, "k")
+	if res.Allowed || res.Count != 2 || res.RetryAfter > 20*time.Second || res.RetryAfter < 19*time.Second {
+		t.Errorf("Check() = %+v, want blocked for about 20s", res)
+	}
+}
+
+func TestMemoryLimiterCheckDoesNotRecord(t *testing.T) {
+	rule := Rule{Name: "requests", Limit: 1, Window: time.Minute}
+	l := NewMemoryLimiter()
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if res, _ := l.Check(ctx, rule, "k"); !res.Allowed || res.Count != 0 {
+			t.Fatalf("Check() = %+v", res)
+		}
+	}
+	if res, _ := l.Hit(ctx, rule, "k"); !res.Allowed {
+		t.Error("first hit after checks was rejected")
+	}
+	if res, _ := l.Check(ctx, rule, "k"); res.Allowed {
+		t.Error("Check() allowed a key at its limit")
+	}
+}
+
+func TestMemoryLimiterKeysAndRulesAreSeparate(t *testing.T) {
+	phone := Rule{Name: "phone", Limit: 1, Window: time.Minute}
+	ip := Rule{Name: "ip", Limit: 1, Window: time.Minute}
+	l := NewMemoryLimiter()
+	ctx := context.Background()
+
+	l.Hit(ctx, phone, "a")
+	if res, _ := l.Hit(ctx, phone, "b"); !res.Allowed {
+		t.Error("another key was limited")
+	}
+	if res, _ := l.Hit(ctx, ip, "a"); !res.Allowed {
+		t.Error("another rule was limited")
+	}
+}
+
+func TestMemoryLimiterReset(t *testing.T) {
+	rule := Rule{Name: "failures", Limit: 1, Window: time.Minute}
+	l := NewMemoryLimiter()
+	ctx := context.Background()
+
+	l.Hit(ctx, rule, "k")
+	if err := l.Reset(ctx, rule, "k"); err != nil {
+		t.Fatal(err)
+	}
+	if res, _ := l.Hit(ctx, rule, "k"); !res.Allowed {
+		t.Error("hit after reset was rejected")
+	}
+}
+
+func TestMemoryLimiterLockouts(t *testing.T) {
+	phone := Rule{Name: "phone", Limit: 2, Window: time.Minute}
+	ip := Rule{Name: "ip", Limit: 1, Window: 10 * time.Minute}
+	l := NewMemoryLimiter()
+	ctx := context.Background()
+
+	l.Hit(ctx, phone, "+1")
+	l.Hit(ctx, phone, "+1")
+	l.Hit(ctx, phone, "+2")
+	l.Hit(ctx, ip, "10.0.0.1")
+	l.Hit(ctx, ip, "10.0.0.2")
+	age(l, ip, "10.0.0.2", 10*time.Minute)
+
+	lockouts, err := l.Lockouts(ctx, []Rule{phone, ip})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lockouts) != 2 {
+		t.Fatalf("Lockouts() = %+v, want 2", lockouts)
+	}
+
+	// Soonest to expire first
+	if lockouts[0].Rule != "phone" || lockouts[0].Key != "+1" || lockouts[0].Count != 2 || lockouts[0].Limit != 2 {
+		t.Errorf("first lockout = %+v", lockouts[0])
+	}
+	if lockouts[1].Rule != "ip" || lockouts[1].Key != "10.0.0.1" {
+		t.Errorf("second lockout = %+v", lockouts[1])
+	}
+
+	// Expired events are pruned while listing
+	l.mu.Lock()
+	_, kept := l.events[memoryKey(ip, "10.0.0.2")]
+	l.mu.Unlock()
+	if kept {
+		t.Error("expired events were kept")
+	}
+}
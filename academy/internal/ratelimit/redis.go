@@ -0,0 +1,148 @@
+package ratelimit
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// slidingWindowScript drops events that fell out of the window from a sorted
+// set of event times, records a new event if ARGV[4] is "1" and the key is
+// under the limit, and returns the count, the time of the oldest event and
+// whether the event was recorded. Times are in milliseconds.
+var slidingWindowScript = redis.NewScript(`
+local key = KEYS[1]
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local limit = tonumber(ARGV[3])
+
+redis.call("ZREMRANGEBYSCORE", key, "-inf", now - window)
+local count = redis.call("ZCARD", key)
+local recorded = 0
+if ARGV[4] == "1" and count < limit then
+	redis.call("ZADD", key, now, ARGV[5])
+	redis.call("PEXPIRE", key, window)
+	count = count + 1
+	recorded = 1
+end
+
+local oldest = redis.call("ZRANGE", key, 0, 0, "WITHSCORES")
+if oldest[2] then
+	return {count, oldest[2], recorded}
+end
+return {count, tostring(now), recorded}
+`)
+
+// RedisLimiter keeps each key's events in a sorted set scored by time
+type RedisLimiter struct {
+	client *redis.Client
+}
+
+// NewRedisLimiter creates a limiter backed by Redis
+func NewRedisLimiter(client *redis.Client) *RedisLimiter {
+	return &RedisLimiter{client: client}
+}
+
+// redisKey is where a rule's events for a key are kept
+func redisKey(rule Rule, key string) string {
+	return fmt.Sprintf("ratelimit:%s:%s", rule.Name, key)
+}
+
+// Check reports whether key is under rule's limit
+func (l *RedisLimiter) Check(ctx context.Context, rule Rule, key string) (Result, error) {
+	return l.run(ctx, rule, key, false)
+}
+
+// Hit records an event for key if it is under rule's limit
+func (l *RedisLimiter) Hit(ctx context.Context, rule Rule, key string) (Result, error) {
+	return l.run(ctx, rule, key, true)
+}
+
+// Reset forgets key's events for rule
+func (l *RedisLimiter) Reset(ctx context.Context, rule Rule, key string) error {
+	return l.client.Del(ctx, redisKey(rule, key)).Err()
+}
+
+// Lockouts lists the keys over the limit of one of rules
+func (l *RedisLimiter) Lockouts(ctx context.Context, rules []Rule) ([]Lockout, error) {
+	var lockouts []Lockout
+	for _, rule := range rules {
+		prefix := redisKey(rule, "")
+		iter := l.client.Scan(ctx, 0, prefix+"*", 100).Iterator()
+		for iter.Next(ctx) {
+			key := strings.TrimPrefix(iter.Val(), prefix)
+			res, err := l.Check(ctx, rule, key)
+			if err != nil {
+				return nil, err
+			}
+			if !res.Allowed {
+				lockouts = append(lockouts, Lockout{
+					Rule:  rule.Name,
+					Key:   key,
+					Count: res.Count,
+					Limit: rule.Limit,
+					Until: time.Now().Add(res.RetryAfter),
+				})
+			}
+		}
+		if err := iter.Err(); err != nil {
+			return nil, fmt.Errorf("failed to list %s rate limits: %w", rule.Name, err)
+		}
+	}
+	return lockouts, nil
+}
+
+// run applies the sliding window script, recording an event if record is set
+func (l *RedisLimiter) run(ctx context.Context, rule Rule, key string, record bool) (Result, error) {
+	now := time.Now()
+	flag := "0"
+	member := ""
+	if record {
+		flag = "1"
+		// Events in the same millisecond need distinct members
+		nonce := make([]byte, 8)
+		if _, err := rand.Read(nonce); err != nil {
+			return Result{}, err
+		}
+		member = fmt.Sprintf("%d-%s", now.UnixNano(), hex.EncodeToString(nonce))
+	}
+
+	values, err := slidingWindowScript.Run(ctx, l.client, []string{redisKey(rule, key)},
+		now.UnixMilli(), rule.Window.Milliseconds(), rule.Limit, flag, member).Slice()
+	if err != nil {
+		return Result{}, fmt.Errorf("redis error applying %s rate limit: %w", rule.Name, err)
+	}
+	if len(values) != 3 {
+		return Result{}, fmt.Errorf("unexpected %s rate limit reply", rule.Name)
+	}
+	count, _ := values[0].(int64)
+	recorded, _ := values[2].(int64)
+	oldestMillis, err := parseMillis(values[1])
+	if err != nil {
+		return Result{}, err
+	}
+
+	res := result(rule, int(count), time.UnixMilli(oldestMillis), now)
+	if record {
+		res = hitResult(res, recorded == 1)
+	}
+	return res, nil
+}
+
+// parseMillis reads a sorted set score, which Redis returns as a string
+func parseMillis(value interface{}) (int64, error) {
+	s, ok := value.(string)
+	if !ok {
+		return 0, fmt.Errorf("unexpected rate limit score %v", value)
+	}
+	var f float64
+	if _, err := fmt.Sscan(s, &f); err != nil {
+		return 0, fmt.Errorf("unexpected rate limit score %q", s)
+	}
+	return int64(f), nil
+}
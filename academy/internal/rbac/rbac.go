@@ -0,0 +1,191 @@
+// Package rbac maps user roles to what they're allowed to do, and changes
+// roles with an audit trail. Routes and handlers check permissions, never
+// role names, so what a role may do is decided here alone.
+package rbac
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/globallstudent/academy/internal/database"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// Permission is something a role may be allowed to do
+type Permission string
+
+// Permissions, as checked by routes and handlers
+const (
+	ViewHiddenTests Permission = "view_hidden_tests" // See hidden test cases and their results
+	Rejudge         Permission = "rejudge"           // Grade stored submissions again
+	ManageProblems  Permission = "manage_problems"   // Create and edit problems
+	ManageContests  Permission = "manage_contests"   // Manage contests and their announcements
+	ManageUsers     Permission = "manage_users"      // Change roles and clear login lockouts
+	WatchTerminals  Permission = "watch_terminals"   // Watch and join other users' terminals
+)
+
+// AllPermissions lists every permission, in the order the admin page shows them
+var AllPermissions = []Permission{ViewHiddenTests, Rejudge, ManageProblems, ManageContests, ManageUsers, WatchTerminals}
+
+// Label describes a permission for the admin page
+func (p Permission) Label() string {
+	switch p {
+	case ViewHiddenTests:
+		return "View hidden tests"
+	case Rejudge:
+		return "Rejudge"
+	case ManageProblems:
+		return "Manage problems"
+	case ManageContests:
+		return "Manage contests"
+	case ManageUsers:
+		return "Manage users"
+	case WatchTerminals:
+		return "Watch terminals"
+	}
+	return string(p)
+}
+
+// Roles a user can have
+const (
+	RoleUser  = "user"
+	RoleJudge = "judge"
+	RoleAdmin = "admin"
+)
+
+// Roles lists every role, from least to most privileged
+var Roles = []string{RoleUser, RoleJudge, RoleAdmin}
+
+// grants are the permissions of each role. Students have none.
+var grants = map[string][]Permission{
+	RoleJudge: {ViewHiddenTests, Rejudge, WatchTerminals},
+	RoleAdmin: AllPermissions,
+}
+
+// ErrUnknownRole is returned when changing a user to a role that doesn't exist
+var ErrUnknownRole = errors.New("unknown role")
+
+// ValidRole reports whether role is one of Roles
+func ValidRole(role string) bool {
+	for _, r := range Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// Can reports whether a role has a permission. Unknown roles have none.
+func Can(role string, p Permission) bool {
+	for _, granted := range grants[role] {
+		if granted == p {
+			return true
+		}
+	}
+	return false
+}
+
+// PermissionsOf lists a role's permissions
+func PermissionsOf(role string) []Permission {
+	return grants[role]
+}
+
+// Role returns a user's current role. Session tokens carry the role the user
+// had when they logged in, so routes that must honour a demotion right away
+// look it up here. The second result is false if there is no such user.
+func Role(ctx context.Context, db *database.DB, userID uuid.UUID) (string, bool, error) {
+	var role string
+	err := db.Pool.QueryRow(ctx, `SELECT role FROM users WHERE id = $1`, userID).Scan(&role)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return role, true, nil
+}
+
+// RoleChange is an entry in the audit log of role changes
+type RoleChange struct {
+	ID            uuid.UUID
+	UserID        uuid.UUID
+	Username      string
+	OldRole       string
+	NewRole       string
+	ChangedBy     *uuid.UUID // nil if the admin's account was deleted
+	ChangedByName string
+	ChangedAt     time.Time
+}
+
+// ChangeRole sets a user's role and records the change in the audit log, in
+// one transaction. It returns the change, and false if the user already had
+// the role or doesn't exist, in which case nothing is recorded.
+func ChangeRole(ctx context.Context, db *database.DB, userID uuid.UUID, newRole string, changedBy uuid.UUID) (RoleChange, bool, error) {
+	if !ValidRole(newRole) {
+		return RoleChange{}, false, ErrUnknownRole
+	}
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return RoleChange{}, false, err
+	}
+	defer tx.Rollback(ctx)
+
+	change := RoleChange{UserID: userID, NewRole: newRole, ChangedBy: &changedBy}
+	err = tx.QueryRow(ctx, `SELECT role, username FROM users WHERE id = $1 FOR UPDATE`, userID).
+		Scan(&change.OldRole, &change.Username)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return RoleChange{}, false, nil
+	}
+	if err != nil {
+		return RoleChange{}, false, err
+	}
+	if change.OldRole == newRole {
+		return change, false, nil
+	}
+
+	if _, err := tx.Exec(ctx, `UPDATE users SET role = $2 WHERE id = $1`, userID, newRole); err != nil {
+		return RoleChange{}, false, err
+	}
+	err = tx.QueryRow(ctx, `
+		INSERT INTO role_changes (user_id, old_role, new_role, changed_by)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, changed_at`, userID, change.OldRole, newRole, changedBy).
+		Scan(&change.ID, &change.ChangedAt)
+	if err != nil {
+		return RoleChange{}, false, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return RoleChange{}, false, err
+	}
+	return change, true, nil
+}
+
+// History returns the latest role changes, newest first
+func History(ctx context.Context, db *database.DB, limit int) ([]RoleChange, error) {
+	rows, err := db.Pool.Query(ctx, `
+		SELECT r.id, r.user_id, COALESCE(u.username, ''), r.old_role, r.new_role,
+			r.changed_by, COALESCE(a.username, ''), r.changed_at
+		FROM role_changes r
+		LEFT JOIN users u ON u.id = r.user_id
+		LEFT JOIN users a ON a.id = r.changed_by
+		ORDER BY r.changed_at DESC
+		LIMIT $1`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var changes []RoleChange
+	for rows.Next() {
+		var r RoleChange
+		if err := rows.Scan(&r.ID, &r.UserID, &r.Username, &r.OldRole, &r.NewRole,
+			&r.ChangedBy, &r.ChangedByName, &r.ChangedAt); err != nil {
+			return nil, err
+		}
+		changes = append(changes, r)
+	}
+	return changes, rows.Err()
+}
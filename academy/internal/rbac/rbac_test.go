@@ -0,0 +1,51 @@
+package rbac
+
+import "testing"
+
+func TestCan(t *testing.T) {
+	tests := []struct {
+		role  string
+		allow []Permission
+	}{
+		{role: RoleUser},
+		{role: RoleJudge, allow: []Permission{ViewHiddenTests, Rejudge, WatchTerminals}},
+		{role: RoleAdmin, allow: AllPermissions},
+		{role: "superuser"},
+		{role: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.role, func(t *testing.T) {
+			allowed := make(map[Permission]bool)
+			for _, p := range tt.allow {
+				allowed[p] = true
+			}
+			for _, p := range AllPermissions {
+				if got := Can(tt.role, p); got != allowed[p] {
+					t.Errorf("Can(%q, %s) = %v, want %v", tt.role, p, got, allowed[p])
+				}
+			}
+		})
+	}
+}
+
+func TestValidRole(t *testing.T) {
+	for _, role := range Roles {
+		if !ValidRole(role) {
+			t.Errorf("ValidRole(%q) = false", role)
+		}
+	}
+	for _, role := range []string{"", "Admin", "student", "root"} {
+		if ValidRole(role) {
+			t.Errorf("ValidRole(%q) = true", role)
+		}
+	}
+}
+
+func TestPermissionLabels(t *testing.T) {
+	for _, p := range AllPermissions {
+		if p.Label() == string(p) {
+			t.Errorf("permission %s has no label", p)
+		}
+	}
+}
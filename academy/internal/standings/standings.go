@@ -0,0 +1,163 @@
+// Package standings works out how students are doing from their submissions,
+// for the leaderboard, profiles and the Telegram bot.
+package standings
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/globallstudent/academy/internal/database"
+	"github.com/globallstudent/academy/internal/models"
+	"github.com/google/uuid"
+)
+
+// Entry is a user's standing, built from their best submission for
+// each problem
+type Entry struct {
+	UserID     uuid.UUID
+	Username   string
+	TotalScore int
+	Solved     int // Problems with full marks
+	LastActive time.Time
+	Problems   []ProblemScore
+
+	reachedAt time.Time // When the user reached their total score; earlier ranks higher on a tie
+}
+
+// ProblemScore is a user's best result on one problem, with its sections:
+// subtasks, or the sections of a verifier or grader
+type ProblemScore struct {
+	Day      int
+	Slug     string
+	Title    string
+	Score    int
+	MaxScore int
+	Sections []models.SectionScore
+}
+
+// Leaderboard ranks every user with a submission by the sum of their best
+// score on each problem
+func Leaderboard(ctx context.Context, db *database.DB) ([]Entry, error) {
+	// The best submission per user and problem is the highest scoring one,
+	// and the earliest of those
+	rows, err := db.Pool.Query(ctx, `
+		SELECT DISTINCT ON (s.user_id, s.problem_id)
+			s.user_id, u.username, p.day, p.slug, p.title, p.score, s.score, s.sections, s.submitted_at,
+			MAX(s.submitted_at) OVER (PARTITION BY s.user_id)
+		FROM submissions s
+		JOIN users u ON u.id = s.user_id
+		JOIN problems p ON p.id = s.problem_id
+		ORDER BY s.user_id, s.problem_id, s.score DESC, s.submitted_at ASC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	index := make(map[uuid.UUID]int)
+	var entries []Entry
+	for rows.Next() {
+		var (
+			userID      uuid.UUID
+			username    string
+			problem     ProblemScore
+			sections    []byte
+			submittedAt time.Time
+			lastActive  time.Time
+		)
+		if err := rows.Scan(&userID, &username, &problem.Day, &problem.Slug, &problem.Title, &problem.MaxScore,
+			&problem.Score, &sections, &submittedAt, &lastActive); err != nil {
+			return nil, err
+		}
+		if sections != nil {
+			if err := json.Unmarshal(sections, &problem.Sections); err != nil {
+				return nil, err
+			}
+		}
+
+		i, ok := index[userID]
+		if !ok {
+			i = len(entries)
+			index[userID] = i
+			entries = append(entries, Entry{UserID: userID, Username: username, LastActive: lastActive})
+		}
+
+		entry := &entries[i]
+		entry.TotalScore += problem.Score
+		if problem.Score >= problem.MaxScore {
+			entry.Solved++
+		}
+		if submittedAt.After(entry.reachedAt) {
+			entry.reachedAt = submittedAt
+		}
+		entry.Problems = append(entry.Problems, problem)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range entries {
+		problems := entries[i].Problems
+		sort.Slice(problems, func(a, b int) bool {
+			if problems[a].Day != problems[b].Day {
+				return problems[a].Day < problems[b].Day
+			}
+			return problems[a].Slug < problems[b].Slug
+		})
+	}
+	sort.SliceStable(entries, func(a, b int) bool {
+		if entries[a].TotalScore != entries[b].TotalScore {
+			return entries[a].TotalScore > entries[b].TotalScore
+		}
+		return entries[a].reachedAt.Before(entries[b].reachedAt)
+	})
+	return entries, nil
+}
+
+// Rank finds a user on the leaderboard, returning their entry and 1-based
+// rank, or false if they have no submissions
+func Rank(entries []Entry, userID uuid.UUID) (Entry, int, bool) {
+	for i, entry := range entries {
+		if entry.UserID == userID {
+			return entry, i + 1, true
+		}
+	}
+	return Entry{}, 0, false
+}
+
+// Streak counts the consecutive days, in UTC, on which a user submitted
+// something, ending today. A streak that ended yesterday still counts, since
+// the user has the rest of today to keep it going.
+func Streak(ctx context.Context, db *database.DB, userID uuid.UUID, now time.Time) (int, error) {
+	rows, err := db.Pool.Query(ctx, `
+		SELECT DISTINCT (submitted_at AT TIME ZONE 'UTC')::date AS day
+		FROM submissions
+		WHERE user_id = $1
+		ORDER BY day DESC
+		LIMIT 400`, userID)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	streak := 0
+	expected := now.UTC().Truncate(24 * time.Hour)
+	for rows.Next() {
+		var day time.Time
+		if err := rows.Scan(&day); err != nil {
+			return 0, err
+		}
+		day = day.UTC().Truncate(24 * time.Hour)
+		if streak == 0 && day.Equal(expected.AddDate(0, 0, -1)) {
+			// Nothing yet today, but the streak is still alive
+			expected = day
+		}
+		if !day.Equal(expected) {
+			break
+		}
+		streak++
+		expected = expected.AddDate(0, 0, -1)
+	}
+	return streak, rows.Err()
+}
@@ -0,0 +1,64 @@
+package telegrambot
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// userState returns what the bot knows about a Telegram user. When the state
+// has expired or was lost, the phone number is looked up from the account the
+// Telegram user is linked to, and the state is restored.
+func (b *Bot) userState(telegramID int64) (*PhoneState, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	state, err := b.states.Get(ctx, telegramID)
+	if err != nil || state != nil {
+		return state, err
+	}
+
+	phoneNumber, username, err := b.lookupTelegramAccount(ctx, telegramID)
+	if err != nil || phoneNumber == "" {
+		return nil, err
+	}
+
+	state = &PhoneState{PhoneNumber: phoneNumber, FullName: username}
+	if err := b.states.Set(ctx, telegramID, state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// lookupTelegramAccount finds the phone number and username of the account
+// linked to a Telegram user, or "" if there is none
+func (b *Bot) lookupTelegramAccount(ctx context.Context, telegramID int64) (string, string, error) {
+	if b.db == nil {
+		return "", "", nil
+	}
+
+	var phoneNumber, username string
+	err := b.db.Pool.QueryRow(ctx, `
+		SELECT phone_number, username FROM users
+		WHERE telegram_id = $1
+		ORDER BY registered_at DESC
+		LIMIT 1`, strconv.FormatInt(telegramID, 10)).Scan(&phoneNumber, &username)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", "", nil
+	}
+	return phoneNumber, username, err
+}
+
+// linkTelegramAccount records which Telegram user owns a phone number,
+// creating the account if the phone number hasn't been seen before
+func (b *Bot) linkTelegramAccount(ctx context.Context, telegramID int64, phoneNumber string) error {
+	if b.db == nil {
+		return nil
+	}
+
+	_, err := b.db.UpsertUserByPhone(ctx, phoneNumber, strconv.FormatInt(telegramID, 10))
+	return err
+}
@@ -0,0 +1,325 @@
+package telegrambot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/globallstudent/academy/internal/announcements"
+	"github.com/globallstudent/academy/internal/rbac"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"gopkg.in/telebot.v3"
+)
+
+// broadcastTimeout bounds how long a broadcast may take. At the default
+// notify rate it's enough for several thousand users.
+const broadcastTimeout = 10 * time.Minute
+
+// Inline buttons of announcement previews and lists. The announcement ID is
+// the button data.
+var (
+	btnAnnounceSend    = &telebot.Btn{Unique: "announce_send"}
+	btnAnnounceCancel  = &telebot.Btn{Unique: "announce_cancel"}
+	btnAnnounceRetract = &telebot.Btn{Unique: "announce_retract"}
+)
+
+// Announce broadcasts a published announcement to its audience. It returns
+// straight away; the messages are sent in the background.
+func (b *Bot) Announce(announcement announcements.Announcement) {
+	b.startBroadcast(announcement, 0)
+}
+
+// startBroadcast sends an announcement in the background, then tells
+// reportTo, if set, how many users got it
+func (b *Bot) startBroadcast(announcement announcements.Announcement, reportTo int64) {
+	if b.db == nil || b.jobsCtx.Err() != nil {
+		return
+	}
+	b.jobs.Add(1)
+	go func() {
+		defer b.jobs.Done()
+		ctx, cancel := context.WithTimeout(b.jobsCtx, broadcastTimeout)
+		defer cancel()
+
+		sent, total, err := b.broadcast(ctx, announcement)
+		if err != nil {
+			log.Printf("Error broadcasting announcement %s: %v", announcement.ID, err)
+		}
+		if reportTo == 0 {
+			return
+		}
+		report := fmt.Sprintf("📨 Delivered to %d of %d users.", sent, total)
+		if err != nil {
+			report = "The broadcast failed. It's still shown in the site banner."
+		}
+		if err := b.notify(b.jobsCtx, reportTo, report, nil); err != nil {
+			log.Printf("Error reporting broadcast to %d: %v", reportTo, err)
+		}
+	}()
+}
+
+// broadcast sends an announcement to every Telegram user in its audience,
+// returning how many got it out of how many were tried
+func (b *Bot) broadcast(ctx context.Context, announcement announcements.Announcement) (int, int, error) {
+	ids, err := announcements.TelegramIDs(ctx, b.db, announcement.ContestID)
+	if err != nil {
+		return 0, 0, err
+	}
+	chatIDs := make([]int64, 0, len(ids))
+	for _, id := range ids {
+		if chatID, ok := parseChatID(id); ok {
+			chatIDs = append(chatIDs, chatID)
+		}
+	}
+
+	sent := b.notifyAll(ctx, chatIDs, announcementText(announcement), &telebot.SendOptions{DisableWebPagePreview: true})
+	log.Printf("Announcement %s delivered to %d of %d users", announcement.ID, sent, len(chatIDs))
+
+	// The count is recorded even if the broadcast was cut short
+	saveCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return sent, len(chatIDs), announcements.SetRecipients(saveCtx, b.db, announcement.ID, sent)
+}
+
+// announcementText is the message users get for an announcement
+func announcementText(announcement announcements.Announcement) string {
+	heading := "📢 Announcement"
+	if announcement.ContestTitle != "" {
+		heading = "📢 " + announcement.ContestTitle
+	}
+	return heading + "\n\n" + announcement.Message
+}
+
+// linkedAdmin finds the account of a Telegram user if its role may manage
+// contests, and so make announcements. The second result is false for
+// everyone else.
+func (b *Bot) linkedAdmin(ctx context.Context, telegramID int64) (uuid.UUID, bool, error) {
+	if b.db == nil {
+		return uuid.Nil, false, errNoDatabase
+	}
+	var (
+		userID uuid.UUID
+		role   string
+	)
+	err := b.db.Pool.QueryRow(ctx, `
+		SELECT id, role FROM users
+		WHERE telegram_id = $1
+		ORDER BY registered_at DESC
+		LIMIT 1`, strconv.FormatInt(telegramID, 10)).Scan(&userID, &role)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return uuid.Nil, false, nil
+	}
+	if err != nil {
+		return uuid.Nil, false, err
+	}
+	return userID, rbac.Can(role, rbac.ManageContests), nil
+}
+
+// adminOnly wraps a handler so only admins can use it. Everyone else is told
+// the command is for admins.
+func (b *Bot) adminOnly(handler func(c telebot.Context, adminID uuid.UUID) error) telebot.HandlerFunc {
+	return func(c telebot.Context) error {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		adminID, isAdmin, err := b.linkedAdmin(ctx, c.Sender().ID)
+		if err != nil {
+			return b.sendAnnouncementError(c, err)
+		}
+		if !isAdmin {
+			if c.Callback() != nil {
+				return c.Respond(&telebot.CallbackResponse{Text: "Only admins can do that."})
+			}
+			return c.Send("Sorry, that command is only for admins.")
+		}
+		return handler(c, adminID)
+	}
+}
+
+// commandArgs returns what follows the command in a message. Unlike
+// telebot's payload, it keeps line breaks.
+func commandArgs(text string) string {
+	text = strings.TrimSpace(text)
+	if i := strings.IndexFunc(text, unicode.IsSpace); i >= 0 {
+		return strings.TrimSpace(text[i:])
+	}
+	return ""
+}
+
+// handleBroadcast handles the /broadcast command: it drafts an announcement
+// to everyone and asks for confirmation
+func (b *Bot) handleBroadcast(c telebot.Context, adminID uuid.UUID) error {
+	message := commandArgs(c.Text())
+	if message == "" {
+		return c.Send("Usage: /broadcast <message>\n\nYou'll see a preview before anything is sent.")
+	}
+	return b.draftAnnouncement(c, adminID, message, nil)
+}
+
+// handleContestBroadcast handles the /broadcast_contest command: it drafts an
+// announcement to one contest's participants and asks for confirmation
+func (b *Bot) handleContestBroadcast(c telebot.Context, adminID uuid.UUID) error {
+	args := commandArgs(c.Text())
+	slug, message := args, ""
+	if i := strings.IndexFunc(args, unicode.IsSpace); i >= 0 {
+		slug, message = args[:i], strings.TrimSpace(args[i:])
+	}
+	if slug == "" || message == "" {
+		return c.Send("Usage: /broadcast_contest <contest-slug> <message>\n\nYou'll see a preview before anything is sent.")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	contest, found, err := announcements.FindContest(ctx, b.db, slug)
+	if err != nil {
+		return b.sendAnnouncementError(c, err)
+	}
+	if !found {
+		return c.Send(fmt.Sprintf("There is no contest %q.", slug))
+	}
+	return b.draftAnnouncement(c, adminID, message, &contest.ID)
+}
+
+// draftAnnouncement stores a draft and replies with its preview and buttons
+// to send or cancel it
+func (b *Bot) draftAnnouncement(c telebot.Context, adminID uuid.UUID, message string, contestID *uuid.UUID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	draft, err := announcements.CreateDraft(ctx, b.db, message, contestID, true, adminID)
+	if errors.Is(err, announcements.ErrTooLong) {
+		return c.Send(fmt.Sprintf("That's too long. Announcements can have at most %d characters.", announcements.MaxLength))
+	}
+	if err != nil {
+		return b.sendAnnouncementError(c, err)
+	}
+	recipients, err := announcements.TelegramIDs(ctx, b.db, contestID)
+	if err != nil {
+		return b.sendAnnouncementError(c, err)
+	}
+
+	markup := &telebot.ReplyMarkup{}
+	markup.Inline(markup.Row(
+		markup.Data("✅ Send", btnAnnounceSend.Unique, draft.ID.String()),
+		markup.Data("✖️ Cancel", btnAnnounceCancel.Unique, draft.ID.String()),
+	))
+	preview := fmt.Sprintf("Preview, for %s (%d Telegram users). It will also be shown in the site banner.\n\n%s",
+		draft.Audience(), len(recipients), announcementText(draft))
+	return c.Send(preview, markup, telebot.NoPreview)
+}
+
+// handleAnnounceSend handles the Send button of a preview: it publishes the
+// draft and broadcasts it
+func (b *Bot) handleAnnounceSend(c telebot.Context, _ uuid.UUID) error {
+	id, err := uuid.Parse(c.Data())
+	if err != nil {
+		return c.Respond(&telebot.CallbackResponse{Text: "Unknown announcement."})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	announcement, published, err := announcements.Publish(ctx, b.db, id)
+	if err != nil {
+		log.Printf("Error publishing announcement %s: %v", id, err)
+		return c.Respond(&telebot.CallbackResponse{Text: "An error occurred. Please try again."})
+	}
+	if !published {
+		return c.Respond(&telebot.CallbackResponse{Text: "It was already sent or cancelled."})
+	}
+	log.Printf("Announcement %s published by Telegram user %d for %s", id, c.Sender().ID, announcement.Audience())
+
+	b.startBroadcast(announcement, c.Sender().ID)
+	if err := c.Edit(announcementText(announcement)+"\n\n✅ Published. Sending…", telebot.NoPreview); err != nil {
+		log.Printf("Error updating announcement preview: %v", err)
+	}
+	return c.Respond()
+}
+
+// handleAnnounceCancel handles the Cancel button of a preview
+func (b *Bot) handleAnnounceCancel(c telebot.Context, _ uuid.UUID) error {
+	id, err := uuid.Parse(c.Data())
+	if err != nil {
+		return c.Respond(&telebot.CallbackResponse{Text: "Unknown announcement."})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	discarded, err := announcements.Discard(ctx, b.db, id)
+	if err != nil {
+		log.Printf("Error discarding announcement %s: %v", id, err)
+		return c.Respond(&telebot.CallbackResponse{Text: "An error occurred. Please try again."})
+	}
+	if !discarded {
+		return c.Respond(&telebot.CallbackResponse{Text: "It was already sent or cancelled."})
+	}
+	if err := c.Edit("✖️ Cancelled. Nothing was sent."); err != nil {
+		log.Printf("Error updating announcement preview: %v", err)
+	}
+	return c.Respond()
+}
+
+// handleAnnouncements handles the /announcements command: it lists the
+// announcements in the site banner, each with a button to retract it
+func (b *Bot) handleAnnouncements(c telebot.Context, _ uuid.UUID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	active, err := announcements.Active(ctx, b.db, time.Now())
+	if err != nil {
+		return b.sendAnnouncementError(c, err)
+	}
+	if len(active) == 0 {
+		return c.Send("No announcements are in the site banner. Use /broadcast to make one.")
+	}
+
+	for _, announcement := range active {
+		markup := &telebot.ReplyMarkup{}
+		markup.Inline(markup.Row(markup.Data("Retract", btnAnnounceRetract.Unique, announcement.ID.String())))
+		text := fmt.Sprintf("For %s, published %s, delivered to %d users:\n\n%s",
+			announcement.Audience(), announcement.PublishedAt.UTC().Format(unlockTimeFormat),
+			announcement.Recipients, announcement.Message)
+		if err := c.Send(text, markup, telebot.NoPreview); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// handleAnnounceRetract handles the Retract button: it takes an announcement
+// out of the site banner
+func (b *Bot) handleAnnounceRetract(c telebot.Context, _ uuid.UUID) error {
+	id, err := uuid.Parse(c.Data())
+	if err != nil {
+		return c.Respond(&telebot.CallbackResponse{Text: "Unknown announcement."})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	retracted, err := announcements.Retract(ctx, b.db, id)
+	if err != nil {
+		log.Printf("Error retracting announcement %s: %v", id, err)
+		return c.Respond(&telebot.CallbackResponse{Text: "An error occurred. Please try again."})
+	}
+	if !retracted {
+		return c.Respond(&telebot.CallbackResponse{Text: "It was already retracted."})
+	}
+	if err := c.Edit("🗑 Retracted from the site banner. Messages already sent stay sent."); err != nil {
+		log.Printf("Error updating announcement: %v", err)
+	}
+	return c.Respond()
+}
+
+// sendAnnouncementError tells an admin their command failed
+func (b *Bot) sendAnnouncementError(c telebot.Context, err error) error {
+	if errors.Is(err, errNoDatabase) {
+		return c.Send("Announcements aren't available right now.")
+	}
+	log.Printf("Error handling announcement command from %d: %v", c.Sender().ID, err)
+	return c.Send("An error occurred. Please try again later.")
+}
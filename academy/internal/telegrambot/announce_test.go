@@ -0,0 +1,54 @@
+package telegrambot
+
+import (
+	"testing"
+
+	"github.com/globallstudent/academy/internal/announcements"
+)
+
+func TestCommandArgs(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{text: "/broadcast", want: ""},
+		{text: "/broadcast   ", want: ""},
+		{text: "/broadcast Lunch is at noon", want: "Lunch is at noon"},
+		{text: "/broadcast@academy_bot Lunch", want: "Lunch"},
+		{text: "/broadcast Line one\n\nLine two\n", want: "Line one\n\nLine two"},
+		{text: "/broadcast_contest week-1\nStarts tomorrow", want: "week-1\nStarts tomorrow"},
+	}
+
+	for _, tt := range tests {
+		if got := commandArgs(tt.text); got != tt.want {
+			t.Errorf("commandArgs(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestAnnouncementText(t *testing.T) {
+	tests := []struct {
+		name         string
+		announcement announcements.Announcement
+		want         string
+	}{
+		{
+			name:         "to everyone",
+			announcement: announcements.Announcement{Message: "Lunch is at noon"},
+			want:         "📢 Announcement\n\nLunch is at noon",
+		},
+		{
+			name:         "to a contest",
+			announcement: announcements.Announcement{Message: "Problem B was fixed", ContestTitle: "Week 1"},
+			want:         "📢 Week 1\n\nProblem B was fixed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := announcementText(tt.announcement); got != tt.want {
+				t.Errorf("announcementText() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package telegrambot
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"gopkg.in/telebot.v3"
+)
+
+// notifyRetries is how often a notification is retried after Telegram asks
+// the bot to slow down
+const notifyRetries = 3
+
+// pacer spaces out sends so the bot stays under Telegram's limit of about 30
+// messages per second. All notifications share one pacer.
+type pacer struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+func newPacer(perSecond int) *pacer {
+	if perSecond <= 0 {
+		perSecond = 1
+	}
+	return &pacer{interval: time.Second / time.Duration(perSecond)}
+}
+
+// wait blocks until the caller may send the next message
+func (p *pacer) wait(ctx context.Context) error {
+	p.mu.Lock()
+	now := time.Now()
+	slot := p.next
+	if slot.Before(now) {
+		slot = now
+	}
+	p.next = slot.Add(p.interval)
+	p.mu.Unlock()
+
+	timer := time.NewTimer(slot.Sub(now))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// notify sends an unprompted message to a chat, pacing it with the other
+// notifications and waiting out Telegram's flood limits. Chats that can no
+// longer be messaged are unsubscribed.
+func (b *Bot) notify(ctx context.Context, chatID int64, text string, opts *telebot.SendOptions) error {
+	for attempt := 0; ; attempt++ {
+		if err := b.pacer.wait(ctx); err != nil {
+			return err
+		}
+		_, err := b.bot.Send(telebot.ChatID(chatID), text, opts)
+
+		var flood telebot.FloodError
+		switch {
+		case err == nil:
+			return nil
+		case errors.As(err, &flood) && attempt < notifyRetries:
+			log.Printf("Telegram asked to slow down for %ds", flood.RetryAfter)
+			select {
+			case <-time.After(time.Duration(flood.RetryAfter) * time.Second):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		case errors.Is(err, telebot.ErrBlockedByUser), errors.Is(err, telebot.ErrUserIsDeactivated), errors.Is(err, telebot.ErrChatNotFound):
+			if unsubErr := b.unsubscribe(ctx, chatID); unsubErr != nil {
+				log.Printf("Error unsubscribing unreachable chat %d: %v", chatID, unsubErr)
+			}
+			return err
+		default:
+			return err
+		}
+	}
+}
+
+// notifyAll sends the same message to many chats and returns how many got it
+func (b *Bot) notifyAll(ctx context.Context, chatIDs []int64, text string, opts *telebot.SendOptions) int {
+	sent := 0
+	for _, chatID := range chatIDs {
+		if err := b.notify(ctx, chatID, text, opts); err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			log.Printf("Error notifying Telegram chat %d: %v", chatID, err)
+			continue
+		}
+		sent++
+	}
+	return sent
+}
+
+// parseChatID reads a Telegram ID stored as text
+func parseChatID(id string) (int64, bool) {
+	chatID, err := strconv.ParseInt(id, 10, 64)
+	return chatID, err == nil
+}
@@ -1,14 +1,16 @@
 package telegrambot
 
 import (
+	"context"
 	"fmt"
 	"net/url"
 
+	"github.com/globallstudent/academy/internal/auth"
 	"gopkg.in/telebot.v3"
 )
 
-// sendVerificationMessage sends an OTP code and verification link to the user
-func (b *Bot) sendVerificationMessage(c telebot.Context, phoneNumber, otp string) error {
+// verificationMessage formats an OTP code with quick login links, in Markdown
+func (b *Bot) verificationMessage(phoneNumber, otp string) string {
 	// Create verification URLs
 	verifyURL := fmt.Sprintf("%s?phone=%s&otp=%s",
 		b.loginURL, url.QueryEscape(phoneNumber), otp)
@@ -17,8 +19,7 @@ func (b *Bot) sendVerificationMessage(c telebot.Context, phoneNumber, otp string
 	loginURL := fmt.Sprintf("%s/login?phone=%s&otp=%s",
 		b.serverURL, url.QueryEscape(phoneNumber), otp)
 
-	// Format a message with markdown
-	message := fmt.Sprintf("🔐 *Verification Code*\n\n"+
+	return fmt.Sprintf("🔐 *Verification Code*\n\n"+
 		"Your login code is: *%s*\n\n"+
 		"📱 For phone number: *%s*\n\n"+
 		"🔗 *Quick Login Options*:\n"+
@@ -26,9 +27,31 @@ func (b *Bot) sendVerificationMessage(c telebot.Context, phoneNumber, otp string
 		"2️⃣ [Open the login page](%s)\n\n"+
 		"Or enter the code manually on the login page.",
 		otp, phoneNumber, verifyURL, loginURL)
+}
+
+// Channel names the bot's login code channel. The bot is the auth.OTPSender
+// for codes requested on the login page.
+func (b *Bot) Channel() string {
+	return auth.OTPChannelTelegram
+}
+
+// CanReach reports whether the user has linked a Telegram account, by
+// sharing their phone number with the bot
+func (b *Bot) CanReach(to auth.OTPRecipient) bool {
+	_, ok := parseChatID(to.TelegramID)
+	return ok
+}
 
-	// Send the message with markdown formatting
-	return c.Send(message, &telebot.SendOptions{
-		ParseMode: telebot.ModeMarkdown,
-	})
+// SendOTP messages a login code to the user's linked Telegram account
+func (b *Bot) SendOTP(ctx context.Context, to auth.OTPRecipient, otp string) error {
+	chatID, ok := parseChatID(to.TelegramID)
+	if !ok {
+		return auth.ErrOTPNoRoute
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	_, err := b.bot.Send(telebot.ChatID(chatID), b.verificationMessage(to.PhoneNumber, otp),
+		&telebot.SendOptions{ParseMode: telebot.ModeMarkdown})
+	return err
 }
@@ -0,0 +1,281 @@
+package telegrambot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/globallstudent/academy/internal/models"
+	"github.com/globallstudent/academy/internal/standings"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"gopkg.in/telebot.v3"
+)
+
+const (
+	// leaderboardSize is how many users /leaderboard shows
+	leaderboardSize = 10
+	// verdictTimeout bounds how long a verdict message may wait for its turn
+	verdictTimeout = time.Minute
+)
+
+// verdicts describe a submission status to its author
+var verdicts = map[string]string{
+	"passed":  "✅ Accepted",
+	"partial": "🟡 Partially accepted",
+	"failed":  "❌ Not accepted",
+}
+
+// SubmissionJudged messages a student the verdict of their submission, if
+// their account is linked to Telegram. It returns straight away; the message
+// is sent in the background.
+func (b *Bot) SubmissionJudged(submission models.Submission) {
+	if b.db == nil || b.jobsCtx.Err() != nil {
+		return
+	}
+	b.jobs.Add(1)
+	go func() {
+		defer b.jobs.Done()
+		ctx, cancel := context.WithTimeout(b.jobsCtx, verdictTimeout)
+		defer cancel()
+		if err := b.sendVerdict(ctx, submission); err != nil && ctx.Err() == nil {
+			log.Printf("Error sending verdict for submission %s: %v", submission.ID, err)
+		}
+	}()
+}
+
+// sendVerdict messages the author of a submission its verdict and score
+func (b *Bot) sendVerdict(ctx context.Context, submission models.Submission) error {
+	chatID, found, err := b.linkedTelegramID(ctx, submission.UserID)
+	if err != nil || !found {
+		return err
+	}
+
+	title, link := "your submission", ""
+	maxScore := 0
+	if problem, ok := b.catalog.ProblemByID(submission.ProblemID); ok {
+		title = problem.Title
+		link = fmt.Sprintf("%s/problems/%s", b.serverURL, problem.Slug)
+		maxScore = problem.Score
+	}
+	if len(submission.Sections) > 0 {
+		maxScore = 0
+		for _, section := range submission.Sections {
+			maxScore += section.MaxScore
+		}
+	}
+
+	verdict, ok := verdicts[submission.Status]
+	if !ok {
+		verdict = "📝 Judged"
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s: %s\n", verdict, title)
+	if maxScore > 0 {
+		fmt.Fprintf(&sb, "Score: %d/%d\n", submission.Score, maxScore)
+	} else {
+		fmt.Fprintf(&sb, "Score: %d\n", submission.Score)
+	}
+	if len(submission.Sections) > 1 {
+		sb.WriteString("\n")
+		for _, section := range submission.Sections {
+			fmt.Fprintf(&sb, "• %s: %d/%d\n", section.Name, section.Score, section.MaxScore)
+		}
+	}
+	if link != "" {
+		sb.WriteString("\n" + link + "\n")
+	}
+	sb.WriteString("\nUse /status to see where you stand.")
+
+	return b.notify(ctx, chatID, sb.String(), &telebot.SendOptions{DisableWebPagePreview: true})
+}
+
+// linkedTelegramID finds the Telegram user an account is linked to
+func (b *Bot) linkedTelegramID(ctx context.Context, userID uuid.UUID) (int64, bool, error) {
+	var telegramID string
+	err := b.db.Pool.QueryRow(ctx, `SELECT COALESCE(telegram_id, '') FROM users WHERE id = $1`, userID).Scan(&telegramID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	chatID, ok := parseChatID(telegramID)
+	return chatID, ok, nil
+}
+
+// linkedUserID finds the account a Telegram user is linked to
+func (b *Bot) linkedUserID(ctx context.Context, telegramID int64) (uuid.UUID, bool, error) {
+	if b.db == nil {
+		return uuid.Nil, false, errNoDatabase
+	}
+	var userID uuid.UUID
+	err := b.db.Pool.QueryRow(ctx, `
+		SELECT id FROM users
+		WHERE telegram_id = $1
+		ORDER BY registered_at DESC
+		LIMIT 1`, strconv.FormatInt(telegramID, 10)).Scan(&userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return uuid.Nil, false, nil
+	}
+	return userID, err == nil, err
+}
+
+// leaderboard returns the same standings as the web leaderboard
+func (b *Bot) leaderboard(ctx context.Context) ([]standings.Entry, error) {
+	if b.db == nil {
+		return nil, errNoDatabase
+	}
+	return standings.Leaderboard(ctx, b.db)
+}
+
+// handleStatus handles the /status command: the sender's rank, total score
+// and streak
+func (b *Bot) handleStatus(c telebot.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	userID, linked, err := b.linkedUserID(ctx, c.Sender().ID)
+	if err != nil {
+		return b.sendStandingsError(c, err)
+	}
+	if !linked {
+		return c.Send("Your Telegram account isn't linked to the academy yet. Use /login to link it.")
+	}
+
+	entries, err := b.leaderboard(ctx)
+	if err != nil {
+		return b.sendStandingsError(c, err)
+	}
+	entry, rank, found := standings.Rank(entries, userID)
+	if !found {
+		return c.Send("You haven't submitted anything yet. Use /problems to find something to solve.")
+	}
+	streak, err := standings.Streak(ctx, b.db, userID, time.Now())
+	if err != nil {
+		return b.sendStandingsError(c, err)
+	}
+
+	return c.Send(fmt.Sprintf(
+		"📊 %s\n\nRank: #%d of %d\nTotal score: %d\nSolved: %d of %d attempted\nStreak: %s",
+		entry.Username, rank, len(entries), entry.TotalScore, entry.Solved, len(entry.Problems), formatStreak(streak)))
+}
+
+// handleLeaderboard handles the /leaderboard command: the top users, and the
+// sender's own place if they aren't among them
+func (b *Bot) handleLeaderboard(c telebot.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	entries, err := b.leaderboard(ctx)
+	if err != nil {
+		return b.sendStandingsError(c, err)
+	}
+	if len(entries) == 0 {
+		return c.Send("Nobody has submitted anything yet. Be the first!")
+	}
+
+	userID, _, err := b.linkedUserID(ctx, c.Sender().ID)
+	if err != nil {
+		log.Printf("Error looking up account of Telegram user %d: %v", c.Sender().ID, err)
+	}
+
+	var sb strings.Builder
+	sb.WriteString("🏆 Leaderboard\n\n")
+	for i, entry := range entries {
+		if i == leaderboardSize {
+			break
+		}
+		writeLeaderboardLine(&sb, i+1, entry, entry.UserID == userID)
+	}
+	if entry, rank, found := standings.Rank(entries, userID); found && rank > leaderboardSize {
+		sb.WriteString("…\n")
+		writeLeaderboardLine(&sb, rank, entry, true)
+	}
+	fmt.Fprintf(&sb, "\n%s/leaderboard", b.serverURL)
+
+	return c.Send(sb.String(), &telebot.SendOptions{DisableWebPagePreview: true})
+}
+
+// writeLeaderboardLine writes one leaderboard row
+func writeLeaderboardLine(sb *strings.Builder, rank int, entry standings.Entry, isSender bool) {
+	marker := ""
+	if isSender {
+		marker = " ← you"
+	}
+	fmt.Fprintf(sb, "%d. %s: %d (%d solved)%s\n", rank, entry.Username, entry.TotalScore, entry.Solved, marker)
+}
+
+// handleProblems handles the /problems command: the problems of the latest
+// unlocked day, with the sender's best score on each
+func (b *Bot) handleProblems(c telebot.Context) error {
+	current, _ := b.currentDay(time.Now())
+	if current == nil {
+		return c.Send("Nothing has unlocked yet. Use /today to see when the first day opens.")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Scores are a bonus, so the list is still shown when they can't be loaded
+	best := make(map[string]standings.ProblemScore)
+	userID, linked, err := b.linkedUserID(ctx, c.Sender().ID)
+	if err == nil && linked {
+		var entries []standings.Entry
+		entries, err = b.leaderboard(ctx)
+		if entry, _, found := standings.Rank(entries, userID); found {
+			for _, problem := range entry.Problems {
+				best[problem.Slug] = problem
+			}
+		}
+	}
+	if err != nil && !errors.Is(err, errNoDatabase) {
+		log.Printf("Error loading scores of Telegram user %d: %v", c.Sender().ID, err)
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "📚 Day %d: %s\n\n", current.Day, current.Title)
+	for _, problem := range current.Problems {
+		result := "not attempted"
+		if score, ok := best[problem.Slug]; ok {
+			result = fmt.Sprintf("%d/%d", score.Score, score.MaxScore)
+			if score.Score >= score.MaxScore {
+				result += " ✅"
+			}
+		} else if !linked {
+			result = fmt.Sprintf("%d points", problem.Score)
+		}
+		fmt.Fprintf(&sb, "• %s (%s), %s\n  %s/problems/%s\n", problem.Title, problem.Type, result, b.serverURL, problem.Slug)
+	}
+	if !linked {
+		sb.WriteString("\nUse /login to link your account and see your scores here.")
+	}
+
+	return c.Send(strings.TrimRight(sb.String(), "\n"), &telebot.SendOptions{DisableWebPagePreview: true})
+}
+
+// sendStandingsError tells the user their standings couldn't be loaded
+func (b *Bot) sendStandingsError(c telebot.Context, err error) error {
+	if errors.Is(err, errNoDatabase) {
+		return c.Send("Standings aren't available right now.")
+	}
+	log.Printf("Error loading standings for %d: %v", c.Sender().ID, err)
+	return c.Send("An error occurred. Please try again later.")
+}
+
+// formatStreak describes a streak of days
+func formatStreak(days int) string {
+	switch days {
+	case 0:
+		return "none yet. Submit something today to start one!"
+	case 1:
+		return "1 day 🔥"
+	default:
+		return fmt.Sprintf("%d days 🔥", days)
+	}
+}
@@ -0,0 +1,134 @@
+package telegrambot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// PhoneState stores what the bot knows about a Telegram user between messages
+type PhoneState struct {
+	PhoneNumber string `json:"phone_number"`
+	FullName    string `json:"full_name"`
+}
+
+// StateStore keeps each Telegram user's state, keyed by Telegram user ID.
+// States expire so the store doesn't grow forever; the phone number can be
+// recovered from the users table after that.
+type StateStore interface {
+	// Get returns the user's state, or nil if there is none
+	Get(ctx context.Context, telegramID int64) (*PhoneState, error)
+	Set(ctx context.Context, telegramID int64, state *PhoneState) error
+	Delete(ctx context.Context, telegramID int64) error
+}
+
+// RedisStateStore keeps states in Redis, so they survive restarts and are
+// shared between academy instances
+type RedisStateStore struct {
+	client *redis.Client
+	ttl    time.Duration
+}
+
+// NewRedisStateStore creates a state store backed by Redis
+func NewRedisStateStore(client *redis.Client, ttl time.Duration) *RedisStateStore {
+	return &RedisStateStore{client: client, ttl: ttl}
+}
+
+func stateKey(telegramID int64) string {
+	return fmt.Sprintf("telegram:state:%d", telegramID)
+}
+
+// Get returns the user's state, or nil if there is none
+func (s *RedisStateStore) Get(ctx context.Context, telegramID int64) (*PhoneState, error) {
+	data, err := s.client.Get(ctx, stateKey(telegramID)).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("redis error retrieving bot state: %w", err)
+	}
+
+	var state PhoneState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("invalid bot state: %w", err)
+	}
+	return &state, nil
+}
+
+// Set stores the user's state, restarting its TTL
+func (s *RedisStateStore) Set(ctx context.Context, telegramID int64, state *PhoneState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return s.client.Set(ctx, stateKey(telegramID), data, s.ttl).Err()
+}
+
+// Delete forgets the user's state
+func (s *RedisStateStore) Delete(ctx context.Context, telegramID int64) error {
+	return s.client.Del(ctx, stateKey(telegramID)).Err()
+}
+
+// MemoryStateStore keeps states in memory, for development without Redis.
+// States are lost on restart.
+type MemoryStateStore struct {
+	mu     sync.Mutex
+	ttl    time.Duration
+	states map[int64]memoryState
+}
+
+type memoryState struct {
+	state     PhoneState
+	expiresAt time.Time
+}
+
+// NewMemoryStateStore creates an in-memory state store
+func NewMemoryStateStore(ttl time.Duration) *MemoryStateStore {
+	return &MemoryStateStore{ttl: ttl, states: make(map[int64]memoryState)}
+}
+
+// Get returns the user's state, or nil if there is none
+func (s *MemoryStateStore) Get(ctx context.Context, telegramID int64) (*PhoneState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.states[telegramID]
+	if !ok {
+		return nil, nil
+	}
+	if time.Now().After(entry.expiresAt) {
+		delete(s.states, telegramID)
+		return nil, nil
+	}
+	state := entry.state
+	return &state, nil
+}
+
+// Set stores the user's state, restarting its TTL
+func (s *MemoryStateStore) Set(ctx context.Context, telegramID int64, state *PhoneState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Drop expired states while we hold the lock
+	now := time.Now()
+	for id, entry := range s.states {
+		if now.After(entry.expiresAt) {
+			delete(s.states, id)
+		}
+	}
+
+	s.states[telegramID] = memoryState{state: *state, expiresAt: now.Add(s.ttl)}
+	return nil
+}
+
+// Delete forgets the user's state
+func (s *MemoryStateStore) Delete(ctx context.Context, telegramID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.states, telegramID)
+	return nil
+}
@@ -0,0 +1,105 @@
+package telegrambot
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"gopkg.in/telebot.v3"
+)
+
+// errNoDatabase is returned when a feature needs the database and there is none
+var errNoDatabase = errors.New("no database")
+
+// subscribe opts a Telegram user in to notifications
+func (b *Bot) subscribe(ctx context.Context, telegramID int64) error {
+	if b.db == nil {
+		return errNoDatabase
+	}
+	_, err := b.db.Pool.Exec(ctx, `
+		INSERT INTO telegram_subscriptions (telegram_id) VALUES ($1)
+		ON CONFLICT (telegram_id) DO NOTHING`, strconv.FormatInt(telegramID, 10))
+	return err
+}
+
+// unsubscribe opts a Telegram user out of notifications
+func (b *Bot) unsubscribe(ctx context.Context, telegramID int64) error {
+	if b.db == nil {
+		return errNoDatabase
+	}
+	_, err := b.db.Pool.Exec(ctx, `DELETE FROM telegram_subscriptions WHERE telegram_id = $1`,
+		strconv.FormatInt(telegramID, 10))
+	return err
+}
+
+// isSubscribed reports whether a Telegram user gets notifications
+func (b *Bot) isSubscribed(ctx context.Context, telegramID int64) (bool, error) {
+	if b.db == nil {
+		return false, errNoDatabase
+	}
+	var one int
+	err := b.db.Pool.QueryRow(ctx, `SELECT 1 FROM telegram_subscriptions WHERE telegram_id = $1`,
+		strconv.FormatInt(telegramID, 10)).Scan(&one)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// subscribers lists the chats of every subscribed Telegram user
+func (b *Bot) subscribers(ctx context.Context) ([]int64, error) {
+	if b.db == nil {
+		return nil, errNoDatabase
+	}
+	rows, err := b.db.Pool.Query(ctx, `SELECT telegram_id FROM telegram_subscriptions ORDER BY subscribed_at`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var chatIDs []int64
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		if chatID, ok := parseChatID(id); ok {
+			chatIDs = append(chatIDs, chatID)
+		}
+	}
+	return chatIDs, rows.Err()
+}
+
+// handleSubscribe handles the /subscribe command
+func (b *Bot) handleSubscribe(c telebot.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := b.subscribe(ctx, c.Sender().ID); err != nil {
+		return b.sendSubscriptionError(c, err)
+	}
+	return c.Send("🔔 You're subscribed. I'll message you when a new day unlocks.\n\nUse /unsubscribe to stop.")
+}
+
+// handleUnsubscribe handles the /unsubscribe command
+func (b *Bot) handleUnsubscribe(c telebot.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := b.unsubscribe(ctx, c.Sender().ID); err != nil {
+		return b.sendSubscriptionError(c, err)
+	}
+	return c.Send("🔕 You won't hear about new days anymore. Use /subscribe to turn it back on.")
+}
+
+// sendSubscriptionError tells the user their subscription couldn't be changed
+func (b *Bot) sendSubscriptionError(c telebot.Context, err error) error {
+	if errors.Is(err, errNoDatabase) {
+		return c.Send("Notifications aren't available right now.")
+	}
+	log.Printf("Error updating subscription for %d: %v", c.Sender().ID, err)
+	return c.Send("An error occurred. Please try again later.")
+}
@@ -1,64 +1,101 @@
 package telegrambot
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
-	"math/rand"
+	"sync"
 	"time"
 
+	"github.com/globallstudent/academy/internal/auth"
 	"github.com/globallstudent/academy/internal/config"
 	"github.com/globallstudent/academy/internal/database"
+	"github.com/globallstudent/academy/internal/problems"
 	"gopkg.in/telebot.v3"
 )
 
 // Bot represents the Telegram bot service
 type Bot struct {
-	bot         *telebot.Bot
-	redis       *database.Redis
-	db          *database.DB
-	cfg         *config.Config
-	serverURL   string
-	loginURL    string
-	devOTPStore interface{} // Function to store development OTPs
+	bot           *telebot.Bot
+	db            *database.DB
+	cfg           *config.Config
+	serverURL     string
+	loginURL      string
+	states        StateStore
+	otp           *auth.OTPService
+	webhookSecret string // Set in webhook mode
+	catalog       *problems.Catalog
+	pacer         *pacer // Spaces out notifications
+	jobsCtx       context.Context
+	stopJobs      context.CancelFunc
+	jobs          sync.WaitGroup // Background jobs, such as the unlock scheduler
 }
 
-// PhoneState stores user's phone number during authentication flow
-type PhoneState struct {
-	PhoneNumber string
-	FullName    string
-	OTP         string
-}
-
-var (
-	// States stores the current state for each user
-	userStates = make(map[int64]*PhoneState)
-)
-
 // New creates a new Telegram bot
-func New(cfg *config.Config, redis *database.Redis, db *database.DB, serverURL string) (*Bot, error) {
+func New(cfg *config.Config, redis *database.Redis, db *database.DB, otp *auth.OTPService, catalog *problems.Catalog, serverURL string) (*Bot, error) {
 	// Initialize the bot with the token from config
 	botToken := cfg.Telegram.BotToken
 	if botToken == "" {
 		return nil, fmt.Errorf("telegram bot token not set")
 	}
 
+	// Receive updates through the webhook route when a public URL is
+	// configured, and long-poll for them otherwise
+	var poller telebot.Poller = &telebot.LongPoller{Timeout: 10 * time.Second}
+	webhookSecret := ""
+	if cfg.Telegram.WebhookURL != "" {
+		webhookSecret = cfg.Telegram.WebhookSecret
+		if webhookSecret == "" {
+			var err error
+			if webhookSecret, err = newWebhookSecret(); err != nil {
+				return nil, fmt.Errorf("failed to generate webhook secret: %w", err)
+			}
+		}
+		poller = newWebhookPoller(cfg.Telegram.WebhookURL, webhookSecret)
+	}
+
 	b, err := telebot.NewBot(telebot.Settings{
+		URL:    cfg.Telegram.APIURL,
 		Token:  botToken,
-		Poller: &telebot.LongPoller{Timeout: 10 * time.Second},
+		Poller: poller,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to create Telegram bot: %w", err)
 	}
 
+	// Telegram refuses to long-poll while a webhook is registered, e.g. one
+	// left over from running in webhook mode
+	if webhookSecret == "" {
+		if err := b.RemoveWebhook(); err != nil {
+			log.Printf("Warning: Failed to remove Telegram webhook: %v", err)
+		}
+	}
+
+	// Keep conversation state in Redis when it's available, so it survives restarts
+	var states StateStore
+	if redis != nil && redis.Client != nil {
+		states = NewRedisStateStore(redis.Client, cfg.Telegram.StateTTL)
+	} else {
+		log.Printf("Telegram bot state is kept in memory and will be lost on restart")
+		states = NewMemoryStateStore(cfg.Telegram.StateTTL)
+	}
+
 	// Create the bot instance
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
 	bot := &Bot{
-		bot:         b,
-		redis:       redis,
-		db:          db,
-		cfg:         cfg,
-		serverURL:   serverURL,
-		loginURL:    fmt.Sprintf("%s/verify", serverURL),
-		devOTPStore: nil, // Will be set by the caller if needed
+		bot:           b,
+		db:            db,
+		cfg:           cfg,
+		serverURL:     serverURL,
+		loginURL:      fmt.Sprintf("%s/verify", serverURL),
+		states:        states,
+		otp:           otp,
+		webhookSecret: webhookSecret,
+		catalog:       catalog,
+		pacer:         newPacer(cfg.Telegram.NotifyRate),
+		jobsCtx:       jobsCtx,
+		stopJobs:      stopJobs,
 	}
 
 	// Set up the bot handlers
@@ -67,14 +104,25 @@ func New(cfg *config.Config, redis *database.Redis, db *database.DB, serverURL s
 	return bot, nil
 }
 
-// Start launches the Telegram bot
+// Start launches the Telegram bot and its background jobs
 func (b *Bot) Start() {
+	if b.db != nil {
+		b.jobs.Add(1)
+		go func() {
+			defer b.jobs.Done()
+			b.runUnlockScheduler(b.jobsCtx)
+		}()
+	} else {
+		log.Printf("No database, so unlock notifications are off")
+	}
 	b.bot.Start()
 }
 
-// Stop stops the Telegram bot
+// Stop stops the Telegram bot, waiting for its background jobs to finish
 func (b *Bot) Stop() {
 	b.bot.Stop()
+	b.stopJobs()
+	b.jobs.Wait()
 }
 
 // setupHandlers configures all the bot's command and message handlers
@@ -86,6 +134,32 @@ func (b *Bot) setupHandlers() {
 	b.bot.Handle("/login", func(c telebot.Context) error {
 		return b.handleLogin(c)
 	})
+	b.bot.Handle("/subscribe", func(c telebot.Context) error {
+		return b.handleSubscribe(c)
+	})
+	b.bot.Handle("/unsubscribe", func(c telebot.Context) error {
+		return b.handleUnsubscribe(c)
+	})
+	b.bot.Handle("/today", func(c telebot.Context) error {
+		return b.handleToday(c)
+	})
+	b.bot.Handle("/problems", func(c telebot.Context) error {
+		return b.handleProblems(c)
+	})
+	b.bot.Handle("/status", func(c telebot.Context) error {
+		return b.handleStatus(c)
+	})
+	b.bot.Handle("/leaderboard", func(c telebot.Context) error {
+		return b.handleLeaderboard(c)
+	})
+
+	// Admin commands and the buttons of their messages
+	b.bot.Handle("/broadcast", b.adminOnly(b.handleBroadcast))
+	b.bot.Handle("/broadcast_contest", b.adminOnly(b.handleContestBroadcast))
+	b.bot.Handle("/announcements", b.adminOnly(b.handleAnnouncements))
+	b.bot.Handle(btnAnnounceSend, b.adminOnly(b.handleAnnounceSend))
+	b.bot.Handle(btnAnnounceCancel, b.adminOnly(b.handleAnnounceCancel))
+	b.bot.Handle(btnAnnounceRetract, b.adminOnly(b.handleAnnounceRetract))
 
 	// Contact button handler
 	b.bot.Handle(telebot.OnContact, func(c telebot.Context) error {
@@ -103,19 +177,28 @@ func (b *Bot) handleStart(c telebot.Context) error {
 	return c.Send(
 		"👋 Welcome to Summer Academy Bot!\n\n" +
 			"I will help you authenticate for the Summer Academy platform.\n\n" +
-			"Use /login to start the authentication process.",
+			"Use /login to start the authentication process.\n\n" +
+			"Other commands:\n" +
+			"/today - See today's problems\n" +
+			"/problems - See today's problems with your scores\n" +
+			"/status - See your rank, score and streak\n" +
+			"/leaderboard - See the top 10\n" +
+			"/subscribe - Get a message when a new day unlocks\n" +
+			"/unsubscribe - Stop new day messages",
 	)
 }
 
 // handleLogin handles the /login command
 func (b *Bot) handleLogin(c telebot.Context) error {
-	userID := c.Sender().ID
-
 	// Check if we already have this user's phone number
-	state, exists := userStates[userID]
+	state, err := b.userState(c.Sender().ID)
+	if err != nil {
+		log.Printf("Error loading bot state for %d: %v", c.Sender().ID, err)
+		return c.Send("An error occurred. Please try again later.")
+	}
 
 	// If user hasn't shared their phone number yet
-	if !exists || state == nil || state.PhoneNumber == "" {
+	if state == nil || state.PhoneNumber == "" {
 		// Create a custom keyboard for phone number sharing
 		kb := &telebot.ReplyMarkup{ResizeKeyboard: true}
 		shareBtn := kb.Contact("📱 Share Phone Number")
@@ -129,28 +212,13 @@ func (b *Bot) handleLogin(c telebot.Context) error {
 	}
 
 	// User already has shared their phone number before, generate a new OTP
-	// Generate OTP
-	otp := generateOTP()
-	state.OTP = otp
-
-	// Store OTP in Redis with expiration (5 minutes) if Redis is available
-	if b.redis != nil && b.redis.Client != nil {
-		err := b.redis.StoreOTP(state.PhoneNumber, otp, 5*time.Minute)
-		if err != nil {
-			// Log the error in production
-			log.Printf("Error storing OTP in Redis: %v", err)
-			return c.Send("An error occurred while storing OTP. Please try again later.")
-		}
-	} else {
-		// In development mode without Redis
-		if storeFunc, ok := b.devOTPStore.(func(string, string)); ok {
-			storeFunc(state.PhoneNumber, otp)
-		}
-		log.Printf("Development mode: OTP for %s is %s", state.PhoneNumber, otp)
+	otp, err := b.issueOTP(state.PhoneNumber)
+	if err != nil {
+		return b.sendIssueError(c, state.PhoneNumber, err)
 	}
 
 	// Send verification message with OTP and quick login links
-	return b.sendVerificationMessage(c, state.PhoneNumber, otp)
+	return c.Send(b.verificationMessage(state.PhoneNumber, otp), &telebot.SendOptions{ParseMode: telebot.ModeMarkdown})
 }
 
 // handleContact handles phone number sharing
@@ -173,47 +241,36 @@ func (b *Bot) handleContact(c telebot.Context) error {
 		return c.Send("Could not get your phone number. Please try again with /login.")
 	}
 
-	// Create or update user state
-	state := userStates[userID]
-	if state == nil {
-		state = &PhoneState{}
-		userStates[userID] = state
+	// Store the username if available, otherwise use a default name
+	username := c.Sender().Username
+	if username == "" {
+		username = "User"
+	}
+
+	// Remember the phone number, and link it to the user's account so it can
+	// be recovered once the state expires
+	state := &PhoneState{PhoneNumber: phoneNumber, FullName: username}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := b.states.Set(ctx, userID, state); err != nil {
+		log.Printf("Error storing bot state for %d: %v", userID, err)
+	}
+	if err := b.linkTelegramAccount(ctx, userID, phoneNumber); err != nil {
+		log.Printf("Error linking Telegram account %d to %s: %v", userID, phoneNumber, err)
 	}
-	state.PhoneNumber = phoneNumber
 
 	// Remove custom keyboard
 	kb := &telebot.ReplyMarkup{RemoveKeyboard: true}
 	c.Send("Thank you!", kb)
 
 	// Generate OTP immediately
-	otp := generateOTP()
-	state.OTP = otp
-
-	// Store the username if available, otherwise use a default name
-	username := c.Sender().Username
-	if username == "" {
-		username = "User"
-	}
-	state.FullName = username
-
-	// Store OTP in Redis with expiration (5 minutes) if Redis is available
-	if b.redis != nil && b.redis.Client != nil {
-		err := b.redis.StoreOTP(state.PhoneNumber, otp, 5*time.Minute)
-		if err != nil {
-			// Log the error in production
-			log.Printf("Error storing OTP in Redis: %v", err)
-			return c.Send("An error occurred while storing OTP. Please try again later.")
-		}
-	} else {
-		// In development mode without Redis
-		if storeFunc, ok := b.devOTPStore.(func(string, string)); ok {
-			storeFunc(state.PhoneNumber, otp)
-		}
-		log.Printf("Development mode: OTP for %s is %s", state.PhoneNumber, otp)
+	otp, err := b.issueOTP(state.PhoneNumber)
+	if err != nil {
+		return b.sendIssueError(c, state.PhoneNumber, err)
 	}
 
 	// Send verification message with OTP and quick login links
-	return b.sendVerificationMessage(c, state.PhoneNumber, otp)
+	return c.Send(b.verificationMessage(state.PhoneNumber, otp), &telebot.SendOptions{ParseMode: telebot.ModeMarkdown})
 }
 
 // handleText handles text messages
@@ -225,8 +282,10 @@ func (b *Bot) handleText(c telebot.Context) error {
 		return b.handleLogin(c)
 	}
 
-	userID := c.Sender().ID
-	state := userStates[userID]
+	state, err := b.userState(c.Sender().ID)
+	if err != nil {
+		log.Printf("Error loading bot state for %d: %v", c.Sender().ID, err)
+	}
 
 	// If no active state or phone number, ask to start login process
 	if state == nil || state.PhoneNumber == "" {
@@ -237,18 +296,20 @@ func (b *Bot) handleText(c telebot.Context) error {
 	return c.Send("Need a new login code? Use /login to get one.\n\nIf you're having issues, try /start to restart the bot.")
 }
 
-// SetDevOTPStore sets the function to use for development mode OTP storage
-func (b *Bot) SetDevOTPStore(storeFunc interface{}) {
-	b.devOTPStore = storeFunc
+// sendIssueError tells the user why they didn't get a code
+func (b *Bot) sendIssueError(c telebot.Context, phoneNumber string, err error) error {
+	var limitErr *auth.OTPLimitError
+	if errors.As(err, &limitErr) {
+		minutes := int((limitErr.RetryAfter + time.Minute - 1) / time.Minute)
+		return c.Send(fmt.Sprintf("You've asked for too many codes. Please try again in %d min.", minutes))
+	}
+	log.Printf("Error issuing OTP for %s: %v", phoneNumber, err)
+	return c.Send("An error occurred while generating your code. Please try again later.")
 }
 
-// generateOTP generates a 6-digit random OTP
-func generateOTP() string {
-	// Seed the random number generator
-	rand.New(rand.NewSource(time.Now().UnixNano()))
-
-	// Generate a random number between 100000 and 999999
-	otp := 100000 + rand.Intn(900000)
-
-	return fmt.Sprintf("%06d", otp)
+// issueOTP generates a new login code for a phone number
+func (b *Bot) issueOTP(phoneNumber string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return b.otp.Issue(ctx, phoneNumber)
 }
@@ -0,0 +1,177 @@
+package telegrambot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/globallstudent/academy/internal/problems"
+	"gopkg.in/telebot.v3"
+)
+
+const (
+	// unlockCheckInterval is how often the scheduler looks for days that unlocked
+	unlockCheckInterval = 30 * time.Second
+	// unlockCatchUp is how late an unlock is still announced, e.g. when the
+	// server was down at the time. Older unlocks are never announced.
+	unlockCatchUp = 6 * time.Hour
+	// unlockTimeFormat is how unlock times are shown to students
+	unlockTimeFormat = "Mon 2 Jan, 15:04 MST"
+	// unlockClaimTimeout is how long a claim on an announcement lasts. A
+	// replica that stopped while sending leaves its claim behind, and another
+	// one may take over once it expires.
+	unlockClaimTimeout = 30 * time.Minute
+)
+
+// runUnlockScheduler announces each day to subscribers when it unlocks,
+// until ctx is cancelled
+func (b *Bot) runUnlockScheduler(ctx context.Context) {
+	ticker := time.NewTicker(unlockCheckInterval)
+	defer ticker.Stop()
+	for {
+		b.announceUnlocks(ctx)
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// announceUnlocks sends the announcement for every day that unlocked recently
+// and hasn't been announced yet
+func (b *Bot) announceUnlocks(ctx context.Context) {
+	now := time.Now()
+	days := b.catalog.Days()
+	for i := range days {
+		day := &days[i]
+		if day.UnlockDate.IsZero() || day.UnlockDate.After(now) || now.Sub(day.UnlockDate) > unlockCatchUp {
+			continue
+		}
+
+		claimed, err := b.claimUnlockAnnouncement(ctx, day.Day)
+		if err != nil {
+			log.Printf("Error claiming day %d unlock announcement: %v", day.Day, err)
+			continue
+		}
+		if !claimed {
+			continue
+		}
+
+		chatIDs, err := b.subscribers(ctx)
+		if err != nil {
+			log.Printf("Error listing subscribers for day %d: %v", day.Day, err)
+			b.releaseUnlockAnnouncement(day.Day)
+			continue
+		}
+		message := fmt.Sprintf("🔓 Day %d is open!\n\n%s", day.Day, b.dayMessage(day))
+		sent := b.notifyAll(ctx, chatIDs, message, &telebot.SendOptions{DisableWebPagePreview: true})
+		if sent == 0 && ctx.Err() != nil {
+			// Stopped before anyone got the message, so it can be sent again
+			b.releaseUnlockAnnouncement(day.Day)
+			return
+		}
+		b.finishUnlockAnnouncement(day.Day)
+		log.Printf("Announced day %d to %d of %d subscribers", day.Day, sent, len(chatIDs))
+	}
+}
+
+// claimUnlockAnnouncement marks a day as being announced. Only one caller
+// gets true until the announcement is finished or released, or the claim
+// expires, so a day is announced once even with several replicas or restarts.
+func (b *Bot) claimUnlockAnnouncement(ctx context.Context, day int) (bool, error) {
+	tag, err := b.db.Pool.Exec(ctx, `
+		INSERT INTO unlock_announcements (day, state, claimed_at) VALUES ($1, 'sending', now())
+		ON CONFLICT (day) DO UPDATE SET claimed_at = now()
+		WHERE unlock_announcements.state = 'sending'
+			AND unlock_announcements.claimed_at < now() - make_interval(secs => $2)`,
+		day, unlockClaimTimeout.Seconds())
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// finishUnlockAnnouncement records that a day has been announced. If that
+// fails, the claim expires and the day may be announced again.
+func (b *Bot) finishUnlockAnnouncement(day int) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := b.db.Pool.Exec(ctx, `
+		UPDATE unlock_announcements SET state = 'sent', sent_at = now()
+		WHERE day = $1`, day)
+	if err != nil {
+		log.Printf("Error recording day %d unlock announcement: %v", day, err)
+	}
+}
+
+// releaseUnlockAnnouncement drops the claim on a day that wasn't announced,
+// so the next check tries again. If that fails, the claim expires instead.
+func (b *Bot) releaseUnlockAnnouncement(day int) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := b.db.Pool.Exec(ctx, `
+		DELETE FROM unlock_announcements WHERE day = $1 AND state = 'sending'`, day)
+	if err != nil {
+		log.Printf("Error releasing day %d unlock announcement: %v", day, err)
+	}
+}
+
+// dayMessage describes a day and links its problems
+func (b *Bot) dayMessage(day *problems.Day) string {
+	var sb strings.Builder
+	sb.WriteString(day.Title)
+	sb.WriteString("\n")
+	if day.Description != "" {
+		sb.WriteString("\n" + day.Description + "\n")
+	}
+	sb.WriteString("\n")
+	for _, problem := range day.Problems {
+		fmt.Fprintf(&sb, "• %s (%s): %s/problems/%s\n", problem.Title, problem.Type, b.serverURL, problem.Slug)
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}
+
+// currentDay returns the latest day unlocked at now and the next day to
+// unlock. Either is nil if there is no such day.
+func (b *Bot) currentDay(now time.Time) (current, next *problems.Day) {
+	days := b.catalog.Days()
+	for i := range days {
+		day := &days[i]
+		if !day.UnlockDate.After(now) {
+			if current == nil || day.UnlockDate.After(current.UnlockDate) {
+				current = day
+			}
+		} else if next == nil || day.UnlockDate.Before(next.UnlockDate) {
+			next = day
+		}
+	}
+	return current, next
+}
+
+// handleToday handles the /today command: it shows the latest unlocked day
+// and when the next one opens
+func (b *Bot) handleToday(c telebot.Context) error {
+	current, next := b.currentDay(time.Now())
+
+	var sb strings.Builder
+	if current != nil {
+		fmt.Fprintf(&sb, "📅 Day %d\n\n%s\n", current.Day, b.dayMessage(current))
+	} else {
+		sb.WriteString("Nothing has unlocked yet.\n")
+	}
+	if next != nil {
+		fmt.Fprintf(&sb, "\n⏭ Day %d unlocks %s.", next.Day, next.UnlockDate.UTC().Format(unlockTimeFormat))
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if subscribed, err := b.isSubscribed(ctx, c.Sender().ID); err == nil && !subscribed {
+			sb.WriteString(" Use /subscribe to get a message when it does.")
+		}
+	} else if current != nil {
+		sb.WriteString("\nThis is the last day. 🎉")
+	}
+
+	return c.Send(sb.String(), &telebot.SendOptions{DisableWebPagePreview: true})
+}
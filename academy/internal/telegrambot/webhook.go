@@ -0,0 +1,97 @@
+package telegrambot
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/telebot.v3"
+)
+
+const (
+	// WebhookPath is where Telegram posts updates in webhook mode. The secret
+	// only travels in a header, so it never shows up in request logs.
+	WebhookPath = "/telegram/webhook"
+
+	// secretTokenHeader carries the secret token Telegram was given with setWebhook
+	secretTokenHeader = "X-Telegram-Bot-Api-Secret-Token"
+
+	// maxUpdateSize bounds the body of a webhook request
+	maxUpdateSize = 1 << 20
+)
+
+// newWebhookSecret generates a secret for when none is configured. Telegram
+// allows letters, digits, "_" and "-" in secret tokens.
+func newWebhookSecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// webhookPoller registers the webhook with Telegram when the bot starts and
+// then waits to be stopped; updates arrive through HandleWebhook. telebot's
+// own Webhook poller can't be used without its listener, as it panics on Stop.
+type webhookPoller struct {
+	webhook *telebot.Webhook
+}
+
+func newWebhookPoller(baseURL, secret string) *webhookPoller {
+	return &webhookPoller{webhook: &telebot.Webhook{
+		SecretToken: secret,
+		Endpoint: &telebot.WebhookEndpoint{
+			PublicURL: strings.TrimRight(baseURL, "/") + WebhookPath,
+		},
+	}}
+}
+
+// Poll implements telebot.Poller
+func (p *webhookPoller) Poll(b *telebot.Bot, dest chan telebot.Update, stop chan struct{}) {
+	if err := b.SetWebhook(p.webhook); err != nil {
+		log.Printf("Failed to register Telegram webhook: %v", err)
+	}
+	<-stop
+}
+
+// UsesWebhook reports whether the bot receives updates through HandleWebhook
+// rather than long polling
+func (b *Bot) UsesWebhook() bool {
+	return b.webhookSecret != ""
+}
+
+// HandleWebhook receives an update from Telegram and hands it to the bot's
+// handlers. Telegram's secret-token header must carry the secret the webhook
+// was registered with, so updates can't be forged.
+func (b *Bot) HandleWebhook(c *gin.Context) {
+	if !b.UsesWebhook() || !secretsMatch(c.GetHeader(secretTokenHeader), b.webhookSecret) {
+		c.Status(http.StatusUnauthorized)
+		return
+	}
+
+	var update telebot.Update
+	if err := json.NewDecoder(http.MaxBytesReader(c.Writer, c.Request.Body, maxUpdateSize)).Decode(&update); err != nil {
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	// Telegram retries updates that aren't acknowledged, so a full queue can
+	// refuse them rather than hold the request open
+	select {
+	case b.bot.Updates <- update:
+		c.Status(http.StatusOK)
+	default:
+		log.Printf("Telegram update queue is full, asking Telegram to retry update %d", update.ID)
+		c.Status(http.StatusServiceUnavailable)
+	}
+}
+
+// secretsMatch compares secrets in constant time
+func secretsMatch(got, want string) bool {
+	return subtle.ConstantTimeCompare([]byte(got), []byte(want)) == 1
+}
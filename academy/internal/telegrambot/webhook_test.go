@@ -0,0 +1,140 @@
+package telegrambot
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/telebot.v3"
+)
+
+const testWebhookSecret = "webhook-secret_1"
+
+// webhookRouter serves HandleWebhook on WebhookPath for a bot whose update
+// queue holds one update
+func webhookRouter(t *testing.T, secret string) (*gin.Engine, *telebot.Bot) {
+	t.Helper()
+	tb, err := telebot.NewBot(telebot.Settings{Token: "123456:test", Offline: true, Updates: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &Bot{bot: tb, webhookSecret: secret}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST(WebhookPath, b.HandleWebhook)
+	return r, tb
+}
+
+func TestHandleWebhook(t *testing.T) {
+	tests := []struct {
+		name        string
+		botSecret   string // empty when the bot long-polls
+		path        string
+		header      string
+		body        string
+		queueFull   bool
+		wantStatus  int
+		wantUpdates int
+	}{
+		{
+			name:        "good header",
+			botSecret:   testWebhookSecret,
+			path:        WebhookPath,
+			header:      testWebhookSecret,
+			body:        `{"update_id": 1}`,
+			wantStatus:  http.StatusOK,
+			wantUpdates: 1,
+		},
+		{
+			name:       "bad header",
+			botSecret:  testWebhookSecret,
+			path:       WebhookPath,
+			header:     "guess",
+			body:       `{"update_id": 1}`,
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "missing header",
+			botSecret:  testWebhookSecret,
+			path:       WebhookPath,
+			body:       `{"update_id": 1}`,
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "secret in the path",
+			botSecret:  testWebhookSecret,
+			path:       WebhookPath + "/" + testWebhookSecret,
+			header:     testWebhookSecret,
+			body:       `{"update_id": 1}`,
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "other path",
+			botSecret:  testWebhookSecret,
+			path:       "/telegram/hook",
+			header:     testWebhookSecret,
+			body:       `{"update_id": 1}`,
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "bot is long-polling",
+			path:       WebhookPath,
+			body:       `{"update_id": 1}`,
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "malformed update",
+			botSecret:  testWebhookSecret,
+			path:       WebhookPath,
+			header:     testWebhookSecret,
+			body:       `{"update_id":`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:        "queue full",
+			botSecret:   testWebhookSecret,
+			path:        WebhookPath,
+			header:      testWebhookSecret,
+			body:        `{"update_id": 2}`,
+			queueFull:   true,
+			wantStatus:  http.StatusServiceUnavailable,
+			wantUpdates: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router, tb := webhookRouter(t, tt.botSecret)
+			if tt.queueFull {
+				tb.Updates <- telebot.Update{ID: 1}
+			}
+
+			req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+			if tt.header != "" {
+				req.Header.Set(secretTokenHeader, tt.header)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if got := len(tb.Updates); got != tt.wantUpdates {
+				t.Errorf("%d updates queued, want %d", got, tt.wantUpdates)
+			}
+		})
+	}
+}
+
+func TestWebhookURLHasNoSecret(t *testing.T) {
+	p := newWebhookPoller("https://academy.example.com/", testWebhookSecret)
+	if got, want := p.webhook.Endpoint.PublicURL, "https://academy.example.com/telegram/webhook"; got != want {
+		t.Errorf("webhook URL = %q, want %q", got, want)
+	}
+	if p.webhook.SecretToken != testWebhookSecret {
+		t.Errorf("secret token = %q, want %q", p.webhook.SecretToken, testWebhookSecret)
+	}
+}
@@ -5,16 +5,18 @@ set -e
 # Docker Hub username
 DOCKER_USER=globalstudent
 
-# Build base image first
+DOCKER_DIR=$(cd "$(dirname "$0")" && pwd)
+
+# Build base image first; it compiles wbfy, so its context is the repository root
 echo "Building base image..."
-cd $(dirname "$0")/wbfy-base
-docker build -t $DOCKER_USER/wbfy-base:latest .
+cd "$DOCKER_DIR/.."
+docker build -f docker/wbfy-base/Dockerfile -t $DOCKER_USER/wbfy-base:latest .
 docker push $DOCKER_USER/wbfy-base:latest
 
 # Build language-specific images
 for lang in python golang node; do
     echo "Building $lang image..."
-    cd $(dirname "$0")/wbfy-$lang
+    cd "$DOCKER_DIR/wbfy-$lang"
     docker build -t $DOCKER_USER/wbfy-$lang:latest .
     docker push $DOCKER_USER/wbfy-$lang:latest
 done
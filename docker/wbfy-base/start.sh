@@ -9,12 +9,13 @@ echo "Starting terminal environment for $PROBLEM_TYPE"
 echo "Session ID: $SESSION_ID"
 echo "Command: $WBFY_CMD"
 
-# If there's a setup.sh in the workspace, run it
-if [ -f "/workspace/setup.sh" ]; then
-    echo "Running setup script..."
-    chmod +x /workspace/setup.sh
-    /workspace/setup.sh
-fi
+# The workspace is the student's home directory. Problem setup scripts are run
+# by the academy once the terminal server is up, so they never sit in the
+# workspace where students could read them.
+export HOME=/workspace
 
-# Execute the command
-exec $WBFY_CMD
+# Serve the command in the browser through wbfy. wbfy loads its web assets
+# from its working directory and starts the command in the workspace.
+cd /opt/wbfy
+export PORT=8081 WBFY_WORKDIR=/workspace WBFY_NO_BROWSER=1
+exec ./wbfy $WBFY_CMD
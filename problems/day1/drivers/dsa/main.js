@@ -0,0 +1,13 @@
+const fs = require("fs");
+const vm = require("vm");
+
+// The solution is a plain function declaration, so run it in this context
+// rather than requiring it as a module
+vm.runInThisContext(fs.readFileSync(__dirname + "/solution.js", "utf8"), { filename: "solution.js" });
+
+let s = fs.readFileSync(0, "utf8");
+if (s.endsWith("\n")) {
+    s = s.slice(0, -1);
+}
+
+console.log(isPalindrome(s) ? "true" : "false");
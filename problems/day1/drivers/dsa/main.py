@@ -0,0 +1,9 @@
+import sys
+
+from solution import is_palindrome
+
+s = sys.stdin.read()
+if s.endswith("\n"):
+    s = s[:-1]
+
+print("true" if is_palindrome(s) else "false")
@@ -0,0 +1,14 @@
+#!/bin/bash
+# Setup for Day 1 Linux: File Navigation and Manipulation.
+#
+# Runs inside the student's container from the workspace (their home
+# directory) after the fixtures in env/linux have been copied in.
+set -e
+
+# Git can't track empty directories or every permission, so finish the layout here
+mkdir -p temp
+chmod 644 documents/report.txt
+chmod 600 documents/notes/meeting_notes.txt
+
+# Something for "ls -a" to find
+echo "Hidden files start with a dot." > .hidden_hint
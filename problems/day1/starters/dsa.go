@@ -0,0 +1,6 @@
+package main
+
+func IsPalindrome(s string) bool {
+	// Your code here
+	return false
+}
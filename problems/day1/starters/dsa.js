@@ -0,0 +1,3 @@
+function isPalindrome(s) {
+    // Your code here
+}
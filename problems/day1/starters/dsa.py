@@ -0,0 +1,3 @@
+def is_palindrome(s: str) -> bool:
+    # Your code here
+    pass
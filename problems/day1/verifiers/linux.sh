@@ -0,0 +1,60 @@
+#!/bin/bash
+# Verifier for Day 1 Linux: File Navigation and Manipulation.
+#
+# Runs inside the student's container from the workspace root and prints one
+# line per check: "PASS <id>" or "FAIL <id> <reason>". Tasks that only print
+# something are graded from the commands written down in linux_commands.txt.
+
+check() {
+    local id=$1 reason=$2
+    shift 2
+    if "$@" >/dev/null 2>&1; then
+        echo "PASS $id"
+    else
+        echo "FAIL $id $reason"
+    fi
+}
+
+mode_is() {
+    [ "$(stat -c '%a' "$1" 2>/dev/null)" = "$2" ]
+}
+
+answered() {
+    [ -f linux_commands.txt ] && grep -Eq "$1" linux_commands.txt
+}
+
+profile_moved() {
+    [ -f documents/profile.png ] && [ ! -e pictures/profile.png ]
+}
+
+notes_linked() {
+    local target link
+    target=$(readlink -f documents/notes) || return 1
+    for link in * .[!.]*; do
+        if [ -L "$link" ] && [ "$(readlink -f "$link")" = "$target" ]; then
+            return 0
+        fi
+    done
+    return 1
+}
+
+# 1. Directory Navigation
+check archive-dir "archive is not a directory in your home directory" test -d archive
+
+# 2. File Operations
+check todo-content "todo.txt should contain \"Learn Linux commands\"" grep -qx "Learn Linux commands" todo.txt
+check report-copied "archive/report.txt is not a copy of documents/report.txt" cmp -s documents/report.txt archive/report.txt
+check profile-moved "profile.png should be in documents and no longer in pictures" profile_moved
+check notes-link "No symbolic link to documents/notes in your home directory" notes_linked
+check meeting-appended "meeting_notes.txt doesn't contain \"Meeting scheduled for Friday\"" grep -q "Meeting scheduled for Friday" documents/notes/meeting_notes.txt
+
+# 3. Text Search
+check search-meeting "No recursive grep for \"meeting\" in linux_commands.txt" answered 'grep .*(-[a-zA-Z]*[rR]|--recursive).*meeting|grep .*meeting.*(-[a-zA-Z]*[rR]|--recursive)'
+check count-lines "No line count of report.txt in linux_commands.txt" answered 'wc +-l.*report\.txt|report\.txt.*\| *wc +-l'
+check first-lines "No command showing the first 5 lines of report.txt in linux_commands.txt" answered 'head +(-n *5|-5)\b.*report\.txt|head .*report\.txt +(-n *5|-5)\b'
+check find-txt "No find command for .txt files in linux_commands.txt" answered "find .*-i?name +['\"]?\*\.txt"
+
+# 4. File Permissions
+check todo-mode "todo.txt should be readable and writable by its owner only (600)" mode_is todo.txt 600
+check notes-mode "meeting_notes.txt should be readable by everyone and writable by its owner only (644)" mode_is documents/notes/meeting_notes.txt 644
+check list-permissions "No long listing of documents in linux_commands.txt" answered 'ls +-[a-zA-Z]*l[a-zA-Z]* .*documents'
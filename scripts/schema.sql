@@ -5,6 +5,7 @@ CREATE TABLE IF NOT EXISTS users (
     id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
     phone_number TEXT UNIQUE NOT NULL,
     telegram_id TEXT,
+    email TEXT,
     username TEXT NOT NULL,
     registered_at TIMESTAMP WITH TIME ZONE DEFAULT now(),
     role TEXT NOT NULL DEFAULT 'user'
@@ -29,9 +30,19 @@ CREATE TABLE IF NOT EXISTS submissions (
     status TEXT NOT NULL,
     output TEXT,
     score INTEGER NOT NULL DEFAULT 0,
+    sections JSONB,
+    code TEXT,
     submitted_at TIMESTAMP WITH TIME ZONE DEFAULT now()
 );
 
+-- Databases created before submissions were scored by section
+ALTER TABLE submissions ADD COLUMN IF NOT EXISTS sections JSONB;
+-- Databases created before login codes could be emailed
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email TEXT;
+-- Databases created before submissions could be rejudged
+ALTER TABLE submissions ADD COLUMN IF NOT EXISTS code TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_users_telegram ON users(telegram_id);
 CREATE INDEX IF NOT EXISTS idx_submissions_user ON submissions(user_id);
 CREATE INDEX IF NOT EXISTS idx_submissions_problem ON submissions(problem_id);
 
@@ -52,4 +63,60 @@ CREATE TABLE IF NOT EXISTS contest_participants (
     PRIMARY KEY(contest_id, user_id)
 );
 
+CREATE TABLE IF NOT EXISTS terminal_sessions (
+    id TEXT PRIMARY KEY,
+    user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+    problem_id UUID NOT NULL,
+    problem_slug TEXT NOT NULL,
+    port INTEGER NOT NULL,
+    address TEXT NOT NULL DEFAULT '',
+    container_id TEXT NOT NULL,
+    container_name TEXT NOT NULL,
+    command TEXT NOT NULL,
+    language TEXT NOT NULL,
+    temp_dir TEXT NOT NULL,
+    secret TEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT now(),
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    state TEXT NOT NULL DEFAULT 'provisioning',
+    failure_reason TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS idx_terminal_sessions_user ON terminal_sessions(user_id);
+
+CREATE TABLE IF NOT EXISTS telegram_subscriptions (
+    telegram_id TEXT PRIMARY KEY,
+    subscribed_at TIMESTAMP WITH TIME ZONE DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS unlock_announcements (
+    day INTEGER PRIMARY KEY,
+    state TEXT NOT NULL DEFAULT 'sending',
+    claimed_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+    sent_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE TABLE IF NOT EXISTS announcements (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    message TEXT NOT NULL,
+    contest_id UUID REFERENCES contests(id) ON DELETE CASCADE,
+    telegram BOOLEAN NOT NULL DEFAULT true,
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT now(),
+    published_at TIMESTAMP WITH TIME ZONE,
+    retracted_at TIMESTAMP WITH TIME ZONE,
+    recipients INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE INDEX IF NOT EXISTS idx_announcements_published ON announcements(published_at);
+
+CREATE TABLE IF NOT EXISTS role_changes (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    old_role TEXT NOT NULL,
+    new_role TEXT NOT NULL,
+    changed_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    changed_at TIMESTAMP WITH TIME ZONE DEFAULT now()
+);
 
+CREATE INDEX IF NOT EXISTS idx_role_changes_changed ON role_changes(changed_at);
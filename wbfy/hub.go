@@ -0,0 +1,429 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"unsafe"
+
+	"github.com/gorilla/websocket"
+)
+
+// Role describes what an attached client is allowed to do with the terminal
+type Role string
+
+const (
+	// RoleOwner is the student who owns the session (read-write)
+	RoleOwner Role = "owner"
+	// RoleObserver can only watch the terminal output
+	RoleObserver Role = "observer"
+	// RoleMentor watches the terminal and may request control from the owner
+	RoleMentor Role = "mentor"
+)
+
+// parseRole converts a query parameter into a Role, defaulting to owner
+func parseRole(s string) (Role, bool) {
+	switch Role(s) {
+	case "", RoleOwner:
+		return RoleOwner, true
+	case RoleObserver:
+		return RoleObserver, true
+	case RoleMentor:
+		return RoleMentor, true
+	default:
+		return "", false
+	}
+}
+
+// signClient returns the token a client must present to attach with the given role and name.
+// The academy computes the same value with the session secret it hands over in WBFY_SECRET_FILE.
+func signClient(secret, role, name string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(role + ":" + name))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Client is a single WebSocket connection attached to the terminal
+type Client struct {
+	ID   string
+	Name string
+	Role Role
+	ws   *websocket.Conn
+	send chan frame
+}
+
+// frame is one WebSocket message queued for a client. Terminal output goes out
+// in binary frames and JSON control messages in text frames, so nothing a
+// program prints can be mistaken for a control message.
+type frame struct {
+	kind int // websocket.BinaryMessage or websocket.TextMessage
+	data []byte
+}
+
+// outputFrame wraps terminal output for sending
+func outputFrame(data []byte) frame {
+	return frame{kind: websocket.BinaryMessage, data: data}
+}
+
+// controlFrame wraps a JSON control message for sending
+func controlFrame(msg []byte) frame {
+	return frame{kind: websocket.TextMessage, data: msg}
+}
+
+// endedNotice is the last output of every session, written once the command exits
+var endedNotice = []byte("\r\n\x1b[33m[ Terminal session ended ]\x1b[0m\r\n")
+
+// ClientInfo is the public view of a client sent in presence updates
+type ClientInfo struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Role    Role   `json:"role"`
+	Control bool   `json:"control"`
+}
+
+// Hub fans PTY output out to every attached client and decides whose input reaches the PTY.
+// It keeps draining the PTY while nobody is attached, recording output in the scrollback.
+type Hub struct {
+	ptmx *os.File
+
+	mu         sync.Mutex
+	scrollback *Scrollback
+	clients    map[string]*Client
+	nextID     int
+	controller string // ID of the mentor currently holding control, empty means owners type
+	closed     bool
+}
+
+// NewHub creates a hub for the given PTY, retaining up to scrollbackBytes of output for replay
+func NewHub(ptmx *os.File, scrollbackBytes int) *Hub {
+	return &Hub{
+		ptmx:       ptmx,
+		scrollback: NewScrollback(scrollbackBytes),
+		clients:    make(map[string]*Client),
+	}
+}
+
+// Run reads from the PTY until it closes and broadcasts everything to attached clients
+func (h *Hub) Run() {
+	buf := make([]byte, 1024)
+	for {
+		n, err := h.ptmx.Read(buf)
+		if err != nil {
+			log.Println("PTY read error:", err)
+			break
+		}
+
+		data := make([]byte, n)
+		copy(data, buf[:n])
+		h.output(data)
+	}
+
+	// Let everyone know the terminal is gone, then drop them
+	h.output(endedNotice)
+	h.mu.Lock()
+	h.closed = true
+	for _, c := range h.clients {
+		close(c.send)
+	}
+	h.clients = make(map[string]*Client)
+	h.mu.Unlock()
+	log.Println("PTY read loop ended")
+}
+
+// Attach registers a new client and starts its writer goroutine.
+// The client first receives the output it missed since the given sequence number
+// (everything retained when since is 0), then a "hello" carrying the sequence
+// number the live stream continues from.
+func (h *Hub) Attach(ws *websocket.Conn, name string, role Role, since uint64) (*Client, bool) {
+	h.mu.Lock()
+	if h.closed {
+		// The PTY is gone, but the client can still read what it missed,
+		// which ends with the notice that the session is over
+		replay, _ := h.scrollback.Since(since)
+		h.mu.Unlock()
+		if len(replay) > 0 {
+			ws.WriteMessage(websocket.BinaryMessage, replay)
+		}
+		return nil, false
+	}
+
+	h.nextID++
+	c := &Client{
+		ID:   fmt.Sprintf("c%d", h.nextID),
+		Name: name,
+		Role: role,
+		ws:   ws,
+		send: make(chan frame, 256),
+	}
+
+	// Queue the replay and hello before registering so no live output can slip in between
+	replay, truncated := h.scrollback.Since(since)
+	if truncated {
+		c.send <- outputFrame([]byte("\r\n\x1b[33m[ Some earlier output was discarded ]\x1b[0m\r\n"))
+	}
+	if len(replay) > 0 {
+		c.send <- outputFrame(replay)
+	}
+	hello, _ := json.Marshal(map[string]interface{}{
+		"type": "hello",
+		"id":   c.ID,
+		"role": c.Role,
+		"seq":  h.scrollback.Seq(),
+	})
+	c.send <- controlFrame(hello)
+
+	h.clients[c.ID] = c
+	h.mu.Unlock()
+
+	go c.writeLoop()
+
+	h.broadcastPresence()
+
+	log.Printf("Client %s (%s, %s) attached", c.ID, c.Name, c.Role)
+	return c, true
+}
+
+// Detach removes a client, returning control to the owners if it held it
+func (h *Hub) Detach(c *Client) {
+	h.mu.Lock()
+	if _, ok := h.clients[c.ID]; !ok {
+		h.mu.Unlock()
+		return
+	}
+	delete(h.clients, c.ID)
+	close(c.send)
+	if h.controller == c.ID {
+		h.controller = ""
+	}
+	h.mu.Unlock()
+
+	h.broadcastPresence()
+	log.Printf("Client %s (%s) detached", c.ID, c.Name)
+}
+
+// Alive reports whether the command is still running
+func (h *Hub) Alive() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return !h.closed
+}
+
+// HandleMessage processes a single message received from a client
+func (h *Hub) HandleMessage(c *Client, msgType int, msg []byte) {
+	if msgType == websocket.TextMessage {
+		text := string(msg)
+
+		// Handle resize messages sent as special string format: "RESIZE:cols,rows"
+		// This is a simple approach that avoids needing json parsing
+		if len(text) > 7 && text[:7] == "RESIZE:" {
+			if h.canWrite(c) {
+				h.resize(text[7:])
+			}
+			return
+		}
+
+		// Control messages use the same style: "CONTROL:action[:clientID]"
+		if len(text) > 8 && text[:8] == "CONTROL:" {
+			h.handleControl(c, text[8:])
+			return
+		}
+	}
+
+	if !h.canWrite(c) {
+		return
+	}
+
+	if _, err := h.ptmx.Write(msg); err != nil {
+		log.Println("PTY write error:", err)
+	}
+}
+
+// canWrite reports whether input from the client should reach the PTY
+func (h *Hub) canWrite(c *Client) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.controller != "" {
+		return c.ID == h.controller
+	}
+	return c.Role == RoleOwner
+}
+
+// handleControl implements the mentor request-control flow
+func (h *Hub) handleControl(c *Client, action string) {
+	var target string
+	if i := strings.IndexByte(action, ':'); i >= 0 {
+		action, target = action[:i], action[i+1:]
+	}
+
+	switch action {
+	case "request":
+		// Mentors ask, owners decide
+		if c.Role != RoleMentor {
+			return
+		}
+		h.sendToRole(RoleOwner, map[string]interface{}{
+			"type": "control_request",
+			"from": ClientInfo{ID: c.ID, Name: c.Name, Role: c.Role},
+		})
+
+	case "grant":
+		if c.Role != RoleOwner {
+			return
+		}
+		h.mu.Lock()
+		mentor, ok := h.clients[target]
+		if ok && mentor.Role == RoleMentor {
+			h.controller = mentor.ID
+		}
+		h.mu.Unlock()
+		h.broadcastPresence()
+
+	case "deny":
+		if c.Role != RoleOwner {
+			return
+		}
+		h.mu.Lock()
+		mentor, ok := h.clients[target]
+		h.mu.Unlock()
+		if ok {
+			h.sendJSON(mentor, map[string]interface{}{"type": "control_denied"})
+		}
+
+	case "release", "revoke":
+		// The mentor hands control back, or an owner takes it back
+		h.mu.Lock()
+		if h.controller == c.ID || c.Role == RoleOwner {
+			h.controller = ""
+		}
+		h.mu.Unlock()
+		h.broadcastPresence()
+	}
+}
+
+// resize applies a "cols,rows" window size to the PTY
+func (h *Hub) resize(spec string) {
+	var cols, rows uint16
+	_, err := fmt.Sscanf(spec, "%d,%d", &cols, &rows)
+	if err != nil || cols == 0 || rows == 0 {
+		return
+	}
+
+	ws := &Winsize{
+		Rows: rows,
+		Cols: cols,
+	}
+
+	// TIOCSWINSZ is the ioctl request code for setting window size
+	const TIOCSWINSZ = 0x5414
+	syscall.Syscall(
+		syscall.SYS_IOCTL,
+		h.ptmx.Fd(),
+		uintptr(TIOCSWINSZ),
+		uintptr(unsafe.Pointer(ws)),
+	)
+	log.Printf("Resized terminal to %dx%d", cols, rows)
+}
+
+// output records a chunk of terminal output in the scrollback and sends it to every client
+func (h *Hub) output(data []byte) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.scrollback.Append(data)
+	h.broadcastLocked(outputFrame(data))
+}
+
+// broadcast queues a control message for every attached client
+func (h *Hub) broadcast(msg []byte) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.broadcastLocked(controlFrame(msg))
+}
+
+// broadcastLocked queues a frame for every attached client; h.mu must be held
+func (h *Hub) broadcastLocked(f frame) {
+	for id, c := range h.clients {
+		select {
+		case c.send <- f:
+		default:
+			// Client can't keep up; drop it rather than stall the PTY
+			log.Printf("Client %s is too slow, disconnecting", id)
+			delete(h.clients, id)
+			close(c.send)
+			if h.controller == id {
+				h.controller = ""
+			}
+		}
+	}
+}
+
+// broadcastPresence tells every client who is connected and who holds control
+func (h *Hub) broadcastPresence() {
+	h.mu.Lock()
+	infos := make([]ClientInfo, 0, len(h.clients))
+	for _, c := range h.clients {
+		control := c.ID == h.controller || (h.controller == "" && c.Role == RoleOwner)
+		infos = append(infos, ClientInfo{ID: c.ID, Name: c.Name, Role: c.Role, Control: control})
+	}
+	h.mu.Unlock()
+
+	msg, _ := json.Marshal(map[string]interface{}{
+		"type":    "presence",
+		"clients": infos,
+	})
+	h.broadcast(msg)
+}
+
+// sendToRole sends a control message to every client with the given role
+func (h *Hub) sendToRole(role Role, v interface{}) {
+	h.mu.Lock()
+	var targets []*Client
+	for _, c := range h.clients {
+		if c.Role == role {
+			targets = append(targets, c)
+		}
+	}
+	h.mu.Unlock()
+
+	for _, c := range targets {
+		h.sendJSON(c, v)
+	}
+}
+
+// sendJSON queues a JSON control message for a single client
+func (h *Hub) sendJSON(c *Client, v interface{}) {
+	msg, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.clients[c.ID]; !ok {
+		return
+	}
+	select {
+	case c.send <- controlFrame(msg):
+	default:
+	}
+}
+
+// writeLoop is the only goroutine that writes to the client's WebSocket
+func (c *Client) writeLoop() {
+	for f := range c.send {
+		if err := c.ws.WriteMessage(f.kind, f.data); err != nil {
+			log.Println("WebSocket write error:", err)
+			break
+		}
+	}
+	c.ws.Close()
+}
@@ -1,13 +1,17 @@
 package main
 
 import (
+	"crypto/hmac"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
 	"os/exec"
-	"syscall"
-	"unsafe"
+	"path/filepath"
+	"strconv"
+	"strings"
 
 	"github.com/creack/pty"
 	"github.com/gorilla/websocket"
@@ -23,9 +27,71 @@ type Winsize struct {
 }
 
 var upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool {
-		return true // Allow all origins for development
-	},
+	CheckOrigin: checkOrigin,
+}
+
+// checkOrigin accepts browsers on the page wbfy serves itself and clients that
+// send no Origin at all, such as the academy's proxy. Tokens are still checked
+// for both; this only keeps other sites from attaching through a visitor's browser.
+func checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(u.Host, r.Host)
+}
+
+// loadSecret reads the client-signing secret from WBFY_SECRET_FILE and deletes
+// the file, so the command started afterwards can't read it. A relative path
+// is taken from WBFY_WORKDIR.
+func loadSecret() (string, error) {
+	path := os.Getenv("WBFY_SECRET_FILE")
+	if path == "" {
+		return "", nil
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(os.Getenv("WBFY_WORKDIR"), path)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	if err := os.Remove(path); err != nil {
+		return "", err
+	}
+
+	secret := strings.TrimSpace(string(data))
+	if secret == "" {
+		return "", fmt.Errorf("secret file %s is empty", path)
+	}
+	return secret, nil
+}
+
+// clientSecret returns the secret client tokens are checked against. It is
+// read before the command starts, and without one wbfy only runs in dev mode.
+func clientSecret() (string, error) {
+	secret, err := loadSecret()
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret: %w", err)
+	}
+	if secret == "" && os.Getenv("WBFY_DEV") == "" {
+		return "", errors.New("no WBFY_SECRET_FILE given; set WBFY_DEV=1 to accept unauthenticated clients for local development")
+	}
+	return secret, nil
+}
+
+// validToken reports whether a client may attach with role and name. Any
+// client may in dev mode, when there is no secret.
+func validToken(secret string, role Role, name, token string) bool {
+	if secret == "" {
+		return true
+	}
+	return hmac.Equal([]byte(signClient(secret, string(role), name)), []byte(token))
 }
 
 func main() {
@@ -34,119 +100,120 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Port to serve on; containers publish 8081
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = "8080"
+	}
+
+	// Clients must present a token signed with this secret for their role
+	secret, err := clientSecret()
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	// Create and start the command with PTY
 	cmd := exec.Command(os.Args[1], os.Args[2:]...)
+	// Run the command in the workspace when we're not already started there
+	cmd.Dir = os.Getenv("WBFY_WORKDIR")
 	ptmx, err := pty.Start(cmd)
 	if err != nil {
 		log.Fatal("Failed to start PTY:", err)
 	}
 	defer func() { _ = ptmx.Close() }()
 
+	// A single hub drains the PTY and fans output out to every attached client,
+	// keeping recent output so reconnecting clients can catch up
+	scrollbackBytes := 256 * 1024
+	if v, err := strconv.Atoi(os.Getenv("WBFY_SCROLLBACK")); err == nil && v > 0 {
+		scrollbackBytes = v
+	}
+	hub := NewHub(ptmx, scrollbackBytes)
+	go hub.Run()
+
 	// Setup HTTP server
 	http.Handle("/", http.FileServer(http.Dir("web")))
 
+	// Health check for supervisors: 200 while the command runs, 503 once it has exited
+	http.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		if !hub.Alive() {
+			http.Error(w, "session ended", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok"))
+	})
+
 	// WebSocket endpoint for terminal I/O
+	// Query parameters: role (owner, observer, mentor), name, token, and since
+	// (the last output sequence number seen, to resume after a reconnect)
 	http.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
 		log.Println("New WebSocket connection from:", r.RemoteAddr)
 
+		query := r.URL.Query()
+		role, ok := parseRole(query.Get("role"))
+		if !ok {
+			http.Error(w, "invalid role", http.StatusBadRequest)
+			return
+		}
+
+		name := query.Get("name")
+		if name == "" {
+			name = r.RemoteAddr
+		}
+
+		// Verify the client is allowed to attach with the requested role
+		if !validToken(secret, role, name, query.Get("token")) {
+			http.Error(w, "invalid token", http.StatusForbidden)
+			return
+		}
+
 		// Upgrade HTTP connection to WebSocket
 		ws, err := upgrader.Upgrade(w, r, nil)
 		if err != nil {
 			log.Println("WebSocket upgrade failed:", err)
 			return
 		}
-		defer ws.Close()
 
-		// Create channel to signal when PTY session ends
-		done := make(chan struct{})
+		// Resume after the last chunk the client saw, or replay everything we kept
+		since, _ := strconv.ParseUint(query.Get("since"), 10, 64)
 
-		// PTY → WebSocket: Read from PTY and send to WebSocket
-		go func() {
-			buf := make([]byte, 1024)
-			for {
-				n, err := ptmx.Read(buf)
-				if err != nil {
-					log.Println("PTY read error:", err)
-					break
-				}
-
-				if err := ws.WriteMessage(websocket.TextMessage, buf[:n]); err != nil {
-					log.Println("WebSocket write error:", err)
-					break
-				}
+		client, ok := hub.Attach(ws, name, role, since)
+		if !ok {
+			// The session is over; the hub has already replayed its final output
+			ws.Close()
+			return
+		}
+		defer hub.Detach(client)
+
+		// WebSocket → PTY: Read from WebSocket and hand it to the hub
+		for {
+			msgType, msg, err := ws.ReadMessage()
+			if err != nil {
+				log.Println("WebSocket read error:", err)
+				break
 			}
 
-			// Signal that PTY session has ended
-			close(done)
-			log.Println("PTY read loop ended for client:", r.RemoteAddr)
-		}()
-
-		// WebSocket → PTY: Read from WebSocket and write to PTY
-		go func() {
-			for {
-				msgType, msg, err := ws.ReadMessage()
-				if err != nil {
-					log.Println("WebSocket read error:", err)
-					break
-				}
-
-				// Debug input content
-				if len(msg) > 0 {
-					log.Printf("Received input: %d bytes", len(msg))
-				}
-
-				// Handle resize messages sent as special string format: "RESIZE:cols,rows"
-				// This is a simple approach that avoids needing json parsing
-				if msgType == websocket.TextMessage && len(msg) > 7 && string(msg[:7]) == "RESIZE:" {
-					// Extract cols and rows
-					var cols, rows uint16
-					_, err := fmt.Sscanf(string(msg[7:]), "%d,%d", &cols, &rows)
-					if err == nil && cols > 0 && rows > 0 {
-						ws := &Winsize{
-							Rows: rows,
-							Cols: cols,
-						}
-
-						// TIOCSWINSZ is the ioctl request code for setting window size
-						const TIOCSWINSZ = 0x5414
-						syscall.Syscall(
-							syscall.SYS_IOCTL,
-							ptmx.Fd(),
-							uintptr(TIOCSWINSZ),
-							uintptr(unsafe.Pointer(ws)),
-						)
-						log.Printf("Resized terminal to %dx%d", cols, rows)
-						continue
-					}
-				}
-
-				// Otherwise, treat as normal input
-				if _, err := ptmx.Write(msg); err != nil {
-					log.Println("PTY write error:", err)
-					break
-				}
+			// Debug input content
+			if len(msg) > 0 {
+				log.Printf("Received input from %s: %d bytes", client.ID, len(msg))
 			}
-		}()
-
-		// We'll handle the resize in the main WebSocket input loop to avoid conflicts
 
-		// Wait for PTY session to end
-		<-done
-
-		// Send terminal closed message
-		ws.WriteMessage(websocket.TextMessage, []byte("\r\n\x1b[33m[ Terminal session ended ]\x1b[0m\r\n"))
+			hub.HandleMessage(client, msgType, msg)
+		}
 	})
 
-	// Open browser automatically
-	go func() {
-		url := "http://localhost:8080"
-		log.Println("Opening browser at:", url)
-		if err := browser.OpenURL(url); err != nil {
-			log.Println("Failed to open browser:", err)
-		}
-	}()
+	// Open browser automatically, unless we're running as a managed session
+	if os.Getenv("WBFY_NO_BROWSER") == "" {
+		go func() {
+			url := "http://localhost:" + port
+			log.Println("Opening browser at:", url)
+			if err := browser.OpenURL(url); err != nil {
+				log.Println("Failed to open browser:", err)
+			}
+		}()
+	}
 
 	// Start HTTP server
-	fmt.Println("Serving at http://localhost:8080")
-	log.Fatal(http.ListenAndServe(":8080", nil))
+	fmt.Println("Serving at http://localhost:" + port)
+	log.Fatal(http.ListenAndServe(":"+port, nil))
 }
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestClientSecret(t *testing.T) {
+	tests := []struct {
+		name       string
+		file       string // content of the secret file, if there is one
+		relative   bool   // whether WBFY_SECRET_FILE is relative to WBFY_WORKDIR
+		dev        bool
+		want       string
+		wantErr    bool
+		wantRemove bool
+	}{
+		{name: "absolute path", file: "s3cret\n", want: "s3cret", wantRemove: true},
+		{name: "path relative to the workdir", file: "s3cret", relative: true, want: "s3cret", wantRemove: true},
+		{name: "empty file", file: " \n", wantErr: true},
+		{name: "no secret", wantErr: true},
+		{name: "no secret in dev mode", dev: true, want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, ".wbfy-secret")
+			t.Setenv("WBFY_WORKDIR", dir)
+			t.Setenv("WBFY_SECRET_FILE", "")
+			t.Setenv("WBFY_DEV", "")
+			if tt.dev {
+				t.Setenv("WBFY_DEV", "1")
+			}
+			if tt.file != "" {
+				if err := os.WriteFile(path, []byte(tt.file), 0600); err != nil {
+					t.Fatal(err)
+				}
+				if tt.relative {
+					t.Setenv("WBFY_SECRET_FILE", ".wbfy-secret")
+				} else {
+					t.Setenv("WBFY_SECRET_FILE", path)
+				}
+			}
+
+			secret, err := clientSecret()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("clientSecret() error = %v, want error %v", err, tt.wantErr)
+			}
+			if secret != tt.want {
+				t.Errorf("clientSecret() = %q, want %q", secret, tt.want)
+			}
+			if _, err := os.Stat(path); tt.wantRemove && err == nil {
+				t.Error("the secret file was left for the command to read")
+			}
+		})
+	}
+}
+
+func TestValidToken(t *testing.T) {
+	const secret = "s3cret"
+
+	tests := []struct {
+		name   string
+		secret string
+		role   Role
+		token  string
+		want   bool
+	}{
+		{name: "owner token", secret: secret, role: RoleOwner, token: signClient(secret, "owner", "ada"), want: true},
+		{name: "observer token", secret: secret, role: RoleObserver, token: signClient(secret, "observer", "ada"), want: true},
+		{name: "observer token used as owner", secret: secret, role: RoleOwner, token: signClient(secret, "observer", "ada")},
+		{name: "token for another name", secret: secret, role: RoleOwner, token: signClient(secret, "owner", "bob")},
+		{name: "token signed with another secret", secret: secret, role: RoleOwner, token: signClient("other", "owner", "ada")},
+		{name: "no token", secret: secret, role: RoleOwner},
+		{name: "dev mode", role: RoleOwner, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := validToken(tt.secret, tt.role, "ada", tt.token); got != tt.want {
+				t.Errorf("validToken() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckOrigin(t *testing.T) {
+	tests := []struct {
+		name   string
+		origin string
+		want   bool
+	}{
+		{name: "no origin", want: true},
+		{name: "same host", origin: "http://10.0.0.5:8081", want: true},
+		{name: "other site", origin: "https://evil.example.com"},
+		{name: "same host on another port", origin: "http://10.0.0.5:9999"},
+		{name: "malformed origin", origin: "http://%zz"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "http://10.0.0.5:8081/ws", nil)
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+			if got := checkOrigin(r); got != tt.want {
+				t.Errorf("checkOrigin(%q) = %v, want %v", tt.origin, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRole(t *testing.T) {
+	tests := []struct {
+		in     string
+		want   Role
+		wantOK bool
+	}{
+		{in: "", want: RoleOwner, wantOK: true},
+		{in: "owner", want: RoleOwner, wantOK: true},
+		{in: "observer", want: RoleObserver, wantOK: true},
+		{in: "mentor", want: RoleMentor, wantOK: true},
+		{in: "admin"},
+	}
+
+	for _, tt := range tests {
+		if got, ok := parseRole(tt.in); got != tt.want || ok != tt.wantOK {
+			t.Errorf("parseRole(%q) = %q, %v; want %q, %v", tt.in, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
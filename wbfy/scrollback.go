@@ -0,0 +1,65 @@
+package main
+
+// chunk is one PTY read, numbered in the order it was produced
+type chunk struct {
+	seq  uint64
+	data []byte
+}
+
+// Scrollback is a bounded ring of recent PTY output used to replay what a
+// client missed while it was disconnected. Sequence numbers count chunks, so a
+// client only has to count the output messages it receives to know where it is.
+type Scrollback struct {
+	limit  int // maximum number of bytes retained
+	size   int
+	chunks []chunk
+	seq    uint64 // sequence number of the newest chunk
+}
+
+// NewScrollback creates a scrollback buffer holding up to limit bytes
+func NewScrollback(limit int) *Scrollback {
+	return &Scrollback{limit: limit}
+}
+
+// Append stores a chunk of output and returns its sequence number
+func (s *Scrollback) Append(data []byte) uint64 {
+	s.seq++
+	s.chunks = append(s.chunks, chunk{seq: s.seq, data: data})
+	s.size += len(data)
+
+	// Drop the oldest chunks once we're over the limit, but always keep the newest
+	drop := 0
+	for s.size > s.limit && drop < len(s.chunks)-1 {
+		s.size -= len(s.chunks[drop].data)
+		drop++
+	}
+	if drop > 0 {
+		s.chunks = append(s.chunks[:0:0], s.chunks[drop:]...)
+	}
+
+	return s.seq
+}
+
+// Seq returns the sequence number of the newest chunk
+func (s *Scrollback) Seq() uint64 {
+	return s.seq
+}
+
+// Since returns all retained output newer than seq, concatenated, and whether
+// some of the requested output has already been discarded. A seq of 0 asks for
+// everything retained, which is never reported as truncated.
+func (s *Scrollback) Since(seq uint64) ([]byte, bool) {
+	if len(s.chunks) == 0 || seq >= s.seq {
+		return nil, false
+	}
+
+	truncated := seq > 0 && seq+1 < s.chunks[0].seq
+
+	var out []byte
+	for _, c := range s.chunks {
+		if c.seq > seq {
+			out = append(out, c.data...)
+		}
+	}
+	return out, truncated
+}
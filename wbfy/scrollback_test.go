@@ -0,0 +1,114 @@
+package main
+
+import "testing"
+
+func TestScrollbackSince(t *testing.T) {
+	tests := []struct {
+		name          string
+		limit         int
+		chunks        []string
+		since         uint64
+		want          string
+		wantTruncated bool
+	}{
+		{
+			name:  "empty buffer",
+			limit: 16,
+			since: 0,
+			want:  "",
+		},
+		{
+			name:   "everything on first connect",
+			limit:  16,
+			chunks: []string{"ab", "cd", "ef"},
+			since:  0,
+			want:   "abcdef",
+		},
+		{
+			name:   "resume after a chunk",
+			limit:  16,
+			chunks: []string{"ab", "cd", "ef"},
+			since:  1,
+			want:   "cdef",
+		},
+		{
+			name:   "up to date",
+			limit:  16,
+			chunks: []string{"ab", "cd"},
+			since:  2,
+			want:   "",
+		},
+		{
+			name:   "ahead of the buffer",
+			limit:  16,
+			chunks: []string{"ab"},
+			since:  5,
+			want:   "",
+		},
+		{
+			name:   "first connect after wraparound is not truncated",
+			limit:  4,
+			chunks: []string{"ab", "cd", "ef"},
+			since:  0,
+			want:   "cdef",
+		},
+		{
+			name:          "resume from discarded output is truncated",
+			limit:         4,
+			chunks:        []string{"ab", "cd", "ef", "gh"},
+			since:         1,
+			want:          "efgh",
+			wantTruncated: true,
+		},
+		{
+			name:   "resume right before the oldest retained chunk",
+			limit:  4,
+			chunks: []string{"ab", "cd", "ef", "gh"},
+			since:  2,
+			want:   "efgh",
+		},
+		{
+			name:   "oversized chunk is kept",
+			limit:  4,
+			chunks: []string{"ab", "0123456789"},
+			since:  0,
+			want:   "0123456789",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewScrollback(tt.limit)
+			for _, c := range tt.chunks {
+				s.Append([]byte(c))
+			}
+
+			got, truncated := s.Since(tt.since)
+			if string(got) != tt.want {
+				t.Errorf("Since(%d) = %q, want %q", tt.since, got, tt.want)
+			}
+			if truncated != tt.wantTruncated {
+				t.Errorf("Since(%d) truncated = %v, want %v", tt.since, truncated, tt.wantTruncated)
+			}
+		})
+	}
+}
+
+func TestScrollbackSequence(t *testing.T) {
+	s := NewScrollback(3)
+	for i, c := range []string{"a", "b", "c", "d", "e"} {
+		if seq := s.Append([]byte(c)); seq != uint64(i+1) {
+			t.Fatalf("Append #%d returned seq %d", i+1, seq)
+		}
+	}
+
+	if s.Seq() != 5 {
+		t.Errorf("Seq() = %d, want 5", s.Seq())
+	}
+	if s.size != 3 || len(s.chunks) != 3 {
+		t.Errorf("retained %d chunks of %d bytes, want 3 of 3", len(s.chunks), s.size)
+	}
+	if s.chunks[0].seq != 3 {
+		t.Errorf("oldest retained seq = %d, want 3", s.chunks[0].seq)
+	}
+}